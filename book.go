@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/apd"
+)
+
+// decimalPrecision is the number of significant digits kept by order book analytics.
+const decimalPrecision = 34
+
+// L2Book is an order book aggregated by price levels.
+type L2Book struct {
+	// Bids are sorted by descending price.
+	Bids []BookLevel
+	// Asks are sorted by ascending price.
+	Asks []BookLevel
+}
+
+// SortLevels sorts snapshot levels the way repositories return them: bids by descending price, then asks
+// by ascending price. The levels are sorted in place and returned.
+func SortLevels(levels []BookLevel) []BookLevel {
+	sort.SliceStable(levels, func(i, j int) bool {
+		a, b := levels[i], levels[j]
+		if a.Side != b.Side {
+			return a.Side == SideBid
+		}
+		if a.Side == SideBid {
+			return a.Price.Cmp(b.Price) > 0
+		}
+
+		return a.Price.Cmp(b.Price) < 0
+	})
+
+	return levels
+}
+
+// BestBid returns the highest bid level.
+func (b L2Book) BestBid() (BookLevel, bool) {
+	if len(b.Bids) == 0 {
+		return BookLevel{}, false
+	}
+
+	return b.Bids[0], true
+}
+
+// BestAsk returns the lowest ask level.
+func (b L2Book) BestAsk() (BookLevel, bool) {
+	if len(b.Asks) == 0 {
+		return BookLevel{}, false
+	}
+
+	return b.Asks[0], true
+}
+
+// Spread returns the difference between the best ask and the best bid prices.
+func (b L2Book) Spread() (*apd.Decimal, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return nil, false
+	}
+
+	spread := new(apd.Decimal)
+	decimalContext().Sub(spread, ask.Price, bid.Price)
+
+	return spread, true
+}
+
+// Mid returns the price in the middle between the best bid and the best ask.
+func (b L2Book) Mid() (*apd.Decimal, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return nil, false
+	}
+
+	ctx := decimalContext()
+	mid := new(apd.Decimal)
+	ctx.Add(mid, ask.Price, bid.Price)
+	ctx.Quo(mid, mid, apd.New(2, 0))
+
+	return mid, true
+}
+
+// Depth returns total bid and ask quantities within percent (e.g. 1 for 1%) of the mid price.
+func (b L2Book) Depth(percent float64) (bids, asks *apd.Decimal, ok bool) {
+	mid, ok := b.Mid()
+	if !ok {
+		return nil, nil, false
+	}
+
+	ctx := decimalContext()
+	band, _ := new(apd.Decimal).SetFloat64(percent)
+	ctx.Quo(band, band, apd.New(100, 0))
+	ctx.Mul(band, band, mid)
+
+	low, high := new(apd.Decimal), new(apd.Decimal)
+	ctx.Sub(low, mid, band)
+	ctx.Add(high, mid, band)
+
+	bids, asks = new(apd.Decimal), new(apd.Decimal)
+	for _, l := range b.Bids {
+		if l.Price.Cmp(low) < 0 {
+			break
+		}
+		ctx.Add(bids, bids, l.Quantity)
+	}
+	for _, l := range b.Asks {
+		if l.Price.Cmp(high) > 0 {
+			break
+		}
+		ctx.Add(asks, asks, l.Quantity)
+	}
+
+	return bids, asks, true
+}
+
+// Imbalance returns (bids - asks) / (bids + asks) of quantities within percent of the mid price.
+// It ranges from -1 (only asks) to 1 (only bids).
+func (b L2Book) Imbalance(percent float64) (*apd.Decimal, bool) {
+	bids, asks, ok := b.Depth(percent)
+	if !ok {
+		return nil, false
+	}
+
+	ctx := decimalContext()
+	total, imbalance := new(apd.Decimal), new(apd.Decimal)
+	ctx.Add(total, bids, asks)
+	if total.IsZero() {
+		return nil, false
+	}
+	ctx.Sub(imbalance, bids, asks)
+	ctx.Quo(imbalance, imbalance, total)
+
+	return imbalance, true
+}
+
+// Slippage estimates how far (in basis points) the average fill price of a market order
+// for the notional (in quote currency) deviates from the mid price.
+// Buy (SideBid) orders walk the asks and sell (SideAsk) orders walk the bids.
+// It reports false when the book is one-sided or not deep enough to fill the notional.
+func (b L2Book) Slippage(side uint8, notional *apd.Decimal) (*apd.Decimal, bool) {
+	mid, ok := b.Mid()
+	if !ok || notional.Sign() <= 0 {
+		return nil, false
+	}
+
+	levels := b.Asks
+	if side == SideAsk {
+		levels = b.Bids
+	}
+
+	ctx := decimalContext()
+	remaining, filled := new(apd.Decimal).Set(notional), new(apd.Decimal)
+	levelNotional, take, qty := new(apd.Decimal), new(apd.Decimal), new(apd.Decimal)
+	for _, l := range levels {
+		ctx.Mul(levelNotional, l.Price, l.Quantity)
+		take.Set(levelNotional)
+		if remaining.Cmp(levelNotional) < 0 {
+			take.Set(remaining)
+		}
+		ctx.Quo(qty, take, l.Price)
+		ctx.Add(filled, filled, qty)
+		ctx.Sub(remaining, remaining, take)
+		if remaining.Sign() <= 0 {
+			break
+		}
+	}
+	if remaining.Sign() > 0 || filled.IsZero() {
+		return nil, false
+	}
+
+	slippage := new(apd.Decimal)
+	ctx.Quo(slippage, notional, filled) // average fill price
+	if side == SideAsk {
+		ctx.Sub(slippage, mid, slippage)
+	} else {
+		ctx.Sub(slippage, slippage, mid)
+	}
+	ctx.Quo(slippage, slippage, mid)
+	ctx.Mul(slippage, slippage, apd.New(10000, 0))
+
+	return slippage, true
+}
+
+func decimalContext() *apd.Context {
+	return apd.BaseContext.WithPrecision(decimalPrecision)
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+)
+
+func testBook(t *testing.T) L2Book {
+	t.Helper()
+
+	return L2Book{
+		Bids: []BookLevel{
+			testLevel(t, SideBid, "100", "2"),
+			testLevel(t, SideBid, "99", "3"),
+			testLevel(t, SideBid, "95", "10"),
+		},
+		Asks: []BookLevel{
+			testLevel(t, SideAsk, "101", "1"),
+			testLevel(t, SideAsk, "102", "4"),
+			testLevel(t, SideAsk, "110", "5"),
+		},
+	}
+}
+
+func TestL2BookSpreadMid(t *testing.T) {
+	book := testBook(t)
+
+	spread, ok := book.Spread()
+	if !ok || spread.Cmp(apd.New(1, 0)) != 0 {
+		t.Errorf("Spread() = %v, %v, want 1", spread, ok)
+	}
+	mid, ok := book.Mid()
+	if !ok || mid.Cmp(apd.New(1005, -1)) != 0 {
+		t.Errorf("Mid() = %v, %v, want 100.5", mid, ok)
+	}
+
+	oneSided := L2Book{Bids: book.Bids}
+	if _, ok = oneSided.Spread(); ok {
+		t.Error("Spread() of one-sided book is ok, want false")
+	}
+	if _, ok = oneSided.Mid(); ok {
+		t.Error("Mid() of one-sided book is ok, want false")
+	}
+}
+
+func TestL2BookDepthImbalance(t *testing.T) {
+	tests := []struct {
+		percent   float64
+		bids      string
+		asks      string
+		imbalance float64
+	}{
+		{0.1, "0", "0", math.NaN()},
+		{1, "2", "1", 1.0 / 3},
+		{2, "5", "5", 0},
+		{10, "15", "10", 0.2},
+	}
+
+	book := testBook(t)
+	for _, tc := range tests {
+		bids, asks, ok := book.Depth(tc.percent)
+		if !ok || bids.Cmp(testDecimal(t, tc.bids)) != 0 || asks.Cmp(testDecimal(t, tc.asks)) != 0 {
+			t.Errorf("Depth(%v) = %v, %v, %v, want %s, %s", tc.percent, bids, asks, ok, tc.bids, tc.asks)
+		}
+
+		imbalance, ok := book.Imbalance(tc.percent)
+		if math.IsNaN(tc.imbalance) {
+			if ok {
+				t.Errorf("Imbalance(%v) = %v, want false without depth", tc.percent, imbalance)
+			}
+			continue
+		}
+		if !ok || !closeTo(imbalance, tc.imbalance) {
+			t.Errorf("Imbalance(%v) = %v, %v, want %v", tc.percent, imbalance, ok, tc.imbalance)
+		}
+	}
+
+	if _, _, ok := (L2Book{Asks: book.Asks}).Depth(1); ok {
+		t.Error("Depth() of one-sided book is ok, want false")
+	}
+}
+
+func TestL2BookSlippage(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     uint8
+		notional string
+		want     float64
+		ok       bool
+	}{
+		{"buy within best ask", SideBid, "101", (101 - 100.5) / 100.5 * 10000, true},
+		{"buy walks asks", SideBid, "509", (101.8 - 100.5) / 100.5 * 10000, true},
+		{"sell within best bid", SideAsk, "200", (100.5 - 100) / 100.5 * 10000, true},
+		{"sell walks bids", SideAsk, "497", (100.5 - 99.4) / 100.5 * 10000, true},
+		{"not deep enough", SideBid, "1000000", 0, false},
+		{"zero notional", SideBid, "0", 0, false},
+	}
+
+	book := testBook(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := book.Slippage(tc.side, testDecimal(t, tc.notional))
+			if ok != tc.ok {
+				t.Fatalf("Slippage() = %v, %v, want ok %v", got, ok, tc.ok)
+			}
+			if ok && !closeTo(got, tc.want) {
+				t.Errorf("Slippage() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func testLevel(t *testing.T, side uint8, price, quantity string) BookLevel {
+	t.Helper()
+
+	return BookLevel{Side: side, Price: testDecimal(t, price), Quantity: testDecimal(t, quantity), Orders: 1}
+}
+
+func testDecimal(t *testing.T, s string) *apd.Decimal {
+	t.Helper()
+
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		t.Fatalf("apd.NewFromString(%q) error = %v", s, err)
+	}
+
+	return d
+}
+
+func closeTo(d *apd.Decimal, want float64) bool {
+	f, err := d.Float64()
+	return err == nil && math.Abs(f-want) < 1e-9
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Candle summarizes trades of the currency pair made within the interval starting at Start.
+type Candle struct {
+	CurrencyPair string
+	Start        time.Time
+	Interval     time.Duration
+	Open         *apd.Decimal
+	High         *apd.Decimal
+	Low          *apd.Decimal
+	Close        *apd.Decimal
+	// Volume is traded base currency quantity.
+	Volume *apd.Decimal
+	// Notional is traded quote currency amount.
+	Notional *apd.Decimal
+	// NotionalUSD is Notional converted into USD at trade times, it's nil when a trade can't be converted.
+	NotionalUSD *apd.Decimal
+	Trades      int
+}
+
+// Candles aggregates trades ordered by time into candles of the interval. Candles start at multiples
+// of the interval in UTC as time.Truncate does, e.g. hourly candles start at full hours and daily candles
+// at midnight. Intervals without trades have no candles. Notional is converted into USD by USD-PHP rates,
+// candles have no USD notional when rates are nil.
+func Candles(trades []Trade, interval time.Duration, usd FXRates) []Candle {
+	if interval <= 0 {
+		return nil
+	}
+
+	ctx := decimalContext()
+	var candles []Candle
+	for _, t := range trades {
+		start := t.Timestamp.UTC().Truncate(interval)
+
+		n := len(candles)
+		if n == 0 || !candles[n-1].Start.Equal(start) || candles[n-1].CurrencyPair != t.CurrencyPair {
+			candles = append(candles, Candle{
+				CurrencyPair: t.CurrencyPair,
+				Start:        start,
+				Interval:     interval,
+				Open:         t.Price,
+				High:         t.Price,
+				Low:          t.Price,
+				Volume:       new(apd.Decimal),
+				Notional:     new(apd.Decimal),
+			})
+			if usd != nil {
+				candles[n].NotionalUSD = new(apd.Decimal)
+			}
+			n++
+		}
+
+		c := &candles[n-1]
+		if t.Price.Cmp(c.High) > 0 {
+			c.High = t.Price
+		}
+		if t.Price.Cmp(c.Low) < 0 {
+			c.Low = t.Price
+		}
+		c.Close = t.Price
+		ctx.Add(c.Volume, c.Volume, t.Quantity)
+		var amount apd.Decimal
+		ctx.Mul(&amount, t.Price, t.Quantity)
+		ctx.Add(c.Notional, c.Notional, &amount)
+		if c.NotionalUSD != nil {
+			if v, ok := usd.NotionalUSD(t); ok {
+				ctx.Add(c.NotionalUSD, c.NotionalUSD, v)
+			} else {
+				c.NotionalUSD = nil
+			}
+		}
+		c.Trades++
+	}
+
+	return candles
+}
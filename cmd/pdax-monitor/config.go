@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/peterbourgon/ff"
+	"github.com/peterbourgon/ff/ffyaml"
+	"github.com/prometheus/client_golang/prometheus"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/auth"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
+	"github.com/pudgydoge/pdax-monitor/internal/storage"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+)
+
+const (
+	envVarPrefix    = "PDAX_MONITOR"
+	secretKeyEnvVar = "PDAX_MONITOR_SECRET_KEY"
+
+	defaultPDAXAuthURL         = "https://trade.pdax.ph/moon/v1/login"
+	defaultPDAXSignInURL       = "https://trade.pdax.ph/signin"
+	defaultPDAXAuthRefreshURL  = "https://trade.pdax.ph/moon/v1/refreshToken"
+	defaultPDAXTradeURL        = "wss://trade.pdax.ph/tradeui/ws/master"
+	defaultCaptchaRecaptchaKey = "6Lcj_WQUAAAAAH7U8sEordiEHPEJDdVzoKQiH7Oa"
+	defaultSolverServiceKey    = "captcha-solver-key"
+	defaultPGConnString        = "user=postgres password=postgres host=127.0.0.1 port=5432 dbname=pdax_test connect_timeout=3 sslmode=disable"
+)
+
+// errFailed is returned by commands which already reported the failure, so it's not printed again.
+var errFailed = errors.New("command failed")
+
+// command is flag set of a subcommand with secret flags, every command reads the shared config file.
+type command struct {
+	fs      *flag.FlagSet
+	secrets *secret.Flags
+}
+
+func newCommand(name string, secretKey []byte) command {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.String("config", "", "YAML config file shared by all commands (optional)")
+
+	// Secrets are set by flags, config file (optionally encrypted with "enc:" prefix), env vars
+	// or files named by *_FILE env vars; they are redacted whenever printed.
+	return command{fs: fs, secrets: secret.NewFlags(fs, secretKey)}
+}
+
+// options returns ff options shared by all commands. Config file keys of other commands are ignored,
+// so one file configures every command.
+func (c command) options() []ff.Option {
+	return []ff.Option{
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(ffyaml.Parser),
+		ff.WithEnvVarPrefix(envVarPrefix),
+		ff.WithEnvVarIgnoreCommas(true),
+		ff.WithIgnoreUndefined(true),
+	}
+}
+
+// loadSecretFiles must be called once flags are parsed.
+func (c command) loadSecretFiles() error {
+	if err := c.secrets.LoadFiles(envVarPrefix); err != nil {
+		return fmt.Errorf("loading secret files failed: %v", err)
+	}
+
+	return nil
+}
+
+// pdaxConfig is PDAX connection and sign-in config shared by commands talking to PDAX.
+type pdaxConfig struct {
+	currencyCodesPath    *string
+	wsInitBookPath       *string
+	authURL              *string
+	authRefreshURL       *string
+	tradeURL             *string
+	username             *string
+	password             *secret.Value
+	accountsFile         *string
+	accountCoolDown      *time.Duration
+	profilesFile         *string
+	devicesFile          *string
+	captchaSolverKey     *secret.Value
+	captchaTaskURL       *string
+	captchaTask          *string
+	captchaDailyBudget   *int
+	captchaMonthlyBudget *int
+	captchaBudgetFile    *string
+}
+
+func (c command) pdaxFlags() *pdaxConfig {
+	fs := c.fs
+	return &pdaxConfig{
+		wsInitBookPath:    fs.String("wsInitBook", "./auxiliary/wsbook.json", "Path to the PDAX websocket connection bootstrap book"),
+		currencyCodesPath: fs.String("currencyCodes", "./auxiliary/currencyCodes.json", "Path to the PDAX currency codes file"),
+		authURL: fs.String("pdax.auth-url", defaultPDAXAuthURL,
+			"PDAX backend URL to which page refers after filling user,pass and solved gcaptcha"),
+		authRefreshURL: fs.String("pdax.auth-refresh-url", defaultPDAXAuthRefreshURL, "PDAX backend URL to query for JWT token"),
+		tradeURL:       fs.String("pdax.trade-url", defaultPDAXTradeURL, "PDAX trading page main websocket"),
+		username:       fs.String("pdax.username", "", "PDAX username"),
+		password:       c.secrets.String("pdax.password", "", "PDAX password"),
+		accountsFile: fs.String("pdax.accounts-file", "",
+			"JSON or YAML file with PDAX accounts to rotate, PDAX_ACCOUNTS env var (user:pass,...) is used otherwise"),
+		accountCoolDown:  fs.Duration("pdax.account-cool-down", time.Hour, "Cool-down of PDAX account after failed login"),
+		profilesFile:     fs.String("pdax.profiles-file", "", "JSON or YAML file with login profiles (user agent, headers, device)"),
+		devicesFile:      fs.String("pdax.devices-file", "", "JSON file to persist device fingerprints assigned to accounts"),
+		captchaSolverKey: c.secrets.String("captcha.solver-key", defaultSolverServiceKey, "Recaptcha solver access key"),
+		captchaTaskURL: fs.String("captcha.task-url", defaultPDAXSignInURL,
+			"PDAX page URL with login form and captcha. Used by captcha solver"),
+		captchaTask:          fs.String("captcha.task", defaultCaptchaRecaptchaKey, "Recaptcha key generated by PDAX itself"),
+		captchaDailyBudget:   fs.Int("captcha.daily-budget", 0, "Max captcha solves per UTC day (0 is unlimited)"),
+		captchaMonthlyBudget: fs.Int("captcha.monthly-budget", 0, "Max captcha solves per UTC month (0 is unlimited)"),
+		captchaBudgetFile: fs.String("captcha.budget-file", "",
+			"JSON file to persist captcha solves counted against budgets, so restarts don't reset them"),
+	}
+}
+
+func (c command) pgFlags() *secret.Value {
+	return c.secrets.String("pg.conn-string", defaultPGConnString, "Postgres connection string")
+}
+
+// storageConfig selects the storage backend shared by commands reading or writing trades.
+type storageConfig struct {
+	driver   *string
+	dsn      *string
+	pgString *secret.Value
+}
+
+func (c command) storageFlags() *storageConfig {
+	fs := c.fs
+	return &storageConfig{
+		driver: fs.String("storage.driver", storage.DriverPostgres,
+			"Storage of trades and order books: "+strings.Join(storage.Drivers(), ", ")),
+		dsn: fs.String("storage.dsn", "./data",
+			"SQLite database file or NDJSON files directory, Postgres is configured by pg.conn-string"),
+		pgString: c.pgFlags(),
+	}
+}
+
+// open opens the storage of the configured driver.
+func (c *storageConfig) open(logger log.Logger) (monitor.Storage, error) {
+	dsn := *c.dsn
+	if *c.driver == storage.DriverPostgres {
+		dsn = c.pgString.Reveal()
+	}
+
+	return storage.Open(*c.driver, dsn, logger)
+}
+
+// loadData reads PDAX currency codes and websocket bootstrap book.
+func (c *pdaxConfig) loadData() (map[int]string, websocket.InitBook, error) {
+	wsInitBook, err := websocket.LoadInitBook(*c.wsInitBookPath)
+	if err != nil {
+		return nil, wsInitBook, fmt.Errorf("parsing wsInitBook failed: %v", err)
+	}
+
+	currencyCodes, err := trade.LoadCurrencyCodes(*c.currencyCodesPath)
+	if err != nil {
+		return nil, wsInitBook, fmt.Errorf("parsing currencyCodes failed: %v", err)
+	}
+
+	return currencyCodes, wsInitBook, nil
+}
+
+// pdaxAuth is PDAX auth service with its account pool and captcha solver.
+type pdaxAuth struct {
+	service  auth.PDAXAuthService
+	accounts *auth.AccountPool
+	solver   auth.CaptchaSolver
+}
+
+// newAuth builds PDAX auth service rotating configured accounts,
+// captcha solves are not measured when metrics registerer is nil.
+func (c *pdaxConfig) newAuth(logger log.Logger, registerer prometheus.Registerer, solveCost float64) (*pdaxAuth, error) {
+	accounts, err := c.accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newAuthFor(accounts, logger, registerer, solveCost)
+}
+
+func (c *pdaxConfig) accounts() ([]auth.Account, error) {
+	accounts, err := loadAccounts(*c.accountsFile, *c.username, c.password.Reveal())
+	if err != nil {
+		return nil, fmt.Errorf("loading pdax accounts failed: %v", err)
+	}
+
+	return accounts, nil
+}
+
+// newAuthFor builds PDAX auth service rotating the accounts.
+func (c *pdaxConfig) newAuthFor(
+	accounts []auth.Account, logger log.Logger, registerer prometheus.Registerer, solveCost float64,
+) (*pdaxAuth, error) {
+	budget, err := auth.LoadCaptchaBudget(*c.captchaBudgetFile, *c.captchaDailyBudget, *c.captchaMonthlyBudget)
+	if err != nil {
+		return nil, fmt.Errorf("loading captcha budget failed: %v", err)
+	}
+	if *c.captchaBudgetFile == "" && (*c.captchaDailyBudget > 0 || *c.captchaMonthlyBudget > 0) {
+		level.Warn(logger).Log("msg", "captcha budget is counted in memory, restarts reset it, set captcha.budget-file")
+	}
+
+	solver := auth.CaptchaSolver{
+		SolverKey:   c.captchaSolverKey.Reveal(),
+		TaskKey:     *c.captchaTask,
+		TaskPageURL: *c.captchaTaskURL,
+		Logger:      logger,
+		Budget:      budget,
+	}
+	if registerer != nil {
+		solver.Metrics = auth.NewCaptchaMetrics(registerer, solveCost)
+	}
+
+	accountPool := auth.NewAccountPool(accounts, *c.accountCoolDown)
+	level.Info(logger).Log("msg", "pdax accounts loaded", "count", accountPool.Len())
+
+	var profiles []auth.Profile
+	if *c.profilesFile != "" {
+		if profiles, err = auth.LoadProfiles(*c.profilesFile); err != nil {
+			return nil, fmt.Errorf("loading login profiles failed: %v", err)
+		}
+	}
+
+	devices, err := auth.NewDeviceStore(*c.devicesFile, profiles)
+	if err != nil {
+		return nil, fmt.Errorf("loading device fingerprints failed: %v", err)
+	}
+
+	return &pdaxAuth{
+		service: auth.NewAuthService(
+			*c.authURL,
+			*c.authRefreshURL,
+			auth.WithCaptchaSolver(solver),
+			auth.WithLogger(logger),
+			auth.WithAccountPool(accountPool),
+			auth.WithDeviceStore(devices),
+		),
+		accounts: accountPool,
+		solver:   solver,
+	}, nil
+}
+
+// loadAccounts reads PDAX accounts from the file, PDAX_ACCOUNTS env var or single username and password flags.
+func loadAccounts(path, username, password string) ([]auth.Account, error) {
+	if path != "" {
+		return auth.LoadAccounts(path)
+	}
+
+	if env := os.Getenv("PDAX_ACCOUNTS"); env != "" {
+		return auth.ParseAccounts(env)
+	}
+
+	if username == "" {
+		return nil, fmt.Errorf("no PDAX accounts configured")
+	}
+
+	return []auth.Account{{Username: username, Password: password}}, nil
+}
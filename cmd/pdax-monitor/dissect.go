@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+// messageTypes names PDAX websocket message types which are known so far.
+func messageTypes() map[uint8]string {
+	return map[uint8]string{
+		35: "PageUpdateMessage",
+		36: "PageResetMessage",
+	}
+}
+
+func dissectCommand() *ffcli.Command {
+	fs := flag.NewFlagSet("dissect", flag.ExitOnError)
+	fs.String("config", "", "YAML config file shared by all commands (optional)")
+	currencyCodesPath := fs.String("currencyCodes", "./auxiliary/currencyCodes.json", "Path to the PDAX currency codes file")
+	isHex := fs.Bool("hex", false, "Messages given as arguments are hex encoded instead of base64")
+	recording := fs.String("recording", "", "Dissect messages of the file recorded by serve -ws.record-file")
+	frame := fs.Int("frame", 0, "Dissect only N-th message of the recording, counting from 1 (0 dissects all)")
+	dump := fs.Bool("dump", true, "Print hex dump of every message")
+
+	return &ffcli.Command{
+		Name:      "dissect",
+		Usage:     "pdax-monitor dissect [flags] [<message> ...]",
+		ShortHelp: "Decode PDAX binary websocket messages for protocol debugging",
+		LongHelp: "Messages are given as base64 (or hex with -hex) arguments or read from a recording. " +
+			"Headers of page messages are decoded, trade history pages are decoded in full.",
+		FlagSet: fs,
+		Options: (command{}).options(),
+		Exec: func(args []string) error {
+			currencyCodes, err := trade.LoadCurrencyCodes(*currencyCodesPath)
+			if err != nil {
+				return err
+			}
+			d := dissector{tradeReader: trade.Reader{Instruments: trade.NewInstruments(currencyCodes, nil, nil)}, dump: *dump}
+
+			for i, arg := range args {
+				var data []byte
+				if *isHex {
+					data, err = hex.DecodeString(strings.TrimSpace(arg))
+				} else {
+					data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(arg))
+				}
+				if err != nil {
+					return fmt.Errorf("invalid message %d: %v", i+1, err)
+				}
+				d.dissect(fmt.Sprintf("message %d", i+1), data)
+			}
+
+			if *recording == "" {
+				if len(args) == 0 {
+					return flag.ErrHelp
+				}
+				return nil
+			}
+
+			f, err := os.Open(*recording)
+			if err != nil {
+				return fmt.Errorf("failed to open recording: %v", err)
+			}
+			defer f.Close()
+
+			n := 0
+			return websocket.ReadFrames(f, func(fr websocket.Frame) error {
+				if n++; *frame == 0 || *frame == n {
+					d.dissect(fmt.Sprintf("frame %d at %s", n, fr.Time.Format("2006-01-02T15:04:05.000Z07:00")), fr.Data)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+type dissector struct {
+	tradeReader trade.Reader
+	dump        bool
+}
+
+func (d dissector) dissect(title string, data []byte) {
+	fmt.Printf("=== %s, %d bytes\n", title, len(data))
+	defer func() {
+		// frames are not fully reverse-engineered, reading past the end is reported rather than fatal
+		if rec := recover(); rec != nil {
+			fmt.Printf("decoding failed: %v\n", rec)
+		}
+		if d.dump {
+			fmt.Print(hex.Dump(data))
+		}
+	}()
+
+	if len(data) == 0 {
+		return
+	}
+
+	rc := binary.ReadCursor{
+		CurPos: 0,
+		Data:   data,
+	}
+	mtype := rc.ReadUint8()
+	name, ok := messageTypes()[mtype]
+	if !ok {
+		name = "unknown"
+	}
+	fmt.Printf("type: %d (%s)\n", mtype, name)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("message_id: %d\n", rc.ReadUint32())
+	fmt.Printf("seq_number: %d\n", rc.ReadUint16())
+	fmt.Printf("view_id: %.0f\n", rc.ReadFloat64())
+
+	if page, ok := parseTradePage(d.tradeReader, data); ok {
+		fmt.Printf("trade history page, %d trades\n", len(page))
+		for _, t := range page {
+			fmt.Printf("  id=%d pair=%s price=%s quantity=%s time=%s\n",
+				t.ID, t.CurrencyPair, t.Price.Text('f'), t.Quantity.Text('f'), t.Timestamp.Format("2006-01-02T15:04:05Z07:00"))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff/ffcli"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/fx"
+)
+
+const fxTimeout = 5 * time.Minute
+
+func fxCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("fx", secretKey)
+	store := c.storageFlags()
+	fromFlag := c.fs.String("from", "", "Derive rates from stored trades of proxy pairs since the UTC day YYYY-MM-DD")
+	toFlag := c.fs.String("to", "", "Derive rates till the UTC day YYYY-MM-DD exclusive, now by default")
+	interval := c.fs.Duration("interval", time.Hour, "Derive a rate per interval")
+	pairs := c.fs.String("pairs", fx.DefaultProxyPairs, "Comma separated USD stablecoin pairs whose prices proxy USD-PHP rate")
+
+	return &ffcli.Command{
+		Name:      "fx",
+		Usage:     "pdax-monitor fx [flags] [rates.csv]",
+		ShortHelp: "Store USD-PHP rates used to report USD notional",
+		LongHelp: "Rates are loaded from the CSV file (- reads stdin) with time and rate columns, time is RFC 3339 time " +
+			"or YYYY-MM-DD day. Without the file rates are derived from stored trades of USD stablecoin pairs " +
+			"within -from and -to as VWAP per interval. Serve command derives them from live trades when fx.proxy-interval is set.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				return errors.New("only one rates file is expected")
+			}
+			if len(args) == 0 && *fromFlag == "" {
+				return errors.New("rates file or -from is required")
+			}
+
+			var rates []monitor.FXRate
+			var err error
+			if len(args) == 1 {
+				if rates, err = readRates(args[0]); err != nil {
+					return err
+				}
+			}
+
+			s, err := store.open(log.NewNopLogger())
+			if err != nil {
+				return fmt.Errorf("db connection failed: %v", err)
+			}
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), fxTimeout)
+			defer cancel()
+
+			if len(args) == 0 {
+				from, err := time.Parse("2006-01-02", *fromFlag)
+				if err != nil {
+					return fmt.Errorf("invalid from: %v", err)
+				}
+				to := time.Now()
+				if *toFlag != "" {
+					if to, err = time.Parse("2006-01-02", *toFlag); err != nil {
+						return fmt.Errorf("invalid to: %v", err)
+					}
+				}
+
+				var trades []monitor.Trade
+				for _, pair := range splitList(*pairs) {
+					pairTrades, err := s.TradeRepository().Trades(ctx, monitor.TradeQuery{CurrencyPair: pair, From: from, To: to})
+					if err != nil {
+						return fmt.Errorf("failed to read %s trades: %v", pair, err)
+					}
+					trades = append(trades, pairTrades...)
+				}
+				rates = fx.ProxyRates(trades, *interval)
+			}
+
+			if err = s.FXRateRepository().Upsert(ctx, rates); err != nil {
+				return fmt.Errorf("failed to store fx rates: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "stored %d fx rates\n", len(rates))
+
+			return nil
+		},
+	}
+}
+
+func readRates(path string) ([]monitor.FXRate, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	rates, err := fx.ReadCSV(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rates file: %v", err)
+	}
+
+	return rates, nil
+}
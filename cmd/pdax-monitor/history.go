@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones are resolved even where the system database is missing
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff/ffcli"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/auth"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+const (
+	pdaxTradeHistoryFile = "volume-pdax-history.csv"
+	dateLayout           = "2006-01-02"
+	stateFileSuffix      = ".state"
+	modeExport           = "export"
+	modeImport           = "import"
+)
+
+// historyCmd exports PDAX trade history to a file or imports it into the configured storage.
+type historyCmd struct {
+	command
+	pdax          *pdaxConfig
+	storage       *storageConfig
+	durationHours *int
+	from          *string
+	to            *string
+	pairs         *string
+	format        *string
+	output        *string
+	timezone      *string
+	pageSize      *uint
+	resume        *bool
+	mode          *string
+	input         *string
+	dryRun        *bool
+}
+
+func historyCommand(secretKey []byte) *ffcli.Command {
+	c := historyCmd{command: newCommand("history", secretKey)}
+	fs := c.fs
+	c.pdax = c.pdaxFlags()
+	c.storage = c.storageFlags()
+	c.durationHours = fs.Int("duration", 24, "Fetch trades for the last duration hours before now, used when -from is not set")
+	c.from = fs.String("from", "", "Fetch trades since the date (2006-01-02) or time (RFC3339)")
+	c.to = fs.String("to", "", "Fetch trades till the date (2006-01-02, exclusive) or time (RFC3339), defaults to now")
+	c.pairs = fs.String("pairs", "", "Comma separated currency pairs to export, e.g. BTC-PHP,ETH-PHP (all pairs when empty)")
+	c.format = fs.String("format", formatCSV, "Output format: csv, jsonl or parquet")
+	c.output = fs.String("output", pdaxTradeHistoryFile, "Output file path")
+	c.timezone = fs.String("tz", "Europe/Moscow", "Timezone of human readable trade time, e.g. UTC or Asia/Manila")
+	c.pageSize = fs.Uint("page-size", 1000, "Number of trades requested per page (at most 65535)")
+	c.resume = fs.Bool("resume", false, "Continue the interrupted export of the output file from where it stopped")
+	c.mode = fs.String("mode", modeExport, "export writes trades to the output file, import upserts them into trades of storage.driver")
+	c.input = fs.String("input", "", "Import trades from the file in -format instead of fetching them from PDAX")
+	c.dryRun = fs.Bool("dry-run", false, "Report trades which would be imported without writing them")
+
+	return &ffcli.Command{
+		Name:      "history",
+		Usage:     "pdax-monitor history [flags]",
+		ShortHelp: "Export PDAX trade history to CSV, JSON Lines or Parquet file, or import it into the storage",
+		LongHelp: "Trades are paged backwards from the newest one till -from. Progress is saved next to the output file, " +
+			"so an interrupted export continues with -resume. Import mode upserts trades fetched from PDAX or read " +
+			"from -input file into the storage selected by -storage.driver, trades already stored are counted as duplicates.",
+		FlagSet: fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			return c.run()
+		},
+	}
+}
+
+func (c *historyCmd) run() error {
+	if err := c.loadSecretFiles(); err != nil {
+		return err
+	}
+
+	if *c.mode != modeExport && *c.mode != modeImport {
+		return fmt.Errorf("-mode must be export or import")
+	}
+	if *c.input != "" && *c.mode != modeImport {
+		return fmt.Errorf("-input requires -mode import")
+	}
+
+	var err error
+	now := time.Now()
+	from, to := now.Add(time.Duration(-*c.durationHours)*time.Hour), now
+	if *c.input != "" {
+		// files are imported whole unless the range is set explicitly
+		from, to = time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if *c.from != "" {
+		if from, err = parseTime(*c.from); err != nil {
+			return fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+	if *c.to != "" {
+		if to, err = parseTime(*c.to); err != nil {
+			return fmt.Errorf("invalid -to: %v", err)
+		}
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("-from must be before -to")
+	}
+
+	location, err := time.LoadLocation(*c.timezone)
+	if err != nil {
+		return fmt.Errorf("invalid -tz: %v", err)
+	}
+	if *c.pageSize == 0 || *c.pageSize > 65535 {
+		return fmt.Errorf("-page-size must be between 1 and 65535")
+	}
+
+	currencyCodes, wsInitBook, err := c.pdax.loadData()
+	if err != nil {
+		return err
+	}
+
+	resume := *c.resume
+	st := state{From: from, To: to, SinceID: -1}
+	if resume {
+		resumed, ok, err := loadState(*c.output + stateFileSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to read export state: %v", err)
+		}
+		if ok {
+			st = resumed
+			fmt.Printf("Resuming export from trade %.0f, %d trades written so far\n", st.SinceID, st.Written)
+		} else {
+			// nothing to resume, start the export from scratch
+			resume = false
+		}
+	}
+
+	var out tradeWriter
+	var importer *importWriter
+	if *c.mode == modeImport {
+		store, err := c.storage.open(log.NewNopLogger())
+		if err != nil {
+			return fmt.Errorf("failed to open %s storage: %v", *c.storage.driver, err)
+		}
+		defer store.Close()
+
+		importer = &importWriter{repo: store.TradeRepository(), dryRun: *c.dryRun}
+		out = importer
+	} else {
+		if out, err = newTradeWriter(*c.format, *c.output, location, resume); err != nil {
+			return err
+		}
+	}
+
+	e := exporter{
+		tradeReader: trade.Reader{Instruments: trade.NewInstruments(currencyCodes, nil, nil)},
+		tradeURL:    *c.pdax.tradeURL,
+		pairs:       parsePairs(*c.pairs),
+		pageSize:    uint16(*c.pageSize),
+		out:         out,
+		statePath:   *c.output + stateFileSuffix,
+		state:       st,
+	}
+	if *c.input != "" {
+		var trades []monitor.Trade
+		if trades, err = readTrades(*c.format, *c.input); err == nil {
+			err = e.importFile(trades)
+		}
+	} else {
+		var pdaxAuth *pdaxAuth
+		if pdaxAuth, err = c.pdax.newAuth(log.NewNopLogger(), nil, 0); err == nil {
+			err = e.export(pdaxAuth.service, wsInitBook)
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// file imports are simply rerun, trades imported already are duplicates
+		if *c.input == "" && (*c.format != formatParquet || importer != nil) {
+			fmt.Println("Run again with -resume to continue")
+		}
+		return fmt.Errorf("failed to get trades: %v", err)
+	}
+
+	if err = os.Remove(e.statePath); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Failed to remove export state: %v\n", err)
+	}
+	if importer != nil {
+		if *c.dryRun {
+			fmt.Print("Dry run, nothing is written. ")
+		}
+		fmt.Printf("Finished importing trade history, %d trades read: %d inserted, %d duplicates\n",
+			e.state.Written, importer.summary.Inserted, importer.summary.Duplicates)
+		return nil
+	}
+	fmt.Printf("Finished fetching trade history, %d trades written to %s\n", e.state.Written, *c.output)
+
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func parsePairs(s string) map[string]bool {
+	pairs := make(map[string]bool)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.ToUpper(strings.TrimSpace(p)); p != "" {
+			pairs[p] = true
+		}
+	}
+
+	return pairs
+}
+
+// state is progress of the export saved after every page, so an interrupted export can be resumed.
+type state struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	SinceID float64   `json:"sinceID"`
+	Written int       `json:"written"`
+}
+
+func loadState(path string) (state, bool, error) {
+	var st state
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, false, nil
+	}
+	if err != nil {
+		return st, false, err
+	}
+
+	return st, true, json.Unmarshal(data, &st)
+}
+
+func (st state) save(path string) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
+
+// exporter pages trade history backwards from the newest trade till the state's From time.
+type exporter struct {
+	tradeReader trade.Reader
+	tradeURL    string
+	pairs       map[string]bool
+	pageSize    uint16
+	out         tradeWriter
+	statePath   string
+	state       state
+}
+
+func (e *exporter) export(authService auth.PDAXAuthService, wsInitBook websocket.InitBook) error {
+	authToken, err := authService.Login()
+	if err != nil {
+		return fmt.Errorf("failed to get auth token: %v", err)
+	}
+	fmt.Println("Successfully signed in to PDAX\nStart recording trades...")
+
+	tradeConn := websocket.NewPDAXWebSocket(e.tradeURL)
+	if err = tradeConn.Connect(); err != nil {
+		return err
+	}
+	defer tradeConn.Close()
+
+	if err = tradeConn.Bootstrap(authToken, wsInitBook); err != nil {
+		return err
+	}
+
+	for {
+		if err = requestPage(&tradeConn, e.pageSize, e.state.SinceID); err != nil {
+			return err
+		}
+
+		page, err := e.readPage(&tradeConn)
+		if err != nil {
+			return err
+		}
+
+		done, err := e.writePage(page)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// writePage writes trades within the time range and reports whether the export is done.
+func (e *exporter) writePage(page []monitor.Trade) (bool, error) {
+	if len(page) == 0 {
+		return true, nil
+	}
+
+	done := len(page) < int(e.pageSize)
+	for _, t := range page {
+		if t.Timestamp.Before(e.state.From) {
+			// trades are sorted from the newest, the rest is out of range as well
+			done = true
+			break
+		}
+		if !t.Timestamp.Before(e.state.To) {
+			continue
+		}
+		if len(e.pairs) > 0 && !e.pairs[t.CurrencyPair] {
+			continue
+		}
+
+		if err := e.out.Write(t); err != nil {
+			return false, fmt.Errorf("failed to write trade: %v", err)
+		}
+		e.state.Written++
+	}
+
+	oldest := float64(page[len(page)-1].ID)
+	if !done && e.state.SinceID >= 0 && oldest >= e.state.SinceID {
+		return false, fmt.Errorf("trade history page did not advance past trade %.0f", e.state.SinceID)
+	}
+	e.state.SinceID = oldest
+
+	if err := e.out.Flush(); err != nil {
+		return false, fmt.Errorf("failed to flush trades: %v", err)
+	}
+	if err := e.state.save(e.statePath); err != nil {
+		return false, fmt.Errorf("failed to save export state: %v", err)
+	}
+	fmt.Printf("%d trades written, reached %s\n", e.state.Written, page[len(page)-1].Timestamp.Format(time.RFC3339))
+
+	return done, nil
+}
+
+// readPage skips websocket messages till the trade history page arrives.
+func (e *exporter) readPage(conn *websocket.PDAXWebsocket) ([]monitor.Trade, error) {
+	for {
+		closed, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if closed {
+			return nil, errors.New("PDAX websocket closed")
+		}
+
+		if page, ok := parseTradePage(e.tradeReader, data); ok {
+			return page, nil
+		}
+	}
+}
+
+// parseTradePage deserializes trade history page. Messages are deserialized in a way PDAX does it.
+// Yes, they do it themselves. I dont know why PDAX do not use ready libs or framework for it.
+func parseTradePage(tradeReader trade.Reader, data []byte) ([]monitor.Trade, bool) {
+	// the page header is 36 bytes, shorter messages are heartbeats and the like
+	if len(data) < 36 {
+		return nil, false
+	}
+
+	rc := binary.ReadCursor{
+		CurPos: 0,
+		Data:   data,
+	}
+
+	// most read values are going to be skipped
+	if rc.ReadUint8() != 36 { // historical trades have type == 36 (PageResetMessage)
+		return nil, false
+	}
+	rc.ReadUint32() // message_id
+	rc.ReadUint16() // seq_number
+
+	if rc.ReadFloat64() != 4.0 { // trades have view_id == 4
+		return nil, false
+	}
+	rc.ReadFloat64() // page_id
+	rc.ReadFloat64() // first_index
+	rc.ReadUint8()   // animate
+
+	if rc.ReadUint16() != 128 { // number == 'TimeSales_change'
+		return nil, false
+	}
+
+	fetchedLength := int(rc.ReadUint16())
+
+	return tradeReader.ReadTrades(&rc, fetchedLength, make([]monitor.Trade, 0, fetchedLength)), true
+}
+
+// requestPage requests pageSize trades older than sinceID, the newest trades are requested when sinceID is -1.
+func requestPage(conn *websocket.PDAXWebsocket, pageSize uint16, sinceID float64) error {
+	parameters := make([]byte, 11)
+
+	wc := binary.WriteCursor{
+		CurPos: 0,
+		Data:   parameters,
+	}
+	wc.WriteFloat64(sinceID)
+	wc.WriteUint8(0x01)
+	wc.WriteUint16(pageSize) // pageSize is last two bytes in second 40 byte message
+	fetchMessage, _ := base64.StdEncoding.DecodeString("HAAAAAYAAACAAAAAAAAAAAEACVRpbWVzdGFtcP8=")
+
+	if err := conn.WriteMessage(append(fetchMessage, parameters...)); err != nil {
+		return fmt.Errorf("PDAX websocket write error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// importWriter upserts trades into the trade repository, trades are sent in batches on Flush.
+type importWriter struct {
+	repo    monitor.TradeRepository
+	dryRun  bool
+	batch   []monitor.Trade
+	summary monitor.TradeImport
+}
+
+func (w *importWriter) Write(t monitor.Trade) error {
+	w.batch = append(w.batch, t)
+	return nil
+}
+
+func (w *importWriter) Flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	summary, err := w.repo.Upsert(context.Background(), w.batch, w.dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to import trades: %v", err)
+	}
+	w.summary.Inserted += summary.Inserted
+	w.summary.Duplicates += summary.Duplicates
+	w.batch = w.batch[:0]
+
+	return nil
+}
+
+func (w *importWriter) Close() error {
+	return w.Flush()
+}
+
+// importFile writes trades read from the file, they are flushed every page size trades.
+func (e *exporter) importFile(trades []monitor.Trade) error {
+	var pending int
+	for _, t := range trades {
+		if t.Timestamp.Before(e.state.From) || !t.Timestamp.Before(e.state.To) {
+			continue
+		}
+		if len(e.pairs) > 0 && !e.pairs[t.CurrencyPair] {
+			continue
+		}
+
+		if err := e.out.Write(t); err != nil {
+			return fmt.Errorf("failed to write trade: %v", err)
+		}
+		e.state.Written++
+
+		if pending++; pending == int(e.pageSize) {
+			if err := e.out.Flush(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+
+	return e.out.Flush()
+}
+
+// readTrades reads trades exported by the tool in the format.
+func readTrades(format, path string) ([]monitor.Trade, error) {
+	switch format {
+	case formatCSV:
+		return readCSV(path)
+	case formatJSONL:
+		return readJSONL(path)
+	case formatParquet:
+		return readParquet(path)
+	default:
+		return nil, fmt.Errorf("unknown input format %q, use csv, jsonl or parquet", format)
+	}
+}
+
+// readCSV reads trades by column names, so exports without ID or Side column are readable as well.
+func readCSV(path string) ([]monitor.Trade, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trade input file: %v", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(bufio.NewReader(f))
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"CurrencyPair", "Price", "Quantity", "Timestamp"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %s is missing", name)
+		}
+	}
+
+	var trades []monitor.Trade
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return trades, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv line %d: %v", line, err)
+		}
+
+		t, err := parseCSVTrade(columns, record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trade on csv line %d: %v", line, err)
+		}
+		trades = append(trades, t)
+	}
+}
+
+// parseCSVTrade parses the record by indexes of its columns, ID and Side are zero when their columns are missing.
+func parseCSVTrade(columns map[string]int, record []string) (monitor.Trade, error) {
+	var err error
+	var id int64
+	if i, ok := columns["ID"]; ok {
+		if id, err = strconv.ParseInt(record[i], 10, 64); err != nil {
+			return monitor.Trade{}, fmt.Errorf("invalid id: %v", err)
+		}
+	}
+	var side uint64
+	if i, ok := columns["Side"]; ok {
+		if side, err = strconv.ParseUint(record[i], 10, 8); err != nil {
+			return monitor.Trade{}, fmt.Errorf("invalid side: %v", err)
+		}
+	}
+	ts, err := strconv.ParseInt(record[columns["Timestamp"]], 10, 64)
+	if err != nil {
+		return monitor.Trade{}, fmt.Errorf("invalid timestamp: %v", err)
+	}
+
+	return newTrade(id, record[columns["CurrencyPair"]], record[columns["Price"]], record[columns["Quantity"]], time.Unix(ts, 0), uint8(side))
+}
+
+func readJSONL(path string) ([]monitor.Trade, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trade input file: %v", err)
+	}
+	defer f.Close()
+
+	var trades []monitor.Trade
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for line := 1; ; line++ {
+		var r jsonlTrade
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return trades, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read json line %d: %v", line, err)
+		}
+
+		t, err := newTrade(r.ID, r.CurrencyPair, r.Price, r.Quantity, time.Unix(r.Timestamp, 0), r.Side)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trade on json line %d: %v", line, err)
+		}
+		trades = append(trades, t)
+	}
+}
+
+func readParquet(path string) ([]monitor.Trade, error) {
+	f, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trade input file: %v", err)
+	}
+	defer f.Close()
+
+	pr, err := reader.NewParquetReader(f, new(parquetTrade), 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet file: %v", err)
+	}
+	defer pr.ReadStop()
+
+	rows := make([]parquetTrade, pr.GetNumRows())
+	if err = pr.Read(&rows); err != nil {
+		return nil, fmt.Errorf("failed to read parquet rows: %v", err)
+	}
+
+	trades := make([]monitor.Trade, 0, len(rows))
+	for i, r := range rows {
+		ts := time.Unix(0, r.Timestamp*int64(time.Millisecond))
+		t, err := newTrade(r.ID, r.CurrencyPair, r.Price, r.Quantity, ts, uint8(r.Side))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trade in parquet row %d: %v", i, err)
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, nil
+}
+
+func newTrade(id int64, currencyPair, price, quantity string, ts time.Time, side uint8) (monitor.Trade, error) {
+	p, _, err := apd.NewFromString(price)
+	if err != nil {
+		return monitor.Trade{}, fmt.Errorf("invalid price %q: %v", price, err)
+	}
+	q, _, err := apd.NewFromString(quantity)
+	if err != nil {
+		return monitor.Trade{}, fmt.Errorf("invalid quantity %q: %v", quantity, err)
+	}
+
+	return monitor.Trade{
+		ID:           id,
+		CurrencyPair: currencyPair,
+		Price:        p,
+		Quantity:     q,
+		Timestamp:    ts.UTC(),
+		Side:         side,
+	}, nil
+}
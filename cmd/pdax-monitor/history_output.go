@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	formatCSV     = "csv"
+	formatJSONL   = "jsonl"
+	formatParquet = "parquet"
+
+	timeLayout = "2006-01-02 15:04:05"
+)
+
+// tradeWriter writes trades to the output file in one of the supported formats.
+type tradeWriter interface {
+	Write(t monitor.Trade) error
+	// Flush makes written trades durable, so the run can be resumed after them.
+	Flush() error
+	Close() error
+}
+
+// newTradeWriter opens the output file, trades are appended to existing file when resuming.
+func newTradeWriter(format, path string, location *time.Location, resume bool) (tradeWriter, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if format == formatParquet {
+			return nil, fmt.Errorf("parquet output can not be resumed, export into a new file")
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trade output file: %v", err)
+	}
+
+	switch format {
+	case formatCSV:
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		w := csvWriter{f: f, w: csv.NewWriter(f), location: location}
+		if stat.Size() == 0 {
+			if err = w.w.Write([]string{"ID", "CurrencyPair", "Price", "Quantity", "Time", "Timestamp", "Side"}); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+
+		return &w, nil
+	case formatJSONL:
+		return &jsonlWriter{f: f, enc: json.NewEncoder(f), location: location}, nil
+	case formatParquet:
+		pw, err := writer.NewParquetWriterFromWriter(f, new(parquetTrade), 1)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create parquet writer: %v", err)
+		}
+
+		return &parquetWriter{f: f, pw: pw, location: location}, nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unknown output format %q, use csv, jsonl or parquet", format)
+	}
+}
+
+type csvWriter struct {
+	f        *os.File
+	w        *csv.Writer
+	location *time.Location
+}
+
+func (w *csvWriter) Write(t monitor.Trade) error {
+	return w.w.Write([]string{
+		strconv.FormatInt(t.ID, 10),
+		t.CurrencyPair,
+		t.Price.Text('f'),
+		t.Quantity.Text('f'),
+		t.Timestamp.In(w.location).Format(timeLayout),
+		strconv.FormatInt(t.Timestamp.Unix(), 10),
+		strconv.FormatUint(uint64(t.Side), 10),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+
+	return w.f.Sync()
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
+
+// jsonlTrade is a JSON Lines record, decimals are strings to keep them exact.
+type jsonlTrade struct {
+	ID           int64  `json:"id"`
+	CurrencyPair string `json:"currencyPair"`
+	Price        string `json:"price"`
+	Quantity     string `json:"quantity"`
+	Time         string `json:"time"`
+	Timestamp    int64  `json:"timestamp"`
+	Side         uint8  `json:"side"`
+}
+
+type jsonlWriter struct {
+	f        *os.File
+	enc      *json.Encoder
+	location *time.Location
+}
+
+func (w *jsonlWriter) Write(t monitor.Trade) error {
+	return w.enc.Encode(jsonlTrade{
+		ID:           t.ID,
+		CurrencyPair: t.CurrencyPair,
+		Price:        t.Price.Text('f'),
+		Quantity:     t.Quantity.Text('f'),
+		Time:         t.Timestamp.In(w.location).Format(time.RFC3339),
+		Timestamp:    t.Timestamp.Unix(),
+		Side:         t.Side,
+	})
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.f.Sync()
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.f.Close()
+}
+
+// parquetTrade is a Parquet row, decimals are strings to keep them exact.
+type parquetTrade struct {
+	ID           int64  `parquet:"name=id, type=INT64"`
+	CurrencyPair string `parquet:"name=currency_pair, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Price        string `parquet:"name=price, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Quantity     string `parquet:"name=quantity, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Time         string `parquet:"name=time, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp    int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Side         int32  `parquet:"name=side, type=INT32, convertedtype=UINT_8"`
+}
+
+type parquetWriter struct {
+	f        *os.File
+	pw       *writer.ParquetWriter
+	location *time.Location
+}
+
+func (w *parquetWriter) Write(t monitor.Trade) error {
+	return w.pw.Write(parquetTrade{
+		ID:           t.ID,
+		CurrencyPair: t.CurrencyPair,
+		Price:        t.Price.Text('f'),
+		Quantity:     t.Quantity.Text('f'),
+		Time:         t.Timestamp.In(w.location).Format(timeLayout),
+		Timestamp:    t.Timestamp.UnixNano() / int64(time.Millisecond),
+		Side:         int32(t.Side),
+	})
+}
+
+// Flush is no-op, Parquet file is only readable once its footer is written on Close.
+func (w *parquetWriter) Flush() error {
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.pw.WriteStop(); err != nil {
+		w.f.Close()
+		return fmt.Errorf("failed to finish parquet file: %v", err)
+	}
+
+	return w.f.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestTradeFileRoundTrip(t *testing.T) {
+	ts := time.Date(2021, 6, 1, 9, 30, 15, 0, time.UTC)
+	trades := []monitor.Trade{
+		{ID: 101, CurrencyPair: "BTC-PHP", Price: decimal(t, "2850000.50"), Quantity: decimal(t, "0.0125"), Timestamp: ts, Side: monitor.SideBid},
+		{ID: 102, CurrencyPair: "BTC-PHP", Price: decimal(t, "2850001"), Quantity: decimal(t, "0.5"), Timestamp: ts, Side: monitor.SideAsk},
+		{ID: 103, CurrencyPair: "ETH-PHP", Price: decimal(t, "180000"), Quantity: decimal(t, "1.75"), Timestamp: ts.Add(time.Minute), Side: monitor.SideBid},
+	}
+
+	for _, format := range []string{formatCSV, formatJSONL, formatParquet} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "trades."+format)
+			w, err := newTradeWriter(format, path, time.UTC, false)
+			if err != nil {
+				t.Fatalf("newTradeWriter() error = %v", err)
+			}
+			for _, tr := range trades {
+				if err = w.Write(tr); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			got, err := readTrades(format, path)
+			if err != nil {
+				t.Fatalf("readTrades() error = %v", err)
+			}
+			if len(got) != len(trades) {
+				t.Fatalf("read %d trades, want %d", len(got), len(trades))
+			}
+			for i, want := range trades {
+				if got[i].Key() != want.Key() || got[i].CurrencyPair != want.CurrencyPair ||
+					got[i].Price.Cmp(want.Price) != 0 || got[i].Quantity.Cmp(want.Quantity) != 0 ||
+					!got[i].Timestamp.Equal(want.Timestamp) || got[i].Side != want.Side {
+					t.Errorf("trade %d: got %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func decimal(t *testing.T, s string) *apd.Decimal {
+	t.Helper()
+
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		t.Fatalf("apd.NewFromString(%q) error = %v", s, err)
+	}
+
+	return d
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/synth"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+)
+
+func loadGenCommand() *ffcli.Command {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	fs.String("config", "", "YAML config file shared by all commands (optional)")
+	tradeRate := fs.Float64("trade-rate", 2, "Average number of trades per second across all pairs")
+	bookRate := fs.Float64("book-rate", 20, "Average number of order book changes per second across all books (0 disables)")
+	depth := fs.Int("depth", 50, "Number of orders of each side of order book resets")
+	duration := fs.Duration("duration", time.Minute, "Generate frames of the duration")
+	seed := fs.Int64("seed", 1, "Seed of random numbers, the same seed generates the same frames")
+	realTime := fs.Bool("realtime", false, "Write frames as their time comes instead of all at once, e.g. for soak tests")
+
+	return &ffcli.Command{
+		Name:      "loadgen",
+		Usage:     "pdax-monitor loadgen [flags] [<recording>]",
+		ShortHelp: "Generate synthetic PDAX websocket messages for load and soak tests",
+		LongHelp: "Trades and order book changes of BTC-PHP, ETH-PHP and USDT-PHP are generated at random " +
+			"with the average rates and written as a recording (stdout by default) for replay and dissect commands. " +
+			"Instruments and order book views match the bundled currency codes and default view IDs.",
+		FlagSet: fs,
+		Options: (command{}).options(),
+		Exec: func(args []string) error {
+			if len(args) > 1 {
+				return errors.New("only one recording file is expected")
+			}
+
+			var out io.Writer = os.Stdout
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Create(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to create recording: %v", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			w := bufio.NewWriter(out)
+			defer w.Flush()
+			rec := websocket.NewRecorder(w)
+
+			g := synth.NewGenerator(
+				synth.WithTradeRate(*tradeRate),
+				synth.WithBookRate(*bookRate),
+				synth.WithDepth(*depth),
+				synth.WithSeed(*seed),
+			)
+
+			if *realTime {
+				ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+				defer cancel()
+				ctx, cancel = context.WithTimeout(ctx, *duration)
+				defer cancel()
+
+				err := g.Run(ctx, func(f websocket.Frame) error {
+					if err := rec.RecordFrame(f); err != nil {
+						return err
+					}
+					// frames are written as they come, so the recording can be followed
+					return w.Flush()
+				})
+				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+					return nil
+				}
+				return err
+			}
+
+			for _, f := range g.Resets() {
+				if err := rec.RecordFrame(f); err != nil {
+					return err
+				}
+			}
+			end := time.Now().Add(*duration)
+			for f := g.Next(); f.Time.Before(end); f = g.Next() {
+				if err := rec.RecordFrame(f); err != nil {
+					return err
+				}
+			}
+
+			return w.Flush()
+		},
+	}
+}
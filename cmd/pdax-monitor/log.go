@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	kitlevel "github.com/go-kit/log/level"
+)
+
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
+// monitorPanic monitors panics and reports them somewhere (e.g. logs, Rollbar, ...).
+func monitorPanic(logger log.Logger) {
+	if rec := recover(); rec != nil {
+		err := fmt.Sprintf("panic: %v \n stack trace: %s", rec, debug.Stack())
+		level.Error(logger).Log("err", err)
+		panic(err)
+	}
+}
+
+// WithConfigHandler returns logger filtered by the level, HTTP handler to change the level (optionally only for
+// records with a key-value pair) and a function to change the level which fails on unknown levels.
+// Changing the level keeps the key-value pair override, records without the pair are filtered by the new level.
+func WithConfigHandler(level string) (*log.SwapLogger, http.HandlerFunc, func(level string) error) {
+	var baseLogger log.Logger
+	{
+		baseLogger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+		baseLogger = log.With(baseLogger, "ts", log.DefaultTimestampUTC)
+		baseLogger = log.With(baseLogger, "caller", log.DefaultCaller)
+	}
+
+	levelledLogger, _ := levelLogger(baseLogger, level)
+	if levelledLogger == nil {
+		levelledLogger = baseLogger
+	}
+
+	// standardLogger is resolved at log time, so the key-value pair override follows level changes
+	standardLogger := &log.SwapLogger{}
+	standardLogger.Swap(levelledLogger)
+
+	logger := log.SwapLogger{}
+	logger.Swap(standardLogger)
+
+	setLevel := func(level string) error {
+		l, err := levelLogger(baseLogger, level)
+		if err != nil {
+			return err
+		}
+		standardLogger.Swap(l)
+
+		return nil
+	}
+
+	f := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("form parse failed"))
+			return
+		}
+
+		lvl := r.Form.Get("level")
+		if k, v := r.Form.Get("key"), r.Form.Get("value"); lvl == LevelDebug && k != "" && v != "" {
+			logger.Swap(&FilterLogger{
+				Hit:   baseLogger,
+				Miss:  standardLogger,
+				Key:   k,
+				Value: v,
+			})
+			fmt.Fprintf(w, "log level is set to filtered debug: %s=%s", k, v)
+			return
+		}
+
+		if err := setLevel(lvl); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		logger.Swap(standardLogger)
+		fmt.Fprintf(w, "log level is set to %s", lvl)
+	}
+
+	return &logger, f, setLevel
+}
+
+// levelLogger filters base logger by the level.
+func levelLogger(baseLogger log.Logger, level string) (log.Logger, error) {
+	switch level {
+	case LevelError:
+		return kitlevel.NewFilter(baseLogger, kitlevel.AllowError()), nil
+	case LevelWarn:
+		return kitlevel.NewFilter(baseLogger, kitlevel.AllowWarn()), nil
+	case LevelInfo:
+		return kitlevel.NewFilter(baseLogger, kitlevel.AllowInfo()), nil
+	case LevelDebug:
+		return baseLogger, nil
+	}
+
+	return nil, fmt.Errorf("unknown log level %q, try error, warn, info, debug", level)
+}
+
+type FilterLogger struct {
+	Hit   log.Logger
+	Miss  log.Logger
+	Key   string
+	Value string
+}
+
+func (l *FilterLogger) Log(keyvals ...interface{}) error {
+	for i := 0; i < len(keyvals); i += 2 {
+		if k := fmt.Sprint(keyvals[i]); k == l.Key {
+			if v := fmt.Sprint(keyvals[i+1]); v == l.Value {
+				return l.Hit.Log(keyvals...)
+			}
+		}
+	}
+	return l.Miss.Log(keyvals...)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log/level"
+)
+
+func TestWithConfigHandlerFilterFollowsLevel(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() {
+		os.Stderr = stderr
+	}()
+
+	logger, handler, setLevel := WithConfigHandler(LevelInfo)
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/log?level=debug&key=pair&value=BTC-PHP", nil))
+
+	level.Debug(logger).Log("msg", "override debug", "pair", "BTC-PHP")
+	level.Info(logger).Log("msg", "info before")
+	if err = setLevel(LevelError); err != nil {
+		t.Fatalf("setLevel() error = %v", err)
+	}
+	level.Info(logger).Log("msg", "info after")
+	level.Error(logger).Log("msg", "error after")
+	level.Debug(logger).Log("msg", "override debug after", "pair", "BTC-PHP")
+
+	w.Close()
+	os.Stderr = stderr
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+
+	for _, msg := range []string{"override debug", "info before", "error after", "override debug after"} {
+		if !strings.Contains(out, `"msg":"`+msg+`"`) {
+			t.Errorf("record %q is missing in %s", msg, out)
+		}
+	}
+	if strings.Contains(out, `"msg":"info after"`) {
+		t.Errorf("info record is logged after the level is set to error: %s", out)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/peterbourgon/ff/ffcli"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/auth"
+)
+
+func loginTestCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("login-test", secretKey)
+	pdax := c.pdaxFlags()
+	account := c.fs.String("account", "", "Test only the account with the username (all accounts when empty)")
+	verbose := c.fs.Bool("verbose", false, "Log captcha solving and login steps")
+
+	return &ffcli.Command{
+		Name:      "login-test",
+		Usage:     "pdax-monitor login-test [flags]",
+		ShortHelp: "Sign in to PDAX with every configured account and report the result",
+		LongHelp: "Every account signs in on its own, so a captcha is solved (and paid) per account. " +
+			"Tokens are never printed, failures are reported with their error codes.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+
+			logger := log.NewNopLogger()
+			if *verbose {
+				logger = level.NewFilter(log.NewLogfmtLogger(os.Stderr), level.AllowInfo())
+			}
+
+			accounts, err := pdax.accounts()
+			if err != nil {
+				return err
+			}
+
+			var tested, failed int
+			for _, a := range accounts {
+				if *account != "" && a.Username != *account {
+					continue
+				}
+				tested++
+
+				pdaxAuth, err := pdax.newAuthFor([]auth.Account{a}, logger, nil, 0)
+				if err != nil {
+					return err
+				}
+
+				token, err := pdaxAuth.service.Login()
+				if err != nil {
+					failed++
+					code := monitor.ErrorCode(err)
+					if code == "" {
+						code = monitor.ErrorCodeInternal
+					}
+					fmt.Printf("FAIL %s %s: %v\n", a.Username, code, err)
+					continue
+				}
+				fmt.Printf("OK   %s token of %d bytes\n", a.Username, len(token))
+			}
+
+			if tested == 0 {
+				return fmt.Errorf("no account to test")
+			}
+			fmt.Printf("%d of %d accounts signed in\n", tested-failed, tested)
+			if failed > 0 {
+				return errFailed
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,53 @@
+// Command pdax-monitor monitors PDAX trades and order books and bundles tools to work with their history.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
+)
+
+// version is the service version from git tag.
+var version = ""
+
+func main() {
+	secretKey, err := secret.KeyFromEnv(secretKeyEnvVar)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading secret key failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	root := ffcli.Command{
+		Name:  "pdax-monitor",
+		Usage: "pdax-monitor <subcommand> [flags]",
+		LongHelp: "Flags of every subcommand are also read from the YAML file given by -config " +
+			"and from " + envVarPrefix + "_* env vars, e.g. " + envVarPrefix + "_PG_CONN_STRING.",
+		Subcommands: []*ffcli.Command{
+			serveCommand(secretKey),
+			historyCommand(secretKey),
+			migrateCommand(secretKey),
+			reportCommand(secretKey),
+			fxCommand(secretKey),
+			washTradeCommand(secretKey),
+			replayCommand(secretKey),
+			loadGenCommand(),
+			dissectCommand(),
+			loginTestCommand(secretKey),
+			secretCommand(secretKey),
+		},
+		Exec: func(args []string) error {
+			return flag.ErrHelp
+		},
+	}
+
+	if err = root.Run(os.Args[1:]); err != nil {
+		if !errors.Is(err, errFailed) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
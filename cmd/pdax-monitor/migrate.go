@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/pg"
+)
+
+func migrateCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("migrate", secretKey)
+	pgString := c.pgFlags()
+	dryRun := c.fs.Bool("dry-run", false, "List pending migrations without applying them")
+
+	return &ffcli.Command{
+		Name:      "migrate",
+		Usage:     "pdax-monitor migrate [flags]",
+		ShortHelp: "Create or upgrade Postgres schema",
+		LongHelp: "Migrations which are not recorded in schema_migration table are applied in order. " +
+			"Databases created before migrations were introduced are upgraded in place.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+
+			pgClient := pg.NewClient(pg.WithLogger(log.NewNopLogger()))
+			if err := pgClient.Open(pgString.Reveal()); err != nil {
+				return fmt.Errorf("db connection failed: %v", err)
+			}
+			defer pgClient.Close()
+
+			applied, err := pgClient.Migrate(context.Background(), *dryRun)
+			for _, v := range applied {
+				for _, m := range pg.Migrations() {
+					if m.Version == v {
+						fmt.Printf("%d %s\n", m.Version, m.Description)
+					}
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case len(applied) == 0:
+				fmt.Println("Schema is up to date")
+			case *dryRun:
+				fmt.Printf("%d migrations pending\n", len(applied))
+			default:
+				fmt.Printf("%d migrations applied\n", len(applied))
+			}
+
+			return nil
+		},
+	}
+}
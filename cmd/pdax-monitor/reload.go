@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/peterbourgon/ff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pudgydoge/pdax-monitor/internal/service"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+)
+
+// reloadDebounce coalesces bursts of file events, editors write a file in several steps.
+const reloadDebounce = 500 * time.Millisecond
+
+// liveConfig is the part of serve config which is applied without restart.
+type liveConfig struct {
+	currencyCodes     map[int]string
+	maintenance       []service.MaintenanceWindow
+	logLevel          string
+	captchaLowBalance float64
+}
+
+// liveFlags are names of flags applied by liveConfig, changes of other flags need restart.
+// Order book views aren't live: the websocket subscribes them once with wsInitBook messages on connect.
+func liveFlags() map[string]bool {
+	return map[string]bool{
+		"currencyCodes":            true,
+		"pdax.maintenance-windows": true,
+		"log.level":                true,
+		"captcha.low-balance":      true,
+	}
+}
+
+// liveConfig parses and validates the live part of the config.
+func (c *serveCmd) liveConfig() (liveConfig, error) {
+	var live liveConfig
+	var err error
+
+	if live.currencyCodes, err = trade.LoadCurrencyCodes(*c.pdax.currencyCodesPath); err != nil {
+		return live, fmt.Errorf("parsing currencyCodes failed: %v", err)
+	}
+	if live.maintenance, err = service.ParseMaintenanceWindows(*c.maintenanceWindows); err != nil {
+		return live, fmt.Errorf("parsing pdax.maintenance-windows failed: %v", err)
+	}
+	if _, err = levelLogger(log.NewNopLogger(), *c.logLevel); err != nil {
+		return live, fmt.Errorf("parsing log.level failed: %v", err)
+	}
+	live.logLevel = *c.logLevel
+	if *c.captchaLowBalance < 0 {
+		return live, fmt.Errorf("captcha.low-balance must not be negative")
+	}
+	live.captchaLowBalance = *c.captchaLowBalance
+
+	return live, nil
+}
+
+// configReloader watches config and currency codes files and applies live config changes.
+// Invalid changes are rejected as a whole, the applied config stays in effect.
+type configReloader struct {
+	secretKey []byte
+	args      []string
+	apply     func(liveConfig) error
+	logger    log.Logger
+	metrics   *reloadMetrics
+
+	configPath string
+
+	mu        sync.RWMutex
+	startup   *serveCmd
+	codesPath string
+	live      liveConfig
+}
+
+// newConfigReloader instantiates configReloader of the serve command started with the live config,
+// apply is called with every valid live config change.
+func newConfigReloader(
+	startup *serveCmd, secretKey []byte, live liveConfig, apply func(liveConfig) error,
+	logger log.Logger, registerer prometheus.Registerer,
+) *configReloader {
+	return &configReloader{
+		secretKey:  secretKey,
+		args:       commandArgs(startup.fs.Name()),
+		apply:      apply,
+		logger:     logger,
+		metrics:    newReloadMetrics(registerer),
+		configPath: startup.fs.Lookup("config").Value.String(),
+		startup:    startup,
+		codesPath:  *startup.pdax.currencyCodesPath,
+		live:       live,
+	}
+}
+
+// CaptchaLowBalance returns captcha solver balance alert threshold in effect.
+func (r *configReloader) CaptchaLowBalance() float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.live.captchaLowBalance
+}
+
+// Watch reloads the config whenever watched files change till the context is canceled.
+// Directories of the files are watched, so files replaced by editors or Kubernetes config maps are followed.
+func (r *configReloader) Watch(ctx context.Context) error {
+	files := r.files()
+	if len(files) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config: %v", err)
+	}
+	defer watcher.Close()
+
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if dirs[dir] {
+			continue
+		}
+		if err = watcher.Add(dir); err != nil {
+			level.Warn(r.logger).Log("msg", "failed to watch config directory", "dir", dir, "err", err)
+			continue
+		}
+		dirs[dir] = true
+	}
+	level.Info(r.logger).Log("msg", "watching config for changes", "files", fmt.Sprint(files))
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-watcher.Events:
+			if r.watched(files, event.Name) {
+				debounce.Reset(reloadDebounce)
+			}
+		case err = <-watcher.Errors:
+			level.Warn(r.logger).Log("msg", "config watch failed", "err", err)
+		case <-debounce.C:
+			r.Reload()
+			files = r.files()
+		}
+	}
+}
+
+// files returns absolute paths of config and currency codes files in effect.
+func (r *configReloader) files() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var files []string
+	for _, f := range []string{r.configPath, r.codesPath} {
+		if f == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(f); err == nil {
+			files = append(files, abs)
+		}
+	}
+
+	return files
+}
+
+func (r *configReloader) watched(files []string, name string) bool {
+	name, _ = filepath.Abs(name)
+	for _, f := range files {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reload parses the config as on startup and applies changes of its live part.
+func (r *configReloader) Reload() {
+	next := newServeCmd(r.secretKey)
+	next.fs.Init(next.fs.Name(), flag.ContinueOnError)
+	next.fs.SetOutput(io.Discard)
+
+	err := ff.Parse(next.fs, r.args, next.options()...)
+	var live liveConfig
+	if err == nil {
+		live, err = next.liveConfig()
+	}
+	if err != nil {
+		level.Error(r.logger).Log("msg", "config change rejected", "err", err)
+		r.metrics.observe(reloadResultRejected)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if restart := changedFlags(r.startup.fs, next.fs, liveFlags()); len(restart) > 0 {
+		level.Warn(r.logger).Log("msg", "config changes need restart to take effect", "flags", fmt.Sprint(restart))
+	}
+	if err = r.apply(live); err != nil {
+		level.Error(r.logger).Log("msg", "config change rejected", "err", err)
+		r.metrics.observe(reloadResultRejected)
+		return
+	}
+
+	r.codesPath = *next.pdax.currencyCodesPath
+	r.live = live
+	level.Info(r.logger).Log(
+		"msg", "config reloaded",
+		"currencyCodes", len(live.currencyCodes),
+		"maintenanceWindows", fmt.Sprint(live.maintenance),
+		"logLevel", live.logLevel,
+		"captchaLowBalance", live.captchaLowBalance,
+	)
+	r.metrics.observe(reloadResultApplied)
+}
+
+// changedFlags returns names of flags which values differ, except the ignored ones.
+func changedFlags(a, b *flag.FlagSet, ignored map[string]bool) []string {
+	var changed []string
+	a.VisitAll(func(f *flag.Flag) {
+		if ignored[f.Name] {
+			return
+		}
+		if other := b.Lookup(f.Name); other == nil || other.Value.String() != f.Value.String() {
+			changed = append(changed, f.Name)
+		}
+	})
+	sort.Strings(changed)
+
+	return changed
+}
+
+// commandArgs returns command line arguments of the subcommand, they take precedence over the config on reload.
+func commandArgs(name string) []string {
+	for i, arg := range os.Args {
+		if arg == name {
+			return os.Args[i+1:]
+		}
+	}
+
+	return nil
+}
+
+const (
+	reloadResultApplied  = "applied"
+	reloadResultRejected = "rejected"
+)
+
+// reloadMetrics records config reloads.
+type reloadMetrics struct {
+	reloads    *prometheus.CounterVec
+	lastReload prometheus.Gauge
+}
+
+func newReloadMetrics(registerer prometheus.Registerer) *reloadMetrics {
+	m := reloadMetrics{
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pdax_config_reloads_total",
+			Help: "Config reloads per result, applied or rejected.",
+		}, []string{"result"}),
+		lastReload: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pdax_config_last_reload_timestamp_seconds",
+			Help: "Time of the last applied config reload.",
+		}),
+	}
+	registerer.MustRegister(m.reloads, m.lastReload)
+
+	return &m
+}
+
+func (m *reloadMetrics) observe(result string) {
+	m.reloads.WithLabelValues(result).Inc()
+	if result == reloadResultApplied {
+		m.lastReload.SetToCurrentTime()
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestChangedFlags(t *testing.T) {
+	flags := func(args ...string) *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("a", "1", "")
+		fs.String("b", "2", "")
+		fs.Bool("c", false, "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+
+	tests := []struct {
+		name    string
+		a, b    *flag.FlagSet
+		ignored map[string]bool
+		want    []string
+	}{
+		{"same", flags(), flags(), nil, nil},
+		{"set to default", flags(), flags("-a", "1"), nil, nil},
+		{"changed", flags(), flags("-c", "-a", "3"), nil, []string{"a", "c"}},
+		{"changed back", flags("-b", "3"), flags(), nil, []string{"b"}},
+		{"ignored", flags(), flags("-a", "3", "-b", "3"), map[string]bool{"a": true}, []string{"b"}},
+		{"missing", flags(), flag.NewFlagSet("other", flag.ContinueOnError), nil, []string{"a", "b", "c"}},
+	}
+
+	for _, tc := range tests {
+		if got := changedFlags(tc.a, tc.b, tc.ignored); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: changedFlags() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReloadKeepsLiveConfigOnInvalidChange(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	codesPath := filepath.Join(dir, "currencyCodes.json")
+	writeFile(t, codesPath, `{"currencyCodes": {"167": "BTC"}}`)
+	writeFile(t, configPath, "currencyCodes: "+codesPath+"\nlog.level: info\n")
+
+	startup := newServeCmd(nil)
+	args := []string{"-config", configPath}
+	if err := ff.Parse(startup.fs, args, startup.options()...); err != nil {
+		t.Fatal(err)
+	}
+	live, err := startup.liveConfig()
+	if err != nil {
+		t.Fatalf("liveConfig() error = %v", err)
+	}
+
+	var applied []liveConfig
+	r := newConfigReloader(startup, nil, live, func(live liveConfig) error {
+		applied = append(applied, live)
+		return nil
+	}, log.NewNopLogger(), prometheus.NewRegistry())
+	r.args = args
+
+	invalid := []string{
+		"log.level: verbose\n",
+		"captcha.low-balance: -1\n",
+		"pdax.maintenance-windows: 25:00-26:00\n",
+		"captcha.low-balance: lots\n",
+	}
+	for _, config := range invalid {
+		writeFile(t, configPath, "currencyCodes: "+codesPath+"\n"+config)
+		r.Reload()
+	}
+	writeFile(t, codesPath, `{"currencyCodes": {"x": "BTC"}}`)
+	r.Reload()
+
+	if len(applied) != 0 {
+		t.Fatalf("invalid configs applied: %+v", applied)
+	}
+	if !reflect.DeepEqual(r.live, live) {
+		t.Errorf("live config = %+v after invalid changes, want %+v", r.live, live)
+	}
+	if got := testutil.ToFloat64(r.metrics.reloads.WithLabelValues(reloadResultRejected)); got != 5 {
+		t.Errorf("got %v rejected reloads, want 5", got)
+	}
+
+	writeFile(t, codesPath, `{"currencyCodes": {"167": "BTC", "168": "ETH"}}`)
+	writeFile(t, configPath, "currencyCodes: "+codesPath+"\nlog.level: warn\ncaptcha.low-balance: 5\norderbook.view-ids: 16\n")
+	r.Reload()
+
+	if len(applied) != 1 {
+		t.Fatalf("applied %d configs, want 1", len(applied))
+	}
+	want := map[int]string{167: "BTC", 168: "ETH"}
+	if got := applied[0]; got.logLevel != "warn" || got.captchaLowBalance != 5 || !reflect.DeepEqual(got.currencyCodes, want) {
+		t.Errorf("applied config %+v", got)
+	}
+	if got := r.CaptchaLowBalance(); got != 5 {
+		t.Errorf("CaptchaLowBalance() = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(r.metrics.reloads.WithLabelValues(reloadResultApplied)); got != 1 {
+		t.Errorf("got %v applied reloads, want 1", got)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
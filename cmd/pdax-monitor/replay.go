@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/peterbourgon/ff/ffcli"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/pg"
+	"github.com/pudgydoge/pdax-monitor/internal/service"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+)
+
+func replayCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("replay", secretKey)
+	fs := c.fs
+	pgString := c.pgFlags()
+	currencyCodesPath := fs.String("currencyCodes", "./auxiliary/currencyCodes.json", "Path to the PDAX currency codes file")
+	instrumentView := fs.Float64("ws.instrument-view-id", 0, "PDAX websocket view ID of instrument reference view (0 uses currencyCodes only)")
+	orderBookViews := fs.String("orderbook.view-ids", "16,21", "Comma separated PDAX websocket view IDs of order books to track")
+	snapshotInterval := fs.Duration("orderbook.snapshot-interval", 0, "Store order book snapshot every interval (0 disables)")
+	snapshotUpdates := fs.Int("orderbook.snapshot-updates", 0, "Store order book snapshot every N book updates (0 disables)")
+	snapshotOnTopChange := fs.Bool("orderbook.snapshot-on-top-change", false, "Store order book snapshot when the top of book changes")
+	store := fs.Bool("store", false, "Store trades and order book snapshots in Postgres instead of printing them")
+
+	return &ffcli.Command{
+		Name:      "replay",
+		Usage:     "pdax-monitor replay [flags] <recording>",
+		ShortHelp: "Replay websocket messages recorded by serve -ws.record-file",
+		LongHelp: "Recorded messages are decoded the way serve does it. Trades and order book snapshots " +
+			"are printed as JSON lines, or stored in Postgres with -store.",
+		FlagSet: fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("replay requires exactly one recording file")
+			}
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+
+			currencyCodes, err := trade.LoadCurrencyCodes(*currencyCodesPath)
+			if err != nil {
+				return err
+			}
+			viewIDs, err := parseViewIDs(*orderBookViews)
+			if err != nil {
+				return fmt.Errorf("parsing orderbook.view-ids failed: %v", err)
+			}
+
+			var trades monitor.TradeRepository
+			var orders monitor.OrderRepository
+			if *store {
+				pgClient := pg.NewClient(pg.WithLogger(log.NewNopLogger()))
+				if err = pgClient.Open(pgString.Reveal()); err != nil {
+					return fmt.Errorf("db connection failed: %v", err)
+				}
+				defer pgClient.Close()
+
+				trades, orders = pgClient.TradeRepository(), pgClient.OrderRepository()
+			} else {
+				enc := json.NewEncoder(os.Stdout)
+				trades, orders = printTrades{enc: enc}, printOrders{enc: enc}
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open recording: %v", err)
+			}
+			defer f.Close()
+
+			logger := level.NewFilter(log.NewLogfmtLogger(os.Stderr), level.AllowWarn())
+			m := service.NewMonitorService(
+				service.WithTradeRepository(trades),
+				service.WithOrderRepository(orders),
+				service.WithCurrencyCodes(currencyCodes),
+				service.WithInstrumentView(*instrumentView),
+				service.WithOrderBookViews(viewIDs),
+				service.WithSnapshotPolicy(order.NewSnapshotPolicyFactory(*snapshotInterval, *snapshotUpdates, *snapshotOnTopChange)),
+				service.WithLogger(logger),
+			)
+
+			ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer cancel()
+
+			return m.Replay(ctx, f)
+		},
+	}
+}
+
+type printRecord struct {
+	Type     string                     `json:"type"`
+	Trade    *monitor.Trade             `json:"trade,omitempty"`
+	Snapshot *monitor.OrderBookSnapshot `json:"snapshot,omitempty"`
+}
+
+// printTrades prints trades as JSON lines instead of storing them.
+type printTrades struct {
+	enc *json.Encoder
+}
+
+func (r printTrades) Insert(_ context.Context, t *monitor.Trade) error {
+	return r.enc.Encode(printRecord{Type: "trade", Trade: t})
+}
+
+func (r printTrades) Upsert(ctx context.Context, trades []monitor.Trade, _ bool) (monitor.TradeImport, error) {
+	for i := range trades {
+		if err := r.Insert(ctx, &trades[i]); err != nil {
+			return monitor.TradeImport{}, err
+		}
+	}
+
+	return monitor.TradeImport{Inserted: len(trades)}, nil
+}
+
+func (r printTrades) Trades(context.Context, monitor.TradeQuery) ([]monitor.Trade, error) {
+	return nil, nil
+}
+
+// printOrders prints order book snapshots as JSON lines instead of storing them.
+type printOrders struct {
+	enc *json.Encoder
+}
+
+func (r printOrders) Insert(_ context.Context, s *monitor.OrderBookSnapshot) error {
+	return r.enc.Encode(printRecord{Type: "snapshot", Snapshot: s})
+}
+
+func (r printOrders) BookAt(context.Context, string, time.Time) (*monitor.OrderBookSnapshot, error) {
+	return nil, monitor.Error{Code: monitor.ErrorCodeNotFound, Message: "order book snapshots are not stored"}
+}
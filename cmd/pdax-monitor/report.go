@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/report"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+)
+
+const reportTimeout = 10 * time.Minute
+
+// reportConfig is daily volume report rendering and delivery config shared by report and serve commands.
+type reportConfig struct {
+	format       *string
+	pairs        *string
+	timeZone     *string
+	smtpAddr     *string
+	smtpFrom     *string
+	smtpTo       *string
+	smtpUsername *string
+	smtpPassword *secret.Value
+	webhookURL   *string
+}
+
+func (c command) reportFlags() *reportConfig {
+	fs := c.fs
+	return &reportConfig{
+		format: fs.String("report.format", report.FormatHTML, "Volume report format: "+strings.Join(report.Formats(), ", ")),
+		pairs: fs.String("report.pairs", "",
+			"Comma separated currency pairs to report, pairs of known instruments are reported when empty"),
+		timeZone:     fs.String("report.tz", "UTC", "Time zone of reported days, e.g. Asia/Manila"),
+		smtpAddr:     fs.String("report.smtp-addr", "", "SMTP server host:port to email volume reports (empty disables)"),
+		smtpFrom:     fs.String("report.smtp-from", "pdax-monitor@localhost", "Sender of volume report emails"),
+		smtpTo:       fs.String("report.smtp-to", "", "Comma separated recipients of volume report emails"),
+		smtpUsername: fs.String("report.smtp-username", "", "SMTP username, no auth when empty"),
+		smtpPassword: c.secrets.String("report.smtp-password", "", "SMTP password"),
+		webhookURL:   fs.String("report.webhook-url", "", "URL to post volume reports to (empty disables)"),
+	}
+}
+
+// validate checks the format and time zone, it returns the time zone.
+func (c *reportConfig) validate() (*time.Location, error) {
+	if report.ContentType(*c.format) == "" {
+		return nil, fmt.Errorf("unknown report format %q, try %s", *c.format, strings.Join(report.Formats(), ", "))
+	}
+	if *c.smtpAddr != "" && len(splitList(*c.smtpTo)) == 0 {
+		return nil, fmt.Errorf("report.smtp-to is required to email reports")
+	}
+
+	loc, err := time.LoadLocation(*c.timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report time zone: %v", err)
+	}
+
+	return loc, nil
+}
+
+// senders returns configured report deliveries.
+func (c *reportConfig) senders() []report.Sender {
+	var senders []report.Sender
+	if *c.smtpAddr != "" {
+		senders = append(senders, report.SMTP{
+			Addr:     *c.smtpAddr,
+			From:     *c.smtpFrom,
+			To:       splitList(*c.smtpTo),
+			Username: *c.smtpUsername,
+			Password: c.smtpPassword.Reveal(),
+		})
+	}
+	if *c.webhookURL != "" {
+		senders = append(senders, report.Webhook{URL: *c.webhookURL})
+	}
+
+	return senders
+}
+
+// pairList returns configured pairs, or pairs of the instruments when none are configured.
+func (c *reportConfig) pairList(instruments *trade.Instruments) []string {
+	return pairList(*c.pairs, instruments)
+}
+
+// pairList splits the comma separated pairs, all known pairs are listed when it's empty.
+func pairList(list string, instruments *trade.Instruments) []string {
+	if pairs := splitList(list); len(pairs) > 0 {
+		return pairs
+	}
+
+	var pairs []string
+	for _, i := range instruments.All() {
+		pairs = append(pairs, i.Pair())
+	}
+	sort.Strings(pairs)
+
+	return pairs
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+
+	return items
+}
+
+func reportCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("report", secretKey)
+	store := c.storageFlags()
+	cfg := c.reportFlags()
+	currencyCodesPath := c.fs.String("currencyCodes", "./auxiliary/currencyCodes.json", "Path to the PDAX currency codes file")
+	dayFlag := c.fs.String("day", "", "Day to report as YYYY-MM-DD, yesterday by default")
+
+	return &ffcli.Command{
+		Name:      "report",
+		Usage:     "pdax-monitor report [flags]",
+		ShortHelp: "Report daily volume per currency pair",
+		LongHelp: "Trade count, base volume, PHP notional, VWAP, high, low and volume change versus the average " +
+			"of 7 days before are reported per pair. The report is emailed or posted to a webhook when configured, " +
+			"otherwise it's printed. Serve command delivers it daily when report.at is set.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+			loc, err := cfg.validate()
+			if err != nil {
+				return err
+			}
+
+			day := report.Day(time.Now(), loc)
+			if *dayFlag != "" {
+				if day, err = time.ParseInLocation("2006-01-02", *dayFlag, loc); err != nil {
+					return fmt.Errorf("invalid day: %v", err)
+				}
+			}
+
+			currencyCodes, err := trade.LoadCurrencyCodes(*currencyCodesPath)
+			if err != nil {
+				return fmt.Errorf("parsing currencyCodes failed: %v", err)
+			}
+			pairs := cfg.pairList(trade.NewInstruments(currencyCodes, nil, nil))
+
+			s, err := store.open(log.NewNopLogger())
+			if err != nil {
+				return fmt.Errorf("db connection failed: %v", err)
+			}
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+			defer cancel()
+
+			r, err := report.Build(ctx, s.TradeRepository(), s.FXRateRepository(), pairs, day)
+			if err != nil {
+				return err
+			}
+
+			senders := cfg.senders()
+			if len(senders) == 0 {
+				return report.Render(os.Stdout, r, *cfg.format)
+			}
+			if err = report.Deliver(ctx, r, *cfg.format, senders); err != nil {
+				return fmt.Errorf("report delivery failed: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "%s delivered\n", r.Title())
+
+			return nil
+		},
+	}
+}
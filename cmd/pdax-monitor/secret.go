@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
+)
+
+// secretCommand encrypts a secret read from stdin for the config file, e.g.
+//
+//	export PDAX_MONITOR_SECRET_KEY=$(pdax-monitor secret -genkey)
+//	echo -n 'password' | pdax-monitor secret
+//
+// prints enc:... value to put under pdax.password key of the YAML config.
+func secretCommand(secretKey []byte) *ffcli.Command {
+	fs := flag.NewFlagSet("secret", flag.ExitOnError)
+	genKey := fs.Bool("genkey", false, "Generate new base64 encoded AES-256 key")
+
+	return &ffcli.Command{
+		Name:      "secret",
+		Usage:     "pdax-monitor secret [flags] < plaintext",
+		ShortHelp: "Encrypt a secret for the config file",
+		LongHelp: "The secret read from stdin is encrypted with the key of " + secretKeyEnvVar + " env var " +
+			"and printed as enc:... value. Values with enc: prefix are decrypted when the config is read.",
+		FlagSet: fs,
+		Exec: func(args []string) error {
+			if *genKey {
+				key := make([]byte, 32)
+				if _, err := rand.Read(key); err != nil {
+					return fmt.Errorf("failed to generate key: %v", err)
+				}
+				fmt.Println(base64.StdEncoding.EncodeToString(key))
+				return nil
+			}
+
+			if secretKey == nil {
+				return fmt.Errorf("%s must be set, generate a key with -genkey", secretKeyEnvVar)
+			}
+
+			plaintext, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && plaintext == "" {
+				return fmt.Errorf("failed to read secret from stdin: %v", err)
+			}
+
+			encrypted, err := secret.Encrypt(secretKey, strings.TrimRight(plaintext, "\r\n"))
+			if err != nil {
+				return fmt.Errorf("failed to encrypt secret: %v", err)
+			}
+			fmt.Println(secret.EncryptedPrefix + encrypted)
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/run"
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/api"
+	"github.com/pudgydoge/pdax-monitor/internal/archive"
+	"github.com/pudgydoge/pdax-monitor/internal/fx"
+	"github.com/pudgydoge/pdax-monitor/internal/grpcapi"
+	"github.com/pudgydoge/pdax-monitor/internal/health"
+	"github.com/pudgydoge/pdax-monitor/internal/liquidity"
+	livefeed "github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/publish"
+	"github.com/pudgydoge/pdax-monitor/internal/report"
+	"github.com/pudgydoge/pdax-monitor/internal/rollbar"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
+	"github.com/pudgydoge/pdax-monitor/internal/service"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/washtrade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+	monitorv1 "github.com/pudgydoge/pdax-monitor/proto/pdax/monitor/v1"
+	"google.golang.org/grpc"
+)
+
+// exitCode is a process termination code.
+type exitCode int
+
+// Possible process termination codes are listed below.
+const (
+	// exitSuccess is code for successful program termination.
+	exitSuccess exitCode = 0
+	// exitFailure is code for unsuccessful program termination.
+	exitFailure exitCode = 1
+)
+
+// serveCmd monitors PDAX trades and order books.
+type serveCmd struct {
+	command
+	pdax                   *pdaxConfig
+	storage                *storageConfig
+	archiveDir             *string
+	archiveCloseDelay      *time.Duration
+	archivePruneAfterDays  *int
+	report                 *reportConfig
+	reportAt               *string
+	publishDriver          *string
+	publishURL             *string
+	publishSubject         *string
+	publishQueueSize       *int
+	pipelineQueueSize      *int
+	fxProxyInterval        *time.Duration
+	fxProxyPairs           *string
+	washTradeInterval      *time.Duration
+	shutdownDelay          *time.Duration
+	captchaSolveCost       *float64
+	captchaLowBalance      *float64
+	captchaBalanceInterval *time.Duration
+	opsHTTPAddr            *string
+	opsMaxFrameAge         *time.Duration
+	grpcAddr               *string
+	orderBookViews         *string
+	maintenanceWindows     *string
+	logLevel               *string
+	instrumentView         *float64
+	snapshotInterval       *time.Duration
+	snapshotUpdates        *int
+	snapshotOnTopChange    *bool
+	liquidityInterval      *time.Duration
+	slippageNotionals      *string
+	recordFile             *string
+	rollbarEnv             *string
+	rollbarToken           *secret.Value
+	rollbarIsActive        *bool
+	version                *bool
+}
+
+func serveCommand(secretKey []byte) *ffcli.Command {
+	c := newServeCmd(secretKey)
+
+	return &ffcli.Command{
+		Name:      "serve",
+		Usage:     "pdax-monitor serve [flags]",
+		ShortHelp: "Monitor PDAX trades and order books and serve ops and order book APIs",
+		LongHelp: "Changes of the config file and currency codes file are applied without restart to flags " +
+			"currencyCodes, pdax.maintenance-windows, log.level and captcha.low-balance, the only alert threshold " +
+			"of the monitor, alerting rules on its metrics belong to Prometheus. " +
+			"Invalid changes are rejected, changes of other flags need restart.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if c.run(secretKey) != exitSuccess {
+				return errFailed
+			}
+
+			return nil
+		},
+	}
+}
+
+func newServeCmd(secretKey []byte) *serveCmd {
+	c := serveCmd{command: newCommand("serve", secretKey)}
+	fs := c.fs
+	c.pdax = c.pdaxFlags()
+	c.storage = c.storageFlags()
+	c.archiveDir = fs.String("archive.dir", "", "Archive trades of every UTC day per pair into Parquet files in the directory (empty disables)")
+	c.archiveCloseDelay = fs.Duration("archive.close-delay", 5*time.Minute, "Compact the past day into Parquet files the delay after UTC midnight")
+	c.archivePruneAfterDays = fs.Int("archive.prune-after-days", 0,
+		"Delete archived trades from Postgres once they are the number of days old (0 keeps them)")
+	c.report = c.reportFlags()
+	c.reportAt = fs.String("report.at", "", "Deliver the volume report of the previous day daily at HH:MM of report.tz (empty disables)")
+	c.publishDriver = fs.String("publish.driver", "",
+		"Publish received trades to a message bus: "+strings.Join(publish.Drivers(), ", ")+
+			" (empty disables), at most once across restarts as trades are queued in memory")
+	c.publishURL = fs.String("publish.url", "nats://127.0.0.1:4222", "NATS server URL or comma separated Kafka brokers")
+	c.publishSubject = fs.String("publish.subject", "pdax.trades", "NATS subject prefix, trades go to <prefix>.<pair>, or Kafka topic")
+	c.publishQueueSize = fs.Int("publish.queue-size", 10000, "Trades waiting for publishing in memory before the monitor stalls")
+	c.pipelineQueueSize = fs.Int("pipeline.queue-size", 1024, "Frames, trades or snapshots waiting for each pipeline stage before reading stalls")
+	c.fxProxyInterval = fs.Duration("fx.proxy-interval", time.Hour,
+		"Store USD-PHP rate derived from live trades of fx.proxy-pairs every interval (0 disables)")
+	c.fxProxyPairs = fs.String("fx.proxy-pairs", fx.DefaultProxyPairs, "Comma separated USD stablecoin pairs whose prices proxy USD-PHP rate")
+	c.washTradeInterval = fs.Duration("washtrade.interval", time.Hour,
+		"Detect trade patterns which suggest wash trading within windows of the interval, scanned every interval (0 disables)")
+	// Kubernetes (rolling update) doesn't wait until a pod is out of rotation before sending SIGTERM,
+	// and external LB could still route traffic to a non-existing pod resulting in a surge of 50x API errors.
+	// It's recommended to wait for 5 seconds before terminating the program; see references
+	// https://github.com/kubernetes-retired/contrib/issues/1140, https://youtu.be/me5iyiheOC8?t=1797.
+	c.shutdownDelay = fs.Duration("shutdown-delay", 5*time.Second, "Delay before application shutdown")
+	c.captchaSolveCost = fs.Float64("captcha.solve-cost", 0.003, "Price of a single captcha solve in USD, used to estimate spend")
+	c.captchaLowBalance = fs.Float64("captcha.low-balance", 1, "Alert when captcha solver balance in USD drops below the threshold")
+	c.captchaBalanceInterval = fs.Duration("captcha.balance-check-interval", 15*time.Minute,
+		"Check captcha solver balance every interval (0 disables)")
+	c.opsHTTPAddr = fs.String("ops.http-addr", ":8081", "HTTP ops API address to listen")
+	c.grpcAddr = fs.String("grpc.addr", ":8082", "gRPC API address to listen (empty disables)")
+	c.opsMaxFrameAge = fs.Duration("ops.max-frame-age", 2*time.Minute, "Report not ready when no websocket frames are received for the duration")
+	c.orderBookViews = fs.String("orderbook.view-ids", "16,21", "Comma separated PDAX websocket view IDs of order books to track")
+	c.snapshotInterval = fs.Duration("orderbook.snapshot-interval", 0, "Store order book snapshot every interval (0 disables)")
+	c.snapshotUpdates = fs.Int("orderbook.snapshot-updates", 0, "Store order book snapshot every N book updates (0 disables)")
+	c.snapshotOnTopChange = fs.Bool("orderbook.snapshot-on-top-change", false, "Store order book snapshot when the top of book changes")
+	c.liquidityInterval = fs.Duration("liquidity.sample-interval", time.Minute, "Sample order book liquidity every interval (0 disables)")
+	c.slippageNotionals = fs.String("liquidity.slippage-notionals", "100000,1000000", "Comma separated PHP notionals to estimate slippage for")
+	c.instrumentView = fs.Float64("ws.instrument-view-id", 0,
+		"PDAX websocket view ID of instrument reference view subscribed by instrumentMessages of wsInitBook (0 uses currencyCodes only)")
+	c.recordFile = fs.String("ws.record-file", "", "Append received websocket messages to the file for replay and dissect commands")
+	c.rollbarEnv = fs.String("rollbar.env", "development", "Rollbar environment")
+	c.rollbarToken = c.secrets.String("rollbar.token", "", "Rollbar token")
+	c.rollbarIsActive = fs.Bool("rollbar.is_active", false, "Rollbar enabled")
+	c.maintenanceWindows = fs.String("pdax.maintenance-windows", service.DefaultMaintenanceWindows,
+		"Comma separated daily PDAX maintenance windows in UTC, monitoring resumes when they end")
+	c.logLevel = fs.String("log.level", LevelDebug, "Log level: error, warn, info or debug")
+	c.version = fs.Bool("v", false, "Show version")
+
+	return &c
+}
+
+// run releases resources gracefully upon termination.
+// When we call os.Exit defer statements do not run resulting in unclean process shutdown.
+func (c *serveCmd) run(secretKey []byte) exitCode {
+	var err error
+	logger, logConfigHandler, setLogLevel := WithConfigHandler(*c.logLevel)
+	http.DefaultServeMux.HandleFunc("/logging", logConfigHandler)
+
+	if err = c.loadSecretFiles(); err != nil {
+		level.Error(logger).Log("msg", "loading secret files failed", "err", err)
+		return exitFailure
+	}
+
+	if *c.version {
+		if version == "" {
+			fmt.Println("Version not set")
+		} else {
+			fmt.Printf("Version: %s\n", version)
+		}
+
+		keyvals := secret.Dump(c.fs)
+		for i := 0; i < len(keyvals); i += 2 {
+			fmt.Printf("%s=%s\n", keyvals[i], keyvals[i+1])
+		}
+
+		return exitSuccess
+	}
+
+	level.Info(logger).Log(append([]interface{}{"msg", "startup config", "version", version}, secret.Dump(c.fs)...)...)
+
+	if *c.rollbarIsActive {
+		rollbar.SetUp(logger, c.rollbarToken.Reveal(), *c.rollbarEnv)
+		defer rollbar.TearDown()
+	}
+
+	_, wsInitBook, err := c.pdax.loadData()
+	if err != nil {
+		level.Error(logger).Log("msg", "loading pdax data failed", "err", err)
+		return exitFailure
+	}
+
+	live, err := c.liveConfig()
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid config", "err", err)
+		return exitFailure
+	}
+	orderBookViews, err := parseViewIDs(*c.orderBookViews)
+	if err != nil {
+		level.Error(logger).Log("msg", "parsing orderbook.view-ids failed", "err", err)
+		return exitFailure
+	}
+
+	var reportAt time.Duration
+	var reportLocation *time.Location
+	if *c.reportAt != "" {
+		at, err := time.Parse("15:04", *c.reportAt)
+		if err != nil {
+			level.Error(logger).Log("msg", "parsing report.at failed", "err", err)
+			return exitFailure
+		}
+		reportAt = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+
+		if reportLocation, err = c.report.validate(); err != nil {
+			level.Error(logger).Log("msg", "invalid report config", "err", err)
+			return exitFailure
+		}
+		if len(c.report.senders()) == 0 {
+			level.Error(logger).Log("msg", "report.at requires report.smtp-addr or report.webhook-url")
+			return exitFailure
+		}
+	}
+
+	notionals, err := parseDecimals(*c.slippageNotionals)
+	if err != nil {
+		level.Error(logger).Log("msg", "parsing liquidity.slippage-notionals failed", "err", err)
+		return exitFailure
+	}
+
+	// It's nice to be able to see panics in Rollbar, hence we monitor for panics after
+	// logger has been bootstrapped with Rollbar.
+	defer monitorPanic(logger)
+
+	// Expose endpoint for healthcheck.
+	http.DefaultServeMux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	// Expose the registered Prometheus metrics via HTTP.
+	http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
+
+	opsServer := http.Server{
+		Addr:    *c.opsHTTPAddr,
+		Handler: http.DefaultServeMux,
+	}
+
+	var store monitor.Storage
+	{
+		store, err = c.storage.open(logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "db connection failed", "err", err)
+			return exitFailure
+		}
+
+		defer func() {
+			if err := store.Close(); err != nil {
+				level.Warn(logger).Log("msg", "db close failed", "err", err)
+			}
+		}()
+	}
+
+	pdaxAuth, err := c.pdax.newAuth(logger, prometheus.DefaultRegisterer, *c.captchaSolveCost)
+	if err != nil {
+		level.Error(logger).Log("msg", "pdax auth setup failed", "err", err)
+		return exitFailure
+	}
+	prometheus.MustRegister(pdaxAuth.accounts)
+
+	tradeRepository := store.TradeRepository()
+	var tradeArchive *archive.Sink
+	if *c.archiveDir != "" {
+		archiveOptions := []archive.ConfigOption{
+			archive.WithCloseDelay(*c.archiveCloseDelay),
+			archive.WithLogger(logger),
+		}
+		if pruner, ok := store.(archive.Pruner); ok {
+			archiveOptions = append(archiveOptions, archive.WithPruner(pruner, *c.archivePruneAfterDays))
+		} else if *c.archivePruneAfterDays > 0 {
+			level.Warn(logger).Log("msg", "archived trades are not deleted, storage doesn't support it", "driver", *c.storage.driver)
+		}
+		tradeArchive = archive.NewSink(tradeRepository, *c.archiveDir, archiveOptions...)
+		tradeRepository = tradeArchive
+	}
+
+	var publishQueue *publish.Queue
+	if *c.publishDriver != "" {
+		publisher, err := publish.Open(*c.publishDriver, *c.publishURL, *c.publishSubject)
+		if err != nil {
+			level.Error(logger).Log("msg", "publisher setup failed", "err", err)
+			return exitFailure
+		}
+		publishQueue = publish.NewQueue(publisher,
+			publish.WithSize(*c.publishQueueSize),
+			publish.WithDrainTimeout(*c.shutdownDelay),
+			publish.WithMetrics(prometheus.DefaultRegisterer),
+			publish.WithLogger(logger),
+		)
+	}
+
+	instruments := trade.NewInstruments(live.currencyCodes, logger, prometheus.DefaultRegisterer)
+	hub := livefeed.NewHub()
+	monitorOptions := []service.ConfigOption{
+		service.WithAuthService(pdaxAuth.service),
+		service.WithTradeURL(*c.pdax.tradeURL),
+		service.WithTradeRepository(tradeRepository),
+		service.WithOrderRepository(store.OrderRepository()),
+		service.WithInstruments(instruments),
+		service.WithInstrumentView(*c.instrumentView),
+		service.WithOrderBookViews(orderBookViews),
+		service.WithMaintenanceWindows(live.maintenance),
+		service.WithSnapshotPolicy(order.NewSnapshotPolicyFactory(*c.snapshotInterval, *c.snapshotUpdates, *c.snapshotOnTopChange)),
+		service.WithHub(hub),
+		service.WithQueueSize(*c.pipelineQueueSize),
+		service.WithMetrics(prometheus.DefaultRegisterer),
+		service.WithLogger(logger),
+	}
+	if publishQueue != nil {
+		monitorOptions = append(monitorOptions, service.WithPublisher(publishQueue))
+	}
+	if *c.recordFile != "" {
+		f, err := os.OpenFile(*c.recordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			level.Error(logger).Log("msg", "opening websocket record file failed", "err", err)
+			return exitFailure
+		}
+		defer f.Close()
+
+		monitorOptions = append(monitorOptions, service.WithRecorder(websocket.NewRecorder(f)))
+	}
+	tradeMonitor := service.NewMonitorService(monitorOptions...)
+
+	reloader := newConfigReloader(c, secretKey, live, func(live liveConfig) error {
+		if err := setLogLevel(live.logLevel); err != nil {
+			return err
+		}
+		instruments.SetFallback(live.currencyCodes)
+		tradeMonitor.SetMaintenanceWindows(live.maintenance)
+
+		return nil
+	}, logger, prometheus.DefaultRegisterer)
+
+	healthHandler := health.NewHandler(
+		health.WithStatusSource(&tradeMonitor),
+		health.WithDatabase(store),
+		health.WithMaxFrameAge(*c.opsMaxFrameAge),
+		health.WithLogger(logger),
+	)
+	// Expose readiness for orchestrators and detailed status for on-call.
+	http.DefaultServeMux.Handle("/readyz", healthHandler)
+	http.DefaultServeMux.Handle("/status", healthHandler)
+
+	http.DefaultServeMux.Handle("/api/", api.NewHandler(
+		api.WithOrderRepository(store.OrderRepository()),
+		api.WithFindingRepository(store.FindingRepository()),
+		api.WithOrderBookSource(&tradeMonitor),
+		api.WithLogger(logger),
+	))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var g run.Group
+	if *c.grpcAddr != "" {
+		lis, err := net.Listen("tcp", *c.grpcAddr)
+		if err != nil {
+			level.Error(logger).Log("msg", "grpc listen failed", "err", err)
+			cancel()
+			return exitFailure
+		}
+
+		grpcServer := grpc.NewServer()
+		monitorv1.RegisterMonitorServiceServer(grpcServer, grpcapi.NewServer(
+			grpcapi.WithTradeRepository(tradeRepository),
+			grpcapi.WithFXRateRepository(store.FXRateRepository()),
+			grpcapi.WithOrderBookSource(&tradeMonitor),
+			grpcapi.WithInstruments(instruments),
+			grpcapi.WithHub(hub),
+			grpcapi.WithLogger(logger),
+		))
+
+		g.Add(func() error {
+			// It's nice to be able to see panics in Rollbar.
+			defer monitorPanic(logger)
+
+			level.Info(logger).Log("msg", "grpc server is starting", "addr", lis.Addr())
+			return grpcServer.Serve(lis)
+		}, func(_ error) {
+			level.Info(logger).Log("msg", "grpc server was interrupted")
+			// streams of subscribers never end by themselves, so they are not waited for
+			grpcServer.Stop()
+			cancel()
+		})
+	}
+	if *c.liquidityInterval > 0 {
+		sampler := liquidity.NewSampler(
+			&tradeMonitor,
+			liquidity.WithInterval(*c.liquidityInterval),
+			liquidity.WithNotionals(notionals),
+			liquidity.WithRepository(store.BookMetricsRepository()),
+			liquidity.WithLogger(logger),
+		)
+
+		g.Add(func() error {
+			// It's nice to be able to see panics in Rollbar.
+			defer monitorPanic(logger)
+
+			return sampler.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if tradeArchive != nil {
+		g.Add(func() error {
+			return tradeArchive.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if publishQueue != nil {
+		g.Add(func() error {
+			return publishQueue.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if *c.fxProxyInterval > 0 {
+		recorder := fx.NewRecorder(hub, store.TradeRepository(), store.FXRateRepository(),
+			fx.WithPairs(splitList(*c.fxProxyPairs)...),
+			fx.WithInterval(*c.fxProxyInterval),
+			fx.WithLogger(logger),
+		)
+
+		g.Add(func() error {
+			return recorder.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if *c.washTradeInterval > 0 {
+		detector := washtrade.NewDetector(tradeRepository, store.FindingRepository(),
+			washtrade.WithOrderRepository(store.OrderRepository()),
+			washtrade.WithBucket(*c.washTradeInterval),
+			washtrade.WithLogger(logger),
+		)
+
+		g.Add(func() error {
+			return detector.Run(ctx, func() []string {
+				return pairList("", instruments)
+			})
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if *c.reportAt != "" {
+		job := report.NewJob(tradeRepository, func() []string {
+			return c.report.pairList(instruments)
+		}, reportAt,
+			report.WithLocation(reportLocation),
+			report.WithFormat(*c.report.format),
+			report.WithFXRateRepository(store.FXRateRepository()),
+			report.WithSenders(c.report.senders()...),
+			report.WithLogger(logger),
+		)
+
+		g.Add(func() error {
+			return job.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	if *c.captchaBalanceInterval > 0 {
+		g.Add(func() error {
+			return pdaxAuth.solver.MonitorBalance(ctx, *c.captchaBalanceInterval, reloader.CaptchaLowBalance)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	{
+		g.Add(func() error {
+			return reloader.Watch(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log("msg", "trade monitoring is starting")
+
+			err = tradeMonitor.MonitorWithRecovery(ctx, wsInitBook)
+			if err != nil {
+				level.Error(logger).Log("msg", "monitor trades error", "err", err)
+			}
+
+			logger.Log("msg", "trade monitoring stopped")
+			return nil
+		}, func(err error) {
+			logger.Log("msg", "trade monitoring was interrupted", "err", err)
+			cancel()
+		})
+	}
+	{
+		g.Add(func() error {
+			// It's nice to be able to see panics in Rollbar.
+			defer monitorPanic(logger)
+
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			select {
+			case <-ctx.Done():
+				return nil
+			case s := <-sig:
+				message := fmt.Sprintf("signal received (waiting %v before terminating): %v", *c.shutdownDelay, s)
+				level.Info(logger).Log("msg", message)
+				time.Sleep(*c.shutdownDelay)
+				level.Info(logger).Log("msg", "terminating...")
+				return nil
+			}
+		}, func(_ error) {
+			level.Info(logger).Log("msg", "program was interrupted")
+			cancel()
+		})
+	}
+	{
+		g.Add(func() error {
+			// It's nice to be able to see panics in Rollbar.
+			defer monitorPanic(logger)
+
+			level.Info(logger).Log("msg", "ops server is starting", "addr", opsServer.Addr)
+			return opsServer.ListenAndServe()
+		}, func(_ error) {
+			level.Info(logger).Log("msg", "ops server was interrupted")
+
+			defer cancel()
+
+			shErr := opsServer.Shutdown(ctx)
+
+			if shErr != nil {
+				level.Error(logger).Log("msg", "ops server shut down with error", "shErr", shErr)
+			}
+		})
+	}
+
+	err = g.Run()
+	if err != nil {
+		level.Error(logger).Log("msg", "actors stopped gracefully", "err", err)
+		return exitFailure
+	}
+
+	return exitSuccess
+}
+
+func parseViewIDs(s string) ([]float64, error) {
+	var viewIDs []float64
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		id, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid view ID %q: %v", v, err)
+		}
+		viewIDs = append(viewIDs, id)
+	}
+
+	return viewIDs, nil
+}
+
+func parseDecimals(s string) ([]*apd.Decimal, error) {
+	var decimals []*apd.Decimal
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		d, _, err := apd.NewFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimal %q: %v", v, err)
+		}
+		decimals = append(decimals, d)
+	}
+
+	return decimals, nil
+}
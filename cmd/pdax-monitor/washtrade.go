@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/peterbourgon/ff/ffcli"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/washtrade"
+)
+
+const washTradeTimeout = 30 * time.Minute
+
+func washTradeCommand(secretKey []byte) *ffcli.Command {
+	c := newCommand("washtrade", secretKey)
+	store := c.storageFlags()
+	currencyCodesPath := c.fs.String("currencyCodes", "./auxiliary/currencyCodes.json", "Path to the PDAX currency codes file")
+	pairs := c.fs.String("pairs", "", "Comma separated currency pairs to scan, all known pairs by default")
+	fromFlag := c.fs.String("from", "", "Scan trades since the UTC day YYYY-MM-DD, yesterday by default")
+	toFlag := c.fs.String("to", "", "Scan trades till the UTC day YYYY-MM-DD exclusive, now by default")
+	minRun := c.fs.Int("min-run", 5, "Least number of trades of an equal size burst or an aggressor ping-pong")
+
+	return &ffcli.Command{
+		Name:      "washtrade",
+		Usage:     "pdax-monitor washtrade [flags]",
+		ShortHelp: "Detect stored trade patterns which suggest wash trading",
+		LongHelp: "Bursts of equal-sized trades at the same price, alternating aggressor ping-pong, clusters of round " +
+			"quantities and trades which leave top of book unchanged are scored from 0 to 1 and stored as findings, " +
+			"they're listed by /api/v1/findings of ops API. The last check needs order book snapshots taken around trades. " +
+			"Serve command scans trades periodically when washtrade.interval is set.",
+		FlagSet: c.fs,
+		Options: c.options(),
+		Exec: func(args []string) error {
+			if err := c.loadSecretFiles(); err != nil {
+				return err
+			}
+
+			to := time.Now()
+			from := to.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+			var err error
+			if *fromFlag != "" {
+				if from, err = time.Parse("2006-01-02", *fromFlag); err != nil {
+					return fmt.Errorf("invalid from: %v", err)
+				}
+			}
+			if *toFlag != "" {
+				if to, err = time.Parse("2006-01-02", *toFlag); err != nil {
+					return fmt.Errorf("invalid to: %v", err)
+				}
+			}
+
+			currencyCodes, err := trade.LoadCurrencyCodes(*currencyCodesPath)
+			if err != nil {
+				return fmt.Errorf("parsing currencyCodes failed: %v", err)
+			}
+
+			s, err := store.open(log.NewNopLogger())
+			if err != nil {
+				return fmt.Errorf("db connection failed: %v", err)
+			}
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), washTradeTimeout)
+			defer cancel()
+
+			detector := washtrade.NewDetector(s.TradeRepository(), s.FindingRepository(),
+				washtrade.WithOrderRepository(s.OrderRepository()),
+				washtrade.WithRun(*minRun, 0),
+			)
+			findings, err := detector.Scan(ctx, pairList(*pairs, trade.NewInstruments(currencyCodes, nil, nil)), from, to)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range findings {
+				fmt.Printf("%s\t%s\t%s\t%.2f\t%s\n", f.From.UTC().Format(time.RFC3339), f.CurrencyPair, f.Pattern, f.Score, f.Detail)
+			}
+			fmt.Fprintf(os.Stderr, "stored %d findings\n", len(findings))
+
+			return nil
+		},
+	}
+}
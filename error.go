@@ -8,6 +8,33 @@ import (
 const (
 	// ErrorCodeInternal is an internal error code.
 	ErrorCodeInternal = "internal"
+	// ErrorCodeInvalid is an error code for invalid input.
+	ErrorCodeInvalid = "invalid"
+	// ErrorCodeNotFound is an error code for missing records.
+	ErrorCodeNotFound = "not_found"
+
+	// ErrorCodeLoginFailed is an error code for PDAX login failure of unknown reason.
+	ErrorCodeLoginFailed = "login_failed"
+	// ErrorCodeWrongCredentials is an error code for PDAX login rejected due to wrong username or password.
+	ErrorCodeWrongCredentials = "wrong_credentials"
+	// ErrorCodeCaptchaRejected is an error code for PDAX login rejected due to invalid captcha solution.
+	ErrorCodeCaptchaRejected = "captcha_rejected"
+	// ErrorCode2FARequired is an error code for PDAX login requiring two-factor authentication.
+	ErrorCode2FARequired = "2fa_required"
+	// ErrorCodeAccountLocked is an error code for locked, suspended or banned PDAX account.
+	ErrorCodeAccountLocked = "account_locked"
+	// ErrorCodeRateLimited is an error code for PDAX login throttled due to too many attempts.
+	ErrorCodeRateLimited = "rate_limited"
+	// ErrorCodeCaptchaFailed is an error code for captcha which could not be solved this time.
+	ErrorCodeCaptchaFailed = "captcha_failed"
+	// ErrorCodeCaptchaZeroBalance is an error code for captcha solver account running out of funds.
+	ErrorCodeCaptchaZeroBalance = "captcha_zero_balance"
+	// ErrorCodeCaptchaMisconfigured is an error code for captcha solver rejecting the key, IP address or task parameters.
+	ErrorCodeCaptchaMisconfigured = "captcha_misconfigured"
+	// ErrorCodeCaptchaBudgetExceeded is an error code for captcha solves exceeding daily or monthly budget.
+	ErrorCodeCaptchaBudgetExceeded = "captcha_budget_exceeded"
+	// ErrorCodeNoAccounts is an error code for PDAX login impossible as every account is disabled.
+	ErrorCodeNoAccounts = "no_accounts"
 )
 
 // Error represents an error within the context of volume-pdax-monitor service.
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Patterns of trades which suggest wash trading or self-matching.
+const (
+	// PatternEqualSizeBurst is a burst of trades of the same quantity at the same price.
+	PatternEqualSizeBurst = "equal_size_burst"
+	// PatternPingPong is a run of trades of the same quantity whose aggressor side alternates.
+	PatternPingPong = "ping_pong"
+	// PatternRoundNumbers is a cluster of trades of round quantities.
+	PatternRoundNumbers = "round_numbers"
+	// PatternUnchangedTop is a cluster of trades which leave the top of the order book unchanged.
+	PatternUnchangedTop = "unchanged_top"
+)
+
+// Finding is a suspicious pattern of trades of the currency pair made at From or later and at To or earlier.
+type Finding struct {
+	CurrencyPair string
+	Pattern      string
+	From         time.Time
+	To           time.Time
+	Trades       int
+	// Volume is traded base currency quantity.
+	Volume *apd.Decimal
+	// Score tells how suspicious the pattern is from 0 to 1.
+	Score float64
+	// Detail describes the pattern for humans, e.g. the repeated quantity.
+	Detail string
+}
+
+// FindingQuery selects findings which start at From or later and before To with the score of MinScore or higher.
+// Empty CurrencyPair and Pattern select findings of all pairs and patterns.
+type FindingQuery struct {
+	CurrencyPair string
+	Pattern      string
+	From         time.Time
+	To           time.Time
+	MinScore     float64
+	// Limit caps number of returned findings when positive, the earliest findings are returned.
+	Limit int
+}
+
+// Match tells whether the finding is selected by the query.
+func (q FindingQuery) Match(f Finding) bool {
+	return (q.CurrencyPair == "" || f.CurrencyPair == q.CurrencyPair) &&
+		(q.Pattern == "" || f.Pattern == q.Pattern) &&
+		!f.From.Before(q.From) && f.From.Before(q.To) &&
+		f.Score >= q.MinScore
+}
+
+// SortFindings sorts findings by start time, currency pair and pattern.
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if !a.From.Equal(b.From) {
+			return a.From.Before(b.From)
+		}
+		if a.CurrencyPair != b.CurrencyPair {
+			return a.CurrencyPair < b.CurrencyPair
+		}
+		return a.Pattern < b.Pattern
+	})
+}
+
+// FindingRepository is a storage for detected patterns of trades.
+type FindingRepository interface {
+	// Upsert stores the findings, a stored finding of the same pair, pattern and start time is replaced,
+	// so detecting patterns of the same trades again is a no-op.
+	Upsert(ctx context.Context, findings []Finding) error
+	// Findings returns findings matching the query ordered by start time, currency pair and pattern.
+	Findings(ctx context.Context, q FindingQuery) ([]Finding, error)
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+// CurrencyPairUSDPHP is the currency pair of PHP per USD rates.
+const CurrencyPairUSDPHP = "USD-PHP"
+
+// FXRate is the price of the base currency in the quote currency effective from the time till the next rate,
+// e.g. USD-PHP rate 51.5 is 51.5 PHP per USD.
+type FXRate struct {
+	CurrencyPair string
+	Timestamp    time.Time
+	Rate         *apd.Decimal
+	// Source tells where the rate comes from, e.g. csv or proxy.
+	Source string
+}
+
+// FXRateRepository is a storage for currency exchange rates.
+type FXRateRepository interface {
+	// Upsert stores the rates, a stored rate of the same pair, time and source is replaced.
+	Upsert(ctx context.Context, rates []FXRate) error
+	// Rates returns rates of the pair effective within From and To ordered by time: the latest rate
+	// before From followed by rates made at From or later and before To.
+	Rates(ctx context.Context, currencyPair string, from, to time.Time) ([]FXRate, error)
+}
+
+// EffectiveRates sorts rates made before To of a query by time and source, then it drops rates which are
+// not effective at From or later, i.e. all rates made before From but the latest one.
+func EffectiveRates(rates []FXRate, from time.Time) []FXRate {
+	sort.SliceStable(rates, func(i, j int) bool {
+		if !rates[i].Timestamp.Equal(rates[j].Timestamp) {
+			return rates[i].Timestamp.Before(rates[j].Timestamp)
+		}
+		return rates[i].Source < rates[j].Source
+	})
+
+	first := sort.Search(len(rates), func(i int) bool {
+		return !rates[i].Timestamp.Before(from)
+	})
+	if first > 0 {
+		first--
+	}
+
+	return rates[first:]
+}
+
+// FXRates is a series of rates of one currency pair ordered by time.
+type FXRates []FXRate
+
+// At returns the rate effective at the time, i.e. the latest rate at or before it.
+func (r FXRates) At(t time.Time) (*apd.Decimal, bool) {
+	i := sort.Search(len(r), func(i int) bool {
+		return r[i].Timestamp.After(t)
+	})
+	if i == 0 {
+		return nil, false
+	}
+
+	return r[i-1].Rate, true
+}
+
+// NotionalUSD converts notional of the PHP quoted trade into USD at the trade time, the rates must be USD-PHP rates.
+// Trades of other quote currencies and trades made before the first rate are not converted.
+func (r FXRates) NotionalUSD(t Trade) (*apd.Decimal, bool) {
+	if !strings.HasSuffix(t.CurrencyPair, "-PHP") {
+		return nil, false
+	}
+	rate, ok := r.At(t.Timestamp)
+	if !ok || rate.Sign() <= 0 {
+		return nil, false
+	}
+
+	ctx := decimalContext()
+	usd := new(apd.Decimal)
+	ctx.Mul(usd, t.Price, t.Quantity)
+	ctx.Quo(usd, usd, rate)
+
+	return usd, true
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectiveRates(t *testing.T) {
+	from := time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC)
+	rate := func(ts time.Time, source string) FXRate {
+		return FXRate{CurrencyPair: CurrencyPairUSDPHP, Timestamp: ts, Source: source}
+	}
+
+	tests := []struct {
+		name  string
+		rates []FXRate
+		want  []FXRate
+	}{
+		{"none", nil, nil},
+		{
+			"latest before from kept",
+			[]FXRate{rate(from.Add(time.Hour), "csv"), rate(from.Add(-2*time.Hour), "csv"), rate(from.Add(-time.Hour), "csv")},
+			[]FXRate{rate(from.Add(-time.Hour), "csv"), rate(from.Add(time.Hour), "csv")},
+		},
+		{
+			"at from",
+			[]FXRate{rate(from, "csv"), rate(from.Add(-time.Hour), "csv")},
+			[]FXRate{rate(from.Add(-time.Hour), "csv"), rate(from, "csv")},
+		},
+		{
+			"only before from",
+			[]FXRate{rate(from.Add(-2*time.Hour), "csv"), rate(from.Add(-time.Hour), "proxy")},
+			[]FXRate{rate(from.Add(-time.Hour), "proxy")},
+		},
+		{
+			"same time by source",
+			[]FXRate{rate(from, "proxy"), rate(from, "csv"), rate(from.Add(time.Hour), "bsp")},
+			[]FXRate{rate(from, "csv"), rate(from, "proxy"), rate(from.Add(time.Hour), "bsp")},
+		},
+	}
+
+	for _, tc := range tests {
+		got := EffectiveRates(tc.rates, from)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: EffectiveRates() = %+v, want %+v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Timestamp.Equal(tc.want[i].Timestamp) || got[i].Source != tc.want[i].Source {
+				t.Errorf("%s: rate %d = %v %s, want %v %s", tc.name, i, got[i].Timestamp, got[i].Source, tc.want[i].Timestamp, tc.want[i].Source)
+			}
+		}
+	}
+}
+
+func TestFXRatesAt(t *testing.T) {
+	start := time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC)
+	rates := FXRates{
+		{CurrencyPair: CurrencyPairUSDPHP, Timestamp: start, Rate: testDecimal(t, "50")},
+		{CurrencyPair: CurrencyPairUSDPHP, Timestamp: start.Add(time.Hour), Rate: testDecimal(t, "51")},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{start.Add(-time.Nanosecond), ""},
+		{start, "50"},
+		{start.Add(time.Hour - time.Nanosecond), "50"},
+		{start.Add(time.Hour), "51"},
+		{start.AddDate(1, 0, 0), "51"},
+	}
+
+	for _, tc := range tests {
+		got, ok := rates.At(tc.at)
+		switch {
+		case tc.want == "" && ok:
+			t.Errorf("At(%v) = %s, want no rate", tc.at, got)
+		case tc.want != "" && (!ok || got.Cmp(testDecimal(t, tc.want)) != 0):
+			t.Errorf("At(%v) = %v, %v, want %s", tc.at, got, ok, tc.want)
+		}
+	}
+	if _, ok := FXRates(nil).At(start); ok {
+		t.Error("At() of no rates found a rate")
+	}
+}
+
+func TestFXRatesNotionalUSD(t *testing.T) {
+	start := time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC)
+	rates := FXRates{
+		{CurrencyPair: CurrencyPairUSDPHP, Timestamp: start, Rate: testDecimal(t, "50")},
+		{CurrencyPair: CurrencyPairUSDPHP, Timestamp: start.Add(time.Hour), Rate: testDecimal(t, "0")},
+	}
+	trade := func(pair string, ts time.Time) Trade {
+		return Trade{CurrencyPair: pair, Price: testDecimal(t, "2500000"), Quantity: testDecimal(t, "0.01"), Timestamp: ts}
+	}
+
+	tests := []struct {
+		name  string
+		trade Trade
+		want  string
+	}{
+		{"php pair", trade("BTC-PHP", start.Add(time.Minute)), "500"},
+		{"other quote", trade("BTC-USDT", start.Add(time.Minute)), ""},
+		{"before the first rate", trade("BTC-PHP", start.Add(-time.Minute)), ""},
+		{"zero rate", trade("BTC-PHP", start.Add(time.Hour)), ""},
+	}
+
+	for _, tc := range tests {
+		got, ok := rates.NotionalUSD(tc.trade)
+		switch {
+		case tc.want == "" && ok:
+			t.Errorf("%s: NotionalUSD() = %s, want none", tc.name, got)
+		case tc.want != "" && (!ok || got.Cmp(testDecimal(t, tc.want)) != 0):
+			t.Errorf("%s: NotionalUSD() = %v, %v, want %s", tc.name, got, ok, tc.want)
+		}
+	}
+}
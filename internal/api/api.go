@@ -0,0 +1,333 @@
+// Package api exposes collected PDAX market data over HTTP.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// maxFindings is the most findings returned at once.
+const maxFindings = 1000
+
+// OrderBookSource provides live order books.
+type OrderBookSource interface {
+	OrderBook(currencyPair string) (monitor.OrderBook, bool)
+}
+
+// Handler serves read-only HTTP API.
+type Handler struct {
+	OrderRepository   monitor.OrderRepository
+	FindingRepository monitor.FindingRepository
+	OrderBooks        OrderBookSource
+	Logger            log.Logger
+	mux               *http.ServeMux
+}
+
+// NewHandler instantiates Handler.
+func NewHandler(options ...ConfigOption) *Handler {
+	h := Handler{
+		Logger: log.NewNopLogger(),
+		mux:    http.NewServeMux(),
+	}
+
+	for _, opt := range options {
+		opt(&h)
+	}
+
+	h.mux.HandleFunc("/api/v1/orderbook", h.orderBook)
+	h.mux.HandleFunc("/api/v1/orderbook/live", h.liveOrderBook)
+	h.mux.HandleFunc("/api/v1/findings", h.findings)
+
+	return &h
+}
+
+// ConfigOption configures the handler.
+type ConfigOption func(*Handler)
+
+// WithLogger configures a logger to debug the handler.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(h *Handler) {
+		h.Logger = l
+	}
+}
+
+// WithOrderRepository configures order repository to read order book snapshots from.
+func WithOrderRepository(rep monitor.OrderRepository) ConfigOption {
+	return func(h *Handler) {
+		h.OrderRepository = rep
+	}
+}
+
+// WithFindingRepository configures repository of detected patterns of trades.
+func WithFindingRepository(rep monitor.FindingRepository) ConfigOption {
+	return func(h *Handler) {
+		h.FindingRepository = rep
+	}
+}
+
+// WithOrderBookSource configures source of live order books.
+func WithOrderBookSource(src OrderBookSource) ConfigOption {
+	return func(h *Handler) {
+		h.OrderBooks = src
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type bookLevel struct {
+	Price    string `json:"price"`
+	Quantity string `json:"quantity"`
+	Orders   int    `json:"orders,omitempty"`
+}
+
+type liquidityResponse struct {
+	CurrencyPair string      `json:"currencyPair"`
+	DepthPercent float64     `json:"depthPercent"`
+	BestBid      *bookLevel  `json:"bestBid"`
+	BestAsk      *bookLevel  `json:"bestAsk"`
+	Spread       *string     `json:"spread"`
+	Mid          *string     `json:"mid"`
+	BidDepth     *string     `json:"bidDepth"`
+	AskDepth     *string     `json:"askDepth"`
+	Imbalance    *string     `json:"imbalance"`
+	Bids         []bookLevel `json:"bids"`
+	Asks         []bookLevel `json:"asks"`
+}
+
+type orderBookResponse struct {
+	CurrencyPair string      `json:"currencyPair"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Bids         []bookLevel `json:"bids"`
+	Asks         []bookLevel `json:"asks"`
+}
+
+// orderBook responds with the order book snapshot of the pair as of the given time, e.g.
+// GET /api/v1/orderbook?pair=BTC-PHP&at=2022-03-01T10:00:00Z. The latest snapshot is returned when at is omitted.
+func (h *Handler) orderBook(w http.ResponseWriter, r *http.Request) {
+	pair := r.URL.Query().Get("pair")
+	if pair == "" {
+		h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "pair is required"})
+		return
+	}
+
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "at must be RFC3339 timestamp", Inner: err})
+			return
+		}
+	}
+
+	snapshot, err := h.OrderRepository.BookAt(r.Context(), pair, at)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := orderBookResponse{
+		CurrencyPair: snapshot.CurrencyPair,
+		Timestamp:    snapshot.Timestamp,
+		Bids:         []bookLevel{},
+		Asks:         []bookLevel{},
+	}
+	for _, l := range snapshot.Levels {
+		level := newBookLevel(l)
+		if l.Side == monitor.SideBid {
+			resp.Bids = append(resp.Bids, level)
+		} else {
+			resp.Asks = append(resp.Asks, level)
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// liveOrderBook responds with the aggregated live order book of the pair and its liquidity figures, e.g.
+// GET /api/v1/orderbook/live?pair=BTC-PHP&depth=1 where depth is a percent off the mid price (1 by default).
+func (h *Handler) liveOrderBook(w http.ResponseWriter, r *http.Request) {
+	pair := r.URL.Query().Get("pair")
+	if pair == "" {
+		h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "pair is required"})
+		return
+	}
+
+	depth := 1.0
+	if v := r.URL.Query().Get("depth"); v != "" {
+		var err error
+		if depth, err = strconv.ParseFloat(v, 64); err != nil || depth <= 0 {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "depth must be a positive percent", Inner: err})
+			return
+		}
+	}
+
+	if h.OrderBooks == nil {
+		h.writeError(w, monitor.Error{Code: monitor.ErrorCodeNotFound, Message: "order books are not tracked"})
+		return
+	}
+	book, ok := h.OrderBooks.OrderBook(pair)
+	if !ok {
+		h.writeError(w, monitor.Error{Code: monitor.ErrorCodeNotFound, Message: "order book not found"})
+		return
+	}
+
+	l2 := book.L2()
+	resp := liquidityResponse{
+		CurrencyPair: pair,
+		DepthPercent: depth,
+		Bids:         make([]bookLevel, 0, len(l2.Bids)),
+		Asks:         make([]bookLevel, 0, len(l2.Asks)),
+	}
+	if l, ok := l2.BestBid(); ok {
+		level := newBookLevel(l)
+		resp.BestBid = &level
+	}
+	if l, ok := l2.BestAsk(); ok {
+		level := newBookLevel(l)
+		resp.BestAsk = &level
+	}
+	if d, ok := l2.Spread(); ok {
+		resp.Spread = decimalString(d)
+	}
+	if d, ok := l2.Mid(); ok {
+		resp.Mid = decimalString(d)
+	}
+	if bids, asks, ok := l2.Depth(depth); ok {
+		resp.BidDepth, resp.AskDepth = decimalString(bids), decimalString(asks)
+	}
+	if d, ok := l2.Imbalance(depth); ok {
+		resp.Imbalance = decimalString(d)
+	}
+	for _, l := range l2.Bids {
+		resp.Bids = append(resp.Bids, newBookLevel(l))
+	}
+	for _, l := range l2.Asks {
+		resp.Asks = append(resp.Asks, newBookLevel(l))
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+type finding struct {
+	CurrencyPair string    `json:"currencyPair"`
+	Pattern      string    `json:"pattern"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Trades       int       `json:"trades"`
+	Volume       string    `json:"volume"`
+	Score        float64   `json:"score"`
+	Detail       string    `json:"detail"`
+}
+
+// findings responds with findings of wash trade detection which start within the time range ordered by time, e.g.
+// GET /api/v1/findings?pair=BTC-PHP&pattern=ping_pong&from=2022-03-01T00:00:00Z&minScore=0.5&limit=100.
+// All the parameters are optional, findings of the last 24 hours are returned by default, 1000 at most.
+func (h *Handler) findings(w http.ResponseWriter, r *http.Request) {
+	if h.FindingRepository == nil {
+		h.writeError(w, monitor.Error{Code: monitor.ErrorCodeNotFound, Message: "findings are not stored"})
+		return
+	}
+
+	params := r.URL.Query()
+	q := monitor.FindingQuery{
+		CurrencyPair: params.Get("pair"),
+		Pattern:      params.Get("pattern"),
+		To:           time.Now(),
+		Limit:        maxFindings,
+	}
+	var err error
+	if v := params.Get("to"); v != "" {
+		if q.To, err = time.Parse(time.RFC3339, v); err != nil {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "to must be RFC3339 timestamp", Inner: err})
+			return
+		}
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if v := params.Get("from"); v != "" {
+		if q.From, err = time.Parse(time.RFC3339, v); err != nil {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "from must be RFC3339 timestamp", Inner: err})
+			return
+		}
+	}
+	if v := params.Get("minScore"); v != "" {
+		if q.MinScore, err = strconv.ParseFloat(v, 64); err != nil {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "minScore must be a number", Inner: err})
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > maxFindings {
+			h.writeError(w, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "limit must be within 1 and 1000", Inner: err})
+			return
+		}
+	}
+
+	found, err := h.FindingRepository.Findings(r.Context(), q)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := make([]finding, 0, len(found))
+	for _, f := range found {
+		resp = append(resp, finding{
+			CurrencyPair: f.CurrencyPair,
+			Pattern:      f.Pattern,
+			From:         f.From,
+			To:           f.To,
+			Trades:       f.Trades,
+			Volume:       f.Volume.Text('f'),
+			Score:        f.Score,
+			Detail:       f.Detail,
+		})
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func newBookLevel(l monitor.BookLevel) bookLevel {
+	return bookLevel{Price: l.Price.String(), Quantity: l.Quantity.String(), Orders: l.Orders}
+}
+
+func decimalString(d *apd.Decimal) *string {
+	s := d.String()
+	return &s
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Warn(h.Logger).Log("msg", "failed to write response", "err", err)
+	}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	var status int
+	switch monitor.ErrorCode(err) {
+	case monitor.ErrorCodeInvalid:
+		status = http.StatusBadRequest
+	case monitor.ErrorCodeNotFound:
+		status = http.StatusNotFound
+	default:
+		level.Error(h.Logger).Log("msg", "api request failed", "err", err)
+		err = monitor.Error{Code: monitor.ErrorCodeInternal, Message: "internal error"}
+		status = http.StatusInternalServerError
+	}
+
+	var e monitor.Error
+	errors.As(err, &e)
+	h.writeJSON(w, status, e)
+}
@@ -0,0 +1,375 @@
+// Package archive writes trades of every UTC day per currency pair into immutable Parquet files,
+// e.g. date=2022-03-01/BTC-PHP.parquet. Trades are staged in an append-only file of their day first,
+// so no trade is lost on restart, and the day is compacted into Parquet files once it's over.
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	dayLayout      = "2006-01-02"
+	dayDirPrefix   = "date="
+	stagingDir     = "staging"
+	stagingExt     = ".ndjson"
+	prunedMarker   = "_PRUNED"
+	compactedFile  = "_SUCCESS"
+	checkInterval  = time.Minute
+	maxStagingLine = 1 << 20
+)
+
+// Pruner deletes archived trades from the primary storage.
+type Pruner interface {
+	// DeleteTrades deletes the trades matched the way TradeRepository.Upsert matches them
+	// and returns the number of deleted trades.
+	DeleteTrades(ctx context.Context, trades []monitor.Trade) (int64, error)
+}
+
+// Sink is a TradeRepository which stores trades in the next repository and stages them for the archive.
+// Trades are archived even when the next repository fails to store them.
+type Sink struct {
+	next       monitor.TradeRepository
+	dir        string
+	closeDelay time.Duration
+	pruner     Pruner
+	pruneAfter int
+	logger     log.Logger
+
+	mu         sync.Mutex
+	stagingDay string
+	staging    *os.File
+}
+
+// NewSink instantiates Sink archiving into the directory.
+func NewSink(next monitor.TradeRepository, dir string, options ...ConfigOption) *Sink {
+	s := Sink{
+		next:       next,
+		dir:        dir,
+		closeDelay: 5 * time.Minute,
+		logger:     log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the sink.
+type ConfigOption func(*Sink)
+
+// WithLogger configures a logger to debug the sink.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *Sink) {
+		s.logger = l
+	}
+}
+
+// WithCloseDelay configures how long after UTC midnight the past day is compacted, trades of the day
+// received later are not archived.
+func WithCloseDelay(d time.Duration) ConfigOption {
+	return func(s *Sink) {
+		s.closeDelay = d
+	}
+}
+
+// WithPruner configures deletion of archived trades from the primary storage once their day is
+// the given number of days old (0 disables deletion). Trades which are not in the archive are kept.
+func WithPruner(p Pruner, days int) ConfigOption {
+	return func(s *Sink) {
+		s.pruner = p
+		s.pruneAfter = days
+	}
+}
+
+// Insert stores the trade in the next repository and stages it for the archive.
+func (s *Sink) Insert(ctx context.Context, t *monitor.Trade) error {
+	err := s.next.Insert(ctx, t)
+	if serr := s.stage(*t); serr != nil {
+		level.Error(s.logger).Log("msg", "failed to stage trade for archive", "err", serr)
+	}
+
+	return err
+}
+
+// Upsert stores the trades in the next repository only, imported history is not archived and so never pruned.
+func (s *Sink) Upsert(ctx context.Context, trades []monitor.Trade, dryRun bool) (monitor.TradeImport, error) {
+	return s.next.Upsert(ctx, trades, dryRun)
+}
+
+// Trades reads trades from the next repository, trades pruned after archiving are not returned.
+func (s *Sink) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	return s.next.Trades(ctx, q)
+}
+
+func (s *Sink) stage(t monitor.Trade) error {
+	day := t.Timestamp.UTC().Format(dayLayout)
+	if s.archived(day) {
+		level.Warn(s.logger).Log("msg", "trade of archived day is not archived, it's kept in the storage",
+			"day", day, "id", t.ID, "pair", t.CurrencyPair)
+		return nil
+	}
+
+	line, err := json.Marshal(newStagedTrade(t))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.staging == nil || s.stagingDay != day {
+		if err = os.MkdirAll(filepath.Join(s.dir, stagingDir), 0o750); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.stagingPath(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return err
+		}
+		if s.staging != nil {
+			s.staging.Close()
+		}
+		s.staging, s.stagingDay = f, day
+	}
+
+	_, err = s.staging.Write(append(line, '\n'))
+
+	return err
+}
+
+// Run compacts every staged day which is over, then checks for finished days every minute
+// till the context is canceled.
+func (s *Sink) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.CompactFinished(ctx, time.Now()); err != nil {
+			level.Error(s.logger).Log("msg", "trade archive compaction failed", "err", err)
+		}
+		s.prune(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.staging != nil {
+				return s.staging.Close()
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CompactFinished compacts staged days which ended at least close delay before now.
+func (s *Sink) CompactFinished(ctx context.Context, now time.Time) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, stagingDir, "*"+stagingExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		day := strings.TrimSuffix(filepath.Base(path), stagingExt)
+		start, err := time.Parse(dayLayout, day)
+		if err != nil {
+			level.Warn(s.logger).Log("msg", "unexpected file in archive staging directory", "path", path)
+			continue
+		}
+		if now.Before(start.Add(24*time.Hour + s.closeDelay)) {
+			continue
+		}
+
+		if err = s.compact(day); err != nil {
+			return fmt.Errorf("day %s: %v", day, err)
+		}
+	}
+
+	return nil
+}
+
+// compact writes staged trades of the day sorted by time and deduplicated into Parquet file per pair,
+// then removes the staging file. Files are written into a temporary directory renamed once complete,
+// so a day directory is either complete or missing.
+func (s *Sink) compact(day string) error {
+	s.mu.Lock()
+	if s.stagingDay == day && s.staging != nil {
+		s.staging.Close()
+		s.staging, s.stagingDay = nil, ""
+	}
+	s.mu.Unlock()
+
+	dayDir := s.dayDir(day)
+	if exists(filepath.Join(dayDir, compactedFile)) { // a crash left the staging file of the compacted day behind
+		level.Info(s.logger).Log("msg", "trade archive day already compacted, removing its staging file", "day", day)
+		return os.Remove(s.stagingPath(day))
+	}
+
+	trades, err := readStaged(s.stagingPath(day))
+	if err != nil {
+		return err
+	}
+
+	byPair := make(map[string][]monitor.Trade)
+	seen := make(map[string]bool, len(trades))
+	for _, t := range trades {
+		if key := t.Key(); !seen[key] {
+			seen[key] = true
+			byPair[t.CurrencyPair] = append(byPair[t.CurrencyPair], t)
+		}
+	}
+
+	tmpDir := dayDir + ".tmp"
+	if err = os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(tmpDir, 0o750); err != nil {
+		return err
+	}
+
+	for pair, pairTrades := range byPair {
+		sort.SliceStable(pairTrades, func(i, j int) bool {
+			return pairTrades[i].Timestamp.Before(pairTrades[j].Timestamp)
+		})
+		if err = writeParquet(filepath.Join(tmpDir, pair+".parquet"), pairTrades); err != nil {
+			return fmt.Errorf("failed to write %s trades: %v", pair, err)
+		}
+	}
+	if err = os.WriteFile(filepath.Join(tmpDir, compactedFile), nil, 0o640); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpDir, dayDir); err != nil {
+		return err
+	}
+	if err = os.Remove(s.stagingPath(day)); err != nil {
+		return err
+	}
+	level.Info(s.logger).Log("msg", "trade archive day compacted", "day", day, "trades", len(seen), "pairs", len(byPair))
+
+	return nil
+}
+
+// prune deletes trades of archived days older than prune days from the primary storage, pruned days are marked.
+// Only trades read back from the day's Parquet files are deleted, so imported or late trades are kept.
+func (s *Sink) prune(ctx context.Context, now time.Time) {
+	if s.pruner == nil || s.pruneAfter <= 0 {
+		return
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(s.dir, dayDirPrefix+"*"))
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to list archived days", "err", err)
+		return
+	}
+
+	cutoff := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -s.pruneAfter)
+	for _, dir := range dirs {
+		day := strings.TrimPrefix(filepath.Base(dir), dayDirPrefix)
+		start, err := time.Parse(dayLayout, day)
+		if err != nil || !start.Before(cutoff) || !exists(filepath.Join(dir, compactedFile)) ||
+			exists(filepath.Join(dir, prunedMarker)) {
+			continue
+		}
+
+		trades, err := readDay(dir)
+		if err != nil {
+			level.Error(s.logger).Log("msg", "failed to read archived day", "day", day, "err", err)
+			return
+		}
+		n, err := s.pruner.DeleteTrades(ctx, trades)
+		if err != nil {
+			level.Error(s.logger).Log("msg", "failed to delete archived trades", "day", day, "err", err)
+			return
+		}
+		if err = os.WriteFile(filepath.Join(dir, prunedMarker), nil, 0o640); err != nil {
+			level.Error(s.logger).Log("msg", "failed to mark archived day pruned", "day", day, "err", err)
+			return
+		}
+		level.Info(s.logger).Log("msg", "archived trades deleted", "day", day, "trades", n)
+	}
+}
+
+func (s *Sink) archived(day string) bool {
+	return exists(s.dayDir(day))
+}
+
+func (s *Sink) dayDir(day string) string {
+	return filepath.Join(s.dir, dayDirPrefix+day)
+}
+
+func (s *Sink) stagingPath(day string) string {
+	return filepath.Join(s.dir, stagingDir, day+stagingExt)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// stagedTrade is a line of the staging file, decimals are strings to keep them exact.
+type stagedTrade struct {
+	ID           int64     `json:"id,omitempty"`
+	CurrencyPair string    `json:"pair"`
+	Price        string    `json:"price"`
+	Quantity     string    `json:"quantity"`
+	Timestamp    time.Time `json:"ts"`
+	Side         uint8     `json:"side"`
+}
+
+func newStagedTrade(t monitor.Trade) stagedTrade {
+	return stagedTrade{
+		ID:           t.ID,
+		CurrencyPair: t.CurrencyPair,
+		Price:        t.Price.Text('f'),
+		Quantity:     t.Quantity.Text('f'),
+		Timestamp:    t.Timestamp,
+		Side:         t.Side,
+	}
+}
+
+// readStaged reads trades of the staging file, a line torn by a crash is skipped.
+func readStaged(path string) ([]monitor.Trade, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var trades []monitor.Trade
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxStagingLine)
+	for scanner.Scan() {
+		var st stagedTrade
+		if err = json.Unmarshal(scanner.Bytes(), &st); err != nil {
+			continue
+		}
+
+		t := monitor.Trade{ID: st.ID, CurrencyPair: st.CurrencyPair, Timestamp: st.Timestamp, Side: st.Side}
+		if t.Price, _, err = apd.NewFromString(st.Price); err != nil {
+			continue
+		}
+		if t.Quantity, _, err = apd.NewFromString(st.Quantity); err != nil {
+			continue
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, scanner.Err()
+}
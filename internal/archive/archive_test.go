@@ -0,0 +1,159 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+)
+
+var testDay = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCompactFinished(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSink(memory.NewStorage().TradeRepository(), dir, WithCloseDelay(5*time.Minute))
+	insert(t, s,
+		testTrade(2, "BTC-PHP", "2500000.5", "0.01", testDay.Add(2*time.Hour)),
+		testTrade(1, "BTC-PHP", "2500000", "0.02", testDay.Add(time.Hour)),
+		testTrade(1, "BTC-PHP", "2500000", "0.02", testDay.Add(time.Hour)), // duplicate
+		testTrade(3, "ETH-PHP", "150000", "1.5", testDay.Add(3*time.Hour)),
+		testTrade(4, "ETH-PHP", "150100", "2", testDay.Add(24*time.Hour)), // next day
+	)
+
+	if err := s.CompactFinished(context.Background(), testDay.Add(24*time.Hour+time.Minute)); err != nil {
+		t.Fatalf("CompactFinished() before close delay error = %v", err)
+	}
+	if exists(s.dayDir("2022-03-01")) {
+		t.Fatal("day compacted before close delay")
+	}
+
+	if err := s.CompactFinished(context.Background(), testDay.Add(24*time.Hour+5*time.Minute)); err != nil {
+		t.Fatalf("CompactFinished() error = %v", err)
+	}
+	if exists(s.stagingPath("2022-03-01")) {
+		t.Error("staging file of compacted day is not removed")
+	}
+	if !exists(s.stagingPath("2022-03-02")) {
+		t.Error("staging file of unfinished day is removed")
+	}
+
+	btc, err := readParquet(filepath.Join(s.dayDir("2022-03-01"), "BTC-PHP.parquet"))
+	if err != nil {
+		t.Fatalf("readParquet() error = %v", err)
+	}
+	if len(btc) != 2 || btc[0].ID != 1 || btc[1].ID != 2 {
+		t.Fatalf("got BTC-PHP trades %+v, want deduplicated trades 1, 2 sorted by time", btc)
+	}
+	want := testTrade(2, "BTC-PHP", "2500000.5", "0.01", testDay.Add(2*time.Hour))
+	if got := btc[1]; got.Key() != want.Key() || !got.Timestamp.Equal(want.Timestamp) || got.Price.Cmp(want.Price) != 0 ||
+		got.Quantity.Cmp(want.Quantity) != 0 || got.Side != want.Side {
+		t.Errorf("got trade %+v, want %+v", got, want)
+	}
+
+	eth, err := readParquet(filepath.Join(s.dayDir("2022-03-01"), "ETH-PHP.parquet"))
+	if err != nil || len(eth) != 1 {
+		t.Fatalf("got ETH-PHP trades %+v, error %v, want 1 trade", eth, err)
+	}
+}
+
+func TestCompactAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSink(memory.NewStorage().TradeRepository(), dir, WithCloseDelay(0))
+	insert(t, s, testTrade(1, "BTC-PHP", "2500000", "0.02", testDay.Add(time.Hour)))
+
+	staged, err := os.ReadFile(s.stagingPath("2022-03-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.CompactFinished(context.Background(), testDay.Add(25*time.Hour)); err != nil {
+		t.Fatalf("CompactFinished() error = %v", err)
+	}
+
+	// the process crashed after the day directory was renamed, but before the staging file was removed
+	if err = os.WriteFile(s.stagingPath("2022-03-01"), staged, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = s.CompactFinished(context.Background(), testDay.Add(25*time.Hour)); err != nil {
+			t.Fatalf("CompactFinished() after crash error = %v", err)
+		}
+	}
+	if exists(s.stagingPath("2022-03-01")) {
+		t.Error("staging file of compacted day is not removed")
+	}
+	if trades, err := readDay(s.dayDir("2022-03-01")); err != nil || len(trades) != 1 {
+		t.Errorf("got archived trades %+v, error %v, want 1 trade", trades, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	pruner := &fakePruner{}
+	s := NewSink(memory.NewStorage().TradeRepository(), dir, WithCloseDelay(0), WithPruner(pruner, 2))
+	insert(t, s,
+		testTrade(1, "BTC-PHP", "2500000", "0.02", testDay.Add(time.Hour)),
+		testTrade(2, "ETH-PHP", "150000", "1.5", testDay.Add(2*time.Hour)),
+	)
+	if err := s.CompactFinished(context.Background(), testDay.Add(25*time.Hour)); err != nil {
+		t.Fatalf("CompactFinished() error = %v", err)
+	}
+
+	// imported and late trades of the archived day are stored, but not archived
+	imported := testTrade(0, "BTC-PHP", "2400000", "0.1", testDay.Add(4*time.Hour))
+	if _, err := s.Upsert(context.Background(), []monitor.Trade{imported}, false); err != nil {
+		t.Fatal(err)
+	}
+	insert(t, s, testTrade(3, "BTC-PHP", "2500100", "0.03", testDay.Add(5*time.Hour)))
+
+	s.prune(context.Background(), testDay.Add(49*time.Hour))
+	if len(pruner.deleted) != 0 {
+		t.Fatalf("pruned %v before the day is 2 days old", pruner.deleted)
+	}
+
+	s.prune(context.Background(), testDay.Add(72*time.Hour))
+	sort.Strings(pruner.deleted)
+	if len(pruner.deleted) != 2 || pruner.deleted[0] != "1" || pruner.deleted[1] != "2" {
+		t.Fatalf("pruned trades %v, want only archived trades 1 and 2", pruner.deleted)
+	}
+	if !exists(filepath.Join(s.dayDir("2022-03-01"), prunedMarker)) {
+		t.Error("pruned day is not marked")
+	}
+
+	s.prune(context.Background(), testDay.Add(96*time.Hour))
+	if len(pruner.deleted) != 2 {
+		t.Errorf("pruned day is pruned again: %v", pruner.deleted)
+	}
+}
+
+// fakePruner records keys of deleted trades.
+type fakePruner struct {
+	deleted []string
+}
+
+func (p *fakePruner) DeleteTrades(_ context.Context, trades []monitor.Trade) (int64, error) {
+	for _, t := range trades {
+		p.deleted = append(p.deleted, t.Key())
+	}
+	return int64(len(trades)), nil
+}
+
+func insert(t *testing.T, s *Sink, trades ...monitor.Trade) {
+	t.Helper()
+	for i := range trades {
+		if err := s.Insert(context.Background(), &trades[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testTrade(id int64, pair, price, quantity string, ts time.Time) monitor.Trade {
+	p, _, _ := apd.NewFromString(price)
+	q, _, _ := apd.NewFromString(quantity)
+	return monitor.Trade{ID: id, CurrencyPair: pair, Price: p, Quantity: q, Timestamp: ts, Side: monitor.SideAsk}
+}
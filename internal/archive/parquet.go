@@ -0,0 +1,174 @@
+package archive
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// decimalScale is the number of fractional digits of archived prices and quantities, longer ones are rounded.
+const decimalScale = 10
+
+// row is the Parquet schema of archived trades. Price and quantity are DECIMAL(38, 10) stored as
+// big-endian two's complement unscaled integers, timestamp is UTC.
+type row struct {
+	ID        int64  `parquet:"name=trade_id, type=INT64"`
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Price     string `parquet:"name=price, type=BYTE_ARRAY, convertedtype=DECIMAL, scale=10, precision=38"`
+	Quantity  string `parquet:"name=quantity, type=BYTE_ARRAY, convertedtype=DECIMAL, scale=10, precision=38"`
+	Side      int32  `parquet:"name=side, type=INT32, convertedtype=UINT_8"`
+}
+
+func writeParquet(path string, trades []monitor.Trade) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pw, err := writer.NewParquetWriterFromWriter(f, new(row), 1)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, t := range trades {
+		price, err := decimalBytes(t.Price)
+		if err != nil {
+			return fmt.Errorf("trade %d price: %v", t.ID, err)
+		}
+		quantity, err := decimalBytes(t.Quantity)
+		if err != nil {
+			return fmt.Errorf("trade %d quantity: %v", t.ID, err)
+		}
+
+		err = pw.Write(row{
+			ID:        t.ID,
+			Timestamp: t.Timestamp.UnixMicro(),
+			Price:     price,
+			Quantity:  quantity,
+			Side:      int32(t.Side),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = pw.WriteStop(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// readDay reads trades of all pairs of the archived day directory.
+func readDay(dir string) ([]monitor.Trade, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []monitor.Trade
+	for _, path := range paths {
+		pairTrades, err := readParquet(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		trades = append(trades, pairTrades...)
+	}
+
+	return trades, nil
+}
+
+// readParquet reads trades of the pair file written by writeParquet.
+func readParquet(path string) ([]monitor.Trade, error) {
+	f, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pr, err := reader.NewParquetReader(f, new(row), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	rows := make([]row, pr.GetNumRows())
+	if err = pr.Read(&rows); err != nil {
+		return nil, err
+	}
+
+	pair := strings.TrimSuffix(filepath.Base(path), ".parquet")
+	trades := make([]monitor.Trade, len(rows))
+	for i, r := range rows {
+		trades[i] = monitor.Trade{
+			ID:           r.ID,
+			CurrencyPair: pair,
+			Price:        bytesDecimal(r.Price),
+			Quantity:     bytesDecimal(r.Quantity),
+			Timestamp:    time.UnixMicro(r.Timestamp).UTC(),
+			Side:         uint8(r.Side),
+		}
+	}
+
+	return trades, nil
+}
+
+// decimalBytes encodes the decimal rounded to decimalScale as big-endian two's complement unscaled integer.
+func decimalBytes(d *apd.Decimal) (string, error) {
+	var scaled apd.Decimal
+	if _, err := apd.BaseContext.WithPrecision(38).Quantize(&scaled, d, -decimalScale); err != nil {
+		return "", err
+	}
+
+	unscaled := new(big.Int).Set(&scaled.Coeff)
+	if scaled.Negative {
+		unscaled.Neg(unscaled)
+	}
+
+	return string(twosComplement(unscaled)), nil
+}
+
+// bytesDecimal decodes the decimal encoded by decimalBytes.
+func bytesDecimal(b string) *apd.Decimal {
+	n := new(big.Int).SetBytes([]byte(b))
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+
+	d := &apd.Decimal{Exponent: -decimalScale, Negative: n.Sign() < 0}
+	d.Coeff.Abs(n)
+
+	return d
+}
+
+func twosComplement(n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+
+	// -n = 2^bits - |n| with enough bits to keep the sign bit set
+	size := (n.BitLen() + 8) / 8
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	b := new(big.Int).Add(mod, n).Bytes()
+	for len(b) < size {
+		b = append([]byte{0xff}, b...)
+	}
+
+	return b
+}
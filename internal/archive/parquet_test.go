@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+)
+
+func TestTwosComplement(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{255, []byte{0x00, 0xff}},
+		{256, []byte{0x01, 0x00}},
+		{-1, []byte{0xff}},
+		{-127, []byte{0x81}},
+		{-128, []byte{0xff, 0x80}},
+		{-129, []byte{0xff, 0x7f}},
+		{-256, []byte{0xff, 0x00}},
+		{-32769, []byte{0xff, 0x7f, 0xff}},
+	}
+
+	for _, tc := range tests {
+		got := twosComplement(big.NewInt(tc.n))
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("twosComplement(%d) = % x, want % x", tc.n, got, tc.want)
+		}
+		if back := bytesDecimal(string(got)); back.Coeff.Int64() != abs(tc.n) || back.Negative != (tc.n < 0) {
+			t.Errorf("twosComplement(%d) decodes to %s", tc.n, back)
+		}
+	}
+}
+
+func TestDecimalBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []byte // unscaled value of scale 10
+		back  string
+	}{
+		{"zero", "0", []byte{0x00}, "0"},
+		{"one", "1", []byte{0x02, 0x54, 0x0b, 0xe4, 0x00}, "1"},
+		{"minus one", "-1", []byte{0xfd, 0xab, 0xf4, 0x1c, 0x00}, "-1"},
+		{"smallest", "0.0000000001", []byte{0x01}, "1E-10"},
+		{"smallest negative", "-0.0000000001", []byte{0xff}, "-1E-10"},
+		{"rounded down", "0.00000000014", []byte{0x01}, "1E-10"},
+		{"rounded up", "0.00000000015", []byte{0x02}, "2E-10"},
+		{"negative rounded up", "-0.00000000015", []byte{0xfe}, "-2E-10"},
+		{"price", "2500000.55", nil, "2500000.55"},
+		{"negative quantity", "-0.12345678", nil, "-0.12345678"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, _, err := apd.NewFromString(tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := decimalBytes(d)
+			if err != nil {
+				t.Fatalf("decimalBytes(%s) error = %v", tc.value, err)
+			}
+			if tc.want != nil && !bytes.Equal([]byte(got), tc.want) {
+				t.Errorf("decimalBytes(%s) = % x, want % x", tc.value, got, tc.want)
+			}
+
+			want, _, _ := apd.NewFromString(tc.back)
+			if back := bytesDecimal(got); back.Cmp(want) != 0 {
+				t.Errorf("decimalBytes(%s) decodes to %s, want %s", tc.value, back, tc.back)
+			}
+		})
+	}
+}
+
+func TestDecimalBytesOverflow(t *testing.T) {
+	d, _, _ := apd.NewFromString("1E+30")
+	if _, err := decimalBytes(d); err == nil {
+		t.Error("decimalBytes(1E+30) error = nil, want more than 38 digits rejected")
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -9,14 +9,16 @@ import (
 	"strings"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
 )
 
 // PDAXAuthService is used to get authToken by passing auth procedure through user sign-in.
 type PDAXAuthService struct {
-	Username       string
-	Password       string
+	Accounts       *AccountPool
 	AuthURL        string
 	AuthRefreshURL string
+	Devices        *DeviceStore
 	captchaSolver  CaptchaSolver
 	Logger         log.Logger
 }
@@ -26,23 +28,42 @@ func NewAuthService(authURL string, authRefreshURL string, options ...ConfigOpti
 	auth := PDAXAuthService{
 		AuthURL:        authURL,
 		AuthRefreshURL: authRefreshURL,
+		Logger:         log.NewNopLogger(),
 	}
 
 	for _, opt := range options {
 		opt(&auth)
 	}
 
+	if auth.Devices == nil {
+		// in-memory store never fails
+		auth.Devices, _ = NewDeviceStore("", nil)
+	}
+
 	return auth
 }
 
 // ConfigOption configures the PDAXAuthService.
 type ConfigOption func(*PDAXAuthService)
 
-// WithCredentials struct contains credentials for sign-in.
+// WithCredentials configures a single account for sign-in.
 func WithCredentials(username, password string) ConfigOption {
 	return func(auth *PDAXAuthService) {
-		auth.Username = username
-		auth.Password = password
+		auth.Accounts = NewAccountPool([]Account{{Username: username, Password: password}}, defaultCoolDown)
+	}
+}
+
+// WithAccountPool configures pool of accounts to rotate on sign-in failures.
+func WithAccountPool(p *AccountPool) ConfigOption {
+	return func(auth *PDAXAuthService) {
+		auth.Accounts = p
+	}
+}
+
+// WithDeviceStore configures login profiles and device fingerprints of accounts.
+func WithDeviceStore(s *DeviceStore) ConfigOption {
+	return func(auth *PDAXAuthService) {
+		auth.Devices = s
 	}
 }
 
@@ -77,29 +98,87 @@ type pdaxLoginForm struct {
 }
 
 // Login is used to authenticate in PDAX.
+// Accounts of the pool are tried in turn till one of them signs in, failed accounts are put on cool-down
+// and accounts with wrong credentials, locked or requiring 2FA are disabled.
+// Login failures are monitor.Error with login error codes.
 func (a *PDAXAuthService) Login() (string, error) {
-	gcaptcha, err := a.captchaSolver.Solve()
+	if a.Accounts == nil || a.Accounts.Len() == 0 {
+		return "", fmt.Errorf("no PDAX accounts configured")
+	}
+
+	var lastErr error
+	for i := 0; i < a.Accounts.Len(); i++ {
+		account, ok := a.Accounts.Next()
+		if !ok {
+			break
+		}
+
+		gcaptcha, err := a.captchaSolver.Solve()
+		if err != nil {
+			level.Error(a.Logger).Log("msg", "2captcha.com solution error", "err", err)
+			return "", err
+		}
+
+		authToken, err := a.login(account, gcaptcha)
+		switch {
+		case err == nil:
+			a.Accounts.Succeeded(account.Username)
+			level.Info(a.Logger).Log("msg", "pdax login succeeded", "account", account.Username)
+
+			return authToken, nil
+		case monitor.ErrorCode(err) == monitor.ErrorCodeCaptchaRejected:
+			// not the account's fault, the next attempt gets a fresh captcha
+			return "", err
+		case isAccountError(err):
+			level.Error(a.Logger).Log("msg", "pdax login rejected, disabling account", "account", account.Username, "err", err)
+			a.Accounts.Disable(account.Username, err)
+		default:
+			level.Warn(a.Logger).Log("msg", "pdax login failed, rotating account", "account", account.Username, "err", err)
+			a.Accounts.Failed(account.Username, err)
+		}
+		lastErr = err
+	}
+
+	if a.Accounts.Disabled() == a.Accounts.Len() {
+		return "", monitor.Error{
+			Code:    monitor.ErrorCodeNoAccounts,
+			Message: "every PDAX account is disabled",
+			Inner:   lastErr,
+		}
+	}
+
+	if lastErr != nil {
+		return "", lastErr
+	}
+
+	return "", fmt.Errorf("all PDAX accounts are cooling down")
+}
+
+func (a *PDAXAuthService) login(account Account, gcaptcha string) (string, error) {
+	d, profile, err := a.Devices.Device(account.Username)
 	if err != nil {
-		return "", fmt.Errorf("2captcha.com solution error: %v", err)
+		// device is assigned anyway, it is just not persisted
+		level.Warn(a.Logger).Log("msg", "failed to persist account device", "account", account.Username, "err", err)
 	}
 
 	// error is always nil
 	jar, _ := cookiejar.New(nil)
 	client := &http.Client{
-		Jar: jar, // cookies are used to have access for getting refresh token
+		Jar:       jar, // cookies are used to have access for getting refresh token
+		Transport: profileTransport{profile: profile, next: http.DefaultTransport},
 	}
 
 	form := pdaxLoginForm{
-		a.Username,
-		a.Password,
-		false,
+		account.Username,
+		account.Password,
+		profile.Trusted,
 		gcaptcha,
-		"null",
+		profile.Platform,
 		device{
-			"94129614769af80e6b7cd7fc68294349",
-			"ru-RU",
-			"1920x1080",
-			"6ed8863b119af2f53411e620bb1ebd8f35ce1da9e0d7a04b26bbdd1f11d5c156",
+			d.H,
+			profile.Language,
+			profile.Resolution,
+			d.H2,
 		},
 	}
 	formJSON, err := json.Marshal(form)
@@ -128,12 +207,12 @@ func (a *PDAXAuthService) getJWTToken(c *http.Client, formJSON []byte) error {
 	}
 	defer resp.Body.Close()
 
-	_, err = ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return classifyLoginResponse(resp.StatusCode, data)
 }
 
 func (a *PDAXAuthService) getRefreshedToken(client *http.Client, formJSON []byte) (string, error) {
@@ -154,6 +233,10 @@ func (a *PDAXAuthService) getRefreshedToken(client *http.Client, formJSON []byte
 		return "", err
 	}
 
+	if err = classifyLoginResponse(resp.StatusCode, data); err != nil {
+		return "", err
+	}
+
 	type AuthToken struct {
 		AuthToken string `json:"authToken"`
 	}
@@ -163,5 +246,32 @@ func (a *PDAXAuthService) getRefreshedToken(client *http.Client, formJSON []byte
 		return "", err
 	}
 
+	if refreshToken.AuthToken == "" {
+		return "", monitor.Error{
+			Code:    monitor.ErrorCodeLoginFailed,
+			Message: "pdax returned empty auth token",
+			Inner:   fmt.Errorf("status %d: %s", resp.StatusCode, truncate(string(data), 256)),
+		}
+	}
+
 	return refreshToken.AuthToken, nil
 }
+
+// profileTransport sets user agent and headers of the login profile on every request.
+type profileTransport struct {
+	profile Profile
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t profileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.profile.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.profile.UserAgent != "" {
+		req.Header.Set("User-Agent", t.profile.UserAgent)
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const captchaResultSuccess = "success"
+
+// CaptchaBudget bounds number of captcha solves per UTC day and month, zero limit means unlimited.
+// Methods are safe to call on nil budget which allows every solve.
+type CaptchaBudget struct {
+	Daily   int
+	Monthly int
+
+	path    string
+	lock    sync.Mutex
+	day     time.Time
+	month   time.Time
+	daily   int
+	monthly int
+}
+
+// budgetUsage is the persisted number of solves in the day and month.
+type budgetUsage struct {
+	Day     time.Time `json:"day"`
+	Month   time.Time `json:"month"`
+	Daily   int       `json:"daily"`
+	Monthly int       `json:"monthly"`
+}
+
+// NewCaptchaBudget instantiates CaptchaBudget counting solves in memory.
+func NewCaptchaBudget(daily, monthly int) *CaptchaBudget {
+	return &CaptchaBudget{Daily: daily, Monthly: monthly}
+}
+
+// LoadCaptchaBudget instantiates CaptchaBudget and loads solves counted so far from the file.
+// Solves are persisted to the file, so restarts don't reset the spent budget. They are counted in memory only
+// when the path is empty.
+func LoadCaptchaBudget(path string, daily, monthly int) (*CaptchaBudget, error) {
+	b := NewCaptchaBudget(daily, monthly)
+	if path == "" {
+		return b, nil
+	}
+	b.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captcha budget file: %v", err)
+	}
+
+	var u budgetUsage
+	if err = json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("unmarshaling captcha budget failed: %v", err)
+	}
+	b.day, b.month, b.daily, b.monthly = u.Day, u.Month, u.Daily, u.Monthly
+
+	return b, nil
+}
+
+// Allow returns an error when the budget of the current day or month is spent.
+func (b *CaptchaBudget) Allow(now time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.reset(now)
+	if b.Daily > 0 && b.daily >= b.Daily {
+		return monitor.Error{
+			Code:    monitor.ErrorCodeCaptchaBudgetExceeded,
+			Message: fmt.Sprintf("daily captcha budget of %d solves is spent", b.Daily),
+		}
+	}
+	if b.Monthly > 0 && b.monthly >= b.Monthly {
+		return monitor.Error{
+			Code:    monitor.ErrorCodeCaptchaBudgetExceeded,
+			Message: fmt.Sprintf("monthly captcha budget of %d solves is spent", b.Monthly),
+		}
+	}
+
+	return nil
+}
+
+// Spend records a solve, the solve is counted even when it fails to be persisted.
+func (b *CaptchaBudget) Spend(now time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.reset(now)
+	b.daily++
+	b.monthly++
+
+	return b.save()
+}
+
+// Used returns number of solves in the current day and month.
+func (b *CaptchaBudget) Used(now time.Time) (daily, monthly int) {
+	if b == nil {
+		return 0, 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.reset(now)
+
+	return b.daily, b.monthly
+}
+
+func (b *CaptchaBudget) reset(now time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if !day.Equal(b.day) {
+		b.day = day
+		b.daily = 0
+	}
+	if !month.Equal(b.month) {
+		b.month = month
+		b.monthly = 0
+	}
+}
+
+func (b *CaptchaBudget) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(budgetUsage{Day: b.day, Month: b.month, Daily: b.daily, Monthly: b.monthly})
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(b.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save captcha budget file: %v", err)
+	}
+
+	return nil
+}
+
+// CaptchaMetrics records captcha solves, spend and solver balance.
+// Methods are safe to call on nil metrics which records nothing.
+type CaptchaMetrics struct {
+	solves   *prometheus.CounterVec
+	duration prometheus.Histogram
+	spend    prometheus.Counter
+	balance  prometheus.Gauge
+	low      prometheus.Gauge
+	cost     float64
+}
+
+// NewCaptchaMetrics instantiates CaptchaMetrics and registers them. Cost is price of a single solve in USD.
+func NewCaptchaMetrics(registerer prometheus.Registerer, cost float64) *CaptchaMetrics {
+	m := CaptchaMetrics{
+		solves: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pdax_captcha_solves_total",
+			Help: "Captcha solve attempts per result.",
+		}, []string{"result"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pdax_captcha_solve_duration_seconds",
+			Help:    "Time to get a captcha solved.",
+			Buckets: []float64{5, 10, 20, 30, 45, 60, 90, 120, 180},
+		}),
+		spend: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pdax_captcha_spend_usd_total",
+			Help: "Estimated spend on solved captchas in USD.",
+		}),
+		balance: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pdax_captcha_balance_usd",
+			Help: "Captcha solver account balance in USD.",
+		}),
+		low: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pdax_captcha_balance_low",
+			Help: "Whether the captcha solver balance is below the alert threshold (1) or not (0).",
+		}),
+		cost: cost,
+	}
+	registerer.MustRegister(m.solves, m.duration, m.spend, m.balance, m.low)
+
+	return &m
+}
+
+func (m *CaptchaMetrics) observeSolve(err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		// Network errors are not classified, they are failed solves as well.
+		result := monitor.ErrorCode(err)
+		if result == "" {
+			result = monitor.ErrorCodeCaptchaFailed
+		}
+		m.solves.WithLabelValues(result).Inc()
+		return
+	}
+
+	m.solves.WithLabelValues(captchaResultSuccess).Inc()
+	m.duration.Observe(duration.Seconds())
+	m.spend.Add(m.cost)
+}
+
+func (m *CaptchaMetrics) observeBalance(balance, threshold float64) {
+	if m == nil {
+		return
+	}
+
+	m.balance.Set(balance)
+	if balance < threshold {
+		m.low.Set(1)
+	} else {
+		m.low.Set(0)
+	}
+}
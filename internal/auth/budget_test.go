@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestCaptchaBudget(t *testing.T) {
+	start := time.Date(2021, 6, 30, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		daily   int
+		monthly int
+		spend   []time.Time
+		at      time.Time
+		allowed bool
+	}{
+		{"unlimited", 0, 0, []time.Time{start, start, start}, start, true},
+		{"under daily cap", 2, 0, []time.Time{start}, start, true},
+		{"daily cap", 2, 0, []time.Time{start, start}, start, false},
+		{"daily reset", 2, 0, []time.Time{start, start}, start.Add(2 * time.Hour), true},
+		{"daily reset in UTC", 2, 0, []time.Time{start, start}, start.In(time.FixedZone("PHT", 8*3600)).Add(time.Hour), false},
+		{"monthly cap", 0, 3, []time.Time{start.AddDate(0, 0, -20), start.AddDate(0, 0, -1), start}, start, false},
+		{"monthly cap across days", 5, 3, []time.Time{start.AddDate(0, 0, -2), start.AddDate(0, 0, -1), start}, start.Add(time.Hour), false},
+		{"monthly reset", 0, 3, []time.Time{start, start, start}, start.Add(2 * time.Hour), true},
+		{"previous month not counted", 0, 2, []time.Time{start.AddDate(0, -1, 0), start}, start, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewCaptchaBudget(tc.daily, tc.monthly)
+			for _, at := range tc.spend {
+				if err := b.Spend(at); err != nil {
+					t.Fatalf("Spend() error = %v", err)
+				}
+			}
+
+			err := b.Allow(tc.at)
+			if allowed := err == nil; allowed != tc.allowed {
+				t.Fatalf("Allow() error = %v, want allowed %v", err, tc.allowed)
+			}
+			if err != nil && monitor.ErrorCode(err) != monitor.ErrorCodeCaptchaBudgetExceeded {
+				t.Errorf("Allow() error code = %q, want %q", monitor.ErrorCode(err), monitor.ErrorCodeCaptchaBudgetExceeded)
+			}
+		})
+	}
+}
+
+func TestCaptchaBudgetUsed(t *testing.T) {
+	b := NewCaptchaBudget(0, 0)
+	day := time.Date(2021, 6, 10, 9, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{day.AddDate(0, 0, -1), day, day.Add(time.Hour)} {
+		b.Spend(at)
+	}
+
+	if daily, monthly := b.Used(day.Add(2 * time.Hour)); daily != 2 || monthly != 3 {
+		t.Errorf("Used() = %d, %d, want 2, 3", daily, monthly)
+	}
+	if daily, monthly := b.Used(day.AddDate(0, 1, 0)); daily != 0 || monthly != 0 {
+		t.Errorf("Used() next month = %d, %d, want 0, 0", daily, monthly)
+	}
+
+	var nilBudget *CaptchaBudget
+	if err := nilBudget.Allow(day); err != nil {
+		t.Errorf("nil budget Allow() error = %v", err)
+	}
+}
+
+func TestCaptchaBudgetSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.json")
+	now := time.Date(2021, 6, 10, 9, 0, 0, 0, time.UTC)
+
+	b, err := LoadCaptchaBudget(path, 0, 2)
+	if err != nil {
+		t.Fatalf("LoadCaptchaBudget() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = b.Spend(now.AddDate(0, 0, -i)); err != nil {
+			t.Fatalf("Spend() error = %v", err)
+		}
+	}
+
+	restarted, err := LoadCaptchaBudget(path, 0, 2)
+	if err != nil {
+		t.Fatalf("LoadCaptchaBudget() error = %v", err)
+	}
+	if err = restarted.Allow(now); monitor.ErrorCode(err) != monitor.ErrorCodeCaptchaBudgetExceeded {
+		t.Errorf("Allow() after restart error = %v, want monthly budget exceeded", err)
+	}
+	if daily, monthly := restarted.Used(now); daily != 0 || monthly != 2 {
+		t.Errorf("Used() after restart = %d, %d, want 0, 2", daily, monthly)
+	}
+	if err = restarted.Allow(now.AddDate(0, 1, 0)); err != nil {
+		t.Errorf("Allow() next month error = %v", err)
+	}
+}
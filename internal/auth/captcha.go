@@ -1,85 +1,212 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/secret"
 )
 
 const (
 	okPrefix                  = "OK|"
-	zeroBalance               = "ERROR_ZERO_BALANCE"
 	notReadyStatus            = "CAPCHA_NOT_READY"
 	solverPostTaskURL         = "https://2captcha.com/in.php?key=%s&method=userrecaptcha&googlekey=%s&pageurl=%s"
 	solverGetResultURL        = "https://2captcha.com/res.php?key=%s&action=get&googlekey=%s&id=%s"
+	solverGetBalanceURL       = "https://2captcha.com/res.php?key=%s&action=getbalance"
 	solutionCheckPeriodSec    = 5
 	solutionCheckAttemptCount = 30 // in practice captcha is solved less than a minute
 )
 
+// solverErrorCodes maps 2captcha.com error replies to error codes, see https://2captcha.com/2captcha-api#error_handling.
+func solverErrorCodes() map[string]string {
+	return map[string]string{
+		"ERROR_ZERO_BALANCE":            monitor.ErrorCodeCaptchaZeroBalance,
+		"ERROR_WRONG_USER_KEY":          monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_KEY_DOES_NOT_EXIST":      monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_IP_NOT_ALLOWED":          monitor.ErrorCodeCaptchaMisconfigured,
+		"IP_BANNED":                     monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_PAGEURL":                 monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_GOOGLEKEY":               monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_WRONG_GOOGLEKEY":         monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_BAD_TOKEN_OR_PAGEURL":    monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_BAD_PARAMETERS":          monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_WRONG_ID_FORMAT":         monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_EMPTY_ACTION":            monitor.ErrorCodeCaptchaMisconfigured,
+		"ERROR_NO_SLOT_AVAILABLE":       monitor.ErrorCodeCaptchaFailed,
+		"MAX_USER_TURN":                 monitor.ErrorCodeCaptchaFailed,
+		"ERROR_TOO_MUCH_REQUESTS":       monitor.ErrorCodeCaptchaFailed,
+		"ERROR_CAPTCHA_UNSOLVABLE":      monitor.ErrorCodeCaptchaFailed,
+		"ERROR_WRONG_CAPTCHA_ID":        monitor.ErrorCodeCaptchaFailed,
+		"ERROR_BAD_DUPLICATES":          monitor.ErrorCodeCaptchaFailed,
+		"ERROR_CAPTCHAIMAGE_BLOCKED":    monitor.ErrorCodeCaptchaFailed,
+		"ERROR_PROXY_CONNECTION_FAILED": monitor.ErrorCodeCaptchaFailed,
+		"ERROR_TOKEN_EXPIRED":           monitor.ErrorCodeCaptchaFailed,
+	}
+}
+
 // CaptchaSolver is service to solve captcha.
 type CaptchaSolver struct {
 	SolverKey   string
 	TaskKey     string
 	TaskPageURL string
 	Logger      log.Logger
+	// Budget bounds number of solves, it is unlimited when nil.
+	Budget *CaptchaBudget
+	// Metrics records solves, spend and balance, it is not recorded when nil.
+	Metrics *CaptchaMetrics
 }
 
 // Solve is used to solve login form captchas.
 func (cs *CaptchaSolver) Solve() (string, error) {
-	resp, err := http.Get(fmt.Sprintf(solverPostTaskURL, cs.SolverKey, cs.TaskKey, cs.TaskPageURL))
-	if err != nil {
-		return "", fmt.Errorf("failed to post captcha task to 2captcha.com: %v", err)
+	if err := cs.Budget.Allow(time.Now()); err != nil {
+		cs.Metrics.observeSolve(err, 0)
+		return "", err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	start := time.Now()
+	solution, err := cs.solve()
+	cs.Metrics.observeSolve(err, time.Since(start))
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-	task := string(body)
+	if err = cs.Budget.Spend(time.Now()); err != nil {
+		level.Warn(cs.Logger).Log("msg", "failed to persist captcha budget", "err", err)
+	}
+
+	return solution, nil
+}
 
-	if task == zeroBalance {
-		return "", fmt.Errorf("2captcha zero balance")
+func (cs *CaptchaSolver) solve() (string, error) {
+	task, err := cs.get(fmt.Sprintf(solverPostTaskURL, cs.SolverKey, cs.TaskKey, cs.TaskPageURL))
+	if err != nil {
+		return "", fmt.Errorf("failed to post captcha task to 2captcha.com: %v", err)
+	}
+	if !strings.HasPrefix(task, okPrefix) {
+		return "", solverError(task)
 	}
 
-	if strings.HasPrefix(task, okPrefix) {
-		taskID := strings.TrimPrefix(task, okPrefix)
+	taskID := strings.TrimPrefix(task, okPrefix)
+	level.Info(cs.Logger).Log("msg", "captcha task scheduled", "url", cs.TaskPageURL)
+	for i := 0; i < solutionCheckAttemptCount; i++ {
+		// Wait till captcha solved
+		time.Sleep(solutionCheckPeriodSec * time.Second)
 
-		level.Info(cs.Logger).Log("msg", "captcha task scheduled", "url", cs.TaskPageURL)
-		for i := 0; i < solutionCheckAttemptCount; i++ {
-			// Wait till captcha solved
-			time.Sleep(solutionCheckPeriodSec * time.Second)
+		result, err := cs.get(fmt.Sprintf(solverGetResultURL, cs.SolverKey, cs.TaskKey, taskID))
+		if err != nil {
+			return "", fmt.Errorf("failed to get captcha result from 2captcha.com: %v", err)
+		}
 
-			resp, err = http.Get(fmt.Sprintf(solverGetResultURL, cs.SolverKey, cs.TaskKey, taskID))
-			if err != nil {
-				return "", fmt.Errorf("failed to get captcha result from 2captcha.com: %v", err)
-			}
-			defer resp.Body.Close()
+		if result == notReadyStatus {
+			level.Info(cs.Logger).Log("msg", "captcha solution not ready yet", "awaitSeconds", solutionCheckPeriodSec)
+			continue
+		}
 
-			body, err = ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return "", err
-			}
+		if strings.HasPrefix(result, okPrefix) {
+			level.Info(cs.Logger).Log("msg", "captcha solved", "solution", strings.TrimPrefix(result, okPrefix))
+			return strings.TrimPrefix(result, okPrefix), nil
+		}
 
-			bodyString := string(body)
-			if bodyString == notReadyStatus {
-				level.Info(cs.Logger).Log("msg", "captcha solution not ready yet", "awaitSeconds", solutionCheckPeriodSec)
-				continue
-			}
+		return "", solverError(result)
+	}
 
-			if strings.HasPrefix(bodyString, okPrefix) {
-				level.Info(cs.Logger).Log("msg", "captcha solved", "solution", strings.TrimPrefix(bodyString, okPrefix))
-				return strings.TrimPrefix(bodyString, okPrefix), nil
+	return "", monitor.Error{Code: monitor.ErrorCodeCaptchaFailed, Message: "captcha solution await timeout"}
+}
+
+// Balance returns 2captcha.com account balance in USD.
+func (cs *CaptchaSolver) Balance() (float64, error) {
+	reply, err := cs.get(fmt.Sprintf(solverGetBalanceURL, cs.SolverKey))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get balance from 2captcha.com: %v", err)
+	}
+
+	balance, err := strconv.ParseFloat(reply, 64)
+	if err != nil {
+		return 0, solverError(reply)
+	}
+
+	return balance, nil
+}
+
+// MonitorBalance checks the solver balance every interval till the context is canceled,
+// an error is logged whenever the balance is below the threshold. Threshold is read on every check,
+// so it may be changed while the balance is monitored.
+func (cs *CaptchaSolver) MonitorBalance(ctx context.Context, interval time.Duration, threshold func() float64) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		balance, err := cs.Balance()
+		threshold := threshold()
+		if err != nil {
+			level.Warn(cs.Logger).Log("msg", "failed to check captcha solver balance", "err", err)
+		} else {
+			cs.Metrics.observeBalance(balance, threshold)
+			if balance < threshold {
+				level.Error(cs.Logger).Log("msg", "captcha solver balance is low", "balance", balance, "threshold", threshold)
 			}
 		}
 
-		return "", fmt.Errorf("captcha solution await timeout")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cs *CaptchaSolver) get(url string) (string, error) {
+	resp, err := http.Get(url) //nolint:gosec // URL is built from constant templates
+	if err != nil {
+		return "", cs.redact(err)
 	}
+	defer resp.Body.Close()
 
-	return "", nil
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// redact hides solver key from errors, e.g. *url.Error contains full request URL.
+func (cs *CaptchaSolver) redact(err error) error {
+	if cs.SolverKey == "" {
+		return err
+	}
+
+	return errors.New(strings.ReplaceAll(err.Error(), cs.SolverKey, secret.Redacted))
+}
+
+// solverError turns 2captcha.com reply into monitor.Error. Error codes might be followed by details, e.g.
+// "ERROR_TOO_MUCH_REQUESTS|30".
+func solverError(reply string) error {
+	errorCode := reply
+	if i := strings.Index(reply, "|"); i >= 0 {
+		errorCode = reply[:i]
+	}
+
+	code, ok := solverErrorCodes()[errorCode]
+	if !ok {
+		return monitor.Error{
+			Code:    monitor.ErrorCodeCaptchaFailed,
+			Message: "unexpected 2captcha.com reply",
+			Inner:   errors.New(truncate(reply, 256)),
+		}
+	}
+
+	return monitor.Error{
+		Code:    code,
+		Message: "2captcha.com replied with " + errorCode,
+		Inner:   errors.New(reply),
+	}
 }
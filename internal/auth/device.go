@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Profile describes a browser the login form is submitted from.
+type Profile struct {
+	Name       string            `mapstructure:"name"`
+	UserAgent  string            `mapstructure:"user-agent"`
+	Language   string            `mapstructure:"language"`
+	Resolution string            `mapstructure:"resolution"`
+	Platform   string            `mapstructure:"platform"`
+	Trusted    bool              `mapstructure:"trusted"`
+	Headers    map[string]string `mapstructure:"headers"`
+}
+
+// DefaultProfile returns the profile used when none is configured.
+func DefaultProfile() Profile {
+	return Profile{
+		Name: "default",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+			"(KHTML, like Gecko) Chrome/98.0.4758.102 Safari/537.36",
+		Language:   "ru-RU",
+		Resolution: "1920x1080",
+		Platform:   "null",
+		Headers: map[string]string{
+			"Accept":          "application/json, text/plain, */*",
+			"Accept-Language": "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7",
+			"Origin":          "https://trade.pdax.ph",
+			"Referer":         "https://trade.pdax.ph/signin",
+		},
+	}
+}
+
+// LoadProfiles reads login profiles from JSON or YAML file with the list under "profiles" key, e.g.
+// {"profiles": [{"name": "chrome-win", "user-agent": "Mozilla/5.0 ...", "language": "en-US", "resolution": "1920x1080"}]}.
+func LoadProfiles(path string) ([]Profile, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %v", err)
+	}
+
+	var profiles []Profile
+	if err := v.UnmarshalKey("profiles", &profiles); err != nil {
+		return nil, fmt.Errorf("unmarshaling profiles failed: %v", err)
+	}
+
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d has no name", i)
+		}
+		if p.Platform == "" {
+			profiles[i].Platform = "null"
+		}
+	}
+
+	return profiles, nil
+}
+
+// Device is a fingerprint PDAX sees on sign-in.
+type Device struct {
+	Profile string `json:"profile"`
+	H       string `json:"h"`
+	H2      string `json:"h2"`
+}
+
+// DeviceStore assigns every account a stable profile and device fingerprint.
+// Assigned devices are persisted to the file, so they survive restarts and can be pinned by hand.
+type DeviceStore struct {
+	path     string
+	profiles []Profile
+	devices  map[string]Device
+	lock     sync.Mutex
+}
+
+// NewDeviceStore instantiates DeviceStore and loads previously assigned devices from the file.
+// Devices are kept in memory only when the path is empty.
+func NewDeviceStore(path string, profiles []Profile) (*DeviceStore, error) {
+	if len(profiles) == 0 {
+		profiles = []Profile{DefaultProfile()}
+	}
+
+	s := DeviceStore{
+		path:     path,
+		profiles: profiles,
+		devices:  make(map[string]Device),
+	}
+	if path == "" {
+		return &s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read devices file: %v", err)
+	}
+	if err = json.Unmarshal(data, &s.devices); err != nil {
+		return nil, fmt.Errorf("unmarshaling devices failed: %v", err)
+	}
+
+	return &s, nil
+}
+
+// Device returns the account's device and its profile, a new one is assigned and persisted on the first call.
+func (s *DeviceStore) Device(username string) (Device, Profile, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if d, ok := s.devices[username]; ok {
+		if p, ok := s.profile(d.Profile); ok {
+			return d, p, nil
+		}
+	}
+
+	// Same account always gets the same device even when devices are not persisted.
+	h := fnv.New32a()
+	h.Write([]byte(username))
+	p := s.profiles[h.Sum32()%uint32(len(s.profiles))]
+
+	sum := sha256.Sum256([]byte("h:" + p.Name + ":" + username))
+	sum2 := sha256.Sum256([]byte("h2:" + p.Name + ":" + username))
+	d := Device{
+		Profile: p.Name,
+		H:       hex.EncodeToString(sum[:16]),
+		H2:      hex.EncodeToString(sum2[:]),
+	}
+	s.devices[username] = d
+
+	return d, p, s.save()
+}
+
+func (s *DeviceStore) profile(name string) (Profile, bool) {
+	for _, p := range s.profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return Profile{}, false
+}
+
+func (s *DeviceStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.devices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save devices file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceStoreStableAssignment(t *testing.T) {
+	profiles := []Profile{{Name: "chrome-win"}, {Name: "safari-mac"}, {Name: "firefox-linux"}}
+	users := []string{"john@example.com", "jane@example.com", "bob@example.com", "alice@example.com"}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"in memory", ""},
+		{"persisted", filepath.Join(t.TempDir(), "devices.json")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			first, err := NewDeviceStore(tc.path, profiles)
+			if err != nil {
+				t.Fatalf("NewDeviceStore() error = %v", err)
+			}
+
+			seen := make(map[string]string)
+			devices := make(map[string]Device)
+			for _, u := range users {
+				d, p, err := first.Device(u)
+				if err != nil {
+					t.Fatalf("Device(%s) error = %v", u, err)
+				}
+				if d.Profile != p.Name {
+					t.Errorf("Device(%s) profile = %s, device profile %s", u, p.Name, d.Profile)
+				}
+				if d.H == "" || d.H2 == "" {
+					t.Errorf("Device(%s) = %+v, want fingerprint", u, d)
+				}
+				if other, ok := seen[d.H]; ok {
+					t.Errorf("Device(%s) has the fingerprint of %s", u, other)
+				}
+				seen[d.H] = u
+
+				if again, _, _ := first.Device(u); again != d {
+					t.Errorf("Device(%s) = %+v, then %+v, want the same device", u, d, again)
+				}
+				devices[u] = d
+			}
+
+			restarted, err := NewDeviceStore(tc.path, profiles)
+			if err != nil {
+				t.Fatalf("NewDeviceStore() error = %v", err)
+			}
+			for u, want := range devices {
+				if d, _, _ := restarted.Device(u); d != want {
+					t.Errorf("Device(%s) after restart = %+v, want %+v", u, d, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceStorePinnedDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	pinned := `{"john@example.com": {"profile": "safari-mac", "h": "pinned-h", "h2": "pinned-h2"},
+		"jane@example.com": {"profile": "removed", "h": "old-h", "h2": "old-h2"}}`
+	if err := os.WriteFile(path, []byte(pinned), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewDeviceStore(path, []Profile{{Name: "chrome-win"}, {Name: "safari-mac"}})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+
+	d, p, err := s.Device("john@example.com")
+	if err != nil {
+		t.Fatalf("Device() error = %v", err)
+	}
+	if d.H != "pinned-h" || p.Name != "safari-mac" {
+		t.Errorf("Device() = %+v with profile %s, want pinned device", d, p.Name)
+	}
+
+	// device of the profile no longer configured is replaced
+	d, p, err = s.Device("jane@example.com")
+	if err != nil {
+		t.Fatalf("Device() error = %v", err)
+	}
+	if d.H == "old-h" || d.Profile != p.Name {
+		t.Errorf("Device() = %+v with profile %s, want a new device of a configured profile", d, p.Name)
+	}
+}
+
+func TestDeviceStoreDefaultProfile(t *testing.T) {
+	s, err := NewDeviceStore("", nil)
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+
+	if _, p, _ := s.Device("john@example.com"); p.Name != DefaultProfile().Name {
+		t.Errorf("Device() profile = %s, want %s", p.Name, DefaultProfile().Name)
+	}
+}
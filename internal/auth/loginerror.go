@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// loginErrorResponse covers error fields of PDAX auth responses.
+type loginErrorResponse struct {
+	Error     interface{} `json:"error"`
+	Message   string      `json:"message"`
+	Code      interface{} `json:"code"`
+	ErrorCode interface{} `json:"errorCode"`
+}
+
+// loginErrorPattern maps PDAX error texts containing any of the keywords to the error code.
+type loginErrorPattern struct {
+	code     string
+	keywords []string
+}
+
+// loginErrorPatterns are checked in order, the first match wins.
+func loginErrorPatterns() []loginErrorPattern {
+	return []loginErrorPattern{
+		{monitor.ErrorCodeRateLimited, []string{"too many", "rate limit", "throttl", "try again later"}},
+		{monitor.ErrorCodeCaptchaRejected, []string{"captcha", "recaptcha"}},
+		{monitor.ErrorCode2FARequired, []string{"2fa", "two-factor", "two factor", "otp", "mfa", "authenticator"}},
+		{monitor.ErrorCodeAccountLocked, []string{"locked", "suspended", "disabled", "banned", "blocked", "deactivated"}},
+		// "unauthorized" alone is only the status text, an expired token is rejected with it as well
+		{monitor.ErrorCodeWrongCredentials, []string{"password", "credential", "username", "user not found", "account not found"}},
+	}
+}
+
+// classifyLoginResponse turns PDAX auth error response into monitor.Error, nil is returned for successful responses.
+// Wrong credentials are only reported when the response says so, other errors are ErrorCodeLoginFailed.
+func classifyLoginResponse(status int, body []byte) error {
+	var resp loginErrorResponse
+	isJSON := json.Unmarshal(body, &resp) == nil
+
+	hasErrorField := isJSON && (stringify(resp.Error) != "" || stringify(resp.ErrorCode) != "")
+	if status < http.StatusBadRequest && !hasErrorField {
+		return nil
+	}
+
+	text := strings.ToLower(string(body))
+	if isJSON {
+		text = strings.ToLower(strings.Join([]string{
+			stringify(resp.Error), resp.Message, stringify(resp.Code), stringify(resp.ErrorCode),
+		}, " "))
+	}
+
+	message := strings.TrimSpace(resp.Message)
+	if message == "" {
+		message = fmt.Sprintf("pdax responded with status %d", status)
+	}
+
+	e := monitor.Error{
+		Code:    monitor.ErrorCodeLoginFailed,
+		Message: message,
+		Inner:   fmt.Errorf("status %d: %s", status, truncate(string(body), 256)),
+	}
+	switch status {
+	case http.StatusTooManyRequests:
+		e.Code = monitor.ErrorCodeRateLimited
+		return e
+	case http.StatusLocked:
+		e.Code = monitor.ErrorCodeAccountLocked
+		return e
+	}
+
+	for _, p := range loginErrorPatterns() {
+		for _, k := range p.keywords {
+			if strings.Contains(text, k) {
+				e.Code = p.code
+				return e
+			}
+		}
+	}
+
+	// status alone, e.g. 401 without a reason, is a retryable failure rather than the account's fault
+	return e
+}
+
+// isAccountError reports whether the login error is caused by the account itself.
+func isAccountError(err error) bool {
+	switch monitor.ErrorCode(err) {
+	case monitor.ErrorCodeWrongCredentials, monitor.ErrorCodeAccountLocked, monitor.ErrorCode2FARequired:
+		return true
+	}
+
+	return false
+}
+
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "error"
+		}
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n] + "..."
+}
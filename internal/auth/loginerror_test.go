@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestClassifyLoginResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"success", http.StatusOK, `{"access_token":"jwt"}`, ""},
+		{"error field on 200", http.StatusOK, `{"error":"Invalid captcha"}`, monitor.ErrorCodeCaptchaRejected},
+		{"rate limited status", http.StatusTooManyRequests, ``, monitor.ErrorCodeRateLimited},
+		{"locked status", http.StatusLocked, ``, monitor.ErrorCodeAccountLocked},
+		{"rate limited message", http.StatusBadRequest, `{"message":"Too many attempts, try again later"}`, monitor.ErrorCodeRateLimited},
+		{"captcha", http.StatusBadRequest, `{"error":"recaptcha verification failed"}`, monitor.ErrorCodeCaptchaRejected},
+		{"2fa", http.StatusForbidden, `{"message":"OTP is required"}`, monitor.ErrorCode2FARequired},
+		{"account locked", http.StatusForbidden, `{"message":"Account is suspended"}`, monitor.ErrorCodeAccountLocked},
+		{"wrong password", http.StatusUnauthorized, `{"message":"Invalid username or password"}`, monitor.ErrorCodeWrongCredentials},
+		{"user not found", http.StatusBadRequest, `{"errorCode":"USER_NOT_FOUND","message":"User not found"}`, monitor.ErrorCodeWrongCredentials},
+		{"plain text body", http.StatusUnauthorized, `invalid credentials`, monitor.ErrorCodeWrongCredentials},
+		{"bare 401", http.StatusUnauthorized, ``, monitor.ErrorCodeLoginFailed},
+		{"401 status text", http.StatusUnauthorized, `{"error":"Unauthorized"}`, monitor.ErrorCodeLoginFailed},
+		{"expired token 401", http.StatusUnauthorized, `{"message":"Token has expired"}`, monitor.ErrorCodeLoginFailed},
+		{"server error", http.StatusInternalServerError, `<html>Bad Gateway</html>`, monitor.ErrorCodeLoginFailed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyLoginResponse(tc.status, []byte(tc.body))
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("classifyLoginResponse() = %v, want nil", err)
+				}
+				return
+			}
+			if got := monitor.ErrorCode(err); got != tc.want {
+				t.Errorf("classifyLoginResponse() code = %q, want %q (err %v)", got, tc.want, err)
+			}
+		})
+	}
+}
+
+func TestIsAccountError(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{monitor.ErrorCodeWrongCredentials, true},
+		{monitor.ErrorCodeAccountLocked, true},
+		{monitor.ErrorCode2FARequired, true},
+		{monitor.ErrorCodeLoginFailed, false},
+		{monitor.ErrorCodeRateLimited, false},
+		{monitor.ErrorCodeCaptchaRejected, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.code, func(t *testing.T) {
+			if got := isAccountError(monitor.Error{Code: tc.code}); got != tc.want {
+				t.Errorf("isAccountError(%s) = %v, want %v", tc.code, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultCoolDown = time.Hour
+	maxCoolDown     = 24 * time.Hour
+
+	loginResultSuccess = "success"
+	loginResultFailure = "failure"
+)
+
+// Account is PDAX user credentials.
+type Account struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// AccountStatus is health state of a pooled account.
+type AccountStatus struct {
+	Username      string    `json:"username"`
+	Healthy       bool      `json:"healthy"`
+	Disabled      bool      `json:"disabled"`
+	Failures      int       `json:"failures"`
+	CoolDownUntil time.Time `json:"coolDownUntil,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastLogin     time.Time `json:"lastLogin,omitempty"`
+}
+
+type accountState struct {
+	Account
+	failures      int // consecutive failures
+	disabled      bool
+	coolDownUntil time.Time
+	lastErr       error
+	lastLogin     time.Time
+	successes     float64
+	attempts      float64
+}
+
+// AccountPool rotates PDAX accounts, accounts which failed to log in are put on cool-down.
+// AccountPool is a prometheus.Collector of per-account login metrics.
+type AccountPool struct {
+	accounts []*accountState
+	next     int
+	coolDown time.Duration
+	lock     sync.Mutex
+	now      func() time.Time
+
+	attemptsDesc *prometheus.Desc
+	healthyDesc  *prometheus.Desc
+}
+
+// NewAccountPool instantiates AccountPool.
+// Cool-down of failed account doubles on every consecutive failure up to 24 hours.
+func NewAccountPool(accounts []Account, coolDown time.Duration) *AccountPool {
+	if coolDown <= 0 {
+		coolDown = defaultCoolDown
+	}
+
+	p := AccountPool{
+		coolDown: coolDown,
+		now:      time.Now,
+		attemptsDesc: prometheus.NewDesc(
+			"pdax_login_attempts_total",
+			"PDAX login attempts per account and result.",
+			[]string{"account", "result"}, nil,
+		),
+		healthyDesc: prometheus.NewDesc(
+			"pdax_account_healthy",
+			"Whether the PDAX account is available for login (1) or cooling down or disabled (0).",
+			[]string{"account"}, nil,
+		),
+	}
+	for _, a := range accounts {
+		p.accounts = append(p.accounts, &accountState{Account: a})
+	}
+
+	return &p
+}
+
+// Len returns number of accounts in the pool.
+func (p *AccountPool) Len() int {
+	return len(p.accounts)
+}
+
+// Next returns the next account which is not cooling down, accounts are taken in turn.
+func (p *AccountPool) Next() (Account, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	for i := 0; i < len(p.accounts); i++ {
+		a := p.accounts[(p.next+i)%len(p.accounts)]
+		if a.disabled || now.Before(a.coolDownUntil) {
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.accounts)
+
+		return a.Account, true
+	}
+
+	return Account{}, false
+}
+
+// Succeeded records successful login of the account.
+func (p *AccountPool) Succeeded(username string) {
+	p.update(username, func(a *accountState) {
+		a.attempts++
+		a.successes++
+		a.failures = 0
+		a.lastErr = nil
+		a.coolDownUntil = time.Time{}
+		a.lastLogin = p.now()
+	})
+}
+
+// Failed records failed login of the account and puts it on cool-down.
+func (p *AccountPool) Failed(username string, err error) {
+	p.update(username, func(a *accountState) {
+		a.attempts++
+		a.failures++
+		a.lastErr = err
+
+		coolDown := p.coolDown
+		for i := 1; i < a.failures && coolDown < maxCoolDown; i++ {
+			coolDown *= 2
+		}
+		if coolDown > maxCoolDown {
+			coolDown = maxCoolDown
+		}
+		a.coolDownUntil = p.now().Add(coolDown)
+	})
+}
+
+// Disable records login of the account rejected for good (e.g. wrong credentials) so it is never used again.
+func (p *AccountPool) Disable(username string, err error) {
+	p.update(username, func(a *accountState) {
+		a.attempts++
+		a.failures++
+		a.lastErr = err
+		a.disabled = true
+	})
+}
+
+// Disabled returns number of disabled accounts.
+func (p *AccountPool) Disabled() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var n int
+	for _, a := range p.accounts {
+		if a.disabled {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Status returns health state of every account.
+func (p *AccountPool) Status() []AccountStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	statuses := make([]AccountStatus, 0, len(p.accounts))
+	for _, a := range p.accounts {
+		s := AccountStatus{
+			Username:  a.Username,
+			Healthy:   !a.disabled && !now.Before(a.coolDownUntil),
+			Disabled:  a.disabled,
+			Failures:  a.failures,
+			LastLogin: a.lastLogin,
+		}
+		if now.Before(a.coolDownUntil) {
+			s.CoolDownUntil = a.coolDownUntil
+		}
+		if a.lastErr != nil {
+			s.LastError = a.lastErr.Error()
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
+
+// Describe implements prometheus.Collector.
+func (p *AccountPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.attemptsDesc
+	ch <- p.healthyDesc
+}
+
+// Collect implements prometheus.Collector.
+func (p *AccountPool) Collect(ch chan<- prometheus.Metric) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	for _, a := range p.accounts {
+		ch <- prometheus.MustNewConstMetric(p.attemptsDesc, prometheus.CounterValue, a.successes, a.Username, loginResultSuccess)
+		ch <- prometheus.MustNewConstMetric(p.attemptsDesc, prometheus.CounterValue, a.attempts-a.successes, a.Username, loginResultFailure)
+
+		healthy := 1.0
+		if a.disabled || now.Before(a.coolDownUntil) {
+			healthy = 0
+		}
+		ch <- prometheus.MustNewConstMetric(p.healthyDesc, prometheus.GaugeValue, healthy, a.Username)
+	}
+}
+
+func (p *AccountPool) update(username string, f func(a *accountState)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, a := range p.accounts {
+		if a.Username == username {
+			f(a)
+			return
+		}
+	}
+}
+
+// LoadAccounts reads accounts from JSON or YAML file with the list under "accounts" key, e.g.
+// {"accounts": [{"username": "john@example.com", "password": "secret"}]}.
+func LoadAccounts(path string) ([]Account, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read accounts file: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read accounts file: %v", err)
+	}
+
+	var accounts []Account
+	if err := v.UnmarshalKey("accounts", &accounts); err != nil {
+		return nil, fmt.Errorf("unmarshaling accounts failed: %v", err)
+	}
+
+	return accounts, nil
+}
+
+// ParseAccounts parses comma separated username:password pairs, e.g. PDAX_ACCOUNTS env var.
+func ParseAccounts(s string) ([]Account, error) {
+	var accounts []Account
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		i := strings.Index(pair, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("account must be username:password pair")
+		}
+		accounts = append(accounts, Account{Username: pair[:i], Password: pair[i+1:]})
+	}
+
+	return accounts, nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccountPoolRotation(t *testing.T) {
+	p := NewAccountPool([]Account{{Username: "a"}, {Username: "b"}, {Username: "c"}}, time.Hour)
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	tests := []struct {
+		name   string
+		before func()
+		want   string
+	}{
+		{"first", func() {}, "a"},
+		{"second", func() {}, "b"},
+		{"third", func() {}, "c"},
+		{"wraps around", func() {}, "a"},
+		{"skips cooling down", func() { p.Failed("b", errors.New("timeout")) }, "c"},
+		{"skips disabled", func() { p.Disable("a", errors.New("wrong password")) }, "c"},
+		{"cooled down account returns", func() { now = now.Add(time.Hour) }, "b"},
+	}
+
+	for _, tc := range tests {
+		tc.before()
+		got, ok := p.Next()
+		if !ok || got.Username != tc.want {
+			t.Errorf("%s: Next() = %q, %v, want %q", tc.name, got.Username, ok, tc.want)
+		}
+	}
+
+	p.Failed("b", errors.New("timeout"))
+	p.Failed("c", errors.New("timeout"))
+	if got, ok := p.Next(); ok {
+		t.Errorf("Next() = %q, want no account while every account is cooling down or disabled", got.Username)
+	}
+	if got := p.Disabled(); got != 1 {
+		t.Errorf("Disabled() = %d, want 1", got)
+	}
+}
+
+func TestAccountPoolCoolDown(t *testing.T) {
+	tests := []struct {
+		name     string
+		coolDown time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{"first failure", time.Hour, 1, time.Hour},
+		{"doubles", time.Hour, 2, 2 * time.Hour},
+		{"doubles again", time.Hour, 3, 4 * time.Hour},
+		{"capped at a day", time.Hour, 6, 24 * time.Hour},
+		{"stays capped", time.Hour, 20, 24 * time.Hour},
+		{"longer than cap", 36 * time.Hour, 1, 24 * time.Hour},
+		{"default", 0, 1, defaultCoolDown},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewAccountPool([]Account{{Username: "a"}}, tc.coolDown)
+			now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+			p.now = func() time.Time { return now }
+
+			for i := 0; i < tc.failures; i++ {
+				p.Failed("a", errors.New("timeout"))
+			}
+			if got := p.Status()[0].CoolDownUntil.Sub(now); got != tc.want {
+				t.Errorf("cool-down after %d failures = %v, want %v", tc.failures, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccountPoolSucceededResetsCoolDown(t *testing.T) {
+	p := NewAccountPool([]Account{{Username: "a"}}, time.Hour)
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	p.Failed("a", errors.New("timeout"))
+	p.Failed("a", errors.New("timeout"))
+	p.Succeeded("a")
+	p.Failed("a", errors.New("timeout"))
+
+	s := p.Status()[0]
+	if s.Failures != 1 {
+		t.Errorf("Failures = %d, want 1", s.Failures)
+	}
+	if got := s.CoolDownUntil.Sub(now); got != time.Hour {
+		t.Errorf("cool-down after success and failure = %v, want %v", got, time.Hour)
+	}
+}
+
+func TestParseAccounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []Account
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"single", "john@example.com:secret", []Account{{"john@example.com", "secret"}}, false},
+		{"colon in password", "a:b:c, d:e", []Account{{"a", "b:c"}, {"d", "e"}}, false},
+		{"missing password", "john", nil, true},
+		{"missing username", ":secret", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseAccounts(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseAccounts(%q) error = %v, want error %v", tc.s, err, tc.wantErr)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("ParseAccounts(%q) = %v, want %v", tc.s, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("ParseAccounts(%q)[%d] = %v, want %v", tc.s, i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package fx loads USD-PHP exchange rates from CSV files or derives them from PDAX trades of USD stablecoins,
+// whose PHP prices proxy the rate.
+package fx
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// Rate sources.
+const (
+	SourceCSV   = "csv"
+	SourceProxy = "proxy"
+)
+
+// DefaultProxyPairs are PDAX pairs of USD stablecoins whose prices proxy USD-PHP rate.
+const DefaultProxyPairs = "USDT-PHP,USDC-PHP"
+
+// ReadCSV reads rates from CSV with a header. Columns time and rate are required, time is RFC 3339 time or
+// YYYY-MM-DD day in UTC. Optional columns pair and source default to USD-PHP and csv.
+func ReadCSV(r io.Reader) ([]monitor.FXRate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"time", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %q is missing", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rates []monitor.FXRate
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		rate := monitor.FXRate{
+			CurrencyPair: field(record, "pair"),
+			Source:       field(record, "source"),
+		}
+		if rate.CurrencyPair == "" {
+			rate.CurrencyPair = monitor.CurrencyPairUSDPHP
+		}
+		if rate.Source == "" {
+			rate.Source = SourceCSV
+		}
+		if rate.Timestamp, err = parseTime(field(record, "time")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid time: %v", line, err)
+		}
+		if rate.Rate, _, err = apd.NewFromString(field(record, "rate")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate: %v", line, err)
+		}
+		if rate.Rate.Sign() <= 0 {
+			return nil, fmt.Errorf("line %d: rate must be positive", line)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// ProxyRates derives USD-PHP rates from trades of USD stablecoin pairs. Every rate is VWAP of trades of all
+// the pairs within an interval, it's made at the interval start. Intervals without trades have no rates.
+func ProxyRates(trades []monitor.Trade, interval time.Duration) []monitor.FXRate {
+	if interval <= 0 {
+		return nil
+	}
+
+	sorted := append([]monitor.Trade(nil), trades...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	ctx := apd.BaseContext.WithPrecision(34)
+	var rates []monitor.FXRate
+	var start time.Time
+	notional, quantity := new(apd.Decimal), new(apd.Decimal)
+	flush := func() {
+		if quantity.Sign() <= 0 {
+			return
+		}
+		rate := new(apd.Decimal)
+		ctx.Quo(rate, notional, quantity)
+		rates = append(rates, monitor.FXRate{
+			CurrencyPair: monitor.CurrencyPairUSDPHP,
+			Timestamp:    start,
+			Rate:         rate,
+			Source:       SourceProxy,
+		})
+	}
+
+	for _, t := range sorted {
+		if s := t.Timestamp.UTC().Truncate(interval); !s.Equal(start) {
+			flush()
+			start = s
+			notional, quantity = new(apd.Decimal), new(apd.Decimal)
+		}
+
+		var amount apd.Decimal
+		ctx.Mul(&amount, t.Price, t.Quantity)
+		ctx.Add(notional, notional, &amount)
+		ctx.Add(quantity, quantity, t.Quantity)
+	}
+	flush()
+
+	return rates
+}
+
+// USDRates returns USD-PHP rates effective within the time range, no rates are returned when the repository is nil.
+func USDRates(ctx context.Context, rep monitor.FXRateRepository, from, to time.Time) (monitor.FXRates, error) {
+	if rep == nil {
+		return nil, nil
+	}
+
+	rates, err := rep.Rates(ctx, monitor.CurrencyPairUSDPHP, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fx rates: %v", err)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,129 @@
+package fx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []monitor.FXRate
+		err  string
+	}{
+		{
+			name: "defaults",
+			csv:  "time,rate\n2022-03-01,50.25\n2022-03-01T08:30:00+08:00, 51\n",
+			want: []monitor.FXRate{
+				{CurrencyPair: "USD-PHP", Timestamp: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Rate: decimal("50.25"), Source: "csv"},
+				{CurrencyPair: "USD-PHP", Timestamp: time.Date(2022, 3, 1, 0, 30, 0, 0, time.UTC), Rate: decimal("51"), Source: "csv"},
+			},
+		},
+		{
+			name: "all columns in any order and case",
+			csv:  "Source, RATE ,Pair,Time\nbsp,0.019,PHP-USD,2022-03-02\n,52,,2022-03-03\n",
+			want: []monitor.FXRate{
+				{CurrencyPair: "PHP-USD", Timestamp: time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), Rate: decimal("0.019"), Source: "bsp"},
+				{CurrencyPair: "USD-PHP", Timestamp: time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC), Rate: decimal("52"), Source: "csv"},
+			},
+		},
+		{name: "header only", csv: "time,rate\n"},
+		{name: "empty", csv: "", err: "failed to read csv header"},
+		{name: "missing rate", csv: "time,price\n2022-03-01,50\n", err: `csv column "rate" is missing`},
+		{name: "missing time", csv: "day,rate\n2022-03-01,50\n", err: `csv column "time" is missing`},
+		{name: "invalid time", csv: "time,rate\n2022-03-01,50\n03/02/2022,50\n", err: "line 3: invalid time"},
+		{name: "invalid rate", csv: "time,rate\n2022-03-01,fifty\n", err: "line 2: invalid rate"},
+		{name: "zero rate", csv: "time,rate\n2022-03-01,0\n", err: "line 2: rate must be positive"},
+		{name: "negative rate", csv: "time,rate\n2022-03-01,-50\n", err: "line 2: rate must be positive"},
+		{name: "uneven rows", csv: "time,rate\n2022-03-01\n", err: "wrong number of fields"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(tc.csv))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("ReadCSV() error = %v, want %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSV() error = %v", err)
+			}
+			assertRates(t, got, tc.want)
+		})
+	}
+}
+
+func TestProxyRates(t *testing.T) {
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	trades := []monitor.Trade{
+		trade("USDC-PHP", start.Add(2*time.Hour+time.Minute), "53", "1"),
+		trade("USDT-PHP", start.Add(time.Minute), "50", "1"),
+		trade("USDC-PHP", start.Add(59*time.Minute), "51", "3"),
+		trade("USDT-PHP", start.Add(time.Hour-time.Nanosecond), "52", "0"),
+		trade("USDT-PHP", start.Add(2*time.Hour), "54", "1"),
+	}
+
+	got := ProxyRates(trades, time.Hour)
+	assertRates(t, got, []monitor.FXRate{
+		{CurrencyPair: "USD-PHP", Timestamp: start, Rate: decimal("50.75"), Source: "proxy"},
+		{CurrencyPair: "USD-PHP", Timestamp: start.Add(2 * time.Hour), Rate: decimal("53.5"), Source: "proxy"},
+	})
+	if !trades[0].Timestamp.Equal(start.Add(2*time.Hour + time.Minute)) {
+		t.Error("ProxyRates() reordered the trades")
+	}
+
+	if got = ProxyRates([]monitor.Trade{trade("USDT-PHP", start, "50", "0")}, time.Hour); len(got) != 0 {
+		t.Errorf("got rates %+v of trades without quantity", got)
+	}
+	if got = ProxyRates(trades, 0); got != nil {
+		t.Errorf("got rates %+v of zero interval", got)
+	}
+}
+
+func TestUSDRates(t *testing.T) {
+	rates, err := USDRates(context.Background(), nil, time.Now(), time.Now())
+	if err != nil || rates != nil {
+		t.Errorf("USDRates() = %v, %v without a repository, want no rates", rates, err)
+	}
+}
+
+func assertRates(t *testing.T, got, want []monitor.FXRate) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d rates %+v, want %d", len(got), got, len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.CurrencyPair != w.CurrencyPair || !g.Timestamp.Equal(w.Timestamp) || g.Rate.Cmp(w.Rate) != 0 || g.Source != w.Source {
+			t.Errorf("rate %d = %s %v %s %s, want %s %v %s %s", i,
+				g.CurrencyPair, g.Timestamp, g.Rate, g.Source, w.CurrencyPair, w.Timestamp, w.Rate, w.Source)
+		}
+	}
+}
+
+func trade(pair string, ts time.Time, price, quantity string) monitor.Trade {
+	return monitor.Trade{
+		ID:           ts.UnixNano(),
+		CurrencyPair: pair,
+		Price:        decimal(price),
+		Quantity:     decimal(quantity),
+		Timestamp:    ts,
+	}
+}
+
+func decimal(s string) *apd.Decimal {
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
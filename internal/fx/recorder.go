@@ -0,0 +1,190 @@
+package fx
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+)
+
+// Recorder stores proxy USD-PHP rates derived from live trades of USD stablecoin pairs, a rate per interval.
+type Recorder struct {
+	hub *live.Hub
+	// trades are read back on start, so trades of the interval in progress made before a restart aren't lost.
+	trades   monitor.TradeRepository
+	rep      monitor.FXRateRepository
+	pairs    []string
+	interval time.Duration
+	logger   log.Logger
+}
+
+// NewRecorder instantiates Recorder which records hourly rates of the default proxy pairs received by the hub,
+// trades stored in the trade repository are merged with them.
+func NewRecorder(hub *live.Hub, trades monitor.TradeRepository, rep monitor.FXRateRepository, options ...RecorderOption) *Recorder {
+	r := Recorder{
+		hub:      hub,
+		trades:   trades,
+		rep:      rep,
+		pairs:    strings.Split(DefaultProxyPairs, ","),
+		interval: time.Hour,
+		logger:   log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&r)
+	}
+
+	return &r
+}
+
+// RecorderOption configures the recorder.
+type RecorderOption func(*Recorder)
+
+// WithPairs configures the proxy currency pairs.
+func WithPairs(pairs ...string) RecorderOption {
+	return func(r *Recorder) {
+		if len(pairs) > 0 {
+			r.pairs = pairs
+		}
+	}
+}
+
+// WithInterval configures how often rates are made.
+func WithInterval(d time.Duration) RecorderOption {
+	return func(r *Recorder) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// WithLogger configures a logger.
+func WithLogger(l log.Logger) RecorderOption {
+	return func(r *Recorder) {
+		r.logger = l
+	}
+}
+
+// Run records rates until the context is done. A rate of the interval is stored once the interval ends,
+// the rate of the interval in progress is stored on shutdown. Trades of the interval in progress stored before
+// the start are read back, so the rate stored on shutdown is replaced by a rate of trades before and after
+// the restart.
+func (r *Recorder) Run(ctx context.Context) error {
+	trades, cancel := r.hub.SubscribeTrades(r.pairs...)
+	defer func() { cancel() }()
+
+	pending, stored := r.storedTrades(ctx, time.Now())
+	keep := func(t monitor.Trade) {
+		if !stored[t.Key()] {
+			pending = append(pending, t)
+		}
+	}
+	timer := time.NewTimer(r.untilNext(time.Now()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Trades received before the shutdown make part of the last rate. The run context is done already,
+			// so the rate is stored with a short-lived one.
+			for _, t := range drain(trades) {
+				keep(t)
+			}
+			storeCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+			r.store(storeCtx, pending)
+			stop()
+			return nil
+
+		case t, ok := <-trades:
+			if !ok {
+				level.Warn(r.logger).Log("msg", "fx recorder fell behind, resubscribing")
+				trades, cancel = r.hub.SubscribeTrades(r.pairs...)
+				continue
+			}
+			keep(t)
+
+		case now := <-timer.C:
+			pending = r.storeDone(ctx, pending, now)
+			stored = nil
+			timer.Reset(r.untilNext(time.Now()))
+		}
+	}
+}
+
+// storedTrades reads trades of the interval in progress from the trade repository, they are keyed
+// by Trade.Key to skip them when they are received live too.
+func (r *Recorder) storedTrades(ctx context.Context, now time.Time) ([]monitor.Trade, map[string]bool) {
+	from := now.UTC().Truncate(r.interval)
+	var trades []monitor.Trade
+	for _, pair := range r.pairs {
+		pairTrades, err := r.trades.Trades(ctx, monitor.TradeQuery{CurrencyPair: pair, From: from, To: from.Add(r.interval)})
+		if err != nil {
+			level.Warn(r.logger).Log("msg", "failed to read stored trades of fx proxy pair", "pair", pair, "err", err)
+			continue
+		}
+		trades = append(trades, pairTrades...)
+	}
+
+	keys := make(map[string]bool, len(trades))
+	for _, t := range trades {
+		keys[t.Key()] = true
+	}
+
+	return trades, keys
+}
+
+// storeDone stores rates of the pending trades made before the interval of the time, the rest are returned.
+func (r *Recorder) storeDone(ctx context.Context, pending []monitor.Trade, now time.Time) []monitor.Trade {
+	boundary := now.UTC().Truncate(r.interval)
+	var done []monitor.Trade
+	i := 0
+	for _, t := range pending {
+		if t.Timestamp.Before(boundary) {
+			done = append(done, t)
+		} else {
+			pending[i] = t
+			i++
+		}
+	}
+
+	r.store(ctx, done)
+
+	return pending[:i]
+}
+
+func (r *Recorder) store(ctx context.Context, trades []monitor.Trade) {
+	rates := ProxyRates(trades, r.interval)
+	if len(rates) == 0 {
+		return
+	}
+
+	if err := r.rep.Upsert(ctx, rates); err != nil {
+		level.Error(r.logger).Log("msg", "failed to store fx rates", "err", err)
+		return
+	}
+	level.Debug(r.logger).Log("msg", "stored fx rates", "count", len(rates))
+}
+
+// drain returns trades waiting in the channel.
+func drain(trades <-chan monitor.Trade) []monitor.Trade {
+	var drained []monitor.Trade
+	for {
+		select {
+		case t, ok := <-trades:
+			if !ok {
+				return drained
+			}
+			drained = append(drained, t)
+		default:
+			return drained
+		}
+	}
+}
+
+func (r *Recorder) untilNext(now time.Time) time.Duration {
+	return now.UTC().Truncate(r.interval).Add(r.interval).Sub(now)
+}
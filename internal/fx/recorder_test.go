@@ -0,0 +1,91 @@
+package fx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+)
+
+func TestRecorderMergesTradesStoredBeforeRestart(t *testing.T) {
+	const interval = 24 * time.Hour
+	start := time.Now().UTC().Truncate(interval)
+	s := memory.NewStorage()
+	stored := []monitor.Trade{
+		trade("USDT-PHP", start.Add(-time.Minute), "1000", "1"), // of the previous interval
+		trade("USDT-PHP", start, "50", "1"),
+		trade("USDC-PHP", start.Add(time.Nanosecond), "52", "1"),
+	}
+	for i := range stored {
+		if err := s.TradeRepository().Insert(context.Background(), &stored[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the rate stored on shutdown before the restart
+	partial := ProxyRates(stored[1:], interval)
+	if err := s.FXRateRepository().Upsert(context.Background(), partial); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := live.NewHub()
+	trades := &readTrades{TradeRepository: s.TradeRepository(), read: make(chan struct{})}
+	r := NewRecorder(hub, trades, s.FXRateRepository(), WithInterval(interval))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	select {
+	case <-trades.read: // trades are read back once the recorder is subscribed
+	case <-time.After(5 * time.Second):
+		t.Fatal("stored trades are not read")
+	}
+	hub.PublishTrade(stored[1]) // stored and received live
+	hub.PublishTrade(trade("USDC-PHP", start.Add(time.Millisecond), "60", "2"))
+	hub.PublishTrade(trade("BTC-PHP", start.Add(time.Millisecond), "2000000", "1"))
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	rates, err := s.FXRateRepository().Rates(context.Background(), monitor.CurrencyPairUSDPHP, start, start.Add(interval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (50*1 + 52*1 + 60*2) / 4
+	assertRates(t, rates, []monitor.FXRate{
+		{CurrencyPair: "USD-PHP", Timestamp: start, Rate: decimal("55.5"), Source: "proxy"},
+	})
+}
+
+func TestDrain(t *testing.T) {
+	trades := make(chan monitor.Trade, 3)
+	trades <- trade("USDT-PHP", time.Now(), "50", "1")
+	trades <- trade("USDT-PHP", time.Now(), "51", "1")
+	if got := drain(trades); len(got) != 2 || len(trades) != 0 {
+		t.Errorf("drained %d trades leaving %d, want 2 leaving none", len(got), len(trades))
+	}
+
+	close(trades)
+	if got := drain(trades); len(got) != 0 {
+		t.Errorf("drained %d trades of closed channel", len(got))
+	}
+}
+
+// readTrades signals when trades are read the first time.
+type readTrades struct {
+	monitor.TradeRepository
+	read chan struct{}
+	once sync.Once
+}
+
+func (r *readTrades) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	defer r.once.Do(func() { close(r.read) })
+
+	return r.TradeRepository.Trades(ctx, q)
+}
@@ -0,0 +1,361 @@
+// Package grpcapi exposes collected PDAX market data over gRPC, the service is defined in proto/pdax/monitor/v1.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/fx"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	monitorv1 "github.com/pudgydoge/pdax-monitor/proto/pdax/monitor/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultRange          = 24 * time.Hour
+	defaultTradeLimit     = 1000
+	maxTradeLimit         = 10000
+	defaultCandleInterval = time.Minute
+	maxCandles            = 10000
+)
+
+// OrderBookSource provides live order books.
+type OrderBookSource interface {
+	OrderBook(currencyPair string) (monitor.OrderBook, bool)
+}
+
+// Server implements monitorv1.MonitorServiceServer.
+type Server struct {
+	monitorv1.UnimplementedMonitorServiceServer
+	TradeRepository monitor.TradeRepository
+	FXRates         monitor.FXRateRepository
+	OrderBooks      OrderBookSource
+	Instruments     *trade.Instruments
+	Hub             *live.Hub
+	Logger          log.Logger
+}
+
+// NewServer instantiates Server.
+func NewServer(options ...ConfigOption) *Server {
+	s := Server{
+		Logger: log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the server.
+type ConfigOption func(*Server)
+
+// WithLogger configures a logger to debug the server.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *Server) {
+		s.Logger = l
+	}
+}
+
+// WithTradeRepository configures trade repository to read trades and candles from.
+func WithTradeRepository(rep monitor.TradeRepository) ConfigOption {
+	return func(s *Server) {
+		s.TradeRepository = rep
+	}
+}
+
+// WithFXRateRepository configures repository of USD-PHP rates to convert notional into USD,
+// notional isn't converted without it.
+func WithFXRateRepository(rep monitor.FXRateRepository) ConfigOption {
+	return func(s *Server) {
+		s.FXRates = rep
+	}
+}
+
+// WithOrderBookSource configures source of live order books sent first to order book subscribers.
+func WithOrderBookSource(src OrderBookSource) ConfigOption {
+	return func(s *Server) {
+		s.OrderBooks = src
+	}
+}
+
+// WithInstruments configures instruments listed as currency pairs.
+func WithInstruments(instruments *trade.Instruments) ConfigOption {
+	return func(s *Server) {
+		s.Instruments = instruments
+	}
+}
+
+// WithHub configures the hub live trades and order books are streamed from.
+func WithHub(hub *live.Hub) ConfigOption {
+	return func(s *Server) {
+		s.Hub = hub
+	}
+}
+
+// ListPairs returns known instruments.
+func (s *Server) ListPairs(ctx context.Context, req *monitorv1.ListPairsRequest) (*monitorv1.ListPairsResponse, error) {
+	var resp monitorv1.ListPairsResponse
+	for _, i := range s.Instruments.All() {
+		resp.Pairs = append(resp.Pairs, &monitorv1.Pair{
+			Symbol:           i.Pair(),
+			Base:             i.Base,
+			Quote:            i.Quote,
+			InstrumentId:     int32(i.ID),
+			PriceDecimals:    int32(i.PriceDecimals),
+			QuantityDecimals: int32(i.QuantityDecimals),
+		})
+	}
+
+	return &resp, nil
+}
+
+// ListTrades returns stored trades of the pair.
+func (s *Server) ListTrades(ctx context.Context, req *monitorv1.ListTradesRequest) (*monitorv1.ListTradesResponse, error) {
+	q, err := tradeQuery(req.GetPair(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	switch limit := req.GetLimit(); {
+	case limit < 0 || limit > maxTradeLimit:
+		return nil, s.status(monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "limit must be within 0 and 10000"})
+	case limit == 0:
+		q.Limit = defaultTradeLimit
+	default:
+		q.Limit = int(limit)
+	}
+
+	trades, err := s.TradeRepository.Trades(ctx, q)
+	if err != nil {
+		return nil, s.status(err)
+	}
+	usd, err := fx.USDRates(ctx, s.FXRates, q.From, q.To)
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	resp := monitorv1.ListTradesResponse{Trades: make([]*monitorv1.Trade, 0, len(trades))}
+	for _, t := range trades {
+		pt := newTrade(t)
+		if v, ok := usd.NotionalUSD(t); ok {
+			pt.NotionalUsd = decimalString(v)
+		}
+		resp.Trades = append(resp.Trades, pt)
+	}
+
+	return &resp, nil
+}
+
+// ListCandles aggregates stored trades of the pair into candles.
+func (s *Server) ListCandles(ctx context.Context, req *monitorv1.ListCandlesRequest) (*monitorv1.ListCandlesResponse, error) {
+	q, err := tradeQuery(req.GetPair(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	interval := defaultCandleInterval
+	if req.GetInterval() != nil {
+		interval = req.GetInterval().AsDuration()
+	}
+	if interval <= 0 {
+		return nil, s.status(monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "interval must be positive"})
+	}
+	if q.To.Sub(q.From)/interval > maxCandles {
+		return nil, s.status(monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "range spans more than 10000 candles"})
+	}
+
+	trades, err := s.TradeRepository.Trades(ctx, q)
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	usd, err := fx.USDRates(ctx, s.FXRates, q.From, q.To)
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	candles := monitor.Candles(trades, interval, usd)
+	resp := monitorv1.ListCandlesResponse{Candles: make([]*monitorv1.Candle, 0, len(candles))}
+	for _, c := range candles {
+		resp.Candles = append(resp.Candles, &monitorv1.Candle{
+			Pair:        c.CurrencyPair,
+			Start:       timestamppb.New(c.Start),
+			Interval:    durationpb.New(c.Interval),
+			Open:        decimalString(c.Open),
+			High:        decimalString(c.High),
+			Low:         decimalString(c.Low),
+			Close:       decimalString(c.Close),
+			Volume:      decimalString(c.Volume),
+			Trades:      int32(c.Trades),
+			Notional:    decimalString(c.Notional),
+			NotionalUsd: decimalString(c.NotionalUSD),
+		})
+	}
+
+	return &resp, nil
+}
+
+// SubscribeTrades streams live trades of the requested pairs.
+func (s *Server) SubscribeTrades(req *monitorv1.SubscribeTradesRequest, stream monitorv1.MonitorService_SubscribeTradesServer) error {
+	if s.Hub == nil {
+		return status.Error(codes.Unavailable, "live trades are not served")
+	}
+
+	trades, cancel := s.Hub.SubscribeTrades(req.GetPairs()...)
+	defer cancel()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t, ok := <-trades:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind live trades")
+			}
+			if err := stream.Send(&monitorv1.SubscribeTradesResponse{Trade: newTrade(t)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SubscribeOrderBook streams the live order book of the pair starting with the current one.
+func (s *Server) SubscribeOrderBook(req *monitorv1.SubscribeOrderBookRequest, stream monitorv1.MonitorService_SubscribeOrderBookServer) error {
+	if s.Hub == nil {
+		return status.Error(codes.Unavailable, "live order books are not served")
+	}
+	if req.GetPair() == "" {
+		return s.status(monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "pair is required"})
+	}
+	depth := int(req.GetDepth())
+
+	books, cancel := s.Hub.SubscribeOrderBook(req.GetPair())
+	defer cancel()
+
+	if s.OrderBooks != nil {
+		if book, ok := s.OrderBooks.OrderBook(req.GetPair()); ok {
+			u := live.BookUpdate{CurrencyPair: req.GetPair(), Timestamp: time.Now(), Book: book.L2()}
+			if err := stream.Send(&monitorv1.SubscribeOrderBookResponse{Book: newOrderBook(u, depth)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case u := <-books:
+			if err := stream.Send(&monitorv1.SubscribeOrderBookResponse{Book: newOrderBook(u, depth)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tradeQuery validates the pair and time range, the range defaults to the last 24 hours.
+func tradeQuery(pair string, from, to *timestamppb.Timestamp) (monitor.TradeQuery, error) {
+	q := monitor.TradeQuery{CurrencyPair: pair, To: time.Now()}
+	if pair == "" {
+		return q, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "pair is required"}
+	}
+
+	if to != nil {
+		if err := to.CheckValid(); err != nil {
+			return q, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "invalid to", Inner: err}
+		}
+		q.To = to.AsTime()
+	}
+	q.From = q.To.Add(-defaultRange)
+	if from != nil {
+		if err := from.CheckValid(); err != nil {
+			return q, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "invalid from", Inner: err}
+		}
+		q.From = from.AsTime()
+	}
+	if !q.From.Before(q.To) {
+		return q, monitor.Error{Code: monitor.ErrorCodeInvalid, Message: "from must be before to"}
+	}
+
+	return q, nil
+}
+
+func newTrade(t monitor.Trade) *monitorv1.Trade {
+	var notional apd.Decimal
+	apd.BaseContext.WithPrecision(34).Mul(&notional, t.Price, t.Quantity)
+
+	return &monitorv1.Trade{
+		Id:       t.ID,
+		Pair:     t.CurrencyPair,
+		Price:    decimalString(t.Price),
+		Quantity: decimalString(t.Quantity),
+		Time:     timestamppb.New(t.Timestamp),
+		Side:     uint32(t.Side),
+		Notional: decimalString(&notional),
+	}
+}
+
+func newOrderBook(u live.BookUpdate, depth int) *monitorv1.OrderBook {
+	book := monitorv1.OrderBook{
+		Pair: u.CurrencyPair,
+		Time: timestamppb.New(u.Timestamp),
+		Bids: newBookLevels(u.Book.Bids, depth),
+		Asks: newBookLevels(u.Book.Asks, depth),
+	}
+
+	return &book
+}
+
+func newBookLevels(levels []monitor.BookLevel, depth int) []*monitorv1.BookLevel {
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+
+	out := make([]*monitorv1.BookLevel, 0, len(levels))
+	for _, l := range levels {
+		out = append(out, &monitorv1.BookLevel{
+			Price:    decimalString(l.Price),
+			Quantity: decimalString(l.Quantity),
+			Orders:   int32(l.Orders),
+		})
+	}
+
+	return out
+}
+
+func decimalString(d *apd.Decimal) string {
+	if d == nil {
+		return ""
+	}
+
+	return d.Text('f')
+}
+
+// status converts the error into gRPC status, internal errors are logged and not disclosed.
+func (s *Server) status(err error) error {
+	var e monitor.Error
+	errors.As(err, &e)
+
+	switch e.Code {
+	case monitor.ErrorCodeInvalid:
+		return status.Error(codes.InvalidArgument, e.Message)
+	case monitor.ErrorCodeNotFound:
+		return status.Error(codes.NotFound, e.Message)
+	default:
+		level.Error(s.Logger).Log("msg", "grpc request failed", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
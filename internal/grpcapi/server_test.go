@@ -0,0 +1,272 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+	monitorv1 "github.com/pudgydoge/pdax-monitor/proto/pdax/monitor/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var testStart = time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+
+func TestListTradesAndCandles(t *testing.T) {
+	s := memory.NewStorage()
+	for i, price := range []string{"100", "102", "101"} {
+		tr := monitor.Trade{
+			ID:           int64(i + 1),
+			CurrencyPair: "BTC-PHP",
+			Price:        decimal(t, price),
+			Quantity:     decimal(t, "0.5"),
+			Timestamp:    testStart.Add(time.Duration(i) * 20 * time.Second),
+			Side:         monitor.SideBid,
+		}
+		if err := s.TradeRepository().Insert(context.Background(), &tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	client := newTestClient(t, NewServer(WithTradeRepository(s.TradeRepository())))
+	ctx := context.Background()
+
+	trades, err := client.ListTrades(ctx, &monitorv1.ListTradesRequest{
+		Pair: "BTC-PHP", From: timestamppb.New(testStart), To: timestamppb.New(testStart.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("ListTrades() error = %v", err)
+	}
+	if len(trades.GetTrades()) != 3 {
+		t.Fatalf("ListTrades() returned %d trades, want 3", len(trades.GetTrades()))
+	}
+	if tr := trades.GetTrades()[0]; tr.GetPrice() != "100" || tr.GetNotional() != "50.0" || tr.GetSide() != uint32(monitor.SideBid) {
+		t.Errorf("ListTrades() first trade = %v, want price 100, notional 50.0 and bid side", tr)
+	}
+
+	candles, err := client.ListCandles(ctx, &monitorv1.ListCandlesRequest{
+		Pair: "BTC-PHP", From: timestamppb.New(testStart), To: timestamppb.New(testStart.Add(time.Hour)),
+		Interval: durationpb.New(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("ListCandles() error = %v", err)
+	}
+	if len(candles.GetCandles()) != 1 {
+		t.Fatalf("ListCandles() returned %d candles, want 1", len(candles.GetCandles()))
+	}
+	if c := candles.GetCandles()[0]; c.GetOpen() != "100" || c.GetHigh() != "102" || c.GetLow() != "100" ||
+		c.GetClose() != "101" || c.GetTrades() != 3 {
+		t.Errorf("ListCandles() candle = %v, want OHLC 100, 102, 100, 101 of 3 trades", c)
+	}
+}
+
+func TestListValidation(t *testing.T) {
+	client := newTestClient(t, NewServer(WithTradeRepository(memory.NewStorage().TradeRepository())))
+	ctx := context.Background()
+	from, to := timestamppb.New(testStart), timestamppb.New(testStart.Add(time.Hour))
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"trades without pair", func() error {
+			_, err := client.ListTrades(ctx, &monitorv1.ListTradesRequest{})
+			return err
+		}},
+		{"trades from after to", func() error {
+			_, err := client.ListTrades(ctx, &monitorv1.ListTradesRequest{Pair: "BTC-PHP", From: to, To: from})
+			return err
+		}},
+		{"trades negative limit", func() error {
+			_, err := client.ListTrades(ctx, &monitorv1.ListTradesRequest{Pair: "BTC-PHP", Limit: -1})
+			return err
+		}},
+		{"trades limit too big", func() error {
+			_, err := client.ListTrades(ctx, &monitorv1.ListTradesRequest{Pair: "BTC-PHP", Limit: maxTradeLimit + 1})
+			return err
+		}},
+		{"candles without pair", func() error {
+			_, err := client.ListCandles(ctx, &monitorv1.ListCandlesRequest{})
+			return err
+		}},
+		{"candles zero interval", func() error {
+			_, err := client.ListCandles(ctx, &monitorv1.ListCandlesRequest{Pair: "BTC-PHP", Interval: durationpb.New(0)})
+			return err
+		}},
+		{"candles too many", func() error {
+			_, err := client.ListCandles(ctx, &monitorv1.ListCandlesRequest{
+				Pair: "BTC-PHP", From: from, To: to, Interval: durationpb.New(time.Millisecond),
+			})
+			return err
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := status.Code(tc.call()); code != codes.InvalidArgument {
+				t.Errorf("got code %v, want %v", code, codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestSubscribeTrades(t *testing.T) {
+	hub := live.NewHub()
+	client := newTestClient(t, NewServer(WithHub(hub)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.SubscribeTrades(ctx, &monitorv1.SubscribeTradesRequest{Pairs: []string{"ETH-PHP"}})
+	if err != nil {
+		t.Fatalf("SubscribeTrades() error = %v", err)
+	}
+
+	// the subscription is registered once the server handles the stream, trades are published till then
+	go func() {
+		for i := int64(1); ctx.Err() == nil; i++ {
+			hub.PublishTrade(monitor.Trade{ID: i, CurrencyPair: "BTC-PHP", Price: decimal(t, "1"), Quantity: decimal(t, "1")})
+			hub.PublishTrade(monitor.Trade{ID: i, CurrencyPair: "ETH-PHP", Price: decimal(t, "2"), Quantity: decimal(t, "3")})
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		if tr := resp.GetTrade(); tr.GetPair() != "ETH-PHP" || tr.GetNotional() != "6" {
+			t.Errorf("Recv() trade = %v, want ETH-PHP trade with notional 6", tr)
+		}
+	}
+}
+
+func TestSubscribeOrderBook(t *testing.T) {
+	hub := live.NewHub()
+	books := bookSource{"BTC-PHP": l2Book{
+		Bids: []monitor.BookLevel{bookLevel(t, monitor.SideBid, "99", "1"), bookLevel(t, monitor.SideBid, "98", "2")},
+		Asks: []monitor.BookLevel{bookLevel(t, monitor.SideAsk, "101", "3")},
+	}}
+	client := newTestClient(t, NewServer(WithHub(hub), WithOrderBookSource(books)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.SubscribeOrderBook(ctx, &monitorv1.SubscribeOrderBookRequest{Pair: "BTC-PHP", Depth: 1})
+	if err != nil {
+		t.Fatalf("SubscribeOrderBook() error = %v", err)
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if b := resp.GetBook(); len(b.GetBids()) != 1 || b.GetBids()[0].GetPrice() != "99" || len(b.GetAsks()) != 1 {
+		t.Errorf("first book = %v, want the current book cut to depth 1", b)
+	}
+
+	if !hub.WantsOrderBook("BTC-PHP") {
+		t.Fatal("WantsOrderBook() = false after the current book is sent")
+	}
+	hub.PublishOrderBook(live.BookUpdate{CurrencyPair: "BTC-PHP", Timestamp: testStart, Book: monitor.L2Book{
+		Bids: []monitor.BookLevel{bookLevel(t, monitor.SideBid, "100", "5")},
+	}})
+	if resp, err = stream.Recv(); err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if b := resp.GetBook(); len(b.GetBids()) != 1 || b.GetBids()[0].GetPrice() != "100" || !b.GetTime().AsTime().Equal(testStart) {
+		t.Errorf("published book = %v, want bid 100 at %v", b, testStart)
+	}
+
+	invalid, err := client.SubscribeOrderBook(ctx, &monitorv1.SubscribeOrderBookRequest{})
+	if err != nil {
+		t.Fatalf("SubscribeOrderBook() error = %v", err)
+	}
+	if _, err = invalid.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Recv() without pair error = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestSubscribeWithoutHub(t *testing.T) {
+	client := newTestClient(t, NewServer())
+
+	stream, err := client.SubscribeTrades(context.Background(), &monitorv1.SubscribeTradesRequest{})
+	if err != nil {
+		t.Fatalf("SubscribeTrades() error = %v", err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv() error = %v, want %v", err, codes.Unavailable)
+	}
+}
+
+func newTestClient(t *testing.T, s *Server) monitorv1.MonitorServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	monitorv1.RegisterMonitorServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.Dial() error = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return monitorv1.NewMonitorServiceClient(conn)
+}
+
+func decimal(t *testing.T, s string) *apd.Decimal {
+	t.Helper()
+
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		t.Fatalf("apd.NewFromString(%q) error = %v", s, err)
+	}
+
+	return d
+}
+
+func bookLevel(t *testing.T, side uint8, price, quantity string) monitor.BookLevel {
+	t.Helper()
+
+	return monitor.BookLevel{Side: side, Price: decimal(t, price), Quantity: decimal(t, quantity), Orders: 1}
+}
+
+// l2Book is an order book which is already aggregated.
+type l2Book monitor.L2Book
+
+func (b l2Book) Apply(monitor.OrderBookUpdate) error { return nil }
+
+func (b l2Book) Instrument() (int, bool) { return 0, false }
+
+func (b l2Book) Orders() []monitor.Order {
+	return nil
+}
+
+func (b l2Book) L2() monitor.L2Book {
+	return monitor.L2Book(b)
+}
+
+type bookSource map[string]monitor.OrderBook
+
+func (s bookSource) OrderBook(pair string) (monitor.OrderBook, bool) {
+	b, ok := s[pair]
+	return b, ok
+}
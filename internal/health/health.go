@@ -0,0 +1,231 @@
+// Package health reports readiness and detailed status of the monitor over HTTP.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pudgydoge/pdax-monitor/internal/service"
+)
+
+const (
+	defaultMaxFrameAge = 2 * time.Minute
+	pingTimeout        = 3 * time.Second
+)
+
+// StatusSource provides the monitor state.
+type StatusSource interface {
+	Status() service.Status
+}
+
+// Pinger checks a dependency, e.g. the database, is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Handler serves /readyz and /status.
+type Handler struct {
+	Monitor     StatusSource
+	Database    Pinger
+	MaxFrameAge time.Duration
+	Logger      log.Logger
+	mux         *http.ServeMux
+}
+
+// NewHandler instantiates Handler.
+func NewHandler(options ...ConfigOption) *Handler {
+	h := Handler{
+		MaxFrameAge: defaultMaxFrameAge,
+		Logger:      log.NewNopLogger(),
+		mux:         http.NewServeMux(),
+	}
+
+	for _, opt := range options {
+		opt(&h)
+	}
+
+	h.mux.HandleFunc("/readyz", h.readyz)
+	h.mux.HandleFunc("/status", h.status)
+
+	return &h
+}
+
+// ConfigOption configures the handler.
+type ConfigOption func(*Handler)
+
+// WithLogger configures a logger to debug the handler.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(h *Handler) {
+		h.Logger = l
+	}
+}
+
+// WithStatusSource configures source of the monitor state.
+func WithStatusSource(src StatusSource) ConfigOption {
+	return func(h *Handler) {
+		h.Monitor = src
+	}
+}
+
+// WithDatabase configures the database to ping.
+func WithDatabase(db Pinger) ConfigOption {
+	return func(h *Handler) {
+		h.Database = db
+	}
+}
+
+// WithMaxFrameAge configures how long the monitor stays ready without websocket frames.
+func WithMaxFrameAge(d time.Duration) ConfigOption {
+	return func(h *Handler) {
+		h.MaxFrameAge = d
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type report struct {
+	Ready      bool             `json:"ready"`
+	Reasons    []string         `json:"reasons,omitempty"`
+	State      string           `json:"state"`
+	StateSince time.Time        `json:"state_since"`
+	RetryAt    *time.Time       `json:"retry_at,omitempty"`
+	Auth       authReport       `json:"auth"`
+	Websocket  websocketReport  `json:"websocket"`
+	Trades     map[string]trade `json:"trades"`
+	Queues     map[string]int   `json:"queues"`
+	Database   *databaseReport  `json:"database,omitempty"`
+}
+
+type authReport struct {
+	LoggedIn  bool       `json:"logged_in"`
+	LastLogin *time.Time `json:"last_login,omitempty"`
+	ErrorCode string     `json:"error_code,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type websocketReport struct {
+	Connected       bool       `json:"connected"`
+	ConnectedAt     *time.Time `json:"connected_at,omitempty"`
+	LastFrameAt     *time.Time `json:"last_frame_at,omitempty"`
+	LastFrameAgeSec *float64   `json:"last_frame_age_seconds,omitempty"`
+	Frames          uint64     `json:"frames"`
+}
+
+type trade struct {
+	LastTradeAt time.Time `json:"last_trade_at"`
+	AgeSec      float64   `json:"age_seconds"`
+}
+
+type databaseReport struct {
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	rep := h.report(r.Context())
+	if !rep.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, reason := range rep.Reasons {
+			w.Write([]byte(reason + "\n"))
+		}
+		return
+	}
+
+	w.Write([]byte("ok"))
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	rep := h.report(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if !rep.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		level.Warn(h.Logger).Log("msg", "failed to write status response", "err", err)
+	}
+}
+
+// report collects the state, the monitor is ready when it streams frames and the database is reachable.
+func (h *Handler) report(ctx context.Context) report {
+	now := time.Now()
+	rep := report{Ready: true, Trades: make(map[string]trade), Queues: make(map[string]int)}
+	notReady := func(reason string) {
+		rep.Ready = false
+		rep.Reasons = append(rep.Reasons, reason)
+	}
+
+	if h.Monitor != nil {
+		h.monitorReport(&rep, now, notReady)
+	}
+
+	if h.Database != nil {
+		ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+
+		start := time.Now()
+		err := h.Database.Ping(ctx)
+		rep.Database = &databaseReport{OK: err == nil, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			rep.Database.Error = err.Error()
+			notReady("database is unreachable")
+		}
+	}
+
+	return rep
+}
+
+// monitorReport adds the monitor state to the report, the monitor is ready when it streams frames.
+func (h *Handler) monitorReport(rep *report, now time.Time, notReady func(reason string)) {
+	s := h.Monitor.Status()
+	rep.State = s.State
+	rep.StateSince = s.StateSince
+	rep.RetryAt = optionalTime(s.RetryAt)
+	rep.Auth = authReport{
+		LoggedIn:  s.Auth.LoggedIn,
+		LastLogin: optionalTime(s.Auth.LastLogin),
+		ErrorCode: s.Auth.ErrorCode,
+		Error:     s.Auth.Error,
+	}
+	rep.Websocket = websocketReport{
+		Connected:   s.Websocket.Connected,
+		ConnectedAt: optionalTime(s.Websocket.ConnectedAt),
+		LastFrameAt: optionalTime(s.Websocket.LastFrameAt),
+		Frames:      s.Websocket.Frames,
+	}
+	for pair, t := range s.LastTrades {
+		rep.Trades[pair] = trade{LastTradeAt: t, AgeSec: now.Sub(t).Seconds()}
+	}
+	rep.Queues = s.Queues
+
+	if s.State != service.StateStreaming {
+		notReady("monitor is " + s.State)
+	}
+	if !s.Websocket.Connected {
+		notReady("websocket is not connected")
+	}
+	if !s.Websocket.LastFrameAt.IsZero() {
+		age := now.Sub(s.Websocket.LastFrameAt)
+		ageSec := age.Seconds()
+		rep.Websocket.LastFrameAgeSec = &ageSec
+		if s.Websocket.Connected && age > h.MaxFrameAge {
+			notReady("no websocket frames for " + age.Truncate(time.Second).String())
+		}
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pudgydoge/pdax-monitor/internal/service"
+)
+
+func TestStatusReportsQueues(t *testing.T) {
+	h := NewHandler(WithStatusSource(statusFunc(func() service.Status {
+		return service.Status{
+			State:     service.StateStreaming,
+			Websocket: service.WebsocketStatus{Connected: true, LastFrameAt: time.Now()},
+			Queues:    map[string]int{"decode": 3, "repository": 1, service.QueuePublish: 42},
+		}
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	var rep struct {
+		Ready  bool           `json:"ready"`
+		Queues map[string]int `json:"queues"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Ready {
+		t.Error("streaming monitor is not ready")
+	}
+	if rep.Queues["decode"] != 3 || rep.Queues["repository"] != 1 || rep.Queues[service.QueuePublish] != 42 {
+		t.Errorf("got queues %v", rep.Queues)
+	}
+}
+
+type statusFunc func() service.Status
+
+func (f statusFunc) Status() service.Status {
+	return f()
+}
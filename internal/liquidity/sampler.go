@@ -0,0 +1,217 @@
+// Package liquidity samples liquidity figures of live PDAX order books.
+package liquidity
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	defaultInterval = time.Minute
+	sideBid         = "bid"
+	sideAsk         = "ask"
+	sideBuy         = "buy"
+	sideSell        = "sell"
+)
+
+// DepthPercents are the distances off the mid price the cumulative depth is sampled at.
+func DepthPercents() []float64 {
+	return []float64{0.5, 1, 2}
+}
+
+// BookSource provides live order books by currency pair.
+type BookSource interface {
+	OrderBooks() map[string]monitor.OrderBook
+}
+
+// Sampler periodically records liquidity figures of live order books.
+type Sampler struct {
+	Books      BookSource
+	Repository monitor.BookMetricsRepository
+	Interval   time.Duration
+	// Notionals are quote currency (PHP) amounts slippage is estimated for.
+	Notionals []*apd.Decimal
+	Logger    log.Logger
+
+	registerer prometheus.Registerer
+	spread     *prometheus.GaugeVec
+	topSize    *prometheus.GaugeVec
+	depth      *prometheus.GaugeVec
+	slippage   *prometheus.GaugeVec
+}
+
+// NewSampler instantiates Sampler.
+func NewSampler(books BookSource, options ...ConfigOption) *Sampler {
+	s := Sampler{
+		Books:      books,
+		Interval:   defaultInterval,
+		Logger:     log.NewNopLogger(),
+		registerer: prometheus.DefaultRegisterer,
+		spread: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pdax_book_spread_bps",
+			Help: "Spread between the best ask and the best bid in basis points of the mid price.",
+		}, []string{"pair"}),
+		topSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pdax_book_top_size",
+			Help: "Quantity at the best price level.",
+		}, []string{"pair", "side"}),
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pdax_book_depth",
+			Help: "Cumulative quantity within the percent of the mid price.",
+		}, []string{"pair", "side", "percent"}),
+		slippage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pdax_book_slippage_bps",
+			Help: "Estimated market order slippage off the mid price in basis points for the PHP notional.",
+		}, []string{"pair", "side", "notional"}),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	s.registerer.MustRegister(s.spread, s.topSize, s.depth, s.slippage)
+
+	return &s
+}
+
+// ConfigOption configures the sampler.
+type ConfigOption func(*Sampler)
+
+// WithLogger configures a logger to debug the sampler.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *Sampler) {
+		s.Logger = l
+	}
+}
+
+// WithRepository configures repository to store samples in.
+func WithRepository(rep monitor.BookMetricsRepository) ConfigOption {
+	return func(s *Sampler) {
+		s.Repository = rep
+	}
+}
+
+// WithInterval configures how often books are sampled.
+func WithInterval(d time.Duration) ConfigOption {
+	return func(s *Sampler) {
+		s.Interval = d
+	}
+}
+
+// WithNotionals configures PHP notionals to estimate slippage for.
+func WithNotionals(notionals []*apd.Decimal) ConfigOption {
+	return func(s *Sampler) {
+		s.Notionals = notionals
+	}
+}
+
+// WithRegisterer configures Prometheus registerer for the sampler's metrics.
+func WithRegisterer(r prometheus.Registerer) ConfigOption {
+	return func(s *Sampler) {
+		s.registerer = r
+	}
+}
+
+// Run samples order books every interval until the context is canceled.
+func (s *Sampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			for pair, book := range s.Books.OrderBooks() {
+				m := s.Sample(pair, book.L2(), now)
+				s.observe(&m)
+
+				if s.Repository == nil {
+					continue
+				}
+				if err := s.Repository.Insert(ctx, &m); err != nil {
+					level.Error(s.Logger).Log("msg", "error saving book metrics to db", "pair", pair, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// Sample calculates liquidity figures of the book.
+func (s *Sampler) Sample(pair string, book monitor.L2Book, now time.Time) monitor.BookMetrics {
+	m := monitor.BookMetrics{
+		CurrencyPair: pair,
+		Timestamp:    now,
+	}
+
+	if l, ok := book.BestBid(); ok {
+		m.BidSize = l.Quantity
+	}
+	if l, ok := book.BestAsk(); ok {
+		m.AskSize = l.Quantity
+	}
+
+	spread, okSpread := book.Spread()
+	mid, okMid := book.Mid()
+	if okSpread && okMid && !mid.IsZero() {
+		ctx := apd.BaseContext.WithPrecision(16)
+		m.SpreadBps = new(apd.Decimal)
+		ctx.Quo(m.SpreadBps, spread, mid)
+		ctx.Mul(m.SpreadBps, m.SpreadBps, apd.New(10000, 0))
+	}
+
+	for _, percent := range DepthPercents() {
+		if bids, asks, ok := book.Depth(percent); ok {
+			m.Depth = append(m.Depth, monitor.BookDepth{Percent: percent, Bids: bids, Asks: asks})
+		}
+	}
+
+	for _, notional := range s.Notionals {
+		slippage := monitor.BookSlippage{Notional: notional}
+		slippage.BuyBps, _ = book.Slippage(monitor.SideBid, notional)
+		slippage.SellBps, _ = book.Slippage(monitor.SideAsk, notional)
+		m.Slippage = append(m.Slippage, slippage)
+	}
+
+	return m
+}
+
+func (s *Sampler) observe(m *monitor.BookMetrics) {
+	setGauge(s.spread.WithLabelValues(m.CurrencyPair), m.SpreadBps)
+	setGauge(s.topSize.WithLabelValues(m.CurrencyPair, sideBid), m.BidSize)
+	setGauge(s.topSize.WithLabelValues(m.CurrencyPair, sideAsk), m.AskSize)
+
+	for _, d := range m.Depth {
+		percent := strconv.FormatFloat(d.Percent, 'f', -1, 64)
+		setGauge(s.depth.WithLabelValues(m.CurrencyPair, sideBid, percent), d.Bids)
+		setGauge(s.depth.WithLabelValues(m.CurrencyPair, sideAsk, percent), d.Asks)
+	}
+
+	for _, sl := range m.Slippage {
+		setGauge(s.slippage.WithLabelValues(m.CurrencyPair, sideBuy, sl.Notional.String()), sl.BuyBps)
+		setGauge(s.slippage.WithLabelValues(m.CurrencyPair, sideSell, sl.Notional.String()), sl.SellBps)
+	}
+}
+
+// setGauge sets the gauge to the decimal value, missing values are exposed as NaN.
+func setGauge(g prometheus.Gauge, d *apd.Decimal) {
+	if d == nil {
+		g.Set(math.NaN())
+		return
+	}
+
+	f, err := d.Float64()
+	if err != nil {
+		g.Set(math.NaN())
+		return
+	}
+	g.Set(f)
+}
@@ -0,0 +1,154 @@
+package liquidity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestSamplerSample(t *testing.T) {
+	s := NewSampler(nil, WithRegisterer(prometheus.NewRegistry()), WithNotionals([]*apd.Decimal{
+		decimal(t, "200"), decimal(t, "1000000"),
+	}))
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	m := s.Sample("BTC-PHP", testBook(t), now)
+	if m.CurrencyPair != "BTC-PHP" || !m.Timestamp.Equal(now) {
+		t.Errorf("Sample() = %s at %v, want BTC-PHP at %v", m.CurrencyPair, m.Timestamp, now)
+	}
+	if m.BidSize.Cmp(decimal(t, "2")) != 0 || m.AskSize.Cmp(decimal(t, "1")) != 0 {
+		t.Errorf("top sizes = %v, %v, want 2, 1", m.BidSize, m.AskSize)
+	}
+	// spread of 2 off mid of 100
+	if m.SpreadBps.Cmp(decimal(t, "200")) != 0 {
+		t.Errorf("SpreadBps = %v, want 200", m.SpreadBps)
+	}
+	if len(m.Depth) != len(DepthPercents()) {
+		t.Fatalf("got %d depths, want %d", len(m.Depth), len(DepthPercents()))
+	}
+	if d := m.Depth[len(m.Depth)-1]; d.Bids.Cmp(decimal(t, "5")) != 0 || d.Asks.Cmp(decimal(t, "1")) != 0 {
+		t.Errorf("depth within %v%% = %v, %v, want 5, 1", d.Percent, d.Bids, d.Asks)
+	}
+	if len(m.Slippage) != 2 {
+		t.Fatalf("got %d slippages, want 2", len(m.Slippage))
+	}
+	if sl := m.Slippage[0]; sl.BuyBps == nil || sl.SellBps == nil {
+		t.Errorf("slippage of %v = %v, %v, want both sides", sl.Notional, sl.BuyBps, sl.SellBps)
+	}
+	if sl := m.Slippage[1]; sl.BuyBps != nil || sl.SellBps != nil {
+		t.Errorf("slippage of %v = %v, %v, want nil as the book is not deep enough", sl.Notional, sl.BuyBps, sl.SellBps)
+	}
+
+	empty := s.Sample("ETH-PHP", monitor.L2Book{}, now)
+	if empty.SpreadBps != nil || empty.BidSize != nil || len(empty.Depth) != 0 {
+		t.Errorf("Sample() of empty book = %+v, want no figures", empty)
+	}
+}
+
+func TestSamplerRun(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	rep := &metricsRepository{}
+	books := bookSource{"BTC-PHP": l2Book(testBook(t))}
+	s := NewSampler(books, WithRegisterer(registry), WithRepository(rep), WithInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for rep.len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if rep.len() < 2 {
+		t.Fatalf("stored %d samples, want at least 2", rep.len())
+	}
+	if got := testutil.ToFloat64(s.spread.WithLabelValues("BTC-PHP")); got != 200 {
+		t.Errorf("pdax_book_spread_bps = %v, want 200", got)
+	}
+	if got := testutil.ToFloat64(s.topSize.WithLabelValues("BTC-PHP", sideBid)); got != 2 {
+		t.Errorf("pdax_book_top_size bid = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(s.depth.WithLabelValues("BTC-PHP", sideAsk, "2")); got != 1 {
+		t.Errorf("pdax_book_depth ask 2%% = %v, want 1", got)
+	}
+}
+
+// testBook has best bid 99 and best ask 101, so mid is 100.
+func testBook(t *testing.T) monitor.L2Book {
+	t.Helper()
+
+	return monitor.L2Book{
+		Bids: []monitor.BookLevel{
+			{Side: monitor.SideBid, Price: decimal(t, "99"), Quantity: decimal(t, "2"), Orders: 1},
+			{Side: monitor.SideBid, Price: decimal(t, "98.5"), Quantity: decimal(t, "3"), Orders: 2},
+		},
+		Asks: []monitor.BookLevel{
+			{Side: monitor.SideAsk, Price: decimal(t, "101"), Quantity: decimal(t, "1"), Orders: 1},
+			{Side: monitor.SideAsk, Price: decimal(t, "103"), Quantity: decimal(t, "4"), Orders: 1},
+		},
+	}
+}
+
+func decimal(t *testing.T, s string) *apd.Decimal {
+	t.Helper()
+
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		t.Fatalf("apd.NewFromString(%q) error = %v", s, err)
+	}
+
+	return d
+}
+
+// l2Book is an order book which is already aggregated.
+type l2Book monitor.L2Book
+
+func (b l2Book) Apply(monitor.OrderBookUpdate) error { return nil }
+
+func (b l2Book) Instrument() (int, bool) { return 0, false }
+
+func (b l2Book) Orders() []monitor.Order {
+	return nil
+}
+
+func (b l2Book) L2() monitor.L2Book {
+	return monitor.L2Book(b)
+}
+
+type bookSource map[string]monitor.OrderBook
+
+func (s bookSource) OrderBooks() map[string]monitor.OrderBook {
+	return s
+}
+
+type metricsRepository struct {
+	lock    sync.Mutex
+	metrics []monitor.BookMetrics
+}
+
+func (r *metricsRepository) Insert(_ context.Context, m *monitor.BookMetrics) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.metrics = append(r.metrics, *m)
+	return nil
+}
+
+func (r *metricsRepository) len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.metrics)
+}
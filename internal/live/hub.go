@@ -0,0 +1,153 @@
+// Package live fans out trades and order books received by the monitor to in-process subscribers,
+// e.g. streaming API clients. Publishing never blocks the monitor.
+package live
+
+import (
+	"sync"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const defaultTradeBuffer = 1024
+
+// BookUpdate is the order book of the currency pair after an update.
+type BookUpdate struct {
+	CurrencyPair string
+	Timestamp    time.Time
+	Book         monitor.L2Book
+}
+
+// Hub delivers published trades and order books to subscribers, it's safe for concurrent use.
+type Hub struct {
+	mu          sync.Mutex
+	tradeBuffer int
+	tradeSubs   map[chan monitor.Trade]map[string]bool
+	bookSubs    map[chan BookUpdate]string
+}
+
+// NewHub instantiates Hub.
+func NewHub(options ...ConfigOption) *Hub {
+	h := Hub{
+		tradeBuffer: defaultTradeBuffer,
+		tradeSubs:   make(map[chan monitor.Trade]map[string]bool),
+		bookSubs:    make(map[chan BookUpdate]string),
+	}
+
+	for _, opt := range options {
+		opt(&h)
+	}
+
+	return &h
+}
+
+// ConfigOption configures the hub.
+type ConfigOption func(*Hub)
+
+// WithTradeBuffer configures how many trades wait for a subscriber before it's dropped.
+func WithTradeBuffer(n int) ConfigOption {
+	return func(h *Hub) {
+		if n > 0 {
+			h.tradeBuffer = n
+		}
+	}
+}
+
+// SubscribeTrades subscribes to trades of the currency pairs, or all trades when no pairs are given.
+// The channel is closed by the returned cancel func, or by the hub when the subscriber falls behind
+// by more than the trade buffer, so a subscriber never misses trades silently.
+func (h *Hub) SubscribeTrades(pairs ...string) (<-chan monitor.Trade, func()) {
+	var filter map[string]bool
+	if len(pairs) > 0 {
+		filter = make(map[string]bool, len(pairs))
+		for _, p := range pairs {
+			filter[p] = true
+		}
+	}
+
+	c := make(chan monitor.Trade, h.tradeBuffer)
+	h.mu.Lock()
+	h.tradeSubs[c] = filter
+	h.mu.Unlock()
+
+	return c, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.tradeSubs[c]; ok {
+			delete(h.tradeSubs, c)
+			close(c)
+		}
+	}
+}
+
+// SubscribeOrderBook subscribes to order books of the currency pair. Only the latest book waits
+// for the subscriber, books it hasn't received yet are replaced. The channel is closed by the returned cancel func.
+func (h *Hub) SubscribeOrderBook(pair string) (<-chan BookUpdate, func()) {
+	c := make(chan BookUpdate, 1)
+	h.mu.Lock()
+	h.bookSubs[c] = pair
+	h.mu.Unlock()
+
+	return c, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.bookSubs[c]; ok {
+			delete(h.bookSubs, c)
+			close(c)
+		}
+	}
+}
+
+// PublishTrade delivers the trade to its subscribers, subscribers which are full are dropped.
+func (h *Hub) PublishTrade(t monitor.Trade) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c, filter := range h.tradeSubs {
+		if filter != nil && !filter[t.CurrencyPair] {
+			continue
+		}
+
+		select {
+		case c <- t:
+		default:
+			delete(h.tradeSubs, c)
+			close(c)
+		}
+	}
+}
+
+// WantsOrderBook tells whether the pair has order book subscribers, so books are not aggregated for nobody.
+func (h *Hub) WantsOrderBook(pair string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, p := range h.bookSubs {
+		if p == pair {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublishOrderBook delivers the book to its subscribers replacing books they haven't received yet.
+func (h *Hub) PublishOrderBook(u BookUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c, pair := range h.bookSubs {
+		if pair != u.CurrencyPair {
+			continue
+		}
+
+		// the hub is the only sender, so the channel has room once the stale book is taken out
+		select {
+		case <-c:
+		default:
+		}
+		c <- u
+	}
+}
@@ -0,0 +1,315 @@
+// Package memory is an in-memory storage of trades, order book snapshots and liquidity samples, meant for tests.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// Storage keeps records in memory, it's safe for concurrent use.
+type Storage struct {
+	mu          sync.RWMutex
+	trades      []monitor.Trade
+	tradeKeys   map[string]bool
+	snapshots   map[string][]monitor.OrderBookSnapshot
+	bookMetrics []monitor.BookMetrics
+	fxRates     []monitor.FXRate
+	findings    []monitor.Finding
+
+	trade       *tradeRepository
+	order       *orderRepository
+	bookMetricR *bookMetricsRepository
+	fxRate      *fxRateRepository
+	finding     *findingRepository
+}
+
+// NewStorage instantiates empty Storage.
+func NewStorage() *Storage {
+	s := Storage{
+		tradeKeys: make(map[string]bool),
+		snapshots: make(map[string][]monitor.OrderBookSnapshot),
+	}
+	s.trade = &tradeRepository{storage: &s}
+	s.order = &orderRepository{storage: &s}
+	s.bookMetricR = &bookMetricsRepository{storage: &s}
+	s.fxRate = &fxRateRepository{storage: &s}
+	s.finding = &findingRepository{storage: &s}
+
+	return &s
+}
+
+// TradeRepository returns trade repository of the storage.
+func (s *Storage) TradeRepository() monitor.TradeRepository {
+	return s.trade
+}
+
+// OrderRepository returns order book snapshot repository of the storage.
+func (s *Storage) OrderRepository() monitor.OrderRepository {
+	return s.order
+}
+
+// BookMetricsRepository returns liquidity sample repository of the storage.
+func (s *Storage) BookMetricsRepository() monitor.BookMetricsRepository {
+	return s.bookMetricR
+}
+
+// FXRateRepository returns currency exchange rate repository of the storage.
+func (s *Storage) FXRateRepository() monitor.FXRateRepository {
+	return s.fxRate
+}
+
+// FindingRepository returns detected trade pattern repository of the storage.
+func (s *Storage) FindingRepository() monitor.FindingRepository {
+	return s.finding
+}
+
+// Ping always succeeds.
+func (s *Storage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op, records stay readable.
+func (s *Storage) Close() error {
+	return nil
+}
+
+// Trades returns stored trades in insertion order.
+func (s *Storage) Trades() []monitor.Trade {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]monitor.Trade(nil), s.trades...)
+}
+
+// BookMetrics returns stored liquidity samples in insertion order.
+func (s *Storage) BookMetrics() []monitor.BookMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]monitor.BookMetrics(nil), s.bookMetrics...)
+}
+
+// tradeRepository is a service for managing Trades.
+type tradeRepository struct {
+	storage *Storage
+}
+
+// Insert stores the trade unless a trade with the same PDAX ID is stored already.
+func (r *tradeRepository) Insert(ctx context.Context, t *monitor.Trade) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.ID != 0 && s.tradeKeys[t.Key()] {
+		return nil
+	}
+	s.tradeKeys[t.Key()] = true
+	s.trades = append(s.trades, *t)
+
+	return nil
+}
+
+// Upsert stores trades which are not stored yet, nothing is stored on dry run.
+func (r *tradeRepository) Upsert(ctx context.Context, trades []monitor.Trade, dryRun bool) (monitor.TradeImport, error) {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary monitor.TradeImport
+	batch := make(map[string]bool, len(trades))
+	for _, t := range trades {
+		key := t.Key()
+		if s.tradeKeys[key] || batch[key] {
+			summary.Duplicates++
+			continue
+		}
+		batch[key] = true
+		summary.Inserted++
+
+		if !dryRun {
+			s.trades = append(s.trades, t)
+		}
+	}
+
+	if !dryRun {
+		for key := range batch {
+			s.tradeKeys[key] = true
+		}
+	}
+
+	return summary, nil
+}
+
+// Trades returns trades of the pair within the time range ordered by time, trades of the same time
+// are in insertion order.
+func (r *tradeRepository) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	s := r.storage
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var trades []monitor.Trade
+	for _, t := range s.trades {
+		if t.CurrencyPair == q.CurrencyPair && !t.Timestamp.Before(q.From) && t.Timestamp.Before(q.To) {
+			trades = append(trades, t)
+		}
+	}
+
+	return monitor.LimitTrades(trades, q.Limit), nil
+}
+
+// orderRepository is a service for managing order book snapshots.
+type orderRepository struct {
+	storage *Storage
+}
+
+// Insert stores the order book snapshot.
+func (r *orderRepository) Insert(ctx context.Context, snapshot *monitor.OrderBookSnapshot) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *snapshot
+	stored.Levels = monitor.SortLevels(append([]monitor.BookLevel(nil), snapshot.Levels...))
+	s.snapshots[snapshot.CurrencyPair] = append(s.snapshots[snapshot.CurrencyPair], stored)
+
+	return nil
+}
+
+// BookAt returns the latest snapshot of the currency pair's book taken at or before the given time.
+func (r *orderRepository) BookAt(ctx context.Context, currencyPair string, at time.Time) (*monitor.OrderBookSnapshot, error) {
+	s := r.storage
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *monitor.OrderBookSnapshot
+	for i, snapshot := range s.snapshots[currencyPair] {
+		if snapshot.Timestamp.After(at) {
+			continue
+		}
+		if found == nil || snapshot.Timestamp.After(found.Timestamp) {
+			found = &s.snapshots[currencyPair][i]
+		}
+	}
+	if found == nil {
+		return nil, monitor.Error{
+			Code:    monitor.ErrorCodeNotFound,
+			Message: "order book snapshot not found",
+		}
+	}
+
+	book := *found
+	book.Levels = append([]monitor.BookLevel(nil), found.Levels...)
+
+	return &book, nil
+}
+
+// bookMetricsRepository is a service for managing order book liquidity samples.
+type bookMetricsRepository struct {
+	storage *Storage
+}
+
+// Insert stores the liquidity sample.
+func (r *bookMetricsRepository) Insert(ctx context.Context, m *monitor.BookMetrics) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bookMetrics = append(s.bookMetrics, *m)
+
+	return nil
+}
+
+// fxRateRepository is a service for managing currency exchange rates.
+type fxRateRepository struct {
+	storage *Storage
+}
+
+// Upsert stores the rates replacing stored rates of the same pair, time and source.
+func (r *fxRateRepository) Upsert(ctx context.Context, rates []monitor.FXRate) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rate := range rates {
+		replaced := false
+		for i, stored := range s.fxRates {
+			if stored.CurrencyPair == rate.CurrencyPair && stored.Timestamp.Equal(rate.Timestamp) && stored.Source == rate.Source {
+				s.fxRates[i] = rate
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.fxRates = append(s.fxRates, rate)
+		}
+	}
+
+	return nil
+}
+
+// Rates returns rates of the pair effective within the time range ordered by time.
+func (r *fxRateRepository) Rates(ctx context.Context, currencyPair string, from, to time.Time) ([]monitor.FXRate, error) {
+	s := r.storage
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rates []monitor.FXRate
+	for _, rate := range s.fxRates {
+		if rate.CurrencyPair == currencyPair && rate.Timestamp.Before(to) {
+			rates = append(rates, rate)
+		}
+	}
+
+	return monitor.EffectiveRates(rates, from), nil
+}
+
+// findingRepository is a service for managing detected patterns of trades.
+type findingRepository struct {
+	storage *Storage
+}
+
+// Upsert stores the findings replacing stored findings of the same pair, pattern and start time.
+func (r *findingRepository) Upsert(ctx context.Context, findings []monitor.Finding) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range findings {
+		replaced := false
+		for i, stored := range s.findings {
+			if stored.CurrencyPair == f.CurrencyPair && stored.Pattern == f.Pattern && stored.From.Equal(f.From) {
+				s.findings[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.findings = append(s.findings, f)
+		}
+	}
+
+	return nil
+}
+
+// Findings returns findings matching the query ordered by start time, currency pair and pattern.
+func (r *findingRepository) Findings(ctx context.Context, q monitor.FindingQuery) ([]monitor.Finding, error) {
+	s := r.storage
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var findings []monitor.Finding
+	for _, f := range s.findings {
+		if q.Match(f) {
+			findings = append(findings, f)
+		}
+	}
+	monitor.SortFindings(findings)
+	if q.Limit > 0 && len(findings) > q.Limit {
+		findings = findings[:q.Limit]
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+	"github.com/pudgydoge/pdax-monitor/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) monitor.Storage {
+		return memory.NewStorage()
+	})
+}
@@ -0,0 +1,685 @@
+// Package ndjson stores trades, order book snapshots and liquidity samples in newline-delimited JSON files
+// rotated daily, e.g. trade-2022-03-01.ndjson. Days are UTC days of record timestamps.
+package ndjson
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	kindTrade       = "trade"
+	kindOrderBook   = "order_book"
+	kindBookMetrics = "book_metrics"
+	kindFXRate      = "fx_rate"
+	kindFinding     = "finding"
+	fileExt         = ".ndjson"
+	dayLayout       = "2006-01-02"
+	// maxLineSize is the longest record read back, order book snapshots are the largest ones.
+	maxLineSize = 64 << 20
+)
+
+// Storage appends records to files of its directory, it's safe for concurrent use.
+// Keys of stored trades are kept in memory to skip duplicates.
+type Storage struct {
+	dir    string
+	logger log.Logger
+
+	mu        sync.Mutex
+	files     map[string]*os.File
+	tradeKeys map[string]bool
+
+	trade       *tradeRepository
+	order       *orderRepository
+	bookMetrics *bookMetricsRepository
+	fxRate      *fxRateRepository
+	finding     *findingRepository
+}
+
+// NewStorage instantiates Storage.
+func NewStorage(options ...ConfigOption) *Storage {
+	s := Storage{
+		logger:      log.NewNopLogger(),
+		files:       make(map[string]*os.File),
+		tradeKeys:   make(map[string]bool),
+		trade:       &tradeRepository{},
+		order:       &orderRepository{},
+		bookMetrics: &bookMetricsRepository{},
+		fxRate:      &fxRateRepository{},
+		finding:     &findingRepository{},
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	s.trade.storage = &s
+	s.order.storage = &s
+	s.bookMetrics.storage = &s
+	s.fxRate.storage = &s
+	s.finding.storage = &s
+
+	return &s
+}
+
+// ConfigOption configures the storage.
+type ConfigOption func(*Storage)
+
+// WithLogger configures a logger to debug the storage.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *Storage) {
+		s.logger = l
+	}
+}
+
+// Open creates the directory when missing and reads keys of stored trades.
+func (s *Storage) Open(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	s.dir = dir
+
+	paths, err := s.paths(kindTrade)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		err = readLines(path, func(line []byte) error {
+			var rec tradeRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return err
+			}
+			t, err := rec.trade()
+			if err != nil {
+				return err
+			}
+			s.tradeKeys[t.Key()] = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+	level.Debug(s.logger).Log("msg", "ndjson storage opened", "dir", dir, "trades", len(s.tradeKeys))
+
+	return nil
+}
+
+// TradeRepository returns trade repository of the storage.
+func (s *Storage) TradeRepository() monitor.TradeRepository {
+	return s.trade
+}
+
+// OrderRepository returns order book snapshot repository of the storage.
+func (s *Storage) OrderRepository() monitor.OrderRepository {
+	return s.order
+}
+
+// BookMetricsRepository returns liquidity sample repository of the storage.
+func (s *Storage) BookMetricsRepository() monitor.BookMetricsRepository {
+	return s.bookMetrics
+}
+
+// FXRateRepository returns currency exchange rate repository of the storage.
+func (s *Storage) FXRateRepository() monitor.FXRateRepository {
+	return s.fxRate
+}
+
+// FindingRepository returns detected trade pattern repository of the storage.
+func (s *Storage) FindingRepository() monitor.FindingRepository {
+	return s.finding
+}
+
+// Ping verifies the directory is accessible.
+func (s *Storage) Ping(ctx context.Context) error {
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+// Close closes open files.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for name, f := range s.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.files, name)
+	}
+
+	return err
+}
+
+// append writes records to the file of the kind and day, s.mu must be held.
+// Files of past days are closed once a record of a later day is written.
+func (s *Storage) append(kind string, day time.Time, records ...interface{}) error {
+	name := kind + "-" + day.UTC().Format(dayLayout) + fileExt
+
+	f, ok := s.files[name]
+	if !ok {
+		var err error
+		f, err = os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return err
+		}
+		for other, of := range s.files {
+			if strings.HasPrefix(other, kind+"-") && other < name {
+				of.Close()
+				delete(s.files, other)
+			}
+		}
+		s.files[name] = f
+	}
+
+	var buf []byte
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	_, err := f.Write(buf)
+
+	return err
+}
+
+// paths returns files of the kind sorted by day.
+func (s *Storage) paths(kind string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, kind+"-*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// readLines calls fn with every non-empty line of the file.
+func readLines(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err = fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// tradeRepository is a service for managing Trades.
+type tradeRepository struct {
+	storage *Storage
+}
+
+// Insert appends the trade unless a trade with the same PDAX ID is stored already.
+func (r *tradeRepository) Insert(ctx context.Context, t *monitor.Trade) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := t.Key()
+	if t.ID != 0 && s.tradeKeys[key] {
+		return nil
+	}
+	if err := s.append(kindTrade, t.Timestamp, newTradeRecord(*t)); err != nil {
+		return err
+	}
+	s.tradeKeys[key] = true
+
+	return nil
+}
+
+// Upsert appends trades which are not stored yet, nothing is written on dry run.
+func (r *tradeRepository) Upsert(ctx context.Context, trades []monitor.Trade, dryRun bool) (monitor.TradeImport, error) {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary monitor.TradeImport
+	batch := make(map[string]bool, len(trades))
+	for _, t := range trades {
+		key := t.Key()
+		if s.tradeKeys[key] || batch[key] {
+			summary.Duplicates++
+			continue
+		}
+		batch[key] = true
+		summary.Inserted++
+
+		if dryRun {
+			continue
+		}
+		if err := s.append(kindTrade, t.Timestamp, newTradeRecord(t)); err != nil {
+			return summary, err
+		}
+		s.tradeKeys[key] = true
+	}
+
+	return summary, nil
+}
+
+// Trades returns trades of the pair within the time range ordered by time, only files of days
+// within the range are read.
+func (r *tradeRepository) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	s := r.storage
+	paths, err := s.paths(kindTrade)
+	if err != nil {
+		return nil, err
+	}
+
+	first := filepath.Join(s.dir, kindTrade+"-"+q.From.UTC().Format(dayLayout)+fileExt)
+	last := filepath.Join(s.dir, kindTrade+"-"+q.To.UTC().Format(dayLayout)+fileExt)
+	var trades []monitor.Trade
+	for _, path := range paths {
+		if path < first || path > last {
+			continue
+		}
+
+		err = readLines(path, func(line []byte) error {
+			var rec tradeRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return err
+			}
+			if rec.CurrencyPair != q.CurrencyPair || rec.Timestamp.Before(q.From) || !rec.Timestamp.Before(q.To) {
+				return nil
+			}
+			t, err := rec.trade()
+			if err != nil {
+				return err
+			}
+			trades = append(trades, t)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+
+	return monitor.LimitTrades(trades, q.Limit), nil
+}
+
+// orderRepository is a service for managing order book snapshots.
+type orderRepository struct {
+	storage *Storage
+}
+
+// Insert appends the order book snapshot.
+func (r *orderRepository) Insert(ctx context.Context, snapshot *monitor.OrderBookSnapshot) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(kindOrderBook, snapshot.Timestamp, newSnapshotRecord(*snapshot))
+}
+
+// BookAt returns the latest snapshot of the currency pair's book taken at or before the given time.
+// Files are scanned from the day of the time backwards till the first one with a snapshot of the pair.
+func (r *orderRepository) BookAt(ctx context.Context, currencyPair string, at time.Time) (*monitor.OrderBookSnapshot, error) {
+	s := r.storage
+	paths, err := s.paths(kindOrderBook)
+	if err != nil {
+		return nil, err
+	}
+
+	last := filepath.Join(s.dir, kindOrderBook+"-"+at.UTC().Format(dayLayout)+fileExt)
+	for i := len(paths) - 1; i >= 0; i-- {
+		if paths[i] > last {
+			continue
+		}
+
+		var found *snapshotRecord
+		err = readLines(paths[i], func(line []byte) error {
+			var rec snapshotRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return err
+			}
+			if rec.CurrencyPair == currencyPair && !rec.Timestamp.After(at) &&
+				(found == nil || rec.Timestamp.After(found.Timestamp)) {
+				found = &rec
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", paths[i], err)
+		}
+
+		if found != nil {
+			return found.snapshot()
+		}
+	}
+
+	return nil, monitor.Error{
+		Code:    monitor.ErrorCodeNotFound,
+		Message: "order book snapshot not found",
+	}
+}
+
+// bookMetricsRepository is a service for managing order book liquidity samples.
+type bookMetricsRepository struct {
+	storage *Storage
+}
+
+// Insert appends the liquidity sample.
+func (r *bookMetricsRepository) Insert(ctx context.Context, m *monitor.BookMetrics) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(kindBookMetrics, m.Timestamp, bookMetricsRecord{
+		CurrencyPair: m.CurrencyPair,
+		Timestamp:    m.Timestamp,
+		SpreadBps:    m.SpreadBps,
+		BidSize:      m.BidSize,
+		AskSize:      m.AskSize,
+		Depth:        m.Depth,
+		Slippage:     m.Slippage,
+	})
+}
+
+// fxRateRepository is a service for managing currency exchange rates.
+type fxRateRepository struct {
+	storage *Storage
+}
+
+// Upsert appends the rates, rates appended later replace rates of the same pair, time and source when read.
+func (r *fxRateRepository) Upsert(ctx context.Context, rates []monitor.FXRate) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rate := range rates {
+		err := s.append(kindFXRate, rate.Timestamp, fxRateRecord{
+			CurrencyPair: rate.CurrencyPair,
+			Timestamp:    rate.Timestamp,
+			Rate:         rate.Rate.Text('f'),
+			Source:       rate.Source,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rates returns rates of the pair effective within the time range ordered by time,
+// files of days after the range are not read.
+func (r *fxRateRepository) Rates(ctx context.Context, currencyPair string, from, to time.Time) ([]monitor.FXRate, error) {
+	s := r.storage
+	paths, err := s.paths(kindFXRate)
+	if err != nil {
+		return nil, err
+	}
+
+	last := filepath.Join(s.dir, kindFXRate+"-"+to.UTC().Format(dayLayout)+fileExt)
+	index := make(map[string]int)
+	var rates []monitor.FXRate
+	for _, path := range paths {
+		if path > last {
+			continue
+		}
+
+		err = readLines(path, func(line []byte) error {
+			var rec fxRateRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return err
+			}
+			if rec.CurrencyPair != currencyPair || !rec.Timestamp.Before(to) {
+				return nil
+			}
+
+			rate := monitor.FXRate{CurrencyPair: rec.CurrencyPair, Timestamp: rec.Timestamp, Source: rec.Source}
+			var err error
+			if rate.Rate, _, err = apd.NewFromString(rec.Rate); err != nil {
+				return err
+			}
+
+			key := rec.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + rec.Source
+			if i, ok := index[key]; ok {
+				rates[i] = rate
+				return nil
+			}
+			index[key] = len(rates)
+			rates = append(rates, rate)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+
+	return monitor.EffectiveRates(rates, from), nil
+}
+
+// findingRepository is a service for managing detected patterns of trades.
+type findingRepository struct {
+	storage *Storage
+}
+
+// Upsert appends the findings, findings appended later replace findings of the same pair, pattern
+// and start time when read.
+func (r *findingRepository) Upsert(ctx context.Context, findings []monitor.Finding) error {
+	s := r.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range findings {
+		err := s.append(kindFinding, f.From, findingRecord{
+			CurrencyPair: f.CurrencyPair,
+			Pattern:      f.Pattern,
+			From:         f.From,
+			To:           f.To,
+			Trades:       f.Trades,
+			Volume:       f.Volume.Text('f'),
+			Score:        f.Score,
+			Detail:       f.Detail,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Findings returns findings matching the query ordered by start time, currency pair and pattern,
+// only files of days within the query range are read.
+func (r *findingRepository) Findings(ctx context.Context, q monitor.FindingQuery) ([]monitor.Finding, error) {
+	s := r.storage
+	paths, err := s.paths(kindFinding)
+	if err != nil {
+		return nil, err
+	}
+
+	first := filepath.Join(s.dir, kindFinding+"-"+q.From.UTC().Format(dayLayout)+fileExt)
+	last := filepath.Join(s.dir, kindFinding+"-"+q.To.UTC().Format(dayLayout)+fileExt)
+	index := make(map[string]int)
+	var findings []monitor.Finding
+	for _, path := range paths {
+		if path < first || path > last {
+			continue
+		}
+
+		err = readLines(path, func(line []byte) error {
+			var rec findingRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return err
+			}
+
+			f := monitor.Finding{
+				CurrencyPair: rec.CurrencyPair,
+				Pattern:      rec.Pattern,
+				From:         rec.From,
+				To:           rec.To,
+				Trades:       rec.Trades,
+				Score:        rec.Score,
+				Detail:       rec.Detail,
+			}
+			var err error
+			if f.Volume, _, err = apd.NewFromString(rec.Volume); err != nil {
+				return err
+			}
+
+			// The latest record of the finding counts even when it no longer matches the query.
+			key := rec.CurrencyPair + "|" + rec.Pattern + "|" + rec.From.UTC().Format(time.RFC3339Nano)
+			if i, ok := index[key]; ok {
+				findings[i] = f
+				return nil
+			}
+			index[key] = len(findings)
+			findings = append(findings, f)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+
+	matched := findings[:0]
+	for _, f := range findings {
+		if q.Match(f) {
+			matched = append(matched, f)
+		}
+	}
+	monitor.SortFindings(matched)
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+
+	return matched, nil
+}
+
+type findingRecord struct {
+	CurrencyPair string    `json:"pair"`
+	Pattern      string    `json:"pattern"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Trades       int       `json:"trades"`
+	Volume       string    `json:"volume"`
+	Score        float64   `json:"score"`
+	Detail       string    `json:"detail"`
+}
+
+type fxRateRecord struct {
+	CurrencyPair string    `json:"pair"`
+	Timestamp    time.Time `json:"ts"`
+	Rate         string    `json:"rate"`
+	Source       string    `json:"source"`
+}
+
+type tradeRecord struct {
+	ID           int64     `json:"id,omitempty"`
+	CurrencyPair string    `json:"pair"`
+	Price        string    `json:"price"`
+	Quantity     string    `json:"quantity"`
+	Timestamp    time.Time `json:"ts"`
+	Side         uint8     `json:"side,omitempty"`
+}
+
+func newTradeRecord(t monitor.Trade) tradeRecord {
+	return tradeRecord{
+		ID:           t.ID,
+		CurrencyPair: t.CurrencyPair,
+		Price:        t.Price.Text('f'),
+		Quantity:     t.Quantity.Text('f'),
+		Timestamp:    t.Timestamp,
+		Side:         t.Side,
+	}
+}
+
+func (rec tradeRecord) trade() (monitor.Trade, error) {
+	t := monitor.Trade{ID: rec.ID, CurrencyPair: rec.CurrencyPair, Timestamp: rec.Timestamp, Side: rec.Side}
+
+	var err error
+	if t.Price, _, err = apd.NewFromString(rec.Price); err != nil {
+		return t, err
+	}
+	t.Quantity, _, err = apd.NewFromString(rec.Quantity)
+
+	return t, err
+}
+
+type snapshotRecord struct {
+	CurrencyPair string        `json:"pair"`
+	Timestamp    time.Time     `json:"ts"`
+	Levels       []levelRecord `json:"levels"`
+}
+
+type levelRecord struct {
+	Side     uint8  `json:"side"`
+	Price    string `json:"price"`
+	Quantity string `json:"quantity"`
+	Orders   int    `json:"orders,omitempty"`
+}
+
+func newSnapshotRecord(s monitor.OrderBookSnapshot) snapshotRecord {
+	rec := snapshotRecord{
+		CurrencyPair: s.CurrencyPair,
+		Timestamp:    s.Timestamp,
+		Levels:       make([]levelRecord, 0, len(s.Levels)),
+	}
+	for _, l := range monitor.SortLevels(append([]monitor.BookLevel(nil), s.Levels...)) {
+		rec.Levels = append(rec.Levels, levelRecord{
+			Side:     l.Side,
+			Price:    l.Price.Text('f'),
+			Quantity: l.Quantity.Text('f'),
+			Orders:   l.Orders,
+		})
+	}
+
+	return rec
+}
+
+func (rec snapshotRecord) snapshot() (*monitor.OrderBookSnapshot, error) {
+	s := monitor.OrderBookSnapshot{CurrencyPair: rec.CurrencyPair, Timestamp: rec.Timestamp}
+	for _, l := range rec.Levels {
+		level := monitor.BookLevel{Side: l.Side, Orders: l.Orders}
+
+		var err error
+		if level.Price, _, err = apd.NewFromString(l.Price); err != nil {
+			return nil, err
+		}
+		if level.Quantity, _, err = apd.NewFromString(l.Quantity); err != nil {
+			return nil, err
+		}
+		s.Levels = append(s.Levels, level)
+	}
+
+	return &s, nil
+}
+
+type bookMetricsRecord struct {
+	CurrencyPair string                 `json:"pair"`
+	Timestamp    time.Time              `json:"ts"`
+	SpreadBps    *apd.Decimal           `json:"spreadBps"`
+	BidSize      *apd.Decimal           `json:"bidSize"`
+	AskSize      *apd.Decimal           `json:"askSize"`
+	Depth        []monitor.BookDepth    `json:"depth"`
+	Slippage     []monitor.BookSlippage `json:"slippage"`
+}
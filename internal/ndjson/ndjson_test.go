@@ -0,0 +1,19 @@
+package ndjson_test
+
+import (
+	"testing"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/ndjson"
+	"github.com/pudgydoge/pdax-monitor/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) monitor.Storage {
+		s := ndjson.NewStorage()
+		if err := s.Open(t.TempDir()); err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return s
+	})
+}
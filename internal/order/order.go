@@ -1,14 +1,20 @@
 package order
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 
+	"github.com/cockroachdb/apd"
 	monitor "github.com/pudgydoge/pdax-monitor"
 	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
 )
 
 const orderBookCapacity = 800
 
+var errTruncated = errors.New("order book message is truncated")
+
 // PDAXOrderBook is set of dynamically changing orders.
 type PDAXOrderBook struct {
 	orders []monitor.Order
@@ -24,29 +30,106 @@ func NewOrderBook() PDAXOrderBook {
 }
 
 // Apply is used to update PDAXOrderBook with OrderBookUpdate (insert, update, remove).
-func (ob *PDAXOrderBook) Apply(update monitor.OrderBookUpdate) {
+// Updates referring to indices out of the book are rejected, the book is out of sync then.
+func (ob *PDAXOrderBook) Apply(update monitor.OrderBookUpdate) error {
 	ob.lock.Lock()
 	defer ob.lock.Unlock()
 
-	if update.Remove { // remove
+	n := len(ob.orders)
+	switch {
+	case update.Remove: // remove
+		if update.OldIndex < 0 || update.OldIndex >= n {
+			return fmt.Errorf("remove index %d out of book of %d orders", update.OldIndex, n)
+		}
 		ob.remove(update.OldIndex)
-		return
-	}
-
-	if !(update.Insert == monitor.Order{}) { // insert
+	case !(update.Insert == monitor.Order{}): // insert
+		if update.NewIndex < 0 || update.NewIndex > n {
+			return fmt.Errorf("insert index %d out of book of %d orders", update.NewIndex, n)
+		}
 		ob.insert(update.NewIndex, update.Insert)
-		return
-	}
-
-	if !(update.Update == monitor.OrderUpdate{}) { // update
+	case !(update.Update == monitor.OrderUpdate{}): // update
+		if update.OldIndex < 0 || update.OldIndex >= n || update.NewIndex < 0 || update.NewIndex >= n {
+			return fmt.Errorf("update indices %d -> %d out of book of %d orders", update.OldIndex, update.NewIndex, n)
+		}
 		ob.update(update.OldIndex, update.NewIndex, update.Update)
-		return
 	}
+
+	return nil
 }
 
-// Orders returns slice to orders.
+// Orders returns a copy of orders.
 func (ob *PDAXOrderBook) Orders() []monitor.Order {
-	return ob.orders
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+
+	orders := make([]monitor.Order, len(ob.orders))
+	copy(orders, ob.orders)
+
+	return orders
+}
+
+// Instrument returns the instrument of the book's orders, false when the book is empty.
+func (ob *PDAXOrderBook) Instrument() (int, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+
+	if len(ob.orders) == 0 {
+		return 0, false
+	}
+
+	return ob.orders[0].Instrument, true
+}
+
+// L2 aggregates orders by price levels.
+func (ob *PDAXOrderBook) L2() monitor.L2Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+
+	return aggregate(ob.orders)
+}
+
+// aggregate sums quantities and counts orders at every price level of each side.
+func aggregate(orders []monitor.Order) monitor.L2Book {
+	levels := make(map[uint8]map[string]*monitor.BookLevel)
+	for _, o := range orders {
+		side, ok := levels[o.Side]
+		if !ok {
+			side = make(map[string]*monitor.BookLevel)
+			levels[o.Side] = side
+		}
+
+		var reduced apd.Decimal
+		reduced.Reduce(o.Price)
+		key := reduced.String()
+		level, ok := side[key]
+		if !ok {
+			side[key] = &monitor.BookLevel{
+				Side:     o.Side,
+				Price:    new(apd.Decimal).Set(o.Price),
+				Quantity: new(apd.Decimal).Set(o.Quantity),
+				Orders:   1,
+			}
+			continue
+		}
+		apd.BaseContext.Add(level.Quantity, level.Quantity, o.Quantity)
+		level.Orders++
+	}
+
+	var book monitor.L2Book
+	for _, level := range levels[monitor.SideBid] {
+		book.Bids = append(book.Bids, *level)
+	}
+	for _, level := range levels[monitor.SideAsk] {
+		book.Asks = append(book.Asks, *level)
+	}
+	sort.Slice(book.Bids, func(i, j int) bool {
+		return book.Bids[i].Price.Cmp(book.Bids[j].Price) > 0
+	})
+	sort.Slice(book.Asks, func(i, j int) bool {
+		return book.Asks[i].Price.Cmp(book.Asks[j].Price) < 0
+	})
+
+	return book
 }
 
 func (ob *PDAXOrderBook) insert(index int, order monitor.Order) {
@@ -60,7 +143,7 @@ func (ob *PDAXOrderBook) insert(index int, order monitor.Order) {
 
 func (ob *PDAXOrderBook) update(oldIndex int, newIndex int, update monitor.OrderUpdate) {
 	oldOrder := ob.orders[oldIndex]
-	oldOrder.Quantity = update.Quantity
+	oldOrder.Quantity = binary.Decimal(update.Quantity, uint8(-oldOrder.Quantity.Exponent))
 	oldOrder.Timestamp = update.Timestamp
 	if oldIndex != newIndex {
 		ob.remove(oldIndex)
@@ -75,7 +158,7 @@ func (ob *PDAXOrderBook) remove(index int) {
 }
 
 // ReadOrderBookUpdate used to parse OrderBookUpdate object from byte stream.
-func ReadOrderBookUpdate(rc *binary.ReadCursor) []monitor.OrderBookUpdate {
+func ReadOrderBookUpdate(rc *binary.ReadCursor) ([]monitor.OrderBookUpdate, error) {
 	var orderBookUpdates []monitor.OrderBookUpdate
 	rc.ReadFloat64() // page_id
 	rc.ReadUint8()   // first_index nullable check
@@ -123,12 +206,15 @@ func ReadOrderBookUpdate(rc *binary.ReadCursor) []monitor.OrderBookUpdate {
 			orderBookUpdates = append(orderBookUpdates, monitor.OrderBookUpdate{Update: update, OldIndex: int(oldIndex), NewIndex: int(newIndex)})
 		}
 	}
+	if rc.Overflowed() {
+		return nil, errTruncated
+	}
 
-	return orderBookUpdates
+	return orderBookUpdates, nil
 }
 
 // ReadOrderBook used to parse PDAXOrderBook object from byte stream.
-func ReadOrderBook(rc *binary.ReadCursor) monitor.OrderBook {
+func ReadOrderBook(rc *binary.ReadCursor) (monitor.OrderBook, error) {
 	orderBook := NewOrderBook()
 
 	rc.ReadFloat64()           // page_id
@@ -137,20 +223,20 @@ func ReadOrderBook(rc *binary.ReadCursor) monitor.OrderBook {
 	if rc.ReadUint16() == 27 { // number == 'OrderBook_change'
 		length := rc.ReadUint16() // length
 		for t := uint16(0); t < length; t++ {
-			rc.ReadFloat64()              // index
-			rc.ReadFloat64()              // ID
-			ts1 := rc.ReadFloat64()       // timestamp 1 part
-			rc.ReadUint32()               // timestamp 2 part
-			rc.ReadUint8()                // InstrumentMarket  nullable check
-			rc.ReadFloat64()              // InstrumentMarket (currency)
-			side := rc.ReadUint8()        // Side (bid == 1 or ask == 0)
-			price := rc.ReadFloat64()     // Price
-			priceDec := rc.ReadUint8()    // PriceDecimals
-			quantity := rc.ReadFloat64()  // VisibleQunatity
-			quantityDec := rc.ReadUint8() // QuantityDecimals
-			rc.ReadUint8()                // Flags
-			rc.ReadFloat64()              // Orders
-			rc.ReadFloat64()              // GeneralInterest
+			rc.ReadFloat64()               // index
+			rc.ReadFloat64()               // ID
+			ts1 := rc.ReadFloat64()        // timestamp 1 part
+			rc.ReadUint32()                // timestamp 2 part
+			rc.ReadUint8()                 // InstrumentMarket  nullable check
+			instrument := rc.ReadFloat64() // InstrumentMarket (currency)
+			side := rc.ReadUint8()         // Side (bid == 1 or ask == 0)
+			price := rc.ReadFloat64()      // Price
+			priceDec := rc.ReadUint8()     // PriceDecimals
+			quantity := rc.ReadFloat64()   // VisibleQunatity
+			quantityDec := rc.ReadUint8()  // QuantityDecimals
+			rc.ReadUint8()                 // Flags
+			rc.ReadFloat64()               // Orders
+			rc.ReadFloat64()               // GeneralInterest
 
 			rc.Advance(2) // Tag length, mostly 0
 			rc.Advance(2) // OBInfo length, mostly 0
@@ -165,20 +251,21 @@ func ReadOrderBook(rc *binary.ReadCursor) monitor.OrderBook {
 			rc.ReadUint32()  // permissions, RC_after(133)
 
 			order := monitor.Order{
-				Price:       price,
-				PriceDec:    priceDec,
-				Quantity:    quantity,
-				QuantityDec: quantityDec,
-				Timestamp:   ts1,
-				Side:        side,
+				Instrument: int(instrument),
+				Price:      binary.Decimal(price, priceDec),
+				Quantity:   binary.Decimal(quantity, quantityDec),
+				Timestamp:  ts1,
+				Side:       side,
 			}
 
-			orderBookUpdate := monitor.OrderBookUpdate{Insert: order, NewIndex: int(t)}
-			orderBook.Apply(orderBookUpdate)
+			orderBook.insert(int(t), order)
 		}
 	}
+	if rc.Overflowed() {
+		return nil, errTruncated
+	}
 
-	return &orderBook
+	return &orderBook, nil
 }
 
 func readOrderBookInsert(rc *binary.ReadCursor) []monitor.Order {
@@ -188,20 +275,20 @@ func readOrderBookInsert(rc *binary.ReadCursor) []monitor.Order {
 		changes = make([]monitor.Order, length)
 
 		for t := uint16(0); t < length; t++ {
-			rc.ReadFloat64()              // index
-			rc.ReadFloat64()              // ID
-			ts1 := rc.ReadFloat64()       // timestamp 1 part
-			rc.ReadUint32()               // timestamp 2 part
-			rc.ReadUint8()                // InstrumentMarket  nullable check
-			rc.ReadFloat64()              // InstrumentMarket (currency)
-			side := rc.ReadUint8()        // Side (bid or ask)
-			price := rc.ReadFloat64()     // Price
-			priceDec := rc.ReadUint8()    // PriceDecimals
-			quantity := rc.ReadFloat64()  // VisibleQunatity
-			quantityDec := rc.ReadUint8() // QuantityDecimals
-			rc.ReadUint8()                // Flags
-			rc.ReadFloat64()              // Orders
-			rc.ReadFloat64()              // GeneralInterest
+			rc.ReadFloat64()               // index
+			rc.ReadFloat64()               // ID
+			ts1 := rc.ReadFloat64()        // timestamp 1 part
+			rc.ReadUint32()                // timestamp 2 part
+			rc.ReadUint8()                 // InstrumentMarket  nullable check
+			instrument := rc.ReadFloat64() // InstrumentMarket (currency)
+			side := rc.ReadUint8()         // Side (bid or ask)
+			price := rc.ReadFloat64()      // Price
+			priceDec := rc.ReadUint8()     // PriceDecimals
+			quantity := rc.ReadFloat64()   // VisibleQunatity
+			quantityDec := rc.ReadUint8()  // QuantityDecimals
+			rc.ReadUint8()                 // Flags
+			rc.ReadFloat64()               // Orders
+			rc.ReadFloat64()               // GeneralInterest
 
 			rc.Advance(2) // Tag length, mostly 0
 			rc.Advance(2) // OBInfo length, mostly 0
@@ -216,12 +303,11 @@ func readOrderBookInsert(rc *binary.ReadCursor) []monitor.Order {
 			rc.ReadUint32()  // permissions, RC_after(133)
 
 			changes[t] = monitor.Order{
-				Price:       price,
-				PriceDec:    priceDec,
-				Quantity:    quantity,
-				QuantityDec: quantityDec,
-				Timestamp:   ts1,
-				Side:        side,
+				Instrument: int(instrument),
+				Price:      binary.Decimal(price, priceDec),
+				Quantity:   binary.Decimal(quantity, quantityDec),
+				Timestamp:  ts1,
+				Side:       side,
 			}
 		}
 	}
@@ -0,0 +1,199 @@
+package order
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/synth"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+// headerSize is the size of message type, message_id, seq_number and view ID preceding a page.
+const headerSize = 15
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  monitor.OrderBookUpdate
+		want    []string // prices in index order
+		wantErr bool
+	}{
+		{"insert first", monitor.OrderBookUpdate{Insert: testOrder("9"), NewIndex: 0}, []string{"9", "10", "11"}, false},
+		{"insert last", monitor.OrderBookUpdate{Insert: testOrder("12"), NewIndex: 2}, []string{"10", "11", "12"}, false},
+		{"insert past the end", monitor.OrderBookUpdate{Insert: testOrder("12"), NewIndex: 3}, nil, true},
+		{"insert negative", monitor.OrderBookUpdate{Insert: testOrder("12"), NewIndex: -1}, nil, true},
+		{"remove", monitor.OrderBookUpdate{Remove: true, OldIndex: 0}, []string{"11"}, false},
+		{"remove past the end", monitor.OrderBookUpdate{Remove: true, OldIndex: 2}, nil, true},
+		{"update in place", monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 5}, OldIndex: 1, NewIndex: 1},
+			[]string{"10", "11"}, false},
+		{"update moved", monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 5}, OldIndex: 0, NewIndex: 1},
+			[]string{"11", "10"}, false},
+		{"update past the end", monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 5}, OldIndex: 0, NewIndex: 2},
+			nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			book := NewOrderBook()
+			for i, price := range []string{"10", "11"} {
+				if err := book.Apply(monitor.OrderBookUpdate{Insert: testOrder(price), NewIndex: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := book.Apply(tc.update)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Apply() error = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if got := len(book.Orders()); got != 2 {
+					t.Errorf("rejected update changed the book to %d orders", got)
+				}
+				return
+			}
+
+			orders := book.Orders()
+			if len(orders) != len(tc.want) {
+				t.Fatalf("got %d orders, want %d", len(orders), len(tc.want))
+			}
+			for i, o := range orders {
+				if o.Price.String() != tc.want[i] {
+					t.Errorf("order %d price = %s, want %s", i, o.Price, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	book := NewOrderBook()
+	if _, ok := book.Instrument(); ok {
+		t.Error("Instrument() of empty book reported ok")
+	}
+
+	book.Apply(monitor.OrderBookUpdate{Insert: testOrder("10"), NewIndex: 0})
+	if got, ok := book.Instrument(); !ok || got != 2 {
+		t.Errorf("Instrument() = %d, %v, want 2, true", got, ok)
+	}
+}
+
+func TestReadOrderBook(t *testing.T) {
+	frame := synth.NewGenerator(synth.WithDepth(5)).Resets()[0]
+
+	rc := binary.ReadCursor{CurPos: headerSize, Data: frame.Data}
+	book, err := ReadOrderBook(&rc)
+	if err != nil {
+		t.Fatalf("ReadOrderBook() error = %v", err)
+	}
+	if got := len(book.Orders()); got != 10 {
+		t.Errorf("got %d orders, want 10", got)
+	}
+
+	for _, size := range []int{headerSize + 10, len(frame.Data) - 1} {
+		rc := binary.ReadCursor{CurPos: headerSize, Data: frame.Data[:size]}
+		if _, err := ReadOrderBook(&rc); err == nil {
+			t.Errorf("ReadOrderBook() of %d bytes of %d: error = nil, want truncated", size, len(frame.Data))
+		}
+	}
+}
+
+func TestReadOrderBookUpdateTruncated(t *testing.T) {
+	g := synth.NewGenerator(synth.WithTradeRate(0.001), synth.WithBookRate(100))
+	g.Resets()
+	frame := g.Next()
+
+	rc := binary.ReadCursor{CurPos: headerSize, Data: frame.Data}
+	if _, err := ReadOrderBookUpdate(&rc); err != nil {
+		t.Fatalf("ReadOrderBookUpdate() error = %v", err)
+	}
+
+	rc = binary.ReadCursor{CurPos: headerSize, Data: frame.Data[:len(frame.Data)-1]}
+	if _, err := ReadOrderBookUpdate(&rc); err == nil {
+		t.Error("ReadOrderBookUpdate() of truncated frame: error = nil, want truncated")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	orders := []monitor.Order{
+		sideOrder(monitor.SideAsk, "102", "1"),
+		sideOrder(monitor.SideAsk, "101.5", "2"),
+		sideOrder(monitor.SideAsk, "102.00", "0.5"), // same level as 102
+		sideOrder(monitor.SideBid, "100", "3"),
+		sideOrder(monitor.SideBid, "99", "4"),
+		sideOrder(monitor.SideBid, "100.0", "1.25"),
+	}
+
+	book := aggregate(orders)
+
+	wantBids := []struct{ price, quantity string }{{"100", "4.25"}, {"99", "4"}}
+	wantAsks := []struct{ price, quantity string }{{"101.5", "2"}, {"102", "1.5"}}
+	wantOrders := map[string]int{"100": 2, "99": 1, "101.5": 1, "102": 2}
+	check := func(side string, got []monitor.BookLevel, want []struct{ price, quantity string }) {
+		if len(got) != len(want) {
+			t.Fatalf("got %d %s levels, want %d", len(got), side, len(want))
+		}
+		for i, l := range got {
+			if l.Price.Cmp(dec(want[i].price)) != 0 || l.Quantity.Cmp(dec(want[i].quantity)) != 0 {
+				t.Errorf("%s level %d = %s x %s, want %s x %s", side, i, l.Price, l.Quantity, want[i].price, want[i].quantity)
+			}
+			if n := wantOrders[want[i].price]; l.Orders != n {
+				t.Errorf("%s level %s has %d orders, want %d", side, want[i].price, l.Orders, n)
+			}
+		}
+	}
+	check("bid", book.Bids, wantBids)
+	check("ask", book.Asks, wantAsks)
+
+	if orders[0].Quantity.Cmp(dec("1")) != 0 {
+		t.Errorf("aggregate() changed order quantity to %s", orders[0].Quantity)
+	}
+	if got := aggregate(nil); len(got.Bids) != 0 || len(got.Asks) != 0 {
+		t.Errorf("aggregate(nil) = %+v, want empty book", got)
+	}
+}
+
+func TestConcurrentL2AndApply(t *testing.T) {
+	book := NewOrderBook()
+	for i := 0; i < 50; i++ {
+		book.Apply(monitor.OrderBookUpdate{Insert: sideOrder(uint8(i%2), "100", "1"), NewIndex: i})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			book.Apply(monitor.OrderBookUpdate{Insert: sideOrder(monitor.SideBid, "99", "1"), NewIndex: 0})
+			book.Apply(monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 2}, OldIndex: 0, NewIndex: 10})
+			book.Apply(monitor.OrderBookUpdate{Remove: true, OldIndex: 10})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			l2 := book.L2()
+			if len(l2.Bids)+len(l2.Asks) == 0 {
+				t.Error("L2() of non-empty book is empty")
+				return
+			}
+			book.Instrument()
+		}
+	}()
+	wg.Wait()
+
+	if got := len(book.Orders()); got != 50 {
+		t.Errorf("got %d orders, want 50", got)
+	}
+}
+
+func dec(s string) *apd.Decimal {
+	d, _, _ := apd.NewFromString(s)
+	return d
+}
+
+func testOrder(price string) monitor.Order {
+	p, _, _ := apd.NewFromString(price)
+	return monitor.Order{Instrument: 2, Price: p, Quantity: apd.New(1, 0), Side: monitor.SideBid}
+}
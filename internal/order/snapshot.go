@@ -0,0 +1,157 @@
+package order
+
+import (
+	"sync"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// SnapshotPolicy decides whether the order book should be snapshotted after an update has been applied.
+type SnapshotPolicy interface {
+	ShouldSnapshot(book monitor.OrderBook, now time.Time) bool
+}
+
+// IntervalPolicy requests a snapshot once Interval has passed since the previous one.
+type IntervalPolicy struct {
+	Interval time.Duration
+	last     time.Time
+}
+
+// ShouldSnapshot implements SnapshotPolicy.
+func (p *IntervalPolicy) ShouldSnapshot(_ monitor.OrderBook, now time.Time) bool {
+	if now.Sub(p.last) < p.Interval {
+		return false
+	}
+	p.last = now
+
+	return true
+}
+
+// UpdateCountPolicy requests a snapshot on every Updates-th book update.
+type UpdateCountPolicy struct {
+	Updates int
+	count   int
+}
+
+// ShouldSnapshot implements SnapshotPolicy.
+func (p *UpdateCountPolicy) ShouldSnapshot(_ monitor.OrderBook, _ time.Time) bool {
+	p.count++
+	if p.count < p.Updates {
+		return false
+	}
+	p.count = 0
+
+	return true
+}
+
+// TopOfBookPolicy requests a snapshot when the best bid or the best ask (price or quantity) changes.
+type TopOfBookPolicy struct {
+	bid, ask monitor.BookLevel
+}
+
+// ShouldSnapshot implements SnapshotPolicy.
+func (p *TopOfBookPolicy) ShouldSnapshot(book monitor.OrderBook, _ time.Time) bool {
+	l2 := book.L2()
+	bid, _ := l2.BestBid()
+	ask, _ := l2.BestAsk()
+	if sameLevel(bid, p.bid) && sameLevel(ask, p.ask) {
+		return false
+	}
+	p.bid, p.ask = bid, ask
+
+	return true
+}
+
+func sameLevel(a, b monitor.BookLevel) bool {
+	if a.Price == nil || b.Price == nil {
+		return a.Price == b.Price
+	}
+
+	return a.Price.Cmp(b.Price) == 0 && a.Quantity.Cmp(b.Quantity) == 0
+}
+
+// AnyPolicy requests a snapshot when at least one of the policies does.
+// Every policy is consulted so that each keeps its own state up to date.
+type AnyPolicy []SnapshotPolicy
+
+// ShouldSnapshot implements SnapshotPolicy.
+func (p AnyPolicy) ShouldSnapshot(book monitor.OrderBook, now time.Time) bool {
+	var due bool
+	for _, policy := range p {
+		if policy.ShouldSnapshot(book, now) {
+			due = true
+		}
+	}
+
+	return due
+}
+
+// SnapshotPolicyFactory creates fresh policy state for a newly seen order book.
+type SnapshotPolicyFactory func() SnapshotPolicy
+
+// NewSnapshotPolicyFactory builds a factory of policies combined from the given settings.
+// Zero interval and zero updates disable the corresponding policy.
+// It returns nil when every policy is disabled.
+func NewSnapshotPolicyFactory(interval time.Duration, updates int, onTopChange bool) SnapshotPolicyFactory {
+	if interval <= 0 && updates <= 0 && !onTopChange {
+		return nil
+	}
+
+	return func() SnapshotPolicy {
+		var policies AnyPolicy
+		if interval > 0 {
+			policies = append(policies, &IntervalPolicy{Interval: interval})
+		}
+		if updates > 0 {
+			policies = append(policies, &UpdateCountPolicy{Updates: updates})
+		}
+		if onTopChange {
+			policies = append(policies, &TopOfBookPolicy{})
+		}
+
+		return policies
+	}
+}
+
+// Snapshotter tracks snapshot policies per order book.
+type Snapshotter struct {
+	newPolicy SnapshotPolicyFactory
+	policies  map[string]SnapshotPolicy
+	lock      sync.Mutex
+}
+
+// NewSnapshotter instantiates Snapshotter.
+func NewSnapshotter(newPolicy SnapshotPolicyFactory) *Snapshotter {
+	return &Snapshotter{
+		newPolicy: newPolicy,
+		policies:  make(map[string]SnapshotPolicy),
+	}
+}
+
+// ShouldSnapshot reports whether the book of the currency pair is due for a snapshot.
+func (s *Snapshotter) ShouldSnapshot(currencyPair string, book monitor.OrderBook, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	policy, ok := s.policies[currencyPair]
+	if !ok {
+		policy = s.newPolicy()
+		s.policies[currencyPair] = policy
+	}
+
+	return policy.ShouldSnapshot(book, now)
+}
+
+// Snapshot captures price levels of the currency pair's book, bids first.
+func Snapshot(currencyPair string, book monitor.L2Book, now time.Time) monitor.OrderBookSnapshot {
+	snapshot := monitor.OrderBookSnapshot{
+		CurrencyPair: currencyPair,
+		Timestamp:    now,
+		Levels:       make([]monitor.BookLevel, 0, len(book.Bids)+len(book.Asks)),
+	}
+	snapshot.Levels = append(snapshot.Levels, book.Bids...)
+	snapshot.Levels = append(snapshot.Levels, book.Asks...)
+
+	return snapshot
+}
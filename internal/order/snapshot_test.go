@@ -0,0 +1,206 @@
+package order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestIntervalPolicy(t *testing.T) {
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := IntervalPolicy{Interval: time.Minute}
+
+	tests := []struct {
+		at   time.Duration
+		want bool
+	}{
+		{0, true},
+		{30 * time.Second, false},
+		{59 * time.Second, false},
+		{time.Minute, true},
+		{90 * time.Second, false},
+		{3 * time.Minute, true},
+	}
+	for _, tc := range tests {
+		if got := p.ShouldSnapshot(nil, start.Add(tc.at)); got != tc.want {
+			t.Errorf("ShouldSnapshot(+%v) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestUpdateCountPolicy(t *testing.T) {
+	p := UpdateCountPolicy{Updates: 3}
+
+	want := []bool{false, false, true, false, false, true}
+	for i, w := range want {
+		if got := p.ShouldSnapshot(nil, time.Time{}); got != w {
+			t.Errorf("update %d: ShouldSnapshot() = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestTopOfBookPolicy(t *testing.T) {
+	book := NewOrderBook()
+	for i, o := range []monitor.Order{
+		sideOrder(monitor.SideAsk, "102", "1"),
+		sideOrder(monitor.SideAsk, "101", "2"),
+		sideOrder(monitor.SideBid, "100", "3"),
+		sideOrder(monitor.SideBid, "99", "4"),
+	} {
+		book.Apply(monitor.OrderBookUpdate{Insert: o, NewIndex: i})
+	}
+
+	var p TopOfBookPolicy
+	tests := []struct {
+		name   string
+		update *monitor.OrderBookUpdate
+		want   bool
+	}{
+		{"first look", nil, true},
+		{"unchanged", nil, false},
+		{"deeper ask changed", &monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 5}, OldIndex: 0, NewIndex: 0}, false},
+		{"best bid quantity changed", &monitor.OrderBookUpdate{Update: monitor.OrderUpdate{Quantity: 7}, OldIndex: 2, NewIndex: 2}, true},
+		{"best ask removed", &monitor.OrderBookUpdate{Remove: true, OldIndex: 1}, true},
+		{"deeper bid added", &monitor.OrderBookUpdate{Insert: sideOrder(monitor.SideBid, "98", "1"), NewIndex: 3}, false},
+	}
+	for _, tc := range tests {
+		if tc.update != nil {
+			if err := book.Apply(*tc.update); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+		if got := p.ShouldSnapshot(&book, time.Time{}); got != tc.want {
+			t.Errorf("%s: ShouldSnapshot() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTopOfBookPolicyEmptyBook(t *testing.T) {
+	var p TopOfBookPolicy
+	book := NewOrderBook()
+	if p.ShouldSnapshot(&book, time.Time{}) {
+		t.Error("ShouldSnapshot() of empty book = true, want false")
+	}
+}
+
+func TestAnyPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		dues  []bool
+		want  bool
+		calls int
+	}{
+		{"none", nil, false, 0},
+		{"not due", []bool{false, false}, false, 2},
+		{"first due", []bool{true, false}, true, 2},
+		{"last due", []bool{false, true}, true, 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			var p AnyPolicy
+			for _, due := range tc.dues {
+				due := due
+				p = append(p, policyFunc(func() bool {
+					calls++
+					return due
+				}))
+			}
+
+			if got := p.ShouldSnapshot(nil, time.Time{}); got != tc.want {
+				t.Errorf("ShouldSnapshot() = %v, want %v", got, tc.want)
+			}
+			if calls != tc.calls {
+				t.Errorf("consulted %d policies, want every %d", calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestNewSnapshotPolicyFactory(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		updates     int
+		onTopChange bool
+		want        []string
+	}{
+		{"disabled", 0, 0, false, nil},
+		{"negative disabled", -time.Second, -1, false, nil},
+		{"interval", time.Minute, 0, false, []string{"interval"}},
+		{"updates", 0, 10, false, []string{"updates"}},
+		{"top", 0, 0, true, []string{"top"}},
+		{"all", time.Minute, 10, true, []string{"interval", "updates", "top"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := NewSnapshotPolicyFactory(tc.interval, tc.updates, tc.onTopChange)
+			if tc.want == nil {
+				if factory != nil {
+					t.Fatal("NewSnapshotPolicyFactory() != nil, want nil when every policy is disabled")
+				}
+				return
+			}
+
+			policies, ok := factory().(AnyPolicy)
+			if !ok {
+				t.Fatalf("factory() = %T, want AnyPolicy", factory())
+			}
+			var got []string
+			for _, p := range policies {
+				switch p := p.(type) {
+				case *IntervalPolicy:
+					if p.Interval != tc.interval {
+						t.Errorf("interval = %v, want %v", p.Interval, tc.interval)
+					}
+					got = append(got, "interval")
+				case *UpdateCountPolicy:
+					if p.Updates != tc.updates {
+						t.Errorf("updates = %d, want %d", p.Updates, tc.updates)
+					}
+					got = append(got, "updates")
+				case *TopOfBookPolicy:
+					got = append(got, "top")
+				}
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got policies %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got policies %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotterKeepsPolicyPerBook(t *testing.T) {
+	s := NewSnapshotter(NewSnapshotPolicyFactory(0, 2, false))
+
+	for _, pair := range []string{"BTC-PHP", "ETH-PHP"} {
+		if s.ShouldSnapshot(pair, nil, time.Time{}) {
+			t.Errorf("%s: first update is due, want the second", pair)
+		}
+	}
+	for _, pair := range []string{"BTC-PHP", "ETH-PHP"} {
+		if !s.ShouldSnapshot(pair, nil, time.Time{}) {
+			t.Errorf("%s: second update is not due", pair)
+		}
+	}
+}
+
+// policyFunc adapts a function to SnapshotPolicy.
+type policyFunc func() bool
+
+func (f policyFunc) ShouldSnapshot(monitor.OrderBook, time.Time) bool {
+	return f()
+}
+
+func sideOrder(side uint8, price, quantity string) monitor.Order {
+	p, _, _ := apd.NewFromString(price)
+	q, _, _ := apd.NewFromString(quantity)
+	return monitor.Order{Instrument: 2, Price: p, Quantity: q, Side: side}
+}
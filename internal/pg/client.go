@@ -1,6 +1,7 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/go-kit/log"
@@ -22,11 +23,17 @@ type Client struct {
 	logger         log.Logger
 	maxConnections int
 
-	tradeQ map[string]string
-	orderQ map[string]string
-
-	trade *tradeRepository
-	order *orderRepository
+	tradeQ       map[string]string
+	orderQ       map[string]string
+	bookMetricsQ map[string]string
+	fxRateQ      map[string]string
+	findingQ     map[string]string
+
+	trade       *tradeRepository
+	order       *orderRepository
+	bookMetrics *bookMetricsRepository
+	fxRate      *fxRateRepository
+	finding     *findingRepository
 }
 
 // Open connection to PostgreSQL.
@@ -51,15 +58,132 @@ func (c *Client) Open(dataSourceName string) error {
 	return nil
 }
 
+// DeleteTrades deletes the trades, e.g. once they are archived, within a single transaction. Trades are matched
+// the way Upsert matches them: by PDAX ID, or by currency pair, time, price and quantity when ID is unknown.
+func (c *Client) DeleteTrades(ctx context.Context, trades []monitor.Trade) (int64, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, t := range trades {
+		var res sql.Result
+		if t.ID == 0 {
+			res, err = tx.ExecContext(ctx, c.tradeQ["deleteNew"], t.CurrencyPair, t.Price, t.Quantity, t.Timestamp)
+		} else {
+			res, err = tx.ExecContext(ctx, c.tradeQ["delete"], t.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+
+	return deleted, tx.Commit()
+}
+
+// Ping verifies the connection to PostgreSQL is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
 func (c *Client) defineQueries() {
 	c.tradeQ = map[string]string{
 		"insert": `
-			INSERT INTO trade (currency_pair, price, quantity, created_at) VALUES ($1, $2, $3, $4)
+			INSERT INTO trade (pdax_id, currency_pair, price, quantity, created_at, side) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (pdax_id) DO NOTHING
+		`,
+		// Trades without PDAX ID (e.g. imported from old CSV exports) are matched by their content.
+		"insertNew": `
+			INSERT INTO trade (currency_pair, price, quantity, created_at, side)
+			SELECT $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (
+				SELECT 1 FROM trade
+				WHERE currency_pair = $1 AND created_at = $4 AND price = $2 AND quantity = $3
+			)
+		`,
+		"delete": `
+			DELETE FROM trade WHERE pdax_id = $1
+		`,
+		"deleteNew": `
+			DELETE FROM trade
+			WHERE currency_pair = $1 AND created_at = $4 AND price = $2 AND quantity = $3
+		`,
+		// LIMIT NULL is the same as LIMIT ALL, it selects all trades of unlimited queries.
+		"findRange": `
+			SELECT COALESCE(pdax_id, 0), price, quantity, created_at, side FROM trade
+			WHERE currency_pair = $1 AND created_at >= $2 AND created_at < $3
+			ORDER BY created_at, id
+			LIMIT $4
 		`,
 	}
 	c.orderQ = map[string]string{
 		"insert": `
-			INSERT INTO order_book (created_at, order_book) VALUES ($1, $2)
+			INSERT INTO order_book_snapshot (currency_pair, created_at) VALUES ($1, $2) RETURNING id
+		`,
+		"insertLevel": `
+			INSERT INTO order_book_level (snapshot_id, side, price, quantity, orders) VALUES ($1, $2, $3, $4, $5)
+		`,
+		"findAt": `
+			SELECT id, created_at FROM order_book_snapshot
+			WHERE currency_pair = $1 AND created_at <= $2
+			ORDER BY created_at DESC
+			LIMIT 1
+		`,
+		"findLevels": `
+			SELECT side, price, quantity, orders FROM order_book_level
+			WHERE snapshot_id = $1
+			ORDER BY side DESC, CASE WHEN side = 1 THEN -price ELSE price END
+		`,
+	}
+	c.bookMetricsQ = map[string]string{
+		"insert": `
+			INSERT INTO book_metrics (currency_pair, created_at, spread_bps, bid_size, ask_size, depth, slippage)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`,
+	}
+	c.fxRateQ = map[string]string{
+		"upsert": `
+			INSERT INTO fx_rate (currency_pair, created_at, rate, source) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency_pair, created_at, source) DO UPDATE SET rate = EXCLUDED.rate
+		`,
+		"findRange": `
+			(
+				SELECT created_at, rate, source FROM fx_rate
+				WHERE currency_pair = $1 AND created_at < $2
+				ORDER BY created_at DESC, source DESC
+				LIMIT 1
+			)
+			UNION ALL
+			(
+				SELECT created_at, rate, source FROM fx_rate
+				WHERE currency_pair = $1 AND created_at >= $2 AND created_at < $3
+			)
+			ORDER BY created_at, source
+		`,
+	}
+	c.findingQ = map[string]string{
+		"upsert": `
+			INSERT INTO finding (currency_pair, pattern, started_at, ended_at, trades, volume, score, detail)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (currency_pair, pattern, started_at) DO UPDATE SET
+				ended_at = EXCLUDED.ended_at, trades = EXCLUDED.trades, volume = EXCLUDED.volume,
+				score = EXCLUDED.score, detail = EXCLUDED.detail
+		`,
+		// Empty pair or pattern selects all of them.
+		"findRange": `
+			SELECT currency_pair, pattern, started_at, ended_at, trades, volume, score, detail FROM finding
+			WHERE ($1 = '' OR currency_pair = $1) AND ($2 = '' OR pattern = $2)
+				AND started_at >= $3 AND started_at < $4 AND score >= $5
+			ORDER BY started_at, currency_pair COLLATE "C", pattern COLLATE "C"
+			LIMIT $6
 		`,
 	}
 }
@@ -80,7 +204,22 @@ func (c *Client) TradeRepository() monitor.TradeRepository {
 	return c.trade
 }
 
-// OrderRepository returns current instance of tradeRepository interface.
+// OrderRepository returns current instance of orderRepository interface.
 func (c *Client) OrderRepository() monitor.OrderRepository {
 	return c.order
 }
+
+// BookMetricsRepository returns current instance of bookMetricsRepository interface.
+func (c *Client) BookMetricsRepository() monitor.BookMetricsRepository {
+	return c.bookMetrics
+}
+
+// FXRateRepository returns current instance of fxRateRepository interface.
+func (c *Client) FXRateRepository() monitor.FXRateRepository {
+	return c.fxRate
+}
+
+// FindingRepository returns current instance of findingRepository interface.
+func (c *Client) FindingRepository() monitor.FindingRepository {
+	return c.finding
+}
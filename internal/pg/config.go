@@ -11,6 +11,9 @@ func NewClient(options ...ConfigOption) *Client {
 		maxConnections: defaultMaxConnections,
 		trade:          &tradeRepository{},
 		order:          &orderRepository{},
+		bookMetrics:    &bookMetricsRepository{},
+		fxRate:         &fxRateRepository{},
+		finding:        &findingRepository{},
 	}
 
 	for _, opt := range options {
@@ -19,6 +22,9 @@ func NewClient(options ...ConfigOption) *Client {
 
 	c.trade.client = &c
 	c.order.client = &c
+	c.bookMetrics.client = &c
+	c.fxRate.client = &c
+	c.finding.client = &c
 
 	return &c
 }
@@ -0,0 +1,156 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+)
+
+// Migration is a versioned change of the database schema.
+type Migration struct {
+	Version     int
+	Description string
+	SQL         string
+}
+
+// Migrations returns schema changes in the order they are applied. Statements are idempotent,
+// so databases set up with Schema before migrations were introduced are migrated as well.
+func Migrations() []Migration {
+	return []Migration{
+		{1, "trade table", `
+			CREATE TABLE IF NOT EXISTS trade (
+				id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+				currency_pair text NOT NULL,
+				price numeric NOT NULL,
+				quantity numeric NOT NULL,
+				created_at timestamp with time zone DEFAULT now() NOT NULL
+			);
+		`},
+		{2, "order book snapshots", `
+			CREATE TABLE IF NOT EXISTS order_book_snapshot (
+				id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+				currency_pair text NOT NULL,
+				created_at timestamp with time zone DEFAULT now() NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS order_book_snapshot_pair_created_at_idx ON order_book_snapshot (currency_pair, created_at);
+
+			CREATE TABLE IF NOT EXISTS order_book_level (
+				snapshot_id bigint NOT NULL REFERENCES order_book_snapshot (id) ON DELETE CASCADE,
+				side smallint NOT NULL,
+				price numeric NOT NULL,
+				quantity numeric NOT NULL,
+				orders integer NOT NULL DEFAULT 0,
+				PRIMARY KEY (snapshot_id, side, price)
+			);
+		`},
+		{3, "book metrics", `
+			CREATE TABLE IF NOT EXISTS book_metrics (
+				id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+				currency_pair text NOT NULL,
+				created_at timestamp with time zone DEFAULT now() NOT NULL,
+				spread_bps numeric,
+				bid_size numeric,
+				ask_size numeric,
+				depth jsonb NOT NULL,
+				slippage jsonb NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS book_metrics_pair_created_at_idx ON book_metrics (currency_pair, created_at);
+		`},
+		{4, "trade pdax id", `
+			ALTER TABLE trade ADD COLUMN IF NOT EXISTS pdax_id bigint;
+
+			CREATE UNIQUE INDEX IF NOT EXISTS trade_pdax_id_idx ON trade (pdax_id);
+			CREATE INDEX IF NOT EXISTS trade_pair_created_at_idx ON trade (currency_pair, created_at);
+		`},
+		{5, "fx rates", `
+			CREATE TABLE IF NOT EXISTS fx_rate (
+				id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+				currency_pair text NOT NULL,
+				created_at timestamp with time zone NOT NULL,
+				rate numeric NOT NULL,
+				source text NOT NULL
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS fx_rate_pair_created_at_source_idx ON fx_rate (currency_pair, created_at, source);
+		`},
+		{6, "trade aggressor side", `
+			ALTER TABLE trade ADD COLUMN IF NOT EXISTS side smallint NOT NULL DEFAULT 0;
+		`},
+		{7, "findings", `
+			CREATE TABLE IF NOT EXISTS finding (
+				id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+				currency_pair text NOT NULL,
+				pattern text NOT NULL,
+				started_at timestamp with time zone NOT NULL,
+				ended_at timestamp with time zone NOT NULL,
+				trades integer NOT NULL,
+				volume numeric NOT NULL,
+				score double precision NOT NULL,
+				detail text NOT NULL
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS finding_pair_pattern_started_at_idx ON finding (currency_pair, pattern, started_at);
+			CREATE INDEX IF NOT EXISTS finding_started_at_idx ON finding (started_at);
+		`},
+	}
+}
+
+// Migrate applies migrations which are not applied yet, each one in its own transaction.
+// It returns versions of applied migrations, nothing is applied on dry run.
+func (c *Client) Migrate(ctx context.Context, dryRun bool) ([]int, error) {
+	_, err := c.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migration (
+			version integer PRIMARY KEY,
+			description text NOT NULL,
+			applied_at timestamp with time zone DEFAULT now() NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migration table: %v", err)
+	}
+
+	var current int
+	err = c.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migration`).Scan(&current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	var applied []int
+	for _, m := range Migrations() {
+		if m.Version <= current {
+			continue
+		}
+		applied = append(applied, m.Version)
+		if dryRun {
+			continue
+		}
+
+		if err = c.apply(ctx, m); err != nil {
+			return applied[:len(applied)-1], fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+		level.Info(c.logger).Log("msg", "migration applied", "version", m.Version, "description", m.Description)
+	}
+
+	return applied, nil
+}
+
+func (c *Client) apply(ctx context.Context, m Migration) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migration (version, description) VALUES ($1, $2)`, m.Version, m.Description)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,92 @@
+package pg_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/pg"
+	"github.com/pudgydoge/pdax-monitor/internal/storage/storagetest"
+)
+
+// testConnStringEnvVar names Postgres database the tests are run against, its tables are truncated.
+const testConnStringEnvVar = "PDAX_MONITOR_TEST_PG_CONN_STRING"
+
+func TestClient(t *testing.T) {
+	connString := os.Getenv(testConnStringEnvVar)
+	if connString == "" {
+		t.Skipf("%s is not set", testConnStringEnvVar)
+	}
+
+	storagetest.Run(t, func(t *testing.T) monitor.Storage {
+		c := pg.NewClient()
+		if err := c.Open(connString); err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		if _, err := c.Migrate(context.Background(), false); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+		truncate(t, connString)
+		return c
+	})
+}
+
+func TestDeleteTrades(t *testing.T) {
+	connString := os.Getenv(testConnStringEnvVar)
+	if connString == "" {
+		t.Skipf("%s is not set", testConnStringEnvVar)
+	}
+
+	c := pg.NewClient()
+	if err := c.Open(connString); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Migrate(context.Background(), false); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	truncate(t, connString)
+
+	ts := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	live := trade(1, "2500000", "0.01", ts)
+	imported := trade(0, "2500100", "0.5", ts.Add(time.Second))
+	kept := trade(0, "2500200", "0.5", ts.Add(2*time.Second))
+	ctx := context.Background()
+	if _, err := c.TradeRepository().Upsert(ctx, []monitor.Trade{live, imported, kept}, false); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	// archived decimals have trailing zeros
+	archived := trade(0, "2500100.0000000000", "0.5000000000", imported.Timestamp)
+	n, err := c.DeleteTrades(ctx, []monitor.Trade{live, archived})
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteTrades() = %d, %v, want 2 deleted", n, err)
+	}
+
+	trades, err := c.TradeRepository().Trades(ctx, monitor.TradeQuery{CurrencyPair: "BTC-PHP", From: ts, To: ts.Add(time.Minute)})
+	if err != nil || len(trades) != 1 || trades[0].Price.Cmp(kept.Price) != 0 {
+		t.Errorf("Trades() = %+v, %v, want only the trade which is not deleted", trades, err)
+	}
+}
+
+func trade(id int64, price, quantity string, ts time.Time) monitor.Trade {
+	p, _, _ := apd.NewFromString(price)
+	q, _, _ := apd.NewFromString(quantity)
+	return monitor.Trade{ID: id, CurrencyPair: "BTC-PHP", Price: p, Quantity: q, Timestamp: ts}
+}
+
+func truncate(t *testing.T, connString string) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(`TRUNCATE trade, order_book_snapshot, order_book_level, book_metrics, fx_rate, finding`); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+}
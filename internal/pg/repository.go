@@ -2,9 +2,12 @@ package pg
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/cockroachdb/apd"
 	monitor "github.com/pudgydoge/pdax-monitor"
 	"go.opencensus.io/trace"
 )
@@ -22,33 +25,316 @@ func (r *tradeRepository) Insert(ctx context.Context, t *monitor.Trade) error {
 	_, err := r.client.db.ExecContext(
 		ctx,
 		r.client.tradeQ["insert"],
+		nullID(t.ID),
 		t.CurrencyPair,
 		t.Price,
 		t.Quantity,
 		t.Timestamp,
+		t.Side,
 	)
 
 	return err
 }
 
-// orderRepository is a service for managing orders.
+// Upsert inserts trades which are not in the repository yet within a single transaction,
+// the transaction is rolled back on dry run.
+func (r *tradeRepository) Upsert(ctx context.Context, trades []monitor.Trade, dryRun bool) (monitor.TradeImport, error) {
+	_, span := trace.StartSpan(ctx, "tradeRepository.Upsert")
+	defer span.End()
+
+	var summary monitor.TradeImport
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	for _, t := range trades {
+		var res sql.Result
+		if t.ID == 0 {
+			res, err = tx.ExecContext(ctx, r.client.tradeQ["insertNew"], t.CurrencyPair, t.Price, t.Quantity, t.Timestamp, t.Side)
+		} else {
+			res, err = tx.ExecContext(ctx, r.client.tradeQ["insert"], t.ID, t.CurrencyPair, t.Price, t.Quantity, t.Timestamp, t.Side)
+		}
+		if err != nil {
+			return monitor.TradeImport{}, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return monitor.TradeImport{}, err
+		}
+		if n == 0 {
+			summary.Duplicates++
+		} else {
+			summary.Inserted++
+		}
+	}
+
+	if dryRun {
+		return summary, nil
+	}
+
+	return summary, tx.Commit()
+}
+
+// Trades returns trades of the pair within the time range ordered by time.
+func (r *tradeRepository) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	_, span := trace.StartSpan(ctx, "tradeRepository.Trades")
+	defer span.End()
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.tradeQ["findRange"], q.CurrencyPair, q.From, q.To, nullLimit(q.Limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []monitor.Trade
+	for rows.Next() {
+		t := monitor.Trade{
+			CurrencyPair: q.CurrencyPair,
+			Price:        &apd.Decimal{},
+			Quantity:     &apd.Decimal{},
+		}
+		if err = rows.Scan(&t.ID, t.Price, t.Quantity, &t.Timestamp, &t.Side); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+// orderRepository is a service for managing order book snapshots.
 type orderRepository struct {
 	client *Client
 }
 
-// Insert inserts trade's information in the repository.
-func (r *orderRepository) Insert(ctx context.Context, orders []monitor.Order) error {
+// Insert inserts order book snapshot with its price levels in the repository.
+func (r *orderRepository) Insert(ctx context.Context, s *monitor.OrderBookSnapshot) error {
 	_, span := trace.StartSpan(ctx, "orderRepository.Insert")
 	defer span.End()
 
-	json, _ := json.Marshal(orders)
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := r.client.db.ExecContext(
+	var id int64
+	err = tx.QueryRowContext(ctx, r.client.orderQ["insert"], s.CurrencyPair, s.Timestamp).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range s.Levels {
+		_, err = tx.ExecContext(ctx, r.client.orderQ["insertLevel"], id, l.Side, l.Price, l.Quantity, l.Orders)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// BookAt returns the latest snapshot of the currency pair's book taken at or before the given time.
+func (r *orderRepository) BookAt(ctx context.Context, currencyPair string, at time.Time) (*monitor.OrderBookSnapshot, error) {
+	_, span := trace.StartSpan(ctx, "orderRepository.BookAt")
+	defer span.End()
+
+	s := monitor.OrderBookSnapshot{CurrencyPair: currencyPair}
+
+	var id int64
+	err := r.client.db.QueryRowContext(ctx, r.client.orderQ["findAt"], currencyPair, at).Scan(&id, &s.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, monitor.Error{
+			Code:    monitor.ErrorCodeNotFound,
+			Message: "order book snapshot not found",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.orderQ["findLevels"], id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := monitor.BookLevel{
+			Price:    &apd.Decimal{},
+			Quantity: &apd.Decimal{},
+		}
+		if err = rows.Scan(&l.Side, l.Price, l.Quantity, &l.Orders); err != nil {
+			return nil, err
+		}
+		s.Levels = append(s.Levels, l)
+	}
+
+	return &s, rows.Err()
+}
+
+// bookMetricsRepository is a service for managing order book liquidity samples.
+type bookMetricsRepository struct {
+	client *Client
+}
+
+// Insert inserts liquidity sample in the repository.
+func (r *bookMetricsRepository) Insert(ctx context.Context, m *monitor.BookMetrics) error {
+	_, span := trace.StartSpan(ctx, "bookMetricsRepository.Insert")
+	defer span.End()
+
+	depth, err := json.Marshal(m.Depth)
+	if err != nil {
+		return err
+	}
+	slippage, err := json.Marshal(m.Slippage)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.db.ExecContext(
 		ctx,
-		r.client.orderQ["insert"],
-		time.Now(),
-		string(json),
+		r.client.bookMetricsQ["insert"],
+		m.CurrencyPair,
+		m.Timestamp,
+		nullDecimal(m.SpreadBps),
+		nullDecimal(m.BidSize),
+		nullDecimal(m.AskSize),
+		string(depth),
+		string(slippage),
 	)
 
 	return err
 }
+
+// fxRateRepository is a service for managing currency exchange rates.
+type fxRateRepository struct {
+	client *Client
+}
+
+// Upsert stores the rates within a single transaction.
+func (r *fxRateRepository) Upsert(ctx context.Context, rates []monitor.FXRate) error {
+	_, span := trace.StartSpan(ctx, "fxRateRepository.Upsert")
+	defer span.End()
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err = tx.ExecContext(ctx, r.client.fxRateQ["upsert"], rate.CurrencyPair, rate.Timestamp, rate.Rate, rate.Source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Rates returns rates of the pair effective within the time range ordered by time.
+func (r *fxRateRepository) Rates(ctx context.Context, currencyPair string, from, to time.Time) ([]monitor.FXRate, error) {
+	_, span := trace.StartSpan(ctx, "fxRateRepository.Rates")
+	defer span.End()
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.fxRateQ["findRange"], currencyPair, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []monitor.FXRate
+	for rows.Next() {
+		rate := monitor.FXRate{CurrencyPair: currencyPair, Rate: &apd.Decimal{}}
+		if err = rows.Scan(&rate.Timestamp, rate.Rate, &rate.Source); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// findingRepository is a service for managing detected patterns of trades.
+type findingRepository struct {
+	client *Client
+}
+
+// Upsert stores the findings within a single transaction.
+func (r *findingRepository) Upsert(ctx context.Context, findings []monitor.Finding) error {
+	_, span := trace.StartSpan(ctx, "findingRepository.Upsert")
+	defer span.End()
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range findings {
+		_, err = tx.ExecContext(ctx, r.client.findingQ["upsert"],
+			f.CurrencyPair, f.Pattern, f.From, f.To, f.Trades, f.Volume, f.Score, f.Detail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Findings returns findings matching the query ordered by start time, currency pair and pattern.
+func (r *findingRepository) Findings(ctx context.Context, q monitor.FindingQuery) ([]monitor.Finding, error) {
+	_, span := trace.StartSpan(ctx, "findingRepository.Findings")
+	defer span.End()
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.findingQ["findRange"],
+		q.CurrencyPair, q.Pattern, q.From, q.To, q.MinScore, nullLimit(q.Limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []monitor.Finding
+	for rows.Next() {
+		f := monitor.Finding{Volume: &apd.Decimal{}}
+		err = rows.Scan(&f.CurrencyPair, &f.Pattern, &f.From, &f.To, &f.Trades, f.Volume, &f.Score, &f.Detail)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+
+	return findings, rows.Err()
+}
+
+// nullID turns unknown PDAX ID into SQL NULL.
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// nullLimit turns no limit into SQL NULL which is LIMIT ALL.
+func nullLimit(limit int) interface{} {
+	if limit <= 0 {
+		return nil
+	}
+
+	return limit
+}
+
+// nullDecimal turns missing decimal into SQL NULL.
+func nullDecimal(d *apd.Decimal) interface{} {
+	if d == nil {
+		return nil
+	}
+
+	return d
+}
@@ -7,15 +7,69 @@ package pg
 const Schema = `
 CREATE TABLE trade (
     id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    pdax_id bigint,
     currency_pair text NOT NULL,
     price numeric NOT NULL,
     quantity numeric NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    side smallint DEFAULT 0 NOT NULL
+);
+
+CREATE UNIQUE INDEX trade_pdax_id_idx ON trade (pdax_id);
+CREATE INDEX trade_pair_created_at_idx ON trade (currency_pair, created_at);
+
+CREATE TABLE order_book_snapshot (
+    id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    currency_pair text NOT NULL,
     created_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
-CREATE TABLE order_book (
+CREATE INDEX order_book_snapshot_pair_created_at_idx ON order_book_snapshot (currency_pair, created_at);
+
+CREATE TABLE order_book_level (
+    snapshot_id bigint NOT NULL REFERENCES order_book_snapshot (id) ON DELETE CASCADE,
+    side smallint NOT NULL,
+    price numeric NOT NULL,
+    quantity numeric NOT NULL,
+    orders integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (snapshot_id, side, price)
+);
+
+CREATE TABLE book_metrics (
     id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    currency_pair text NOT NULL,
     created_at timestamp with time zone DEFAULT now() NOT NULL,
-	order_book jsonb
+    spread_bps numeric,
+    bid_size numeric,
+    ask_size numeric,
+    depth jsonb NOT NULL,
+    slippage jsonb NOT NULL
 );
+
+CREATE INDEX book_metrics_pair_created_at_idx ON book_metrics (currency_pair, created_at);
+
+CREATE TABLE fx_rate (
+    id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    currency_pair text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    rate numeric NOT NULL,
+    source text NOT NULL
+);
+
+CREATE UNIQUE INDEX fx_rate_pair_created_at_source_idx ON fx_rate (currency_pair, created_at, source);
+
+CREATE TABLE finding (
+    id bigint PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    currency_pair text NOT NULL,
+    pattern text NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    ended_at timestamp with time zone NOT NULL,
+    trades integer NOT NULL,
+    volume numeric NOT NULL,
+    score double precision NOT NULL,
+    detail text NOT NULL
+);
+
+CREATE UNIQUE INDEX finding_pair_pattern_started_at_idx ON finding (currency_pair, pattern, started_at);
+CREATE INDEX finding_started_at_idx ON finding (started_at);
 `
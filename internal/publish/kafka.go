@@ -0,0 +1,55 @@
+package publish
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultKafkaTopic is a topic trades are published to.
+const DefaultKafkaTopic = "pdax.trades"
+
+// kafkaBatchTimeout bounds how long a message waits for a batch to fill. The queue publishes one message
+// at a time, so the writer's default of 1s would cap publishing at a trade per second.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// Kafka publishes messages to a topic keyed by the trade key, so all deliveries of a trade land
+// in the same partition and compacted topics keep one message per trade.
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka instantiates a publisher to comma separated brokers, e.g. localhost:9092.
+func NewKafka(brokers, topic string) *Kafka {
+	if topic == "" {
+		topic = DefaultKafkaTopic
+	}
+
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: kafkaBatchTimeout,
+		},
+	}
+}
+
+// Publish publishes the message and waits till all in-sync replicas acknowledge it.
+func (p *Kafka) Publish(ctx context.Context, m Message) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(m.Key),
+		Value: m.Data,
+		Headers: []kafka.Header{
+			{Key: "schema", Value: []byte(EnvelopeSchema)},
+		},
+	})
+}
+
+// Close flushes and closes the writer.
+func (p *Kafka) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,70 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultNATSSubject is a subject prefix, trades are published to <prefix>.<pair>, e.g. pdax.trades.BTC-PHP.
+const DefaultNATSSubject = "pdax.trades"
+
+// NATS publishes messages to a JetStream stream. The trade key is the JetStream message ID,
+// so retried messages within the stream duplicates window are stored once.
+type NATS struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNATS connects to NATS servers at the url and makes sure the stream capturing the subject exists.
+// The stream is named after the subject, e.g. PDAX_TRADES.
+func NewNATS(url, subject string) (*NATS, error) {
+	if subject == "" {
+		subject = DefaultNATSSubject
+	}
+
+	conn, err := nats.Connect(url, nats.Name("pdax-monitor"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %v", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats jetstream: %v", err)
+	}
+
+	stream := strings.ToUpper(strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(subject))
+	_, err = js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     stream,
+			Subjects: []string{subject + ".>"},
+			Storage:  nats.FileStorage,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats stream %s: %v", stream, err)
+	}
+
+	return &NATS{conn: conn, js: js, subject: subject}, nil
+}
+
+// Publish publishes the message and waits for the stream acknowledgement.
+func (p *NATS) Publish(ctx context.Context, m Message) error {
+	_, err := p.js.Publish(p.subject+"."+m.CurrencyPair, m.Data, nats.MsgId(m.Key), nats.Context(ctx))
+	return err
+}
+
+// Close flushes and closes the connection.
+func (p *NATS) Close() error {
+	err := p.conn.Drain()
+	if errors.Is(err, nats.ErrConnectionClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+// Package publish streams decoded trades to message buses. Delivery is at most once across restarts:
+// trades wait for publishing in memory only, so queued trades are lost when the process crashes or the bus
+// is still unavailable once the shutdown drain timeout passes. While the process runs, a trade is retried
+// till the bus acknowledges it and may be delivered more than once, consumers deduplicate deliveries
+// by the envelope key which is stable for the trade.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// EnvelopeSchema is the schema of published messages, it changes only with incompatible envelope changes.
+const EnvelopeSchema = "pdax.trade.v1"
+
+// Publisher delivers the message to a message bus, it returns once the bus acknowledged the message.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+	Close() error
+}
+
+// Message is an encoded envelope with its deduplication key.
+type Message struct {
+	// Key is the trade key, it's used as the message ID and the partition key.
+	Key string
+	// CurrencyPair routes the message, e.g. into a subject of the pair.
+	CurrencyPair string
+	Data         []byte
+}
+
+// Envelope is JSON published for every trade. Decimals are strings to keep them exact.
+type Envelope struct {
+	Schema       string    `json:"schema"`
+	Key          string    `json:"key"`
+	ID           int64     `json:"id,omitempty"`
+	CurrencyPair string    `json:"pair"`
+	Price        string    `json:"price"`
+	Quantity     string    `json:"quantity"`
+	Side         uint8     `json:"side"`
+	Timestamp    time.Time `json:"ts"`
+	ReceivedAt   time.Time `json:"received_at"`
+}
+
+// NewMessage encodes the trade received at the time into an envelope.
+func NewMessage(t monitor.Trade, receivedAt time.Time) (Message, error) {
+	key := t.Key()
+	data, err := json.Marshal(Envelope{
+		Schema:       EnvelopeSchema,
+		Key:          key,
+		ID:           t.ID,
+		CurrencyPair: t.CurrencyPair,
+		Price:        t.Price.Text('f'),
+		Quantity:     t.Quantity.Text('f'),
+		Side:         t.Side,
+		Timestamp:    t.Timestamp.UTC(),
+		ReceivedAt:   receivedAt.UTC(),
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Key: key, CurrencyPair: t.CurrencyPair, Data: data}, nil
+}
+
+// Publisher drivers.
+const (
+	DriverNATS  = "nats"
+	DriverKafka = "kafka"
+)
+
+// drivers returns publisher constructors by driver name.
+func drivers() map[string]func(url, subject string) (Publisher, error) {
+	return map[string]func(url, subject string) (Publisher, error){
+		DriverNATS: func(url, subject string) (Publisher, error) {
+			return NewNATS(url, subject)
+		},
+		DriverKafka: func(url, subject string) (Publisher, error) {
+			return NewKafka(url, subject), nil
+		},
+	}
+}
+
+// Drivers returns names of available drivers.
+func Drivers() []string {
+	var names []string
+	for name := range drivers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Open connects the publisher of the driver to the url, subject is NATS subject prefix or Kafka topic.
+func Open(driver, url, subject string) (Publisher, error) {
+	open, ok := drivers()[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown publish driver %q, try %s", driver, strings.Join(Drivers(), ", "))
+	}
+
+	p, err := open(url, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s publisher: %v", driver, err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,100 @@
+package publish
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestNewMessage(t *testing.T) {
+	manila := time.FixedZone("PHT", 8*60*60)
+	tests := []struct {
+		name    string
+		trade   monitor.Trade
+		wantKey string
+	}{
+		{"with id", testTrade(42), "42"},
+		{"without id", testTrade(0), "BTC-PHP|1646128800000000000|2500000.5|0.01"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receivedAt := time.Date(2022, 3, 1, 18, 0, 1, 0, manila)
+			m, err := NewMessage(tc.trade, receivedAt)
+			if err != nil {
+				t.Fatalf("NewMessage() error = %v", err)
+			}
+			if m.Key != tc.wantKey || m.CurrencyPair != "BTC-PHP" {
+				t.Errorf("got key %q, pair %q, want %q, BTC-PHP", m.Key, m.CurrencyPair, tc.wantKey)
+			}
+
+			var e Envelope
+			if err = json.Unmarshal(m.Data, &e); err != nil {
+				t.Fatalf("envelope is not JSON: %v", err)
+			}
+			want := Envelope{
+				Schema:       EnvelopeSchema,
+				Key:          tc.wantKey,
+				ID:           tc.trade.ID,
+				CurrencyPair: "BTC-PHP",
+				Price:        "2500000.50",
+				Quantity:     "0.01",
+				Side:         monitor.SideBid,
+				Timestamp:    tc.trade.Timestamp,
+				ReceivedAt:   receivedAt.UTC(),
+			}
+			if e != want {
+				t.Errorf("got envelope %+v, want %+v", e, want)
+			}
+		})
+	}
+}
+
+func TestNewMessageEnvelopeFields(t *testing.T) {
+	m, err := NewMessage(testTrade(0), time.Date(2022, 3, 1, 10, 0, 1, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NewMessage() error = %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(m.Data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["id"]; ok {
+		t.Error("unknown trade ID is encoded, want it omitted")
+	}
+	for _, f := range []string{"schema", "key", "pair", "price", "quantity", "side", "ts", "received_at"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("envelope has no %q field", f)
+		}
+	}
+	if got := fields["ts"]; got != "2022-03-01T10:00:00Z" {
+		t.Errorf("ts = %v, want UTC time", got)
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open("rabbitmq", "amqp://localhost", ""); err == nil {
+		t.Error("Open() of unknown driver error = nil")
+	}
+}
+
+func TestNewKafka(t *testing.T) {
+	p := NewKafka("localhost:9092,localhost:9093", "")
+	defer p.Close()
+
+	if p.writer.Topic != DefaultKafkaTopic {
+		t.Errorf("topic = %q, want %q", p.writer.Topic, DefaultKafkaTopic)
+	}
+	if p.writer.BatchTimeout <= 0 || p.writer.BatchTimeout > 10*time.Millisecond {
+		t.Errorf("batch timeout = %v, want at most 10ms not to wait for batches of one trade", p.writer.BatchTimeout)
+	}
+}
+
+func decimal(s string) *apd.Decimal {
+	d, _, _ := apd.NewFromString(s)
+	return d
+}
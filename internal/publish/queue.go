@@ -0,0 +1,209 @@
+package publish
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	defaultQueueSize   = 10000
+	defaultDrainTimout = 30 * time.Second
+	minRetryDelay      = 100 * time.Millisecond
+	maxRetryDelay      = 30 * time.Second
+)
+
+// Queue publishes trades in the background, so a slow or unavailable bus doesn't stall the websocket.
+// Every message is retried till the bus acknowledges it. Enqueue blocks once the queue is full.
+// The queue is held in memory, messages which are not published on shutdown or crash are lost.
+type Queue struct {
+	publisher    Publisher
+	messages     chan Message
+	size         int
+	drainTimeout time.Duration
+	logger       log.Logger
+	metrics      *queueMetrics
+}
+
+// NewQueue instantiates Queue.
+func NewQueue(p Publisher, options ...ConfigOption) *Queue {
+	q := Queue{
+		publisher:    p,
+		size:         defaultQueueSize,
+		drainTimeout: defaultDrainTimout,
+		logger:       log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&q)
+	}
+	q.messages = make(chan Message, q.size)
+
+	return &q
+}
+
+// ConfigOption configures the queue.
+type ConfigOption func(*Queue)
+
+// WithLogger configures a logger to debug the queue.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(q *Queue) {
+		q.logger = l
+	}
+}
+
+// WithSize configures how many messages wait for publishing before Enqueue blocks.
+func WithSize(n int) ConfigOption {
+	return func(q *Queue) {
+		if n > 0 {
+			q.size = n
+		}
+	}
+}
+
+// WithDrainTimeout configures how long queued messages are published on shutdown.
+func WithDrainTimeout(d time.Duration) ConfigOption {
+	return func(q *Queue) {
+		q.drainTimeout = d
+	}
+}
+
+// WithMetrics configures publishing metrics.
+func WithMetrics(registerer prometheus.Registerer) ConfigOption {
+	return func(q *Queue) {
+		q.metrics = newQueueMetrics(registerer, q)
+	}
+}
+
+// Enqueue queues the trade received at the time for publishing.
+func (q *Queue) Enqueue(ctx context.Context, t monitor.Trade, receivedAt time.Time) error {
+	m, err := NewMessage(t, receivedAt)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case q.messages <- m:
+		return nil
+	default:
+	}
+
+	level.Warn(q.logger).Log("msg", "publish queue is full, waiting", "size", q.size)
+	select {
+	case q.messages <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Depth returns the number of messages waiting for publishing.
+func (q *Queue) Depth() int {
+	return len(q.messages)
+}
+
+// Run publishes queued messages till the context is canceled, then publishes the remaining ones
+// within the drain timeout and closes the publisher.
+func (q *Queue) Run(ctx context.Context) error {
+	defer func() {
+		if err := q.publisher.Close(); err != nil {
+			level.Warn(q.logger).Log("msg", "failed to close publisher", "err", err)
+		}
+	}()
+
+	for {
+		select {
+		case m := <-q.messages:
+			if !q.publish(ctx, m) { // interrupted by shutdown
+				return q.drain(m)
+			}
+		case <-ctx.Done():
+			return q.drain()
+		}
+	}
+}
+
+// drain publishes the pending messages and then the queued ones.
+func (q *Queue) drain(pending ...Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), q.drainTimeout)
+	defer cancel()
+
+	for _, m := range pending {
+		if !q.publish(ctx, m) {
+			level.Error(q.logger).Log("msg", "queued trades are not published on shutdown", "count", q.Depth()+1)
+			return ctx.Err()
+		}
+	}
+	for {
+		select {
+		case m := <-q.messages:
+			if !q.publish(ctx, m) {
+				level.Error(q.logger).Log("msg", "queued trades are not published on shutdown", "count", q.Depth()+1)
+				return ctx.Err()
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// publish retries the message with exponential backoff till it's acknowledged or the context is canceled.
+func (q *Queue) publish(ctx context.Context, m Message) bool {
+	delay := minRetryDelay
+	for {
+		err := q.publisher.Publish(ctx, m)
+		q.metrics.observe(err)
+		if err == nil {
+			return true
+		}
+		level.Warn(q.logger).Log("msg", "failed to publish trade, retrying", "key", m.Key, "retryIn", delay, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// queueMetrics records publishing, methods are safe to call on nil metrics which records nothing.
+type queueMetrics struct {
+	published *prometheus.CounterVec
+}
+
+func newQueueMetrics(registerer prometheus.Registerer, q *Queue) *queueMetrics {
+	m := queueMetrics{
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pdax_publish_attempts_total",
+			Help: "Trade publish attempts per result, ok or error.",
+		}, []string{"result"}),
+	}
+	depth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdax_publish_queue_depth",
+		Help: "Trades waiting for publishing.",
+	}, func() float64 {
+		return float64(q.Depth())
+	})
+	registerer.MustRegister(m.published, depth)
+
+	return &m
+}
+
+func (m *queueMetrics) observe(err error) {
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		m.published.WithLabelValues("error").Inc()
+		return
+	}
+	m.published.WithLabelValues("ok").Inc()
+}
@@ -0,0 +1,211 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+func TestQueueRetries(t *testing.T) {
+	p := &fakePublisher{failures: 2}
+	registry := prometheus.NewRegistry()
+	q := NewQueue(p, WithMetrics(registry))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Run(ctx)
+	}()
+
+	for id := int64(1); id <= 3; id++ {
+		if err := q.Enqueue(ctx, testTrade(id), time.Now()); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	waitFor(t, func() bool { return len(p.keys()) == 3 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := p.keys(); got[0] != "1" || got[1] != "2" || got[2] != "3" {
+		t.Errorf("published %v, want 1, 2, 3 in order", got)
+	}
+	if !p.isClosed() {
+		t.Error("publisher is not closed")
+	}
+	if got := testutil.ToFloat64(q.metrics.published.WithLabelValues("error")); got != 2 {
+		t.Errorf("got %v failed attempts, want 2", got)
+	}
+	if got := testutil.ToFloat64(q.metrics.published.WithLabelValues("ok")); got != 3 {
+		t.Errorf("got %v successful attempts, want 3", got)
+	}
+}
+
+func TestQueueDrainsOnShutdown(t *testing.T) {
+	p := &fakePublisher{}
+	q := NewQueue(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for id := int64(1); id <= 100; id++ {
+		if err := q.Enqueue(ctx, testTrade(id), time.Now()); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if got := q.Depth(); got != 100 {
+		t.Errorf("Depth() = %d, want 100", got)
+	}
+
+	cancel()
+	if err := q.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := len(p.keys()); got != 100 {
+		t.Errorf("published %d queued trades on shutdown, want 100", got)
+	}
+	if got := q.Depth(); got != 0 {
+		t.Errorf("Depth() = %d after drain, want 0", got)
+	}
+}
+
+func TestQueuePublishesRetriedMessageOnShutdown(t *testing.T) {
+	p := &fakePublisher{failures: 1}
+	q := NewQueue(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Run(ctx)
+	}()
+	if err := q.Enqueue(ctx, testTrade(1), time.Now()); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	waitFor(t, func() bool { return p.attemptCount() == 1 })
+
+	cancel() // while the first attempt waits for retry
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.keys(); len(got) != 1 {
+		t.Errorf("published %v, want the retried trade", got)
+	}
+}
+
+func TestQueueDrainTimeout(t *testing.T) {
+	p := &fakePublisher{failures: -1}
+	q := NewQueue(p, WithDrainTimeout(50*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for id := int64(1); id <= 3; id++ {
+		if err := q.Enqueue(ctx, testTrade(id), time.Now()); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	cancel()
+	if err := q.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want deadline exceeded", err)
+	}
+	if !p.isClosed() {
+		t.Error("publisher is not closed")
+	}
+}
+
+func TestQueueEnqueueBlocksWhenFull(t *testing.T) {
+	q := NewQueue(&fakePublisher{}, WithSize(1))
+	if err := q.Enqueue(context.Background(), testTrade(1), time.Now()); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, testTrade(2), time.Now()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Enqueue() to full queue error = %v, want deadline exceeded", err)
+	}
+}
+
+// fakePublisher records published messages, it fails the given number of attempts first (-1 fails all).
+type fakePublisher struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  int
+	published []Message
+	closed    bool
+}
+
+func (p *fakePublisher) Publish(_ context.Context, m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts++
+	if p.failures != 0 {
+		if p.failures > 0 {
+			p.failures--
+		}
+		return errors.New("bus is unavailable")
+	}
+	p.published = append(p.published, m)
+
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	return nil
+}
+
+func (p *fakePublisher) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]string, len(p.published))
+	for i, m := range p.published {
+		keys[i] = m.Key
+	}
+	return keys
+}
+
+func (p *fakePublisher) attemptCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.attempts
+}
+
+func (p *fakePublisher) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in 5s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testTrade(id int64) monitor.Trade {
+	return monitor.Trade{
+		ID:           id,
+		CurrencyPair: "BTC-PHP",
+		Price:        decimal("2500000.50"),
+		Quantity:     decimal("0.01"),
+		Timestamp:    time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC),
+		Side:         monitor.SideBid,
+	}
+}
@@ -0,0 +1,172 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a rendered report.
+type Message struct {
+	Subject string
+	// FileName names the report when it's attached, e.g. pdax-volume-2022-03-01.csv.
+	FileName    string
+	ContentType string
+	Body        []byte
+}
+
+// NewMessage renders the report in the format.
+func NewMessage(r Report, format string) (Message, error) {
+	var body bytes.Buffer
+	if err := Render(&body, r, format); err != nil {
+		return Message{}, err
+	}
+
+	ext := map[string]string{FormatMarkdown: "md", FormatHTML: "html", FormatCSV: "csv"}[format]
+	return Message{
+		Subject:     r.Title(),
+		FileName:    "pdax-volume-" + r.Day.Format("2006-01-02") + "." + ext,
+		ContentType: ContentType(format),
+		Body:        body.Bytes(),
+	}, nil
+}
+
+// Sender delivers rendered reports.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTP emails reports, STARTTLS is used when the server supports it.
+type SMTP struct {
+	// Addr is host:port of the server, e.g. smtp.example.com:587.
+	Addr string
+	From string
+	To   []string
+	// Username and Password authenticate with PLAIN auth when the username is set.
+	Username string
+	Password string
+}
+
+// Send emails the message. HTML reports are the body of the email, other formats are attached as text files
+// and shown inline by most email clients.
+func (s SMTP) Send(ctx context.Context, m Message) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address: %v", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("smtp starttls: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("smtp auth: %v", err)
+		}
+	}
+	if err = c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err = c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp recipient %s: %v", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(s.email(m, time.Now())); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// email formats the message as a single part MIME email.
+func (s SMTP) email(m Message, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	contentType := m.ContentType
+	if !strings.HasPrefix(contentType, "text/html") {
+		// text/plain is shown inline by clients which don't know e.g. text/markdown
+		contentType = "text/plain; charset=utf-8"
+		fmt.Fprintf(&b, "Content-Disposition: inline; filename=%q\r\n", m.FileName)
+	}
+	fmt.Fprintf(&b, "Content-Type: %s\r\n", contentType)
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write(m.Body)
+	qp.Close()
+
+	return b.Bytes()
+}
+
+// Webhook posts reports to the URL with Content-Type of the report format.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send posts the message body, the subject and file name are sent in X-Report-Subject and
+// Content-Disposition headers. Any non-2xx response fails the delivery.
+func (h Webhook) Send(ctx context.Context, m Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", m.ContentType)
+	req.Header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": m.FileName}))
+	req.Header.Set("X-Report-Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package report
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSMTPSend(t *testing.T) {
+	tests := []struct {
+		format      string
+		contentType string
+		inline      bool
+	}{
+		{FormatHTML, "text/html; charset=utf-8", false},
+		{FormatCSV, "text/plain; charset=utf-8", true},
+		{FormatMarkdown, "text/plain; charset=utf-8", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			server := newSMTPServer(t)
+			m, err := NewMessage(testReport(), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := SMTP{
+				Addr:     server.addr,
+				From:     "monitor@example.com",
+				To:       []string{"ops@example.com", "risk@example.com"},
+				Username: "monitor",
+				Password: "secret",
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err = s.Send(ctx, m); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			got := server.delivered()
+			if got.auth != "\x00monitor\x00secret" || got.from != "monitor@example.com" ||
+				!reflect.DeepEqual(got.to, s.To) {
+				t.Errorf("got auth %q, mail from %s to %v", got.auth, got.from, got.to)
+			}
+
+			email, err := mail.ReadMessage(strings.NewReader(got.data))
+			if err != nil {
+				t.Fatalf("invalid email: %v\n%s", err, got.data)
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+			if subject != m.Subject || email.Header.Get("To") != "ops@example.com, risk@example.com" {
+				t.Errorf("got email %q to %q", subject, email.Header.Get("To"))
+			}
+			if got := email.Header.Get("Content-Type"); got != tc.contentType {
+				t.Errorf("Content-Type = %s, want %s", got, tc.contentType)
+			}
+			if got := strings.Contains(email.Header.Get("Content-Disposition"), m.FileName); got != tc.inline {
+				t.Errorf("Content-Disposition = %q, want the file named %v", email.Header.Get("Content-Disposition"), tc.inline)
+			}
+			// text lines of emails end with CRLF
+			body, err := io.ReadAll(quotedprintable.NewReader(email.Body))
+			if err != nil || strings.ReplaceAll(string(body), "\r\n", "\n") != string(m.Body) {
+				t.Errorf("got body (%v)\n%s\nwant\n%s", err, body, m.Body)
+			}
+		})
+	}
+}
+
+func TestSMTPSendRejectedRecipient(t *testing.T) {
+	server := newSMTPServer(t)
+	s := SMTP{Addr: server.addr, From: "monitor@example.com", To: []string{"ops@example.com", "nobody@example.com"}}
+
+	err := s.Send(context.Background(), Message{Subject: "report", ContentType: "text/html", Body: []byte("<p>report</p>")})
+	if err == nil || !strings.Contains(err.Error(), "nobody@example.com") {
+		t.Errorf("Send() error = %v, want the recipient rejected", err)
+	}
+	if got := server.delivered(); got.data != "" {
+		t.Errorf("delivered %q despite the rejected recipient", got.data)
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m, err := NewMessage(testReport(), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (Webhook{URL: srv.URL + "/reports"}).Send(context.Background(), m); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/reports" || string(body) != string(m.Body) {
+		t.Errorf("got %s %s with body\n%s", got.Method, got.URL.Path, body)
+	}
+	if ct := got.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %s, want text/csv; charset=utf-8", ct)
+	}
+	_, params, err := mime.ParseMediaType(got.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] != m.FileName {
+		t.Errorf("Content-Disposition = %q, want attachment of %s", got.Header.Get("Content-Disposition"), m.FileName)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(got.Header.Get("X-Report-Subject")); subject != m.Subject {
+		t.Errorf("X-Report-Subject = %s, want %s", subject, m.Subject)
+	}
+}
+
+func TestWebhookSendFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := Webhook{URL: srv.URL, Client: srv.Client()}.Send(context.Background(), Message{Body: []byte("report")})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Send() error = %v, want the response status", err)
+	}
+}
+
+// smtpServer is a fake SMTP server accepting a single connection, it supports PLAIN auth and rejects
+// recipients starting with nobody.
+type smtpServer struct {
+	addr string
+	done chan struct{}
+
+	mu   sync.Mutex
+	mail smtpMail
+}
+
+// smtpMail is a mail received by the fake server.
+type smtpMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := smtpServer{addr: lis.Addr().String(), done: make(chan struct{})}
+	t.Cleanup(func() {
+		lis.Close()
+		<-s.done
+	})
+
+	go func() {
+		defer close(s.done)
+
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		s.serve(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)))
+	}()
+
+	return &s
+}
+
+func (s *smtpServer) serve(rw *bufio.ReadWriter) {
+	reply := func(line string) {
+		rw.WriteString(line + "\r\n")
+		rw.Flush()
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0])
+
+		s.mu.Lock()
+		switch {
+		case verb == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case verb == "AUTH":
+			auth, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd, "AUTH PLAIN "))
+			s.mail.auth = string(auth)
+			reply("235 2.7.0 Authentication successful")
+		case verb == "MAIL":
+			s.mail.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case verb == "RCPT" && strings.Contains(cmd, "<nobody"):
+			reply("550 No such user")
+		case verb == "RCPT":
+			s.mail.to = append(s.mail.to, strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			s.mail.data = s.readData(rw.Reader)
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("250 OK")
+		}
+		s.mu.Unlock()
+	}
+}
+
+// readData reads the mail till the line of a single dot, it must be called with the lock held.
+func (s *smtpServer) readData(r *bufio.Reader) string {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil || line == ".\r\n" {
+			return b.String()
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// delivered waits for the client to disconnect and returns the received mail.
+func (s *smtpServer) delivered() smtpMail {
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.mail
+}
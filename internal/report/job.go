@@ -0,0 +1,179 @@
+package report
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	defaultDeliveryTimeout = 5 * time.Minute
+	retryDelay             = 15 * time.Minute
+	maxAttempts            = 4
+)
+
+// Job builds the report of the previous day and delivers it every day at the same time.
+type Job struct {
+	repository monitor.TradeRepository
+	fxRates    monitor.FXRateRepository
+	pairs      func() []string
+	at         time.Duration
+	location   *time.Location
+	format     string
+	senders    []Sender
+	logger     log.Logger
+}
+
+// NewJob instantiates the job reporting trades of the pairs from the repository, it runs at the offset
+// from midnight of the job time zone, e.g. 8*time.Hour runs it at 08:00.
+func NewJob(rep monitor.TradeRepository, pairs func() []string, at time.Duration, options ...JobOption) *Job {
+	j := Job{
+		repository: rep,
+		pairs:      pairs,
+		at:         at,
+		location:   time.UTC,
+		format:     FormatHTML,
+		logger:     log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&j)
+	}
+
+	return &j
+}
+
+// JobOption configures the job.
+type JobOption func(*Job)
+
+// WithLogger configures a logger to debug the job.
+func WithLogger(l log.Logger) JobOption {
+	return func(j *Job) {
+		j.logger = l
+	}
+}
+
+// WithLocation configures the time zone of reported days and of the job time, UTC by default.
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *Job) {
+		j.location = loc
+	}
+}
+
+// WithFormat configures the report format, HTML by default.
+func WithFormat(format string) JobOption {
+	return func(j *Job) {
+		j.format = format
+	}
+}
+
+// WithFXRateRepository configures repository of USD-PHP rates to report USD notional.
+func WithFXRateRepository(rep monitor.FXRateRepository) JobOption {
+	return func(j *Job) {
+		j.fxRates = rep
+	}
+}
+
+// WithSenders configures delivery of the report.
+func WithSenders(senders ...Sender) JobOption {
+	return func(j *Job) {
+		j.senders = senders
+	}
+}
+
+// Run delivers reports till the context is canceled. Senders which failed are retried a few times
+// 15 minutes apart, the report is skipped afterwards.
+func (j *Job) Run(ctx context.Context) error {
+	for {
+		next := j.next(time.Now())
+		level.Info(j.logger).Log("msg", "next volume report is scheduled", "at", next)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		day := Day(next, j.location)
+		pending := j.senders
+		for attempt := 1; ; attempt++ {
+			var err error
+			pending, err = j.deliver(ctx, day, pending)
+			if err == nil {
+				level.Info(j.logger).Log("msg", "volume report delivered", "day", day.Format("2006-01-02"))
+				break
+			}
+			level.Error(j.logger).Log("msg", "volume report delivery failed", "day", day.Format("2006-01-02"),
+				"attempt", attempt, "err", err)
+			if attempt == maxAttempts {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retryDelay):
+			}
+		}
+	}
+}
+
+// next returns the first run time after now.
+func (j *Job) next(now time.Time) time.Time {
+	y, m, d := now.In(j.location).Date()
+	next := time.Date(y, m, d, 0, 0, 0, 0, j.location).Add(j.at)
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, 0, 0, 0, 0, j.location).Add(j.at)
+	}
+
+	return next
+}
+
+// deliver builds the report of the day and sends it, senders which failed are returned to be retried.
+func (j *Job) deliver(ctx context.Context, day time.Time, senders []Sender) ([]Sender, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultDeliveryTimeout)
+	defer cancel()
+
+	r, err := Build(ctx, j.repository, j.fxRates, j.pairs(), day)
+	if err != nil {
+		return senders, err
+	}
+	m, err := NewMessage(r, j.format)
+	if err != nil {
+		return senders, err
+	}
+
+	var failed []Sender
+	var firstErr error
+	for _, s := range senders {
+		if err = s.Send(ctx, m); err != nil {
+			failed = append(failed, s)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return failed, firstErr
+}
+
+// Deliver renders the report in the format and sends it with every sender, all senders are tried
+// and the first error is returned.
+func Deliver(ctx context.Context, r Report, format string, senders []Sender) error {
+	m, err := NewMessage(r, format)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, s := range senders {
+		if err = s.Send(ctx, m); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,170 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Report formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatCSV      = "csv"
+)
+
+// format renders reports of MIME type.
+type format struct {
+	render      func(w io.Writer, r Report) error
+	contentType string
+}
+
+// formats returns renderers by format name.
+func formats() map[string]format {
+	return map[string]format{
+		FormatMarkdown: {renderMarkdown, "text/markdown; charset=utf-8"},
+		FormatHTML:     {renderHTML, "text/html; charset=utf-8"},
+		FormatCSV:      {renderCSV, "text/csv; charset=utf-8"},
+	}
+}
+
+// Formats returns names of available formats.
+func Formats() []string {
+	var names []string
+	for name := range formats() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ContentType returns MIME type of the format.
+func ContentType(format string) string {
+	return formats()[format].contentType
+}
+
+// Render writes the report in the format.
+func Render(w io.Writer, r Report, format string) error {
+	f, ok := formats()[format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q, try %s", format, strings.Join(Formats(), ", "))
+	}
+
+	return f.render(w, r)
+}
+
+var columns = []string{
+	"Pair", "Trades", "Volume", "Notional (PHP)", "Notional (USD)", "VWAP", "High", "Low", "7-day avg volume", "Change vs 7-day avg (%)",
+}
+
+// rows formats pair volumes as table cells, missing figures are empty.
+func rows(r Report) [][]string {
+	rows := make([][]string, 0, len(r.Pairs))
+	for _, v := range r.Pairs {
+		rows = append(rows, []string{
+			v.CurrencyPair,
+			strconv.Itoa(v.Trades),
+			fixed(v.Volume, 8),
+			fixed(v.Notional, 2),
+			fixed(v.NotionalUSD, 2),
+			fixed(v.VWAP, 8),
+			fixed(v.High, -1),
+			fixed(v.Low, -1),
+			fixed(v.AverageVolume, 8),
+			fixed(v.Change, 2),
+		})
+	}
+
+	return rows
+}
+
+// fixed formats the decimal rounded to the places, trailing zeros are trimmed. Negative places keep the decimal as is.
+func fixed(d *apd.Decimal, places int32) string {
+	if d == nil {
+		return ""
+	}
+	if places < 0 {
+		return d.Text('f')
+	}
+
+	var rounded apd.Decimal
+	if _, err := apd.BaseContext.WithPrecision(38).Quantize(&rounded, d, -places); err != nil {
+		return d.Text('f')
+	}
+	rounded.Reduce(&rounded)
+
+	return rounded.Text('f')
+}
+
+func renderCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"Day"}, columns...)); err != nil {
+		return err
+	}
+	day := r.Day.Format("2006-01-02")
+	for _, row := range rows(r) {
+		if err := cw.Write(append([]string{day}, row...)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func renderMarkdown(w io.Writer, r Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", r.Title())
+	fmt.Fprintf(&b, "Trades from %s till the next midnight (%s).\n\n", r.Day.Format("2006-01-02 15:04"), r.Day.Location())
+
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows(r) {
+		for i, cell := range row {
+			if cell == "" {
+				row[i] = "-"
+			}
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Trades from {{.From}} till the next midnight ({{.Location}}).</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range $i, $cell := .}}<td{{if $i}} align="right"{{end}}>{{if $cell}}{{$cell}}{{else}}-{{end}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func renderHTML(w io.Writer, r Report) error {
+	return htmlTemplate.Execute(w, struct {
+		Title    string
+		From     string
+		Location string
+		Columns  []string
+		Rows     [][]string
+	}{
+		Title:    r.Title(),
+		From:     r.Day.Format("2006-01-02 15:04"),
+		Location: r.Day.Location().String(),
+		Columns:  columns,
+		Rows:     rows(r),
+	})
+}
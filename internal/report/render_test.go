@@ -0,0 +1,128 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testReport() Report {
+	return Report{
+		Day: day,
+		Pairs: []PairVolume{
+			{
+				CurrencyPair:  "BTC-PHP",
+				Trades:        3,
+				Volume:        decimal("3.5"),
+				Notional:      decimal("575.004"),
+				NotionalUSD:   decimal("21"),
+				VWAP:          decimal("164.2857142857142857142857142857143"),
+				High:          decimal("200.50"),
+				Low:           decimal("100"),
+				AverageVolume: decimal("2"),
+				Change:        decimal("-12.345"),
+			},
+			{CurrencyPair: "XRP-<b>", Volume: decimal("0"), AverageVolume: decimal("0")},
+		},
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, testReport(), FormatCSV); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("rendered invalid csv: %v", err)
+	}
+	want := [][]string{
+		append([]string{"Day"}, columns...),
+		{"2022-03-08", "BTC-PHP", "3", "3.5", "575", "21", "164.28571429", "200.50", "100", "2", "-12.35"},
+		{"2022-03-08", "XRP-<b>", "0", "0", "", "", "", "", "", "0", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("rendered records\n%q\nwant\n%q", records, want)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, testReport(), FormatMarkdown); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{
+		"# PDAX daily volume 2022-03-08",
+		"",
+		"Trades from 2022-03-08 00:00 till the next midnight (UTC).",
+		"",
+		"| " + strings.Join(columns, " | ") + " |",
+		"|" + strings.Repeat(" --- |", len(columns)),
+		"| BTC-PHP | 3 | 3.5 | 575 | 21 | 164.28571429 | 200.50 | 100 | 2 | -12.35 |",
+		"| XRP-<b> | 0 | 0 | - | - | - | - | - | 0 | - |",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("rendered\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, testReport(), FormatHTML); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	out := b.String()
+	for _, want := range []string{
+		"<title>PDAX daily volume 2022-03-08</title>",
+		"<p>Trades from 2022-03-08 00:00 till the next midnight (UTC).</p>",
+		"<th>Change vs 7-day avg (%)</th>",
+		`<tr><td>BTC-PHP</td><td align="right">3</td><td align="right">3.5</td><td align="right">575</td>`,
+		`<td align="right">-12.35</td></tr>`,
+		`<tr><td>XRP-&lt;b&gt;</td><td align="right">0</td><td align="right">0</td><td align="right">-</td>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered html lacks %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "<b>") {
+		t.Errorf("rendered html isn't escaped:\n%s", out)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, testReport(), "pdf"); err == nil || !strings.Contains(err.Error(), "csv, html, markdown") {
+		t.Errorf("Render() error = %v, want unknown format listing the formats", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("rendered %q in unknown format", b.String())
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	tests := []struct {
+		format      string
+		fileName    string
+		contentType string
+	}{
+		{FormatCSV, "pdax-volume-2022-03-08.csv", "text/csv; charset=utf-8"},
+		{FormatHTML, "pdax-volume-2022-03-08.html", "text/html; charset=utf-8"},
+		{FormatMarkdown, "pdax-volume-2022-03-08.md", "text/markdown; charset=utf-8"},
+	}
+
+	for _, tc := range tests {
+		m, err := NewMessage(testReport(), tc.format)
+		if err != nil {
+			t.Fatalf("NewMessage(%s) error = %v", tc.format, err)
+		}
+		if m.Subject != "PDAX daily volume 2022-03-08" || m.FileName != tc.fileName || m.ContentType != tc.contentType || len(m.Body) == 0 {
+			t.Errorf("NewMessage(%s) = %q %q %q of %d bytes", tc.format, m.Subject, m.FileName, m.ContentType, len(m.Body))
+		}
+	}
+}
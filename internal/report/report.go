@@ -0,0 +1,137 @@
+// Package report summarizes daily trading volume per currency pair, renders the summary and delivers it.
+package report
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/fx"
+)
+
+const (
+	// averageDays is number of days before the report day the volume change is measured against.
+	averageDays = 7
+	// notionalQuote is quote currency of pairs whose notional is reported.
+	notionalQuote = "PHP"
+)
+
+// Report is trading volume of currency pairs within the day.
+type Report struct {
+	// Day is the start of the reported day in the report time zone.
+	Day   time.Time
+	Pairs []PairVolume
+}
+
+// PairVolume is trading volume of the currency pair within the day.
+type PairVolume struct {
+	CurrencyPair string
+	Trades       int
+	// Volume is traded base currency quantity.
+	Volume *apd.Decimal
+	// Notional is traded PHP amount, it's nil for pairs which are not quoted in PHP.
+	Notional *apd.Decimal
+	// NotionalUSD is Notional converted into USD at trade times, it's nil when a trade can't be converted.
+	NotionalUSD *apd.Decimal
+	// VWAP, High and Low are nil when there are no trades.
+	VWAP *apd.Decimal
+	High *apd.Decimal
+	Low  *apd.Decimal
+	// AverageVolume is average daily base currency volume of 7 days before the day.
+	AverageVolume *apd.Decimal
+	// Change is percent change of the volume versus the average volume, it's nil when the average is zero.
+	Change *apd.Decimal
+}
+
+// Title names the report, e.g. in an email subject.
+func (r Report) Title() string {
+	return "PDAX daily volume " + r.Day.Format("2006-01-02")
+}
+
+// Day returns the start of the day before the time in the location, i.e. yesterday.
+func Day(now time.Time, loc *time.Location) time.Time {
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d-1, 0, 0, 0, 0, loc)
+}
+
+// Build summarizes trades of the pairs within the day starting at the given time, its location sets the time zone.
+// PHP notional is converted into USD by USD-PHP rates of the rate repository unless it's nil.
+func Build(ctx context.Context, rep monitor.TradeRepository, rates monitor.FXRateRepository, pairs []string, day time.Time) (Report, error) {
+	r := Report{Day: day, Pairs: make([]PairVolume, 0, len(pairs))}
+	usd, err := fx.USDRates(ctx, rates, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return r, err
+	}
+
+	for _, pair := range pairs {
+		v, err := buildPair(ctx, rep, usd, pair, day)
+		if err != nil {
+			return r, fmt.Errorf("failed to summarize %s trades: %v", pair, err)
+		}
+		r.Pairs = append(r.Pairs, v)
+	}
+
+	return r, nil
+}
+
+func buildPair(ctx context.Context, rep monitor.TradeRepository, usd monitor.FXRates, pair string, day time.Time) (PairVolume, error) {
+	from, end := day.AddDate(0, 0, -averageDays), day.AddDate(0, 0, 1)
+	trades, err := rep.Trades(ctx, monitor.TradeQuery{CurrencyPair: pair, From: from, To: end})
+	if err != nil {
+		return PairVolume{}, err
+	}
+
+	dc := apd.BaseContext.WithPrecision(34)
+	v := PairVolume{CurrencyPair: pair, Volume: new(apd.Decimal)}
+	priced := new(apd.Decimal) // sum of price times quantity
+	pricedUSD := new(apd.Decimal)
+	pastVolume := new(apd.Decimal)
+	for _, t := range trades {
+		if t.Timestamp.Before(day) {
+			dc.Add(pastVolume, pastVolume, t.Quantity)
+			continue
+		}
+
+		v.Trades++
+		dc.Add(v.Volume, v.Volume, t.Quantity)
+		var amount apd.Decimal
+		dc.Mul(&amount, t.Price, t.Quantity)
+		dc.Add(priced, priced, &amount)
+		if amountUSD, ok := usd.NotionalUSD(t); ok && pricedUSD != nil {
+			dc.Add(pricedUSD, pricedUSD, amountUSD)
+		} else {
+			pricedUSD = nil
+		}
+		if v.High == nil || t.Price.Cmp(v.High) > 0 {
+			v.High = t.Price
+		}
+		if v.Low == nil || t.Price.Cmp(v.Low) < 0 {
+			v.Low = t.Price
+		}
+	}
+
+	if strings.HasSuffix(pair, "-"+notionalQuote) {
+		v.Notional = priced
+		if usd != nil {
+			v.NotionalUSD = pricedUSD
+		}
+	}
+	if !v.Volume.IsZero() {
+		v.VWAP = new(apd.Decimal)
+		dc.Quo(v.VWAP, priced, v.Volume)
+	}
+
+	v.AverageVolume = new(apd.Decimal)
+	dc.Quo(v.AverageVolume, pastVolume, apd.New(averageDays, 0))
+	if !v.AverageVolume.IsZero() {
+		v.Change = new(apd.Decimal)
+		dc.Quo(v.Change, v.Volume, v.AverageVolume)
+		dc.Sub(v.Change, v.Change, apd.New(1, 0))
+		dc.Mul(v.Change, v.Change, apd.New(100, 0))
+	}
+
+	return v, nil
+}
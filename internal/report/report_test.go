@@ -0,0 +1,164 @@
+package report
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+)
+
+var day = time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC)
+
+func TestBuild(t *testing.T) {
+	s := memory.NewStorage()
+	insertTrades(t, s.TradeRepository(),
+		trade("BTC-PHP", day.AddDate(0, 0, -8), "80", "100"), // before the average days
+		trade("BTC-PHP", day.AddDate(0, 0, -7), "90", "7"),
+		trade("BTC-PHP", day.Add(-time.Minute), "95", "7"),
+		trade("BTC-PHP", day.Add(time.Hour), "100", "1"),
+		trade("BTC-PHP", day.Add(12*time.Hour), "200", "2"),
+		trade("BTC-PHP", day.Add(18*time.Hour), "150", "0.5"),
+		trade("BTC-PHP", day.AddDate(0, 0, 1), "1000", "5"), // the next day
+		trade("ETH-USDT", day.Add(time.Hour), "3000", "0.5"),
+	)
+	rates := []monitor.FXRate{
+		{CurrencyPair: monitor.CurrencyPairUSDPHP, Timestamp: day.AddDate(0, 0, -1), Rate: decimal("50")},
+		{CurrencyPair: monitor.CurrencyPairUSDPHP, Timestamp: day.Add(6 * time.Hour), Rate: decimal("25")},
+	}
+	if err := s.FXRateRepository().Upsert(context.Background(), rates); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Build(context.Background(), s.TradeRepository(), s.FXRateRepository(), []string{"BTC-PHP", "ETH-USDT", "XRP-PHP"}, day)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if !r.Day.Equal(day) || len(r.Pairs) != 3 {
+		t.Fatalf("got report of %v with %d pairs, want of %v with 3 pairs", r.Day, len(r.Pairs), day)
+	}
+
+	// 100*1/50 + 200*2/25 + 150*0.5/25
+	assertPair(t, r.Pairs[0], pairWant{
+		pair: "BTC-PHP", trades: 3, volume: "3.5", notional: "575", notionalUSD: "21", vwap: "164.2857142857142857142857142857143",
+		high: "200", low: "100", average: "2", change: "75",
+	})
+	assertPair(t, r.Pairs[1], pairWant{
+		pair: "ETH-USDT", trades: 1, volume: "0.5", vwap: "3000", high: "3000", low: "3000", average: "0",
+	})
+	assertPair(t, r.Pairs[2], pairWant{pair: "XRP-PHP", volume: "0", notional: "0", notionalUSD: "0", average: "0"})
+}
+
+func TestBuildNotionalUSD(t *testing.T) {
+	s := memory.NewStorage()
+	insertTrades(t, s.TradeRepository(),
+		trade("BTC-PHP", day.Add(time.Hour), "100", "1"),
+		trade("BTC-PHP", day.Add(12*time.Hour), "200", "2"),
+	)
+	ctx := context.Background()
+
+	r, err := Build(ctx, s.TradeRepository(), nil, []string{"BTC-PHP"}, day)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if r.Pairs[0].NotionalUSD != nil {
+		t.Errorf("got USD notional %s without rates", r.Pairs[0].NotionalUSD)
+	}
+
+	rate := monitor.FXRate{CurrencyPair: monitor.CurrencyPairUSDPHP, Timestamp: day.Add(6 * time.Hour), Rate: decimal("50")}
+	if err = s.FXRateRepository().Upsert(ctx, []monitor.FXRate{rate}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = Build(ctx, s.TradeRepository(), s.FXRateRepository(), []string{"BTC-PHP"}, day); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if r.Pairs[0].NotionalUSD != nil {
+		t.Errorf("got USD notional %s of a trade made before the first rate", r.Pairs[0].NotionalUSD)
+	}
+}
+
+func TestDay(t *testing.T) {
+	manila := time.FixedZone("PHT", 8*60*60)
+	tests := []struct {
+		now  time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{time.Date(2022, 3, 9, 8, 0, 0, 0, time.UTC), time.UTC, day},
+		{time.Date(2022, 3, 9, 0, 0, 0, 0, time.UTC), time.UTC, day},
+		{time.Date(2022, 3, 8, 23, 0, 0, 0, time.UTC), manila, time.Date(2022, 3, 8, 0, 0, 0, 0, manila)},
+		{time.Date(2022, 3, 1, 1, 0, 0, 0, time.UTC), time.UTC, time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		if got := Day(tc.now, tc.loc); !got.Equal(tc.want) || got.Location() != tc.loc {
+			t.Errorf("Day(%v, %v) = %v, want %v", tc.now, tc.loc, got, tc.want)
+		}
+	}
+}
+
+// pairWant is the expected pair volume, empty decimals are expected to be nil.
+type pairWant struct {
+	pair                                                            string
+	trades                                                          int
+	volume, notional, notionalUSD, vwap, high, low, average, change string
+}
+
+func assertPair(t *testing.T, got PairVolume, want pairWant) {
+	t.Helper()
+
+	if got.CurrencyPair != want.pair || got.Trades != want.trades {
+		t.Errorf("got %d trades of %s, want %d trades of %s", got.Trades, got.CurrencyPair, want.trades, want.pair)
+	}
+	for _, d := range []struct {
+		name string
+		got  *apd.Decimal
+		want string
+	}{
+		{"Volume", got.Volume, want.volume},
+		{"Notional", got.Notional, want.notional},
+		{"NotionalUSD", got.NotionalUSD, want.notionalUSD},
+		{"VWAP", got.VWAP, want.vwap},
+		{"High", got.High, want.high},
+		{"Low", got.Low, want.low},
+		{"AverageVolume", got.AverageVolume, want.average},
+		{"Change", got.Change, want.change},
+	} {
+		switch {
+		case d.want == "" && d.got != nil:
+			t.Errorf("%s %s = %s, want nil", want.pair, d.name, d.got)
+		case d.want != "" && (d.got == nil || d.got.Cmp(decimal(d.want)) != 0):
+			t.Errorf("%s %s = %v, want %s", want.pair, d.name, d.got, d.want)
+		}
+	}
+}
+
+func insertTrades(t *testing.T, rep monitor.TradeRepository, trades ...monitor.Trade) {
+	t.Helper()
+
+	for i := range trades {
+		if err := rep.Insert(context.Background(), &trades[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func trade(pair string, ts time.Time, price, quantity string) monitor.Trade {
+	return monitor.Trade{
+		CurrencyPair: pair,
+		Price:        decimal(price),
+		Quantity:     decimal(quantity),
+		Timestamp:    ts,
+		Side:         monitor.SideBid,
+	}
+}
+
+func decimal(s string) *apd.Decimal {
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
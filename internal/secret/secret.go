@@ -0,0 +1,214 @@
+// Package secret loads credentials from flags, config file, environment and mounted secret files
+// and keeps them out of logs.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// Redacted is printed instead of secret values.
+	Redacted = "******"
+	// EncryptedPrefix marks values encrypted with Encrypt, e.g. in YAML config file.
+	EncryptedPrefix = "enc:"
+	// FileSuffix is appended to env var name to read the secret from file (Docker/Kubernetes secrets).
+	FileSuffix = "_FILE"
+)
+
+// Value is a flag.Value holding a secret which is redacted whenever it is printed.
+type Value struct {
+	value string
+	key   []byte
+}
+
+// Set implements flag.Value. Values with EncryptedPrefix are decrypted.
+func (v *Value) Set(s string) error {
+	if !strings.HasPrefix(s, EncryptedPrefix) {
+		v.value = s
+		return nil
+	}
+
+	plain, err := Decrypt(v.key, strings.TrimPrefix(s, EncryptedPrefix))
+	if err != nil {
+		return err
+	}
+	v.value = plain
+
+	return nil
+}
+
+// String implements flag.Value and fmt.Stringer, it never reveals the secret.
+func (v *Value) String() string {
+	if v == nil || v.value == "" {
+		return ""
+	}
+
+	return Redacted
+}
+
+// GoString implements fmt.GoStringer, it never reveals the secret.
+func (v *Value) GoString() string {
+	return v.String()
+}
+
+// MarshalText implements encoding.TextMarshaler, it never reveals the secret.
+func (v *Value) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// Reveal returns the secret.
+func (v *Value) Reveal() string {
+	return v.value
+}
+
+// Flags defines secret flags of the flag set.
+type Flags struct {
+	fs      *flag.FlagSet
+	key     []byte
+	secrets map[string]*Value
+}
+
+// NewFlags instantiates Flags. The key decrypts values with EncryptedPrefix, it might be nil
+// when there are no encrypted values.
+func NewFlags(fs *flag.FlagSet, key []byte) *Flags {
+	return &Flags{
+		fs:      fs,
+		key:     key,
+		secrets: make(map[string]*Value),
+	}
+}
+
+// String defines a secret flag with specified name, default value, and usage string.
+func (f *Flags) String(name, value, usage string) *Value {
+	v := &Value{value: value, key: f.key}
+	f.secrets[name] = v
+	f.fs.Var(v, name, usage)
+
+	return v
+}
+
+// LoadFiles sets secret flags from files named by <PREFIX>_<FLAG>_FILE env vars, e.g.
+// PDAX_MONITOR_PDAX_PASSWORD_FILE=/run/secrets/pdax_password.
+// Flags already set by command line, config file or env var take precedence.
+func (f *Flags) LoadFiles(envVarPrefix string) error {
+	provided := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) {
+		provided[fl.Name] = true
+	})
+
+	replacer := strings.NewReplacer("-", "_", ".", "_", "/", "_")
+	for name, v := range f.secrets {
+		if provided[name] {
+			continue
+		}
+
+		key := strings.ToUpper(envVarPrefix + "_" + replacer.Replace(name) + FileSuffix)
+		path := os.Getenv(key)
+		if path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read secret file of %s: %v", key, err)
+		}
+		if err = v.Set(strings.TrimSpace(string(data))); err != nil {
+			return fmt.Errorf("failed to set secret from %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Dump returns every flag of the flag set as name=value pairs suitable for logging, secrets are redacted.
+func Dump(fs *flag.FlagSet) []interface{} {
+	var keyvals []interface{}
+	fs.VisitAll(func(fl *flag.Flag) {
+		keyvals = append(keyvals, fl.Name, fl.Value.String())
+	})
+
+	return keyvals
+}
+
+// KeyFromEnv reads base64 encoded AES key from the env var or from the file named by <envVar>_FILE.
+// It returns nil when neither is set.
+func KeyFromEnv(envVar string) ([]byte, error) {
+	encoded := os.Getenv(envVar)
+	if path := os.Getenv(envVar + FileSuffix); encoded == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret key file: %v", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("secret key must be base64 encoded: %v", err)
+	}
+
+	return key, nil
+}
+
+// Encrypt encrypts the plaintext with AES-GCM, the result is base64 encoded nonce and ciphertext.
+// The key must be 16, 24 or 32 bytes long.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(key []byte, encoded string) (string, error) {
+	if len(key) == 0 {
+		return "", fmt.Errorf("secret key is required to decrypt encrypted value")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("encrypted value must be base64 encoded: %v", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %v", err)
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,203 @@
+package secret
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name      string
+		keySize   int
+		plaintext string
+	}{
+		{"aes-128", 16, "secret"},
+		{"aes-192", 24, "p@ss:word,with;symbols"},
+		{"aes-256", 32, "secret"},
+		{"empty", 32, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key := testKey(tc.keySize)
+			encoded, err := Encrypt(key, tc.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if again, _ := Encrypt(key, tc.plaintext); again == encoded {
+				t.Error("Encrypt() returned the same ciphertext twice, want a random nonce")
+			}
+
+			got, err := Decrypt(key, encoded)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != tc.plaintext {
+				t.Errorf("Decrypt() = %q, want %q", got, tc.plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	key := testKey(32)
+	encoded, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 0x01
+
+	tests := []struct {
+		name    string
+		key     []byte
+		encoded string
+	}{
+		{"tampered ciphertext", key, base64.StdEncoding.EncodeToString(tampered)},
+		{"wrong key", testKey(32)[:16], encoded},
+		{"missing key", nil, encoded},
+		{"invalid key size", key[:10], encoded},
+		{"not base64", key, "not base64!"},
+		{"too short", key, base64.StdEncoding.EncodeToString(data[:4])},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := Decrypt(tc.key, tc.encoded); err == nil {
+				t.Errorf("Decrypt() = %q, want error", got)
+			}
+		})
+	}
+}
+
+func TestValueSet(t *testing.T) {
+	key := testKey(32)
+	encoded, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"plain", nil, "secret", "secret", false},
+		{"encrypted", key, EncryptedPrefix + encoded, "secret", false},
+		{"encrypted without key", nil, EncryptedPrefix + encoded, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := Value{key: tc.key}
+			if err := v.Set(tc.s); (err != nil) != tc.wantErr {
+				t.Fatalf("Set() error = %v, want error %v", err, tc.wantErr)
+			}
+			if got := v.Reveal(); got != tc.want {
+				t.Errorf("Reveal() = %q, want %q", got, tc.want)
+			}
+			if tc.want != "" {
+				for _, s := range []string{v.String(), fmt.Sprintf("%v", &v), fmt.Sprintf("%#v", &v)} {
+					if s != Redacted {
+						t.Errorf("printed %q, want %q", s, Redacted)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{"file", nil, path, "from-file", false},
+		{"flag takes precedence", []string{"-pdax.password=from-flag"}, path, "from-flag", false},
+		{"no file", nil, "", "default", false},
+		{"missing file", nil, filepath.Join(dir, "missing"), "default", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_PDAX_PASSWORD_FILE", tc.file)
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := NewFlags(fs, nil)
+			v := f.String("pdax.password", "default", "")
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if err := f.LoadFiles("TEST"); (err != nil) != tc.wantErr {
+				t.Fatalf("LoadFiles() error = %v, want error %v", err, tc.wantErr)
+			}
+			if got := v.Reveal(); got != tc.want {
+				t.Errorf("Reveal() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	key := testKey(32)
+	encoded := base64.StdEncoding.EncodeToString(key)
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key[:16])+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		file    string
+		want    []byte
+		wantErr bool
+	}{
+		{"unset", "", "", nil, false},
+		{"env", encoded, "", key, false},
+		{"file", "", path, key[:16], false},
+		{"env takes precedence", encoded, path, key, false},
+		{"not base64", "not base64!", "", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_SECRET_KEY", tc.env)
+			t.Setenv("TEST_SECRET_KEY_FILE", tc.file)
+
+			got, err := KeyFromEnv("TEST_SECRET_KEY")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("KeyFromEnv() error = %v, want error %v", err, tc.wantErr)
+			}
+			if string(got) != string(tc.want) {
+				t.Errorf("KeyFromEnv() = %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func testKey(n int) []byte {
+	key := make([]byte, n)
+	for i := range key {
+		key[i] = byte(i + n)
+	}
+
+	return key
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMaintenanceWindows is daily PDAX maintenance in UTC.
+const DefaultMaintenanceWindows = "22:55-23:35"
+
+// MaintenanceWindow is a daily period of PDAX maintenance, offsets are from UTC midnight.
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseMaintenanceWindows parses comma separated UTC windows, e.g. 22:55-23:35,04:00-04:15.
+// Windows ending before they start span midnight.
+func ParseMaintenanceWindows(s string) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		bounds := strings.Split(v, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid maintenance window %q, expected HH:MM-HH:MM", v)
+		}
+
+		var w MaintenanceWindow
+		var err error
+		if w.Start, err = parseClock(bounds[0]); err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", v, err)
+		}
+		if w.End, err = parseClock(bounds[1]); err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", v, err)
+		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("empty maintenance window %q", v)
+		}
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse(clockLayout, strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Remaining returns time left till the end of the window, zero when the time is out of the window.
+func (w MaintenanceWindow) Remaining(t time.Time) time.Duration {
+	t = t.UTC()
+	now := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+
+	switch {
+	case w.Start < w.End && now >= w.Start && now < w.End:
+		return w.End - now
+	case w.Start > w.End && now >= w.Start:
+		return 24*time.Hour - now + w.End
+	case w.Start > w.End && now < w.End:
+		return w.End - now
+	}
+
+	return 0
+}
+
+// String formats the window as HH:MM-HH:MM.
+func (w MaintenanceWindow) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+
+	return clock(w.Start) + "-" + clock(w.End)
+}
@@ -3,25 +3,31 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 	monitor "github.com/pudgydoge/pdax-monitor"
 	"github.com/pudgydoge/pdax-monitor/internal/auth"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/publish"
 	"github.com/pudgydoge/pdax-monitor/internal/trade"
 	"github.com/pudgydoge/pdax-monitor/internal/websocket"
 	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
 )
 
 const (
-	clockLayout                = "15:04"
-	wsPageUpdate               = 35
-	wsPageReset                = 36
-	wsTradeViewID              = 4.0
-	pdaxMaintenanceDurationMin = 35
-
-	// wsOrderBookViewID = 16.0.
+	clockLayout            = "15:04"
+	wsPageUpdate           = 35
+	wsPageReset            = 36
+	wsTradeViewID          = 4.0
+	wsTimeSalesChange      = 128
+	captchaRetryDelay      = time.Minute
+	captchaFundsRetryDelay = time.Hour
 )
 
 // MonitorService is a service to monitor trades and orderbooks.
@@ -32,12 +38,35 @@ type MonitorService struct {
 	OrderRepository monitor.OrderRepository
 	Logger          log.Logger
 	tradeReader     trade.Reader
-	// orderBook       monitor.OrderBook
+	instrumentView  float64
+	orderBookViews  map[float64]bool
+	maintenance     []MaintenanceWindow
+	settingsLock    *sync.RWMutex
+	orderBooks      map[float64]monitor.OrderBook
+	liveBooks       map[string]monitor.OrderBook
+	liveBooksLock   *sync.RWMutex
+	snapshotter     *order.Snapshotter
+	recorder        *websocket.Recorder
+	publisher       *publish.Queue
+	hub             *live.Hub
+	sinks           []namedSink
+	queueSize       int
+	metrics         *pipelineMetrics
+	status          *statusTracker
 }
 
 // NewMonitorService instantiates MonitorService.
 func NewMonitorService(options ...ConfigOption) MonitorService {
-	monitorService := MonitorService{}
+	monitorService := MonitorService{
+		Logger:        log.NewNopLogger(),
+		orderBooks:    make(map[float64]monitor.OrderBook),
+		liveBooks:     make(map[string]monitor.OrderBook),
+		liveBooksLock: &sync.RWMutex{},
+		settingsLock:  &sync.RWMutex{},
+		queueSize:     defaultQueueSize,
+		status:        newStatusTracker(),
+	}
+	monitorService.maintenance, _ = ParseMaintenanceWindows(DefaultMaintenanceWindows)
 
 	for _, opt := range options {
 		opt(&monitorService)
@@ -63,15 +92,32 @@ func WithAuthService(a auth.PDAXAuthService) ConfigOption {
 	}
 }
 
-// WithCurrencyCodes configures currency codes for traderReader.
+// WithCurrencyCodes configures currency codes for traderReader, unknown instruments are neither logged nor counted.
 func WithCurrencyCodes(cc map[int]string) ConfigOption {
 	return func(r *MonitorService) {
 		r.tradeReader = trade.Reader{
-			CurrencyCodes: cc,
+			Instruments: trade.NewInstruments(cc, nil, nil),
+		}
+	}
+}
+
+// WithInstruments configures instruments for traderReader, they are updated by instrument feed.
+func WithInstruments(instruments *trade.Instruments) ConfigOption {
+	return func(r *MonitorService) {
+		r.tradeReader = trade.Reader{
+			Instruments: instruments,
 		}
 	}
 }
 
+// WithInstrumentView configures websocket view ID of PDAX instrument reference view (0 disables discovery).
+// The view is subscribed by instrumentMessages of the websocket bootstrap book.
+func WithInstrumentView(viewID float64) ConfigOption {
+	return func(r *MonitorService) {
+		r.instrumentView = viewID
+	}
+}
+
 // WithTradeURL configures tradeURL for monitor service.
 func WithTradeURL(url string) ConfigOption {
 	return func(r *MonitorService) {
@@ -93,23 +139,145 @@ func WithOrderRepository(rep monitor.OrderRepository) ConfigOption {
 	}
 }
 
+// WithOrderBookViews configures websocket view IDs of order books to track, e.g. 16 (BTC) and 21 (ETH).
+func WithOrderBookViews(viewIDs []float64) ConfigOption {
+	return func(r *MonitorService) {
+		r.orderBookViews = make(map[float64]bool, len(viewIDs))
+		for _, id := range viewIDs {
+			r.orderBookViews[id] = true
+		}
+	}
+}
+
+// WithMaintenanceWindows configures daily PDAX maintenance windows, DefaultMaintenanceWindows by default.
+func WithMaintenanceWindows(windows []MaintenanceWindow) ConfigOption {
+	return func(r *MonitorService) {
+		r.SetMaintenanceWindows(windows)
+	}
+}
+
+// WithSnapshotPolicy configures when order book snapshots are stored in order repository.
+// Snapshots are not stored unless a policy is configured, books of order book views are tracked live regardless.
+func WithSnapshotPolicy(newPolicy order.SnapshotPolicyFactory) ConfigOption {
+	return func(r *MonitorService) {
+		if newPolicy != nil {
+			r.snapshotter = order.NewSnapshotter(newPolicy)
+		}
+	}
+}
+
+// WithRecorder configures recording of received websocket messages for replay.
+func WithRecorder(rec *websocket.Recorder) ConfigOption {
+	return func(r *MonitorService) {
+		r.recorder = rec
+	}
+}
+
+// WithPublisher configures publishing of received trades to a message bus.
+func WithPublisher(q *publish.Queue) ConfigOption {
+	return func(r *MonitorService) {
+		r.publisher = q
+	}
+}
+
+// WithHub configures fan out of received trades and order books to live subscribers.
+func WithHub(hub *live.Hub) ConfigOption {
+	return func(r *MonitorService) {
+		r.hub = hub
+	}
+}
+
+// WithTradeSink configures a sink consuming trades besides trade repository, live hub and publisher,
+// e.g. candle aggregation or alerting. The name labels its logs and metrics.
+func WithTradeSink(name string, sink TradeSink) ConfigOption {
+	return func(m *MonitorService) {
+		m.sinks = append(m.sinks, namedSink{name: name, sink: sink})
+	}
+}
+
+// WithQueueSize configures capacity of queues between pipeline stages, reading is paused while they are full.
+func WithQueueSize(n int) ConfigOption {
+	return func(m *MonitorService) {
+		if n > 0 {
+			m.queueSize = n
+		}
+	}
+}
+
+// WithMetrics configures registerer of pipeline stage metrics.
+func WithMetrics(registerer prometheus.Registerer) ConfigOption {
+	return func(m *MonitorService) {
+		m.metrics = newPipelineMetrics(registerer)
+	}
+}
+
+// SetMaintenanceWindows replaces daily PDAX maintenance windows while monitoring.
+func (m *MonitorService) SetMaintenanceWindows(windows []MaintenanceWindow) {
+	m.settingsLock.Lock()
+	m.maintenance = windows
+	m.settingsLock.Unlock()
+}
+
+// maintenanceRemaining returns time left till the end of PDAX maintenance, zero when PDAX is not under maintenance.
+func (m *MonitorService) maintenanceRemaining(now time.Time) time.Duration {
+	m.settingsLock.RLock()
+	defer m.settingsLock.RUnlock()
+
+	for _, w := range m.maintenance {
+		if d := w.Remaining(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
 // MonitorWithRecovery schedules monitor process with recovery scenarios.
 func (m *MonitorService) MonitorWithRecovery(ctx context.Context, wsInitBook websocket.InitBook) error {
+	defer m.status.setState(StateStopped, time.Time{})
+
 	for {
 		err := m.MonitorTrades(ctx, wsInitBook)
 		if err != nil {
 			level.Warn(m.Logger).Log("msg", "pdax trade monitoring has been interrupted", "err", err)
 
-			if isPDAXMaintenanceWindow() {
+			switch monitor.ErrorCode(err) {
+			case monitor.ErrorCodeNoAccounts:
+				// retrying would only burn captchas, accounts need attention of the operator
+				level.Error(m.Logger).Log("msg", "no usable pdax accounts left, stop monitoring", "err", err)
+				return err
+			case monitor.ErrorCodeCaptchaMisconfigured:
+				level.Error(m.Logger).Log("msg", "captcha solver is misconfigured, stop monitoring", "err", err)
+				return err
+			case monitor.ErrorCodeCaptchaZeroBalance, monitor.ErrorCodeCaptchaBudgetExceeded:
+				// wait for the balance to be topped up or the budget to reset
+				level.Error(m.Logger).Log("msg", "captcha solves are not affordable, retry in an hour", "err", err)
+				if !m.wait(ctx, StateWaitingFunds, captchaFundsRetryDelay) {
+					return nil // graceful termination
+				}
+				continue
+			case monitor.ErrorCodeCaptchaRejected:
+				level.Info(m.Logger).Log("msg", "captcha rejected by pdax, retry with a new one in a minute")
+				if !m.wait(ctx, StateBackoff, captchaRetryDelay) {
+					return nil // graceful termination
+				}
+				continue
+			}
+
+			if d := m.maintenanceRemaining(time.Now()); d > 0 {
 				// wait till maintenance window ends
-				level.Info(m.Logger).Log("msg", "pdax is under maintenance, wait 35 minutes")
-				time.Sleep(pdaxMaintenanceDurationMin * time.Minute)
+				level.Info(m.Logger).Log("msg", "pdax is under maintenance, wait till it ends", "wait", d)
+				if !m.wait(ctx, StateMaintenance, d) {
+					return nil // graceful termination
+				}
 				level.Info(m.Logger).Log("msg", "pdax maintenance should have ended, resume monitoring")
 				continue
 			}
 
 			level.Info(m.Logger).Log("msg", "waiting 15 minutes and then restart monitoring")
-			time.Sleep(15 * time.Minute)
+			if !m.wait(ctx, StateBackoff, 15*time.Minute) {
+				return nil // graceful termination
+			}
 			continue
 		}
 
@@ -117,20 +285,39 @@ func (m *MonitorService) MonitorWithRecovery(ctx context.Context, wsInitBook web
 	}
 }
 
+// wait sleeps in the supervisor state till the monitor is retried, it reports false once the context is done.
+func (m *MonitorService) wait(ctx context.Context, state string, d time.Duration) bool {
+	m.status.setState(state, time.Now().Add(d))
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // MonitorTrades monitors websocket messages for trades and orders.
 func (m *MonitorService) MonitorTrades(ctx context.Context, wsInitBook websocket.InitBook) error {
+	m.status.setState(StateAuthenticating, time.Time{})
 	authToken, err := m.AuthService.Login()
+	m.status.login(err)
 	if err != nil {
 		level.Error(m.Logger).Log("msg", "failed to get auth token", "err", err)
 		return err
 	}
 	level.Debug(m.Logger).Log("msg", "successfully authorized to PDAX")
 
+	m.status.setState(StateConnecting, time.Time{})
 	tradeConn := websocket.NewPDAXWebSocket(m.PDAXTradeURL)
 	err = tradeConn.Connect()
 	if err != nil {
 		return err
 	}
+	m.status.connected(true)
+	defer m.status.connected(false)
 	defer tradeConn.Close()
 	level.Info(m.Logger).Log("msg", "successfully connected to PDAX", "url", m.PDAXTradeURL)
 
@@ -138,28 +325,29 @@ func (m *MonitorService) MonitorTrades(ctx context.Context, wsInitBook websocket
 	if err != nil {
 		return fmt.Errorf("failed to bootstrap websocket: %v", err)
 	}
+	m.status.setState(StateStreaming, time.Time{})
 
-	var closed bool
-	var data []byte
-	for !closed {
+	return m.runPipeline(ctx, &tradeConn)
+}
+
+// Replay feeds recorded websocket messages to trade and order book handlers as if they were received live,
+// order book snapshots are taken at the time the messages were recorded.
+func (m *MonitorService) Replay(ctx context.Context, r io.Reader) error {
+	c := m.directConsumer()
+	return websocket.ReadFrames(r, func(f websocket.Frame) error {
 		select {
 		case <-ctx.Done():
-			return nil // graceful termination
+			return ctx.Err()
 		default:
 		}
 
-		closed, data, err = tradeConn.ReadMessage()
-		if err != nil {
-			return fmt.Errorf("failed to read message from trade websocket: %v", err)
-		}
-
-		m.handleBinMessage(ctx, data)
-	}
-
-	return nil
+		m.handleBinMessage(ctx, f.Data, f.Time, c)
+		return nil
+	})
 }
 
-func (m *MonitorService) handleBinMessage(ctx context.Context, data []byte) {
+// handleBinMessage decodes the frame, trades and order book snapshots are handed to the consumer.
+func (m *MonitorService) handleBinMessage(ctx context.Context, data []byte, receivedAt time.Time, c consumer) {
 	rc := binary.ReadCursor{
 		CurPos: 0,
 		Data:   data,
@@ -173,46 +361,155 @@ func (m *MonitorService) handleBinMessage(ctx context.Context, data []byte) {
 
 		viewID := rc.ReadFloat64()
 		if viewID == wsTradeViewID { // trades have viewID == 4
-			m.handleTrade(ctx, &rc)
+			m.handleTrade(ctx, &rc, receivedAt, c)
+		} else if m.instrumentView != 0 && viewID == m.instrumentView {
+			m.handleInstruments(&rc)
+		} else if m.orderBookViews[viewID] { // orderbooks have viewID == 16 (BTC), 21 (ETH)
+			m.handleOrderBook(ctx, mtype, viewID, &rc, receivedAt, c)
+		} else if _, ok := m.orderBooks[viewID]; ok { // the view is no longer tracked
+			m.dropOrderBook(viewID)
+		}
+	}
+}
+
+func (m *MonitorService) handleOrderBook(ctx context.Context, mtype uint8, viewID float64, rc *binary.ReadCursor,
+	now time.Time, c consumer) {
+	book, ok := m.orderBooks[viewID]
+	switch {
+	case mtype == wsPageReset: // initial PDAXOrderBook
+		var err error
+		if book, err = order.ReadOrderBook(rc); err != nil {
+			m.orderBookFailed(viewID, err)
+			return
+		}
+		m.orderBooks[viewID] = book
+	case ok: // OrderBook_change is update of existing orderbook
+		if err := m.applyOrderBookUpdates(book, rc); err != nil {
+			m.orderBookFailed(viewID, err)
+			return
+		}
+	default:
+		return
+	}
+
+	instrument, ok := book.Instrument()
+	if !ok {
+		return
+	}
+
+	currencyPair := m.tradeReader.CurrencyPair(instrument)
+	if mtype == wsPageReset {
+		m.liveBooksLock.Lock()
+		m.liveBooks[currencyPair] = book
+		m.liveBooksLock.Unlock()
+	}
+	if m.hub != nil && m.hub.WantsOrderBook(currencyPair) {
+		m.hub.PublishOrderBook(live.BookUpdate{CurrencyPair: currencyPair, Timestamp: now, Book: book.L2()})
+	}
+
+	// live books are tracked even when snapshots are not stored
+	if m.snapshotter == nil || !m.snapshotter.ShouldSnapshot(currencyPair, book, now) {
+		return
+	}
+
+	snapshot := order.Snapshot(currencyPair, book.L2(), now)
+	c.snapshot(ctx, &snapshot)
+}
+
+func (m *MonitorService) applyOrderBookUpdates(book monitor.OrderBook, rc *binary.ReadCursor) error {
+	updates, err := order.ReadOrderBookUpdate(rc)
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if err := book.Apply(update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orderBookFailed drops the book which can't be kept in sync till the next reset of its view.
+// Order book frames are not fully reverse-engineered, so some of them are not decoded.
+func (m *MonitorService) orderBookFailed(viewID float64, err error) {
+	level.Error(m.Logger).Log("msg", "failed to read order book, waiting for reset", "viewID", viewID, "err", err)
+	m.dropOrderBook(viewID)
+}
+
+func (m *MonitorService) dropOrderBook(viewID float64) {
+	m.liveBooksLock.Lock()
+	defer m.liveBooksLock.Unlock()
+
+	for pair, book := range m.liveBooks {
+		if book == m.orderBooks[viewID] {
+			delete(m.liveBooks, pair)
 		}
-		// Disabled due to error with ReadOrderBookUpdate method "panic: runtime error: index out of range [7] with length 7"
-		// Also we do not use ordebook at all.
-		// else if viewID == wsOrderBookViewID { // orderbooks have viewID == 16 (BTC), 21 (ETH)
-		// if mtype == wsPageReset { // initial PDAXOrderBook
-		// 	m.orderBook = order.ReadOrderBook(&rc)
-		// 	m.OrderRepository.Insert(ctx, m.orderBook.Orders())
-		// } else if mtype == wsPageUpdate { // OrderBook_change is update of existing orderbook
-		// 	orderBookUpdates := order.ReadOrderBookUpdate(&rc)
-		// 	for _, update := range orderBookUpdates {
-		// 		m.orderBook.Apply(update)
-		// 	}
-		// }
-		// }
-	}
-}
-
-func (m *MonitorService) handleTrade(ctx context.Context, rc *binary.ReadCursor) {
+	}
+	delete(m.orderBooks, viewID)
+}
+
+// OrderBook returns live order book of the currency pair.
+func (m *MonitorService) OrderBook(currencyPair string) (monitor.OrderBook, bool) {
+	m.liveBooksLock.RLock()
+	defer m.liveBooksLock.RUnlock()
+
+	book, ok := m.liveBooks[currencyPair]
+
+	return book, ok
+}
+
+// OrderBooks returns live order books by currency pair.
+func (m *MonitorService) OrderBooks() map[string]monitor.OrderBook {
+	m.liveBooksLock.RLock()
+	defer m.liveBooksLock.RUnlock()
+
+	books := make(map[string]monitor.OrderBook, len(m.liveBooks))
+	for pair, book := range m.liveBooks {
+		books[pair] = book
+	}
+
+	return books
+}
+
+func (m *MonitorService) handleTrade(ctx context.Context, rc *binary.ReadCursor, receivedAt time.Time, c consumer) {
 	rc.ReadFloat64()              // page_id
 	rc.ReadUint8()                // nullable check
 	tradeCount := rc.ReadUint16() // tradeCount (always even)
 
 	for t := uint16(0); t < tradeCount; t += 2 {
-		rc.ReadUint8()              // insert
-		if rc.ReadUint16() == 128 { // number == 'TimeSales_change'
+		rc.ReadUint8()                            // insert
+		if rc.ReadUint16() == wsTimeSalesChange { // number == 'TimeSales_change'
 			rc.ReadUint16() // length
 			// RC stands for ReadCursor, _after(N) suffix means cursor position at N byte after read
-			readTrade := m.tradeReader.ReadNullableTrade(rc)
-			if err := m.TradeRepository.Insert(ctx, &readTrade); err != nil {
-				level.Error(m.Logger).Log("msg", "error saving to db", "err", err)
+			raw := m.tradeReader.ReadNullableRawTrade(rc)
+			if rc.Overflowed() {
+				level.Error(m.Logger).Log("msg", "failed to read pdax trade, the message is truncated")
+				return
 			}
+			m.status.trade(raw.CurrencyPair, receivedAt)
+			c.trade(ctx, raw, receivedAt)
 		}
 	}
 }
 
-func isPDAXMaintenanceWindow() bool {
-	start, _ := time.Parse(clockLayout, "22:55")
-	end, _ := time.Parse(clockLayout, "23:35")
-	clockNow, _ := time.Parse(clockLayout, time.Now().UTC().Format(clockLayout))
-
-	return clockNow.After(start) && clockNow.Before(end)
+func (m *MonitorService) handleInstruments(rc *binary.ReadCursor) {
+	rc.ReadFloat64()            // page_id
+	rc.ReadUint8()              // nullable check
+	rowCount := rc.ReadUint16() // rowCount
+
+	for n := uint16(0); n < rowCount; n++ {
+		rc.ReadUint8()                  // insert
+		rc.ReadUint16()                 // number == 'InstrumentMarket_change'
+		length := uint(rc.ReadUint16()) // length
+		end := rc.CurPos + length
+
+		instrument := trade.ReadInstrument(rc)
+		if rc.Overflowed() || rc.CurPos > end {
+			level.Error(m.Logger).Log("msg", "failed to read pdax instruments, the message is truncated")
+			return
+		}
+		m.tradeReader.Instruments.Set(instrument)
+		rc.CurPos = end // skip fields of the row which are not decoded
+	}
 }
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+	"github.com/pudgydoge/pdax-monitor/internal/ndjson"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/sqlite"
+	"github.com/pudgydoge/pdax-monitor/internal/synth"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+)
+
+// benchStart is the start of virtual clock of generated frames, it's fixed to generate the same frames every run.
+var benchStart = time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+
+// BenchmarkHandleTrades measures decode throughput of TimeSales frames, trades are discarded.
+func BenchmarkHandleTrades(b *testing.B) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithBookRate(0))
+	frames := generate(g, 4096)
+	m := newBenchMonitor(discardTrades{}, nil)
+
+	benchmarkFrames(b, m, frames, "trades/s")
+}
+
+// BenchmarkHandleOrderBookChanges measures decode throughput of OrderBook_change frames applied to live books,
+// snapshots are taken on every top of book change.
+func BenchmarkHandleOrderBookChanges(b *testing.B) {
+	// trades are so rare they are never generated
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithTradeRate(1e-9))
+	m := newBenchMonitor(discardTrades{}, memory.NewStorage().OrderRepository())
+	c := m.directConsumer()
+	for _, f := range g.Resets() {
+		m.handleBinMessage(context.Background(), f.Data, f.Time, c)
+	}
+	// books change with every frame, so frames can't be replayed over and over
+	frames := generate(g, b.N)
+
+	benchmarkFrames(b, m, frames, "changes/s")
+}
+
+// BenchmarkPersistTrades measures end-to-end latency of trades from the time their frame is received till
+// they are stored, its percentiles are reported.
+func BenchmarkPersistTrades(b *testing.B) {
+	storages := map[string]func(b *testing.B) monitor.Storage{
+		"memory": func(b *testing.B) monitor.Storage {
+			return memory.NewStorage()
+		},
+		"sqlite": func(b *testing.B) monitor.Storage {
+			c := sqlite.NewClient()
+			if err := c.Open(filepath.Join(b.TempDir(), "bench.db")); err != nil {
+				b.Fatalf("Open() error = %v", err)
+			}
+			return c
+		},
+		"ndjson": func(b *testing.B) monitor.Storage {
+			s := ndjson.NewStorage()
+			if err := s.Open(b.TempDir()); err != nil {
+				b.Fatalf("Open() error = %v", err)
+			}
+			return s
+		},
+	}
+
+	for _, name := range []string{"memory", "sqlite", "ndjson"} {
+		b.Run(name, func(b *testing.B) {
+			s := storages[name](b)
+			defer s.Close()
+
+			g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithBookRate(0))
+			// trades are unique, so every frame is stored rather than ignored as a duplicate
+			frames := generate(g, b.N)
+			rep := &latencyRepository{TradeRepository: s.TradeRepository()}
+			m := newBenchMonitor(rep, nil)
+
+			c := m.directConsumer()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, f := range frames {
+				rep.receivedAt = time.Now()
+				m.handleBinMessage(context.Background(), f.Data, rep.receivedAt, c)
+			}
+			b.StopTimer()
+
+			if rep.failed > 0 {
+				b.Fatalf("failed to store %d of %d trades", rep.failed, len(rep.latencies))
+			}
+			sort.Slice(rep.latencies, func(i, j int) bool {
+				return rep.latencies[i] < rep.latencies[j]
+			})
+			b.ReportMetric(percentile(rep.latencies, 0.5), "p50-µs")
+			b.ReportMetric(percentile(rep.latencies, 0.99), "p99-µs")
+		})
+	}
+}
+
+// benchmarkFrames feeds the frames to the monitor b.N times reporting bytes and frames per second.
+func benchmarkFrames(b *testing.B, m MonitorService, frames []websocket.Frame, unit string) {
+	size := 0
+	for _, f := range frames {
+		size += len(f.Data)
+	}
+	b.SetBytes(int64(size / len(frames)))
+	b.ReportAllocs()
+
+	ctx := context.Background()
+	c := m.directConsumer()
+	start := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := frames[i%len(frames)]
+		m.handleBinMessage(ctx, f.Data, f.Time, c)
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), unit)
+}
+
+func newBenchMonitor(trades monitor.TradeRepository, orders monitor.OrderRepository) MonitorService {
+	markets := synth.DefaultMarkets()
+	options := []ConfigOption{
+		WithTradeRepository(trades),
+		WithCurrencyCodes(synth.CurrencyCodes(markets)),
+	}
+	if orders != nil {
+		options = append(options,
+			WithOrderRepository(orders),
+			WithOrderBookViews(synth.ViewIDs(markets)),
+			WithSnapshotPolicy(order.NewSnapshotPolicyFactory(0, 0, true)),
+		)
+	}
+
+	return NewMonitorService(options...)
+}
+
+// generate returns the next n frames of the generator.
+func generate(g *synth.Generator, n int) []websocket.Frame {
+	frames := make([]websocket.Frame, n)
+	for i := range frames {
+		frames[i] = g.Next()
+	}
+
+	return frames
+}
+
+// percentile returns the percentile of sorted latencies in microseconds.
+func percentile(latencies []time.Duration, p float64) float64 {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	return float64(latencies[int(p*float64(len(latencies)-1))]) / float64(time.Microsecond)
+}
+
+// discardTrades is a trade repository which stores nothing.
+type discardTrades struct{}
+
+func (discardTrades) Insert(context.Context, *monitor.Trade) error {
+	return nil
+}
+
+func (discardTrades) Upsert(context.Context, []monitor.Trade, bool) (monitor.TradeImport, error) {
+	return monitor.TradeImport{}, nil
+}
+
+func (discardTrades) Trades(context.Context, monitor.TradeQuery) ([]monitor.Trade, error) {
+	return nil, nil
+}
+
+// latencyRepository measures time since the frame of the stored trade was received.
+type latencyRepository struct {
+	monitor.TradeRepository
+	receivedAt time.Time
+	latencies  []time.Duration
+	failed     int
+}
+
+func (r *latencyRepository) Insert(ctx context.Context, t *monitor.Trade) error {
+	err := r.TradeRepository.Insert(ctx, t)
+	r.latencies = append(r.latencies, time.Since(r.receivedAt))
+	if err != nil {
+		r.failed++
+	}
+
+	return err
+}
+
+// BenchmarkPipeline measures throughput of frames read, decoded and stored in memory by the pipeline.
+func BenchmarkPipeline(b *testing.B) {
+	g := synth.NewGenerator(synth.WithStart(benchStart))
+	s := memory.NewStorage()
+	m := newBenchMonitor(s.TradeRepository(), s.OrderRepository())
+	frames := append(g.Resets(), generate(g, b.N)...)
+
+	b.ReportAllocs()
+	start := time.Now()
+	b.ResetTimer()
+	if err := m.runPipeline(context.Background(), &frameConn{frames: frames}); err != nil {
+		b.Fatalf("runPipeline() error = %v", err)
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "frames/s")
+}
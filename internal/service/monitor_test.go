@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+func TestWaitReturnsOnCancel(t *testing.T) {
+	m := NewMonitorService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if m.wait(ctx, StateBackoff, time.Hour) {
+		t.Error("wait() = true, want false once the context is done")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("wait() returned after %v, want it to return right away", d)
+	}
+	if !m.wait(context.Background(), StateBackoff, time.Millisecond) {
+		t.Error("wait() = false, want true once the delay is over")
+	}
+}
+
+func TestHandleInstruments(t *testing.T) {
+	instruments := trade.NewInstruments(map[int]string{167: "BTC", 168: "ETH"}, nil, nil)
+	m := NewMonitorService(WithInstruments(instruments), WithInstrumentView(instrumentViewID))
+
+	page := encodeInstruments(
+		trade.Instrument{ID: 167, Base: "BTC", Quote: "USDT", PriceDecimals: 2, QuantityDecimals: 6},
+		trade.Instrument{ID: 250, Base: "SOL", Quote: "PHP", PriceDecimals: 2, QuantityDecimals: 4},
+	)
+	m.handleBinMessage(context.Background(), page, time.Now(), nil)
+
+	for id, want := range map[int]string{167: "BTC-USDT", 168: "ETH-PHP", 250: "SOL-PHP"} {
+		if got := instruments.Pair(id); got != want {
+			t.Errorf("Pair(%d) = %s, want %s", id, got, want)
+		}
+	}
+	if i, _ := instruments.Get(250); i.QuantityDecimals != 4 {
+		t.Errorf("got instrument %+v, want the one of the feed", i)
+	}
+	if got := instruments.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2 instruments of the feed", got)
+	}
+}
+
+func TestHandleInstrumentsTruncated(t *testing.T) {
+	instruments := trade.NewInstruments(nil, nil, nil)
+	m := NewMonitorService(WithInstruments(instruments), WithInstrumentView(instrumentViewID))
+
+	page := encodeInstruments(
+		trade.Instrument{ID: 167, Base: "BTC", Quote: "PHP"},
+		trade.Instrument{ID: 168, Base: "ETH", Quote: "PHP"},
+	)
+	m.handleBinMessage(context.Background(), page[:len(page)-instrumentTailSize-1], time.Now(), nil)
+
+	if got := instruments.Pair(167); got != "BTC-PHP" {
+		t.Errorf("Pair(167) = %s, want the instrument read before the message is cut", got)
+	}
+	if _, ok := instruments.Get(168); ok {
+		t.Error("the instrument cut short is stored")
+	}
+}
+
+func TestHandleInstrumentsOfOtherView(t *testing.T) {
+	instruments := trade.NewInstruments(nil, nil, nil)
+	m := NewMonitorService(WithInstruments(instruments))
+
+	m.handleBinMessage(context.Background(), encodeInstruments(trade.Instrument{ID: 167, Base: "BTC", Quote: "PHP"}), time.Now(), nil)
+	if got := instruments.Len(); got != 0 {
+		t.Errorf("Len() = %d, want instruments ignored while discovery is disabled", got)
+	}
+}
+
+const (
+	instrumentViewID = 50
+	// instrumentTailSize is the size of InstrumentMarket fields after Status which are not decoded.
+	instrumentTailSize = 8
+)
+
+// encodeInstruments encodes an InstrumentMarket page reset of the instrument reference view.
+func encodeInstruments(instruments ...trade.Instrument) []byte {
+	wc := binary.WriteCursor{Data: make([]byte, 1024)}
+	wc.WriteUint8(wsPageReset)
+	wc.WriteUint32(1) // message_id
+	wc.WriteUint16(1) // seq_number
+	wc.WriteFloat64(instrumentViewID)
+	wc.WriteFloat64(0) // page_id
+	wc.WriteUint8(0)   // nullable check
+	wc.WriteUint16(uint16(len(instruments)))
+
+	for n, i := range instruments {
+		symbol := i.Base + i.Quote
+		wc.WriteUint8(1)  // insert
+		wc.WriteUint16(0) // number == 'InstrumentMarket_change'
+		wc.WriteUint16(uint16(8 + 8 + 3*2 + len(symbol) + len(i.Base) + len(i.Quote) + 3 + instrumentTailSize))
+		wc.WriteFloat64(float64(n)) // index
+		wc.WriteFloat64(float64(i.ID))
+		wc.WriteString(symbol)
+		wc.WriteString(i.Base)
+		wc.WriteString(i.Quote)
+		wc.WriteUint8(i.PriceDecimals)
+		wc.WriteUint8(i.QuantityDecimals)
+		wc.WriteUint8(1)   // Status
+		wc.WriteFloat64(1) // fields not decoded
+	}
+
+	return wc.Data[:wc.CurPos]
+}
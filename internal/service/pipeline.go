@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultQueueSize = 1024
+	stageRead        = "read"
+	stageDecode      = "decode"
+	stageSnapshots   = "snapshots"
+)
+
+// TradeSink consumes decoded trades, e.g. stores, publishes or aggregates them. Every sink gets all trades
+// in the order they are received, sinks of the pipeline consume them concurrently with each other.
+type TradeSink interface {
+	Consume(ctx context.Context, t *monitor.Trade, receivedAt time.Time) error
+}
+
+// TradeSinkFunc is an adapter to use ordinary functions as trade sinks.
+type TradeSinkFunc func(ctx context.Context, t *monitor.Trade, receivedAt time.Time) error
+
+// Consume calls f(ctx, t, receivedAt).
+func (f TradeSinkFunc) Consume(ctx context.Context, t *monitor.Trade, receivedAt time.Time) error {
+	return f(ctx, t, receivedAt)
+}
+
+// namedSink is a trade sink named in logs and metrics.
+type namedSink struct {
+	name string
+	sink TradeSink
+}
+
+// tradeSinks returns trade repository, live hub and publisher sinks followed by sinks configured by WithTradeSink.
+func (m *MonitorService) tradeSinks() []namedSink {
+	store := func(ctx context.Context, t *monitor.Trade, _ time.Time) error {
+		return m.TradeRepository.Insert(ctx, t)
+	}
+	sinks := []namedSink{{name: "repository", sink: TradeSinkFunc(store)}}
+
+	if m.hub != nil {
+		broadcast := func(_ context.Context, t *monitor.Trade, _ time.Time) error {
+			m.hub.PublishTrade(*t)
+			return nil
+		}
+		sinks = append(sinks, namedSink{name: "hub", sink: TradeSinkFunc(broadcast)})
+	}
+	if m.publisher != nil {
+		enqueue := func(ctx context.Context, t *monitor.Trade, receivedAt time.Time) error {
+			return m.publisher.Enqueue(ctx, *t, receivedAt)
+		}
+		sinks = append(sinks, namedSink{name: "publisher", sink: TradeSinkFunc(enqueue)})
+	}
+
+	return append(sinks, m.sinks...)
+}
+
+// consumer takes trades and order book snapshots decoded from frames. Trades are raw, so decoding allocates
+// nothing for them and decimals are constructed by the consumer.
+type consumer interface {
+	trade(ctx context.Context, raw trade.Raw, receivedAt time.Time)
+	snapshot(ctx context.Context, s *monitor.OrderBookSnapshot)
+}
+
+// directConsumer hands trades to sinks and stores snapshots right away, frames are decoded once they are consumed.
+type directConsumer struct {
+	m     *MonitorService
+	sinks []namedSink
+}
+
+// directConsumer returns consumer of trade sinks and order repository.
+func (m *MonitorService) directConsumer() directConsumer {
+	return directConsumer{m: m, sinks: m.tradeSinks()}
+}
+
+func (c directConsumer) trade(ctx context.Context, raw trade.Raw, receivedAt time.Time) {
+	t := raw.NewTrade()
+	for _, s := range c.sinks {
+		c.m.consumeTrade(ctx, s, t, receivedAt)
+	}
+}
+
+func (c directConsumer) snapshot(ctx context.Context, s *monitor.OrderBookSnapshot) {
+	c.m.storeSnapshot(ctx, s)
+}
+
+// consumeTrade hands the trade to the sink, failures are logged rather than returned, so the trade isn't retried.
+func (m *MonitorService) consumeTrade(ctx context.Context, s namedSink, t *monitor.Trade, receivedAt time.Time) {
+	start := time.Now()
+	err := s.sink.Consume(ctx, t, receivedAt)
+	m.metrics.observe(s.name, start, err)
+	if err != nil {
+		level.Error(m.Logger).Log("msg", "failed to consume trade", "sink", s.name, "err", err)
+	}
+}
+
+func (m *MonitorService) storeSnapshot(ctx context.Context, s *monitor.OrderBookSnapshot) {
+	start := time.Now()
+	err := m.OrderRepository.Insert(ctx, s)
+	m.metrics.observe(stageSnapshots, start, err)
+	if err != nil {
+		level.Error(m.Logger).Log("msg", "error saving order book snapshot to db", "err", err)
+	}
+}
+
+// tradeEvent is a raw trade queued for a sink.
+type tradeEvent struct {
+	raw        trade.Raw
+	receivedAt time.Time
+}
+
+// pipeline connects read, decode and persist stages by bounded queues.
+type pipeline struct {
+	m         *MonitorService
+	frames    chan websocket.Frame
+	sinks     []namedSink
+	trades    []chan tradeEvent
+	snapshots chan *monitor.OrderBookSnapshot
+}
+
+// messageConn is a websocket connection the pipeline reads frames from.
+type messageConn interface {
+	ReadMessage() (bool, []byte, error)
+	Close() error
+}
+
+// runPipeline reads frames of the connection, decodes them and hands what's decoded to persist stages, stages are
+// connected by bounded queues and run concurrently. It returns once the connection is closed by PDAX, reading fails
+// or the context is done. Frames read before the connection is closed or fails are decoded and persisted before
+// it returns, queued work is dropped only when the context is done. The connection is closed on cancellation
+// to unblock reading.
+func (m *MonitorService) runPipeline(ctx context.Context, conn messageConn) error {
+	// stages watch ctx rather than the group's context, so a read error drains the queues instead of dropping them
+	var g errgroup.Group
+	p := pipeline{
+		m:         m,
+		frames:    make(chan websocket.Frame, m.queueSize),
+		sinks:     m.tradeSinks(),
+		snapshots: make(chan *monitor.OrderBookSnapshot, m.queueSize),
+	}
+
+	readerDone := make(chan struct{})
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+			// ReadMessage doesn't watch the context, it returns an error once the connection is closed
+			conn.Close()
+		case <-readerDone:
+		}
+		return nil
+	})
+	g.Go(func() error {
+		defer close(readerDone)
+		return p.read(ctx, conn)
+	})
+	for _, s := range p.sinks {
+		q := make(chan tradeEvent, m.queueSize)
+		p.trades = append(p.trades, q)
+
+		s := s
+		g.Go(func() error {
+			p.consume(ctx, s, q)
+			return nil
+		})
+	}
+	g.Go(func() error {
+		p.storeSnapshots(ctx)
+		return nil
+	})
+	m.status.pipeline(p.queues)
+	defer m.status.pipeline(nil)
+	g.Go(func() error {
+		p.decode(ctx)
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// queues returns depths of the pipeline queues by stage, it's safe to call while the pipeline runs.
+func (p *pipeline) queues() map[string]int {
+	depths := map[string]int{
+		stageDecode:    len(p.frames),
+		stageSnapshots: len(p.snapshots),
+	}
+	for i, s := range p.sinks {
+		depths[s.name] = len(p.trades[i])
+	}
+
+	return depths
+}
+
+// read queues frames of the connection for decoding till the connection is closed, reading fails or the context
+// is done. Closing the frame queue on return lets decoding drain what's queued.
+func (p *pipeline) read(ctx context.Context, conn messageConn) error {
+	defer close(p.frames)
+
+	for {
+		start := time.Now()
+		closed, data, err := conn.ReadMessage()
+		if ctx.Err() != nil {
+			return nil // graceful termination
+		}
+		p.m.metrics.observe(stageRead, start, err)
+		if err != nil {
+			return fmt.Errorf("failed to read message from trade websocket: %v", err)
+		}
+		if closed {
+			return nil
+		}
+
+		receivedAt := time.Now()
+		p.m.status.frame(receivedAt)
+		if p.m.recorder != nil {
+			if err = p.m.recorder.Record(data); err != nil {
+				level.Warn(p.m.Logger).Log("msg", "failed to record websocket message", "err", err)
+			}
+		}
+
+		select {
+		case p.frames <- websocket.Frame{Time: receivedAt, Data: data}:
+			p.m.metrics.queued(stageDecode, len(p.frames))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// decode decodes queued frames till reading stops, persist stages are stopped then.
+func (p *pipeline) decode(ctx context.Context) {
+	defer func() {
+		for _, q := range p.trades {
+			close(q)
+		}
+		close(p.snapshots)
+	}()
+
+	for f := range p.frames {
+		p.m.metrics.queued(stageDecode, len(p.frames))
+		start := time.Now()
+		p.m.handleBinMessage(ctx, f.Data, f.Time, p)
+		p.m.metrics.observe(stageDecode, start, nil)
+	}
+}
+
+// trade queues the raw trade for every sink, it blocks while a sink's queue is full.
+func (p *pipeline) trade(ctx context.Context, raw trade.Raw, receivedAt time.Time) {
+	for i, q := range p.trades {
+		select {
+		case q <- tradeEvent{raw: raw, receivedAt: receivedAt}:
+			p.m.metrics.queued(p.sinks[i].name, len(q))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// snapshot queues the snapshot for order repository, it blocks while the queue is full.
+func (p *pipeline) snapshot(ctx context.Context, s *monitor.OrderBookSnapshot) {
+	select {
+	case p.snapshots <- s:
+		p.m.metrics.queued(stageSnapshots, len(p.snapshots))
+	case <-ctx.Done():
+	}
+}
+
+// consume hands queued trades to the sink till decoding stops, trades still queued once the context is done
+// are dropped. Decimals of the trade are constructed here rather than in the decode stage, every sink gets
+// its own trade.
+func (p *pipeline) consume(ctx context.Context, s namedSink, q chan tradeEvent) {
+	for e := range q {
+		p.m.metrics.queued(s.name, len(q))
+		if ctx.Err() != nil {
+			return
+		}
+		p.m.consumeTrade(ctx, s, e.raw.NewTrade(), e.receivedAt)
+	}
+}
+
+// storeSnapshots stores queued snapshots till decoding stops, snapshots still queued once the context is done
+// are dropped.
+func (p *pipeline) storeSnapshots(ctx context.Context) {
+	for s := range p.snapshots {
+		p.m.metrics.queued(stageSnapshots, len(p.snapshots))
+		if ctx.Err() != nil {
+			return
+		}
+		p.m.storeSnapshot(ctx, s)
+	}
+}
+
+// pipelineMetrics records throughput, latency and queue depth of pipeline stages,
+// methods are safe to call on nil metrics which records nothing.
+type pipelineMetrics struct {
+	processed *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	depth     *prometheus.GaugeVec
+}
+
+func newPipelineMetrics(registerer prometheus.Registerer) *pipelineMetrics {
+	m := pipelineMetrics{
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pdax_pipeline_processed_total",
+			Help: "Frames read and decoded, trades consumed by sinks and snapshots stored per stage and result, ok or error.",
+		}, []string{"stage", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pdax_pipeline_duration_seconds",
+			Help:    "Time a stage takes to process a frame, a trade or a snapshot, reading includes waiting for the frame.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"stage"}),
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pdax_pipeline_queue_depth",
+			Help: "Frames, trades or snapshots waiting for the stage.",
+		}, []string{"stage"}),
+	}
+	registerer.MustRegister(m.processed, m.duration, m.depth)
+
+	return &m
+}
+
+func (m *pipelineMetrics) observe(stage string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.duration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.processed.WithLabelValues(stage, "error").Inc()
+		return
+	}
+	m.processed.WithLabelValues(stage, "ok").Inc()
+}
+
+func (m *pipelineMetrics) queued(stage string, depth int) {
+	if m == nil {
+		return
+	}
+
+	m.depth.WithLabelValues(stage).Set(float64(depth))
+}
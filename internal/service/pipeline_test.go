@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/live"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/publish"
+	"github.com/pudgydoge/pdax-monitor/internal/synth"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+)
+
+func TestPipelineCancelUnblocksReader(t *testing.T) {
+	conn := &blockingConn{closed: make(chan struct{})}
+	m := newBenchMonitor(discardTrades{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- m.runPipeline(ctx, conn)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runPipeline() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipeline() is still blocked after cancellation")
+	}
+}
+
+func TestPipelineReadError(t *testing.T) {
+	m := newBenchMonitor(discardTrades{}, nil)
+	err := m.runPipeline(context.Background(), &frameConn{err: errors.New("connection reset")})
+	if err == nil {
+		t.Fatal("runPipeline() error = nil, want read error")
+	}
+}
+
+func TestPipelineReadErrorStoresQueuedTrades(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithBookRate(0))
+	frames := generate(g, 500)
+
+	stored := func(err error) int {
+		s := memory.NewStorage()
+		m := newBenchMonitor(s.TradeRepository(), nil)
+		m.queueSize = 4
+
+		conn := &frameConn{frames: append([]websocket.Frame(nil), frames...), err: err}
+		if got := m.runPipeline(context.Background(), conn); (got != nil) != (err != nil) {
+			t.Fatalf("runPipeline() error = %v, want error %v", got, err)
+		}
+
+		n := 0
+		for _, pair := range []string{"BTC-PHP", "ETH-PHP", "USDT-PHP"} {
+			trades, err := s.TradeRepository().Trades(context.Background(), monitor.TradeQuery{
+				CurrencyPair: pair,
+				From:         benchStart,
+				To:           benchStart.Add(24 * time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("Trades() error = %v", err)
+			}
+			n += len(trades)
+		}
+		return n
+	}
+
+	closed := stored(nil)
+	if closed == 0 {
+		t.Fatal("no trades stored")
+	}
+	if failed := stored(errors.New("connection reset")); failed != closed {
+		t.Errorf("stored %d trades when reading fails, want %d as when the connection is closed", failed, closed)
+	}
+}
+
+func TestPipelineFansOutTrades(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithDepth(10))
+	frames := append(g.Resets(), generate(g, 2000)...)
+
+	s := memory.NewStorage()
+	var got []monitor.Trade
+	var mu sync.Mutex
+	sink := TradeSinkFunc(func(_ context.Context, t *monitor.Trade, _ time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, *t)
+		return nil
+	})
+	markets := synth.DefaultMarkets()
+	m := NewMonitorService(
+		WithTradeRepository(s.TradeRepository()),
+		WithOrderRepository(s.OrderRepository()),
+		WithCurrencyCodes(synth.CurrencyCodes(markets)),
+		WithOrderBookViews(synth.ViewIDs(markets)),
+		WithSnapshotPolicy(order.NewSnapshotPolicyFactory(0, 0, true)),
+		WithTradeSink("test", sink),
+		WithQueueSize(4),
+	)
+
+	if err := m.runPipeline(context.Background(), &frameConn{frames: frames}); err != nil {
+		t.Fatalf("runPipeline() error = %v", err)
+	}
+
+	if len(got) == 0 {
+		t.Fatal("no trades consumed")
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].ID <= got[i-1].ID {
+			t.Fatalf("trade %d: got ID %d after %d, want trades in order", i, got[i].ID, got[i-1].ID)
+		}
+	}
+
+	stored := 0
+	for _, pair := range []string{"BTC-PHP", "ETH-PHP", "USDT-PHP"} {
+		trades, err := s.TradeRepository().Trades(context.Background(), monitor.TradeQuery{
+			CurrencyPair: pair,
+			From:         benchStart,
+			To:           benchStart.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Trades() error = %v", err)
+		}
+		stored += len(trades)
+	}
+	if stored != len(got) {
+		t.Errorf("stored %d trades, sink consumed %d", stored, len(got))
+	}
+	if books := m.OrderBooks(); len(books) != 2 {
+		t.Errorf("got %d live order books, want 2", len(books))
+	}
+	if _, err := s.OrderRepository().BookAt(context.Background(), "BTC-PHP", time.Now()); err != nil {
+		t.Errorf("BookAt() error = %v", err)
+	}
+}
+
+func TestPipelineSinksGetOwnTrades(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithBookRate(0))
+	frames := generate(g, 100)
+
+	var mu sync.Mutex
+	seen := make(map[*monitor.Trade]string)
+	record := func(name string) TradeSink {
+		return TradeSinkFunc(func(_ context.Context, t *monitor.Trade, _ time.Time) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if other, ok := seen[t]; ok {
+				return fmt.Errorf("trade %d is shared with sink %s", t.ID, other)
+			}
+			seen[t] = name
+			t.Price.SetInt64(0) // sinks may change their trades
+			return nil
+		})
+	}
+	s := memory.NewStorage()
+	m := NewMonitorService(
+		WithTradeRepository(s.TradeRepository()),
+		WithCurrencyCodes(synth.CurrencyCodes(synth.DefaultMarkets())),
+		WithTradeSink("a", record("a")),
+		WithTradeSink("b", record("b")),
+	)
+	if err := m.runPipeline(context.Background(), &frameConn{frames: frames}); err != nil {
+		t.Fatalf("runPipeline() error = %v", err)
+	}
+
+	if len(seen) != 2*100 {
+		t.Errorf("sinks got %d distinct trades, want 200", len(seen))
+	}
+	trades, err := s.TradeRepository().Trades(context.Background(), monitor.TradeQuery{
+		CurrencyPair: "BTC-PHP",
+		From:         benchStart,
+		To:           benchStart.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Trades() error = %v", err)
+	}
+	for _, tr := range trades {
+		if tr.Price.Sign() <= 0 {
+			t.Fatalf("stored trade %d has price %s changed by another sink", tr.ID, tr.Price)
+		}
+	}
+}
+
+func TestPipelineTracksBooksWithoutSnapshotPolicy(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithDepth(10))
+	frames := append(g.Resets(), generate(g, 200)...)
+
+	s := memory.NewStorage()
+	hub := live.NewHub()
+	markets := synth.DefaultMarkets()
+	m := NewMonitorService(
+		WithTradeRepository(s.TradeRepository()),
+		WithOrderRepository(s.OrderRepository()),
+		WithCurrencyCodes(synth.CurrencyCodes(markets)),
+		WithOrderBookViews(synth.ViewIDs(markets)),
+		WithHub(hub),
+	)
+	books, cancel := hub.SubscribeOrderBook("BTC-PHP")
+	defer cancel()
+
+	if err := m.runPipeline(context.Background(), &frameConn{frames: frames}); err != nil {
+		t.Fatalf("runPipeline() error = %v", err)
+	}
+
+	select {
+	case u := <-books:
+		if len(u.Book.Bids) == 0 || len(u.Book.Asks) == 0 {
+			t.Errorf("published book has %d bids and %d asks, want both sides", len(u.Book.Bids), len(u.Book.Asks))
+		}
+	default:
+		t.Error("no order book published to the hub")
+	}
+	if books := m.OrderBooks(); len(books) != 2 {
+		t.Errorf("got %d live order books, want 2", len(books))
+	}
+	if _, err := s.OrderRepository().BookAt(context.Background(), "BTC-PHP", time.Now()); err == nil {
+		t.Error("BookAt() error = nil, want no snapshots stored without a policy")
+	}
+}
+
+func TestPipelineDropsTruncatedOrderBook(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithDepth(10))
+	resets := g.Resets()
+	truncated := resets[0]
+	truncated.Data = truncated.Data[:len(truncated.Data)-5]
+	frames := append([]websocket.Frame{truncated}, resets[1:]...)
+	frames = append(frames, generate(g, 200)...)
+
+	markets := synth.DefaultMarkets()
+	m := NewMonitorService(
+		WithTradeRepository(memory.NewStorage().TradeRepository()),
+		WithCurrencyCodes(synth.CurrencyCodes(markets)),
+		WithOrderBookViews(synth.ViewIDs(markets)),
+	)
+	if err := m.runPipeline(context.Background(), &frameConn{frames: frames}); err != nil {
+		t.Fatalf("runPipeline() error = %v", err)
+	}
+	if books := m.OrderBooks(); len(books) != 1 {
+		t.Errorf("got %d live order books, want 1 besides the truncated one", len(books))
+	}
+}
+
+func TestStatusReportsQueueDepths(t *testing.T) {
+	g := synth.NewGenerator(synth.WithStart(benchStart), synth.WithBookRate(0))
+	frames := generate(g, 50)
+
+	release := make(chan struct{})
+	slow := TradeSinkFunc(func(ctx context.Context, _ *monitor.Trade, _ time.Time) error {
+		<-release
+		return nil
+	})
+	queue := publish.NewQueue(nopPublisher{}) // not run, so enqueued trades stay queued
+	m := NewMonitorService(
+		WithTradeRepository(memory.NewStorage().TradeRepository()),
+		WithCurrencyCodes(synth.CurrencyCodes(synth.DefaultMarkets())),
+		WithTradeSink("slow", slow),
+		WithPublisher(queue),
+		WithQueueSize(4),
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.runPipeline(context.Background(), &frameConn{frames: frames})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Status().Queues["slow"] < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("slow sink queue depth is %d, want full queue of 4", m.Status().Queues["slow"])
+		}
+		time.Sleep(time.Millisecond)
+	}
+	queues := m.Status().Queues
+	for _, stage := range []string{"decode", "snapshots", "repository", "publisher", QueuePublish} {
+		if _, ok := queues[stage]; !ok {
+			t.Errorf("no depth of %s queue in %v", stage, queues)
+		}
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("runPipeline() error = %v", err)
+	}
+	queues = m.Status().Queues
+	if _, ok := queues["slow"]; ok {
+		t.Errorf("got pipeline queue depths %v once the pipeline stopped", queues)
+	}
+	if got := queues[QueuePublish]; got != 50 {
+		t.Errorf("publish queue depth = %d, want 50", got)
+	}
+}
+
+// nopPublisher drops messages.
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, publish.Message) error { return nil }
+
+func (nopPublisher) Close() error { return nil }
+
+// blockingConn blocks reading till it's closed.
+type blockingConn struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *blockingConn) ReadMessage() (bool, []byte, error) {
+	<-c.closed
+	return false, nil, errors.New("use of closed network connection")
+}
+
+func (c *blockingConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// frameConn serves the frames and then reports the connection closed by the peer, or fails with the error.
+type frameConn struct {
+	frames []websocket.Frame
+	err    error
+}
+
+func (c *frameConn) ReadMessage() (bool, []byte, error) {
+	if len(c.frames) == 0 {
+		return c.err == nil, nil, c.err
+	}
+
+	f := c.frames[0]
+	c.frames = c.frames[1:]
+
+	return false, f.Data, nil
+}
+
+func (c *frameConn) Close() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// Supervisor states of the monitor.
+const (
+	StateStarting       = "starting"
+	StateAuthenticating = "authenticating"
+	StateConnecting     = "connecting"
+	StateStreaming      = "streaming"
+	StateBackoff        = "backoff"
+	StateMaintenance    = "maintenance"
+	StateWaitingFunds   = "waiting_captcha_funds"
+	StateStopped        = "stopped"
+)
+
+// QueuePublish names the publish queue among queue depths of Status.
+const QueuePublish = "publish"
+
+// Status is a snapshot of the monitor state.
+type Status struct {
+	State      string
+	StateSince time.Time
+	RetryAt    time.Time
+	Auth       AuthStatus
+	Websocket  WebsocketStatus
+	LastTrades map[string]time.Time
+	// Queues are depths of pipeline queues by stage (decode, a trade sink or snapshots) while the websocket
+	// is streaming, and of the publish queue.
+	Queues map[string]int
+}
+
+// AuthStatus is the result of the last PDAX login.
+type AuthStatus struct {
+	LoggedIn  bool
+	LastLogin time.Time
+	ErrorCode string
+	Error     string
+}
+
+// WebsocketStatus is the state of PDAX websocket connection.
+type WebsocketStatus struct {
+	Connected   bool
+	ConnectedAt time.Time
+	LastFrameAt time.Time
+	Frames      uint64
+}
+
+// statusTracker records the monitor state, it's safe for concurrent use.
+type statusTracker struct {
+	mu     sync.RWMutex
+	status Status
+	// queues returns queue depths of the running pipeline, it's nil while no pipeline runs.
+	queues func() map[string]int
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{status: Status{
+		State:      StateStarting,
+		StateSince: time.Now(),
+		LastTrades: make(map[string]time.Time),
+	}}
+}
+
+// setState records the supervisor state, retryAt is when the monitor leaves backoff states.
+func (s *statusTracker) setState(state string, retryAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.State = state
+	s.status.StateSince = time.Now()
+	s.status.RetryAt = retryAt
+}
+
+func (s *statusTracker) login(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.status.Auth = AuthStatus{LastLogin: s.status.Auth.LastLogin, ErrorCode: monitor.ErrorCode(err), Error: err.Error()}
+		return
+	}
+	s.status.Auth = AuthStatus{LoggedIn: true, LastLogin: time.Now()}
+}
+
+func (s *statusTracker) connected(connected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Websocket.Connected = connected
+	if connected {
+		s.status.Websocket.ConnectedAt = time.Now()
+	}
+}
+
+func (s *statusTracker) frame(receivedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Websocket.LastFrameAt = receivedAt
+	s.status.Websocket.Frames++
+}
+
+func (s *statusTracker) trade(currencyPair string, receivedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.LastTrades[currencyPair] = receivedAt
+}
+
+// pipeline records the source of queue depths of the running pipeline, nil once it stops.
+func (s *statusTracker) pipeline(queues func() map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues = queues
+}
+
+func (s *statusTracker) snapshot() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := s.status
+	status.LastTrades = make(map[string]time.Time, len(s.status.LastTrades))
+	for pair, t := range s.status.LastTrades {
+		status.LastTrades[pair] = t
+	}
+	status.Queues = make(map[string]int)
+	if s.queues != nil {
+		status.Queues = s.queues()
+	}
+
+	return status
+}
+
+// Status returns a snapshot of the monitor state.
+func (m *MonitorService) Status() Status {
+	status := m.status.snapshot()
+	if m.publisher != nil {
+		status.Queues[QueuePublish] = m.publisher.Depth()
+	}
+
+	return status
+}
@@ -0,0 +1,292 @@
+// Package sqlite is an embedded SQLite storage of trades, order book snapshots and liquidity samples.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-kit/log"
+	monitor "github.com/pudgydoge/pdax-monitor"
+
+	// sqlite driver registers itself as being available to the database/sql package.
+	_ "modernc.org/sqlite"
+)
+
+// Schema sets up tables, it's applied whenever a database is opened.
+// Decimals are stored as text and timestamps as Unix nanoseconds to keep them exact.
+const Schema = `
+	CREATE TABLE IF NOT EXISTS trade (
+		id INTEGER PRIMARY KEY,
+		pdax_id INTEGER,
+		currency_pair TEXT NOT NULL,
+		price TEXT NOT NULL,
+		quantity TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		side INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS trade_pdax_id_idx ON trade (pdax_id);
+	CREATE INDEX IF NOT EXISTS trade_pair_created_at_idx ON trade (currency_pair, created_at);
+
+	CREATE TABLE IF NOT EXISTS order_book_snapshot (
+		id INTEGER PRIMARY KEY,
+		currency_pair TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS order_book_snapshot_pair_created_at_idx ON order_book_snapshot (currency_pair, created_at);
+
+	CREATE TABLE IF NOT EXISTS order_book_level (
+		snapshot_id INTEGER NOT NULL REFERENCES order_book_snapshot (id) ON DELETE CASCADE,
+		side INTEGER NOT NULL,
+		price TEXT NOT NULL,
+		quantity TEXT NOT NULL,
+		orders INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (snapshot_id, side, price)
+	);
+
+	CREATE TABLE IF NOT EXISTS book_metrics (
+		id INTEGER PRIMARY KEY,
+		currency_pair TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		spread_bps TEXT,
+		bid_size TEXT,
+		ask_size TEXT,
+		depth TEXT NOT NULL,
+		slippage TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS fx_rate (
+		id INTEGER PRIMARY KEY,
+		currency_pair TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		rate TEXT NOT NULL,
+		source TEXT NOT NULL
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS fx_rate_pair_created_at_source_idx ON fx_rate (currency_pair, created_at, source);
+
+	CREATE TABLE IF NOT EXISTS finding (
+		id INTEGER PRIMARY KEY,
+		currency_pair TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		started_at INTEGER NOT NULL,
+		ended_at INTEGER NOT NULL,
+		trades INTEGER NOT NULL,
+		volume TEXT NOT NULL,
+		score REAL NOT NULL,
+		detail TEXT NOT NULL
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS finding_pair_pattern_started_at_idx ON finding (currency_pair, pattern, started_at);
+	CREATE INDEX IF NOT EXISTS finding_started_at_idx ON finding (started_at);
+`
+
+// Client represents a client to the underlying SQLite database file.
+type Client struct {
+	db     *sql.DB
+	logger log.Logger
+
+	tradeQ       map[string]string
+	orderQ       map[string]string
+	bookMetricsQ map[string]string
+	fxRateQ      map[string]string
+	findingQ     map[string]string
+
+	trade       *tradeRepository
+	order       *orderRepository
+	bookMetrics *bookMetricsRepository
+	fxRate      *fxRateRepository
+	finding     *findingRepository
+}
+
+// NewClient returns a new Client backed by SQLite.
+func NewClient(options ...ConfigOption) *Client {
+	c := Client{
+		logger:      log.NewNopLogger(),
+		trade:       &tradeRepository{},
+		order:       &orderRepository{},
+		bookMetrics: &bookMetricsRepository{},
+		fxRate:      &fxRateRepository{},
+		finding:     &findingRepository{},
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	c.trade.client = &c
+	c.order.client = &c
+	c.bookMetrics.client = &c
+	c.fxRate.client = &c
+	c.finding.client = &c
+
+	return &c
+}
+
+// ConfigOption configures the client.
+type ConfigOption func(*Client)
+
+// WithLogger configures a logger to debug interactions with SQLite.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// Open opens the database file, it's created with the schema when missing.
+func (c *Client) Open(path string) error {
+	var err error
+
+	c.logger.Log("level", "debug", "msg", "opening sqlite db", "path", path)
+
+	if c.db, err = sql.Open("sqlite", path); err != nil {
+		return err
+	}
+	// SQLite allows a single writer, concurrent writes would fail with "database is locked".
+	c.db.SetMaxOpenConns(1)
+
+	if _, err = c.db.Exec(`PRAGMA foreign_keys = ON; PRAGMA journal_mode = WAL;`); err != nil {
+		return err
+	}
+	if _, err = c.db.Exec(Schema); err != nil {
+		return err
+	}
+	// Trades stored before the aggressor side was kept lack its column.
+	if err = c.addColumn("trade", "side", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	c.defineQueries()
+
+	return nil
+}
+
+// addColumn adds the column to the table unless it's there already.
+func (c *Client) addColumn(table, column, definition string) error {
+	var n int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`, table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = c.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+func (c *Client) defineQueries() {
+	c.tradeQ = map[string]string{
+		"insert": `
+			INSERT INTO trade (pdax_id, currency_pair, price, quantity, created_at, side) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (pdax_id) DO NOTHING
+		`,
+		"insertNew": `
+			INSERT INTO trade (currency_pair, price, quantity, created_at, side)
+			SELECT $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (
+				SELECT 1 FROM trade WHERE currency_pair = $1 AND created_at = $4 AND price = $2 AND quantity = $3
+			)
+		`,
+		// negative LIMIT selects all trades of unlimited queries
+		"findRange": `
+			SELECT COALESCE(pdax_id, 0), price, quantity, created_at, side FROM trade
+			WHERE currency_pair = $1 AND created_at >= $2 AND created_at < $3
+			ORDER BY created_at, id
+			LIMIT $4
+		`,
+	}
+	c.orderQ = map[string]string{
+		"insert": `
+			INSERT INTO order_book_snapshot (currency_pair, created_at) VALUES ($1, $2) RETURNING id
+		`,
+		"insertLevel": `
+			INSERT INTO order_book_level (snapshot_id, side, price, quantity, orders) VALUES ($1, $2, $3, $4, $5)
+		`,
+		"findAt": `
+			SELECT id, created_at FROM order_book_snapshot
+			WHERE currency_pair = $1 AND created_at <= $2
+			ORDER BY created_at DESC
+			LIMIT 1
+		`,
+		"findLevels": `
+			SELECT side, price, quantity, orders FROM order_book_level
+			WHERE snapshot_id = $1
+		`,
+	}
+	c.bookMetricsQ = map[string]string{
+		"insert": `
+			INSERT INTO book_metrics (currency_pair, created_at, spread_bps, bid_size, ask_size, depth, slippage)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`,
+	}
+	c.fxRateQ = map[string]string{
+		"upsert": `
+			INSERT INTO fx_rate (currency_pair, created_at, rate, source) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency_pair, created_at, source) DO UPDATE SET rate = excluded.rate
+		`,
+		"findRange": `
+			SELECT * FROM (
+				SELECT created_at, rate, source FROM fx_rate
+				WHERE currency_pair = $1 AND created_at < $2
+				ORDER BY created_at DESC, source DESC
+				LIMIT 1
+			)
+			UNION ALL
+			SELECT created_at, rate, source FROM fx_rate
+			WHERE currency_pair = $1 AND created_at >= $2 AND created_at < $3
+			ORDER BY created_at, source
+		`,
+	}
+	c.findingQ = map[string]string{
+		"upsert": `
+			INSERT INTO finding (currency_pair, pattern, started_at, ended_at, trades, volume, score, detail)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (currency_pair, pattern, started_at) DO UPDATE SET
+				ended_at = excluded.ended_at, trades = excluded.trades, volume = excluded.volume,
+				score = excluded.score, detail = excluded.detail
+		`,
+		// Empty pair or pattern selects all of them, negative LIMIT selects all findings of unlimited queries.
+		"findRange": `
+			SELECT currency_pair, pattern, started_at, ended_at, trades, volume, score, detail FROM finding
+			WHERE ($1 = '' OR currency_pair = $1) AND ($2 = '' OR pattern = $2)
+				AND started_at >= $3 AND started_at < $4 AND score >= $5
+			ORDER BY started_at, currency_pair, pattern
+			LIMIT $6
+		`,
+	}
+}
+
+// Ping verifies the database is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// TradeRepository returns current instance of tradeRepository interface.
+func (c *Client) TradeRepository() monitor.TradeRepository {
+	return c.trade
+}
+
+// OrderRepository returns current instance of orderRepository interface.
+func (c *Client) OrderRepository() monitor.OrderRepository {
+	return c.order
+}
+
+// BookMetricsRepository returns current instance of bookMetricsRepository interface.
+func (c *Client) BookMetricsRepository() monitor.BookMetricsRepository {
+	return c.bookMetrics
+}
+
+// FXRateRepository returns current instance of fxRateRepository interface.
+func (c *Client) FXRateRepository() monitor.FXRateRepository {
+	return c.fxRate
+}
+
+// FindingRepository returns current instance of findingRepository interface.
+func (c *Client) FindingRepository() monitor.FindingRepository {
+	return c.finding
+}
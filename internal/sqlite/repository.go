@@ -0,0 +1,371 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"go.opencensus.io/trace"
+)
+
+// tradeRepository is a service for managing Trades.
+type tradeRepository struct {
+	client *Client
+}
+
+// Insert inserts trade's information in the repository.
+func (r *tradeRepository) Insert(ctx context.Context, t *monitor.Trade) error {
+	_, span := trace.StartSpan(ctx, "sqlite.tradeRepository.Insert")
+	defer span.End()
+
+	_, err := r.client.db.ExecContext(
+		ctx,
+		r.client.tradeQ["insert"],
+		nullID(t.ID),
+		t.CurrencyPair,
+		monitor.DecimalKey(t.Price),
+		monitor.DecimalKey(t.Quantity),
+		t.Timestamp.UnixNano(),
+		t.Side,
+	)
+
+	return err
+}
+
+// Upsert inserts trades which are not in the repository yet within a single transaction,
+// the transaction is rolled back on dry run.
+func (r *tradeRepository) Upsert(ctx context.Context, trades []monitor.Trade, dryRun bool) (monitor.TradeImport, error) {
+	_, span := trace.StartSpan(ctx, "sqlite.tradeRepository.Upsert")
+	defer span.End()
+
+	var summary monitor.TradeImport
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	for _, t := range trades {
+		price, quantity, ts := monitor.DecimalKey(t.Price), monitor.DecimalKey(t.Quantity), t.Timestamp.UnixNano()
+
+		var res sql.Result
+		if t.ID == 0 {
+			res, err = tx.ExecContext(ctx, r.client.tradeQ["insertNew"], t.CurrencyPair, price, quantity, ts, t.Side)
+		} else {
+			res, err = tx.ExecContext(ctx, r.client.tradeQ["insert"], t.ID, t.CurrencyPair, price, quantity, ts, t.Side)
+		}
+		if err != nil {
+			return monitor.TradeImport{}, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return monitor.TradeImport{}, err
+		}
+		if n == 0 {
+			summary.Duplicates++
+		} else {
+			summary.Inserted++
+		}
+	}
+
+	if dryRun {
+		return summary, nil
+	}
+
+	return summary, tx.Commit()
+}
+
+// Trades returns trades of the pair within the time range ordered by time.
+func (r *tradeRepository) Trades(ctx context.Context, q monitor.TradeQuery) ([]monitor.Trade, error) {
+	_, span := trace.StartSpan(ctx, "sqlite.tradeRepository.Trades")
+	defer span.End()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.client.db.QueryContext(ctx, r.client.tradeQ["findRange"],
+		q.CurrencyPair, q.From.UnixNano(), q.To.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []monitor.Trade
+	for rows.Next() {
+		t := monitor.Trade{CurrencyPair: q.CurrencyPair}
+		var price, quantity string
+		var ts int64
+		if err = rows.Scan(&t.ID, &price, &quantity, &ts, &t.Side); err != nil {
+			return nil, err
+		}
+		if t.Price, _, err = apd.NewFromString(price); err != nil {
+			return nil, err
+		}
+		if t.Quantity, _, err = apd.NewFromString(quantity); err != nil {
+			return nil, err
+		}
+		t.Timestamp = time.Unix(0, ts).UTC()
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+// orderRepository is a service for managing order book snapshots.
+type orderRepository struct {
+	client *Client
+}
+
+// Insert inserts order book snapshot with its price levels in the repository.
+func (r *orderRepository) Insert(ctx context.Context, s *monitor.OrderBookSnapshot) error {
+	_, span := trace.StartSpan(ctx, "sqlite.orderRepository.Insert")
+	defer span.End()
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, r.client.orderQ["insert"], s.CurrencyPair, s.Timestamp.UnixNano()).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range s.Levels {
+		_, err = tx.ExecContext(ctx, r.client.orderQ["insertLevel"],
+			id, l.Side, monitor.DecimalKey(l.Price), monitor.DecimalKey(l.Quantity), l.Orders)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// BookAt returns the latest snapshot of the currency pair's book taken at or before the given time.
+func (r *orderRepository) BookAt(ctx context.Context, currencyPair string, at time.Time) (*monitor.OrderBookSnapshot, error) {
+	_, span := trace.StartSpan(ctx, "sqlite.orderRepository.BookAt")
+	defer span.End()
+
+	s := monitor.OrderBookSnapshot{CurrencyPair: currencyPair}
+
+	var id, ts int64
+	err := r.client.db.QueryRowContext(ctx, r.client.orderQ["findAt"], currencyPair, at.UnixNano()).Scan(&id, &ts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, monitor.Error{
+			Code:    monitor.ErrorCodeNotFound,
+			Message: "order book snapshot not found",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Timestamp = time.Unix(0, ts).UTC()
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.orderQ["findLevels"], id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l monitor.BookLevel
+		var price, quantity string
+		if err = rows.Scan(&l.Side, &price, &quantity, &l.Orders); err != nil {
+			return nil, err
+		}
+		if l.Price, _, err = apd.NewFromString(price); err != nil {
+			return nil, err
+		}
+		if l.Quantity, _, err = apd.NewFromString(quantity); err != nil {
+			return nil, err
+		}
+		s.Levels = append(s.Levels, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// prices are text, so levels are sorted by their decimal value here
+	monitor.SortLevels(s.Levels)
+
+	return &s, nil
+}
+
+// bookMetricsRepository is a service for managing order book liquidity samples.
+type bookMetricsRepository struct {
+	client *Client
+}
+
+// Insert inserts liquidity sample in the repository.
+func (r *bookMetricsRepository) Insert(ctx context.Context, m *monitor.BookMetrics) error {
+	_, span := trace.StartSpan(ctx, "sqlite.bookMetricsRepository.Insert")
+	defer span.End()
+
+	depth, err := json.Marshal(m.Depth)
+	if err != nil {
+		return err
+	}
+	slippage, err := json.Marshal(m.Slippage)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.db.ExecContext(
+		ctx,
+		r.client.bookMetricsQ["insert"],
+		m.CurrencyPair,
+		m.Timestamp.UnixNano(),
+		nullDecimal(m.SpreadBps),
+		nullDecimal(m.BidSize),
+		nullDecimal(m.AskSize),
+		string(depth),
+		string(slippage),
+	)
+
+	return err
+}
+
+// fxRateRepository is a service for managing currency exchange rates.
+type fxRateRepository struct {
+	client *Client
+}
+
+// Upsert stores the rates within a single transaction.
+func (r *fxRateRepository) Upsert(ctx context.Context, rates []monitor.FXRate) error {
+	_, span := trace.StartSpan(ctx, "sqlite.fxRateRepository.Upsert")
+	defer span.End()
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err = tx.ExecContext(ctx, r.client.fxRateQ["upsert"],
+			rate.CurrencyPair, rate.Timestamp.UnixNano(), monitor.DecimalKey(rate.Rate), rate.Source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Rates returns rates of the pair effective within the time range ordered by time.
+func (r *fxRateRepository) Rates(ctx context.Context, currencyPair string, from, to time.Time) ([]monitor.FXRate, error) {
+	_, span := trace.StartSpan(ctx, "sqlite.fxRateRepository.Rates")
+	defer span.End()
+
+	rows, err := r.client.db.QueryContext(ctx, r.client.fxRateQ["findRange"], currencyPair, from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []monitor.FXRate
+	for rows.Next() {
+		rate := monitor.FXRate{CurrencyPair: currencyPair}
+		var value string
+		var ts int64
+		if err = rows.Scan(&ts, &value, &rate.Source); err != nil {
+			return nil, err
+		}
+		if rate.Rate, _, err = apd.NewFromString(value); err != nil {
+			return nil, err
+		}
+		rate.Timestamp = time.Unix(0, ts).UTC()
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// findingRepository is a service for managing detected patterns of trades.
+type findingRepository struct {
+	client *Client
+}
+
+// Upsert stores the findings within a single transaction.
+func (r *findingRepository) Upsert(ctx context.Context, findings []monitor.Finding) error {
+	_, span := trace.StartSpan(ctx, "sqlite.findingRepository.Upsert")
+	defer span.End()
+
+	tx, err := r.client.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range findings {
+		_, err = tx.ExecContext(ctx, r.client.findingQ["upsert"], f.CurrencyPair, f.Pattern,
+			f.From.UnixNano(), f.To.UnixNano(), f.Trades, monitor.DecimalKey(f.Volume), f.Score, f.Detail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Findings returns findings matching the query ordered by start time, currency pair and pattern.
+func (r *findingRepository) Findings(ctx context.Context, q monitor.FindingQuery) ([]monitor.Finding, error) {
+	_, span := trace.StartSpan(ctx, "sqlite.findingRepository.Findings")
+	defer span.End()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.client.db.QueryContext(ctx, r.client.findingQ["findRange"],
+		q.CurrencyPair, q.Pattern, q.From.UnixNano(), q.To.UnixNano(), q.MinScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []monitor.Finding
+	for rows.Next() {
+		var f monitor.Finding
+		var from, to int64
+		var volume string
+		err = rows.Scan(&f.CurrencyPair, &f.Pattern, &from, &to, &f.Trades, &volume, &f.Score, &f.Detail)
+		if err != nil {
+			return nil, err
+		}
+		if f.Volume, _, err = apd.NewFromString(volume); err != nil {
+			return nil, err
+		}
+		f.From, f.To = time.Unix(0, from).UTC(), time.Unix(0, to).UTC()
+		findings = append(findings, f)
+	}
+
+	return findings, rows.Err()
+}
+
+// nullID turns unknown PDAX ID into SQL NULL.
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// nullDecimal turns missing decimal into SQL NULL.
+func nullDecimal(d *apd.Decimal) interface{} {
+	if d == nil {
+		return nil
+	}
+
+	return monitor.DecimalKey(d)
+}
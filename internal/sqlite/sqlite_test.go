@@ -0,0 +1,20 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/sqlite"
+	"github.com/pudgydoge/pdax-monitor/internal/storage/storagetest"
+)
+
+func TestClient(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) monitor.Storage {
+		c := sqlite.NewClient()
+		if err := c.Open(filepath.Join(t.TempDir(), "pdax.db")); err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return c
+	})
+}
@@ -0,0 +1,82 @@
+// Package storage opens storage backends of trades, order book snapshots and liquidity samples by driver name.
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+	"github.com/pudgydoge/pdax-monitor/internal/ndjson"
+	"github.com/pudgydoge/pdax-monitor/internal/pg"
+	"github.com/pudgydoge/pdax-monitor/internal/sqlite"
+)
+
+// Storage drivers.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverNDJSON   = "ndjson"
+	DriverMemory   = "memory"
+)
+
+// Opener opens a storage with the data source name, e.g. Postgres connection string or a file path.
+type Opener func(dsn string, logger log.Logger) (monitor.Storage, error)
+
+// drivers returns openers by driver name.
+func drivers() map[string]Opener {
+	return map[string]Opener{
+		DriverPostgres: func(dsn string, logger log.Logger) (monitor.Storage, error) {
+			c := pg.NewClient(pg.WithLogger(logger))
+			if err := c.Open(dsn); err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		DriverSQLite: func(dsn string, logger log.Logger) (monitor.Storage, error) {
+			c := sqlite.NewClient(sqlite.WithLogger(logger))
+			if err := c.Open(dsn); err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		DriverNDJSON: func(dsn string, logger log.Logger) (monitor.Storage, error) {
+			s := ndjson.NewStorage(ndjson.WithLogger(logger))
+			if err := s.Open(dsn); err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		DriverMemory: func(_ string, _ log.Logger) (monitor.Storage, error) {
+			return memory.NewStorage(), nil
+		},
+	}
+}
+
+// Drivers returns names of available drivers.
+func Drivers() []string {
+	var names []string
+	for name := range drivers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Open opens the storage of the driver.
+func Open(driver, dsn string, logger log.Logger) (monitor.Storage, error) {
+	open, ok := drivers()[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage driver %q, try %s", driver, strings.Join(Drivers(), ", "))
+	}
+
+	s, err := open(dsn, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s storage: %v", driver, err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,487 @@
+// Package storagetest is a conformance test suite of storage backends.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+// Run tests the storage backend against the repository contracts. Open must return an empty storage
+// for every call, it's closed by the suite.
+func Run(t *testing.T, open func(t *testing.T) monitor.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s monitor.Storage)
+	}{
+		{"Ping", testPing},
+		{"TradeInsertSkipsKnownID", testTradeInsertSkipsKnownID},
+		{"TradeUpsertByID", testTradeUpsertByID},
+		{"TradeUpsertWithoutID", testTradeUpsertWithoutID},
+		{"TradeUpsertDryRun", testTradeUpsertDryRun},
+		{"TradesRange", testTradesRange},
+		{"TradesLimit", testTradesLimit},
+		{"OrderBookAt", testOrderBookAt},
+		{"OrderBookNotFound", testOrderBookNotFound},
+		{"OrderBookLevelsOrder", testOrderBookLevelsOrder},
+		{"BookMetricsInsert", testBookMetricsInsert},
+		{"FXRates", testFXRates},
+		{"FXRateUpsertReplaces", testFXRateUpsertReplaces},
+		{"Findings", testFindings},
+		{"FindingUpsertReplaces", testFindingUpsertReplaces},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+			}()
+
+			tt.test(t, s)
+		})
+	}
+}
+
+var t0 = time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func dec(t *testing.T, s string) *apd.Decimal {
+	t.Helper()
+
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		t.Fatalf("invalid decimal %q: %v", s, err)
+	}
+
+	return d
+}
+
+func trade(t *testing.T, id int64, pair, price, quantity string, ts time.Time) monitor.Trade {
+	return monitor.Trade{
+		ID:           id,
+		CurrencyPair: pair,
+		Price:        dec(t, price),
+		Quantity:     dec(t, quantity),
+		Timestamp:    ts,
+	}
+}
+
+func upsert(t *testing.T, s monitor.Storage, trades []monitor.Trade, dryRun bool) monitor.TradeImport {
+	t.Helper()
+
+	summary, err := s.TradeRepository().Upsert(context.Background(), trades, dryRun)
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	return summary
+}
+
+func wantImport(t *testing.T, got monitor.TradeImport, inserted, duplicates int) {
+	t.Helper()
+
+	if got.Inserted != inserted || got.Duplicates != duplicates {
+		t.Errorf("Upsert() = %+v, want inserted %d, duplicates %d", got, inserted, duplicates)
+	}
+}
+
+func testPing(t *testing.T, s monitor.Storage) {
+	if err := s.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func testTradeInsertSkipsKnownID(t *testing.T, s monitor.Storage) {
+	ctx := context.Background()
+	tr := trade(t, 1001, "BTC-PHP", "2500000.5", "0.01", t0)
+
+	for i := 0; i < 2; i++ {
+		if err := s.TradeRepository().Insert(ctx, &tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	wantImport(t, upsert(t, s, []monitor.Trade{tr}, true), 0, 1)
+}
+
+func testTradeUpsertByID(t *testing.T, s monitor.Storage) {
+	trades := []monitor.Trade{
+		trade(t, 1, "BTC-PHP", "2500000", "0.5", t0),
+		trade(t, 2, "BTC-PHP", "2500000", "0.5", t0),
+		trade(t, 2, "BTC-PHP", "2500000", "0.5", t0),
+	}
+	wantImport(t, upsert(t, s, trades, false), 2, 1)
+
+	// same ID is a duplicate even when other fields differ
+	again := []monitor.Trade{
+		trade(t, 1, "ETH-PHP", "150000", "1", t0.Add(time.Hour)),
+		trade(t, 3, "BTC-PHP", "2500000", "0.5", t0),
+	}
+	wantImport(t, upsert(t, s, again, false), 1, 1)
+}
+
+func testTradeUpsertWithoutID(t *testing.T, s monitor.Storage) {
+	trades := []monitor.Trade{
+		trade(t, 0, "BTC-PHP", "2500000.50", "0.10", t0),
+		trade(t, 0, "BTC-PHP", "2500000.5", "0.1", t0),
+		trade(t, 0, "BTC-PHP", "2500000.5", "0.1", t0.Add(time.Second)),
+		trade(t, 0, "ETH-PHP", "2500000.5", "0.1", t0),
+	}
+	wantImport(t, upsert(t, s, trades, false), 3, 1)
+	wantImport(t, upsert(t, s, trades, false), 0, 4)
+}
+
+func testTradeUpsertDryRun(t *testing.T, s monitor.Storage) {
+	trades := []monitor.Trade{
+		trade(t, 10, "BTC-PHP", "2500000", "0.5", t0),
+		trade(t, 0, "ETH-PHP", "150000", "2", t0),
+	}
+	wantImport(t, upsert(t, s, trades, true), 2, 0)
+	wantImport(t, upsert(t, s, trades, true), 2, 0)
+	wantImport(t, upsert(t, s, trades, false), 2, 0)
+	wantImport(t, upsert(t, s, trades, true), 0, 2)
+}
+
+func tradesOf(t *testing.T, s monitor.Storage, q monitor.TradeQuery) []monitor.Trade {
+	t.Helper()
+
+	trades, err := s.TradeRepository().Trades(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Trades() error = %v", err)
+	}
+
+	return trades
+}
+
+func wantTradeIDs(t *testing.T, got []monitor.Trade, want ...int64) {
+	t.Helper()
+
+	ids := make([]int64, 0, len(got))
+	for _, tr := range got {
+		ids = append(ids, tr.ID)
+	}
+	if len(ids) != len(want) {
+		t.Fatalf("Trades() IDs = %v, want %v", ids, want)
+	}
+	for i := range ids {
+		if ids[i] != want[i] {
+			t.Fatalf("Trades() IDs = %v, want %v", ids, want)
+		}
+	}
+}
+
+func testTradesRange(t *testing.T, s monitor.Storage) {
+	sided := trade(t, 3, "BTC-PHP", "2500000.50", "0.25", t0.Add(2*time.Minute))
+	sided.Side = monitor.SideBid
+	upsert(t, s, []monitor.Trade{
+		sided,
+		trade(t, 1, "BTC-PHP", "2400000", "1", t0),
+		trade(t, 2, "ETH-PHP", "150000", "2", t0.Add(time.Minute)),
+		trade(t, 4, "BTC-PHP", "2450000", "0.5", t0.Add(24*time.Hour)),
+		trade(t, 5, "BTC-PHP", "2460000", "0.5", t0.Add(48*time.Hour)),
+	}, false)
+
+	got := tradesOf(t, s, monitor.TradeQuery{CurrencyPair: "BTC-PHP", From: t0, To: t0.Add(48 * time.Hour)})
+	wantTradeIDs(t, got, 1, 3, 4)
+
+	tr := got[1]
+	if tr.CurrencyPair != "BTC-PHP" || tr.Price.Cmp(dec(t, "2500000.5")) != 0 || tr.Quantity.Cmp(dec(t, "0.25")) != 0 ||
+		!tr.Timestamp.Equal(t0.Add(2*time.Minute)) || tr.Side != monitor.SideBid {
+		t.Errorf("Trades()[1] = %s %s %s %v side %d, want BTC-PHP 2500000.5 0.25 %v side %d",
+			tr.CurrencyPair, tr.Price, tr.Quantity, tr.Timestamp, tr.Side, t0.Add(2*time.Minute), monitor.SideBid)
+	}
+
+	wantTradeIDs(t, tradesOf(t, s, monitor.TradeQuery{CurrencyPair: "BTC-PHP", From: t0.Add(time.Nanosecond), To: t0.Add(time.Hour)}), 3)
+	wantTradeIDs(t, tradesOf(t, s, monitor.TradeQuery{CurrencyPair: "XRP-PHP", From: t0, To: t0.Add(time.Hour)}))
+}
+
+func testTradesLimit(t *testing.T, s monitor.Storage) {
+	var trades []monitor.Trade
+	for id := int64(1); id <= 5; id++ {
+		trades = append(trades, trade(t, id, "BTC-PHP", "2500000", "0.1", t0.Add(time.Duration(id)*time.Second)))
+	}
+	upsert(t, s, trades, false)
+
+	q := monitor.TradeQuery{CurrencyPair: "BTC-PHP", From: t0, To: t0.Add(time.Hour), Limit: 3}
+	wantTradeIDs(t, tradesOf(t, s, q), 1, 2, 3)
+	q.Limit = 0
+	wantTradeIDs(t, tradesOf(t, s, q), 1, 2, 3, 4, 5)
+}
+
+func snapshot(t *testing.T, pair string, ts time.Time, bidPrice string) monitor.OrderBookSnapshot {
+	return monitor.OrderBookSnapshot{
+		CurrencyPair: pair,
+		Timestamp:    ts,
+		Levels: []monitor.BookLevel{
+			{Side: monitor.SideBid, Price: dec(t, bidPrice), Quantity: dec(t, "1.5"), Orders: 2},
+			{Side: monitor.SideAsk, Price: dec(t, "2600000"), Quantity: dec(t, "0.25"), Orders: 1},
+		},
+	}
+}
+
+func insertSnapshot(t *testing.T, s monitor.Storage, snapshot monitor.OrderBookSnapshot) {
+	t.Helper()
+
+	if err := s.OrderRepository().Insert(context.Background(), &snapshot); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+}
+
+func testOrderBookAt(t *testing.T, s monitor.Storage) {
+	ctx := context.Background()
+	insertSnapshot(t, s, snapshot(t, "BTC-PHP", t0, "2400000"))
+	insertSnapshot(t, s, snapshot(t, "BTC-PHP", t0.Add(time.Minute), "2450000"))
+	insertSnapshot(t, s, snapshot(t, "BTC-PHP", t0.Add(48*time.Hour), "2500000"))
+	insertSnapshot(t, s, snapshot(t, "ETH-PHP", t0.Add(30*time.Second), "150000"))
+
+	tests := []struct {
+		at       time.Time
+		wantTime time.Time
+		wantBid  string
+	}{
+		{t0, t0, "2400000"},
+		{t0.Add(59 * time.Second), t0, "2400000"},
+		{t0.Add(time.Minute), t0.Add(time.Minute), "2450000"},
+		{t0.Add(24 * time.Hour), t0.Add(time.Minute), "2450000"},
+		{t0.Add(72 * time.Hour), t0.Add(48 * time.Hour), "2500000"},
+	}
+	for _, tt := range tests {
+		got, err := s.OrderRepository().BookAt(ctx, "BTC-PHP", tt.at)
+		if err != nil {
+			t.Fatalf("BookAt(%v) error = %v", tt.at, err)
+		}
+		if got.CurrencyPair != "BTC-PHP" || !got.Timestamp.Equal(tt.wantTime) {
+			t.Errorf("BookAt(%v) = %s at %v, want BTC-PHP at %v", tt.at, got.CurrencyPair, got.Timestamp, tt.wantTime)
+		}
+		if len(got.Levels) != 2 || got.Levels[0].Price.Cmp(dec(t, tt.wantBid)) != 0 {
+			t.Errorf("BookAt(%v) levels = %v, want best bid %s", tt.at, got.Levels, tt.wantBid)
+		}
+	}
+}
+
+func testOrderBookNotFound(t *testing.T, s monitor.Storage) {
+	insertSnapshot(t, s, snapshot(t, "BTC-PHP", t0, "2400000"))
+
+	for _, tt := range []struct {
+		pair string
+		at   time.Time
+	}{
+		{"BTC-PHP", t0.Add(-time.Nanosecond)},
+		{"ETH-PHP", t0.Add(time.Hour)},
+	} {
+		_, err := s.OrderRepository().BookAt(context.Background(), tt.pair, tt.at)
+		if code := monitor.ErrorCode(err); code != monitor.ErrorCodeNotFound {
+			t.Errorf("BookAt(%s, %v) error = %v, want code %s", tt.pair, tt.at, err, monitor.ErrorCodeNotFound)
+		}
+	}
+}
+
+func testOrderBookLevelsOrder(t *testing.T, s monitor.Storage) {
+	insertSnapshot(t, s, monitor.OrderBookSnapshot{
+		CurrencyPair: "BTC-PHP",
+		Timestamp:    t0,
+		Levels: []monitor.BookLevel{
+			{Side: monitor.SideAsk, Price: dec(t, "2600000"), Quantity: dec(t, "1"), Orders: 1},
+			{Side: monitor.SideBid, Price: dec(t, "900000"), Quantity: dec(t, "2"), Orders: 1},
+			{Side: monitor.SideAsk, Price: dec(t, "2550000.25"), Quantity: dec(t, "0.5"), Orders: 3},
+			{Side: monitor.SideBid, Price: dec(t, "2400000"), Quantity: dec(t, "0.125"), Orders: 2},
+			{Side: monitor.SideAsk, Price: dec(t, "10000000"), Quantity: dec(t, "4"), Orders: 1},
+		},
+	})
+
+	got, err := s.OrderRepository().BookAt(context.Background(), "BTC-PHP", t0)
+	if err != nil {
+		t.Fatalf("BookAt() error = %v", err)
+	}
+
+	want := []monitor.BookLevel{
+		{Side: monitor.SideBid, Price: dec(t, "2400000"), Quantity: dec(t, "0.125"), Orders: 2},
+		{Side: monitor.SideBid, Price: dec(t, "900000"), Quantity: dec(t, "2"), Orders: 1},
+		{Side: monitor.SideAsk, Price: dec(t, "2550000.25"), Quantity: dec(t, "0.5"), Orders: 3},
+		{Side: monitor.SideAsk, Price: dec(t, "2600000"), Quantity: dec(t, "1"), Orders: 1},
+		{Side: monitor.SideAsk, Price: dec(t, "10000000"), Quantity: dec(t, "4"), Orders: 1},
+	}
+	if len(got.Levels) != len(want) {
+		t.Fatalf("BookAt() got %d levels, want %d", len(got.Levels), len(want))
+	}
+	for i, l := range got.Levels {
+		w := want[i]
+		if l.Side != w.Side || l.Price.Cmp(w.Price) != 0 || l.Quantity.Cmp(w.Quantity) != 0 || l.Orders != w.Orders {
+			t.Errorf("level %d = {%d %s %s %d}, want {%d %s %s %d}", i,
+				l.Side, l.Price, l.Quantity, l.Orders, w.Side, w.Price, w.Quantity, w.Orders)
+		}
+	}
+}
+
+func testBookMetricsInsert(t *testing.T, s monitor.Storage) {
+	m := monitor.BookMetrics{
+		CurrencyPair: "BTC-PHP",
+		Timestamp:    t0,
+		SpreadBps:    dec(t, "12.5"),
+		BidSize:      dec(t, "1.5"),
+		AskSize:      nil, // one-sided book
+		Depth:        []monitor.BookDepth{{Percent: 1, Bids: dec(t, "3"), Asks: dec(t, "0")}},
+		Slippage:     []monitor.BookSlippage{{Notional: dec(t, "100000")}},
+	}
+
+	if err := s.BookMetricsRepository().Insert(context.Background(), &m); err != nil {
+		t.Errorf("Insert() error = %v", err)
+	}
+}
+
+func fxRate(t *testing.T, ts time.Time, rate, source string) monitor.FXRate {
+	return monitor.FXRate{CurrencyPair: monitor.CurrencyPairUSDPHP, Timestamp: ts, Rate: dec(t, rate), Source: source}
+}
+
+func upsertRates(t *testing.T, s monitor.Storage, rates ...monitor.FXRate) {
+	t.Helper()
+
+	if err := s.FXRateRepository().Upsert(context.Background(), rates); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+}
+
+func wantRates(t *testing.T, s monitor.Storage, pair string, from, to time.Time, want ...monitor.FXRate) {
+	t.Helper()
+
+	got, err := s.FXRateRepository().Rates(context.Background(), pair, from, to)
+	if err != nil {
+		t.Fatalf("Rates() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Rates(%v, %v) = %v, want %v", from, to, got, want)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.CurrencyPair != w.CurrencyPair || !g.Timestamp.Equal(w.Timestamp) || g.Rate.Cmp(w.Rate) != 0 || g.Source != w.Source {
+			t.Errorf("Rates(%v, %v)[%d] = %s %v %s %s, want %s %v %s %s", from, to, i,
+				g.CurrencyPair, g.Timestamp, g.Rate, g.Source, w.CurrencyPair, w.Timestamp, w.Rate, w.Source)
+		}
+	}
+}
+
+func testFXRates(t *testing.T, s monitor.Storage) {
+	r0 := fxRate(t, t0, "51.25", "csv")
+	r1 := fxRate(t, t0.Add(time.Hour), "51.3", "USDT-PHP")
+	r2 := fxRate(t, t0.Add(25*time.Hour), "51.4", "csv")
+	upsertRates(t, s, r2, r0, r1)
+
+	// the latest rate before the range is effective at its start
+	wantRates(t, s, monitor.CurrencyPairUSDPHP, t0.Add(30*time.Minute), t0.Add(25*time.Hour), r0, r1)
+	wantRates(t, s, monitor.CurrencyPairUSDPHP, t0, t0.Add(48*time.Hour), r0, r1, r2)
+	wantRates(t, s, monitor.CurrencyPairUSDPHP, t0.Add(48*time.Hour), t0.Add(72*time.Hour), r2)
+	wantRates(t, s, monitor.CurrencyPairUSDPHP, t0.Add(-time.Hour), t0)
+	wantRates(t, s, "EUR-PHP", t0, t0.Add(48*time.Hour))
+}
+
+func testFXRateUpsertReplaces(t *testing.T, s monitor.Storage) {
+	upsertRates(t, s, fxRate(t, t0, "51.25", "csv"), fxRate(t, t0, "51.2", "USDT-PHP"))
+	upsertRates(t, s, fxRate(t, t0, "51.5", "csv"))
+
+	got, err := s.FXRateRepository().Rates(context.Background(), monitor.CurrencyPairUSDPHP, t0, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Rates() error = %v", err)
+	}
+	// rates of the same time are told apart by their source
+	want := map[string]string{"csv": "51.5", "USDT-PHP": "51.2"}
+	if len(got) != len(want) {
+		t.Fatalf("Rates() = %v, want rates %v", got, want)
+	}
+	for _, rate := range got {
+		if rate.Rate.Cmp(dec(t, want[rate.Source])) != 0 {
+			t.Errorf("Rates() %s rate = %s, want %s", rate.Source, rate.Rate, want[rate.Source])
+		}
+	}
+}
+
+func finding(t *testing.T, pair, pattern string, from time.Time, score float64) monitor.Finding {
+	return monitor.Finding{
+		CurrencyPair: pair,
+		Pattern:      pattern,
+		From:         from,
+		To:           from.Add(time.Minute),
+		Trades:       6,
+		Volume:       dec(t, "1.5"),
+		Score:        score,
+		Detail:       "6 trades of 0.25",
+	}
+}
+
+func upsertFindings(t *testing.T, s monitor.Storage, findings ...monitor.Finding) {
+	t.Helper()
+
+	if err := s.FindingRepository().Upsert(context.Background(), findings); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+}
+
+func findingsOf(t *testing.T, s monitor.Storage, q monitor.FindingQuery) []monitor.Finding {
+	t.Helper()
+
+	findings, err := s.FindingRepository().Findings(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Findings() error = %v", err)
+	}
+
+	return findings
+}
+
+func wantFindings(t *testing.T, got []monitor.Finding, want ...monitor.Finding) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("Findings() = %v, want %v", got, want)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.CurrencyPair != w.CurrencyPair || g.Pattern != w.Pattern || !g.From.Equal(w.From) || !g.To.Equal(w.To) ||
+			g.Trades != w.Trades || g.Volume.Cmp(w.Volume) != 0 || g.Score != w.Score || g.Detail != w.Detail {
+			t.Errorf("Findings()[%d] = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func testFindings(t *testing.T, s monitor.Storage) {
+	f0 := finding(t, "BTC-PHP", monitor.PatternPingPong, t0, 0.5)
+	f1 := finding(t, "BTC-PHP", monitor.PatternEqualSizeBurst, t0.Add(time.Minute), 0.9)
+	f2 := finding(t, "ETH-PHP", monitor.PatternEqualSizeBurst, t0.Add(time.Minute), 0.75)
+	f3 := finding(t, "BTC-PHP", monitor.PatternRoundNumbers, t0.Add(24*time.Hour), 0.25)
+	upsertFindings(t, s, f3, f2, f1, f0)
+
+	all := monitor.FindingQuery{From: t0, To: t0.Add(48 * time.Hour)}
+	wantFindings(t, findingsOf(t, s, all), f0, f1, f2, f3)
+
+	q := all
+	q.CurrencyPair = "BTC-PHP"
+	wantFindings(t, findingsOf(t, s, q), f0, f1, f3)
+	q.Pattern = monitor.PatternEqualSizeBurst
+	wantFindings(t, findingsOf(t, s, q), f1)
+
+	q = all
+	q.MinScore = 0.75
+	wantFindings(t, findingsOf(t, s, q), f1, f2)
+	q.Limit = 1
+	wantFindings(t, findingsOf(t, s, q), f1)
+
+	q = all
+	q.From, q.To = t0.Add(time.Minute), t0.Add(24*time.Hour)
+	wantFindings(t, findingsOf(t, s, q), f1, f2)
+}
+
+func testFindingUpsertReplaces(t *testing.T, s monitor.Storage) {
+	f := finding(t, "BTC-PHP", monitor.PatternPingPong, t0, 0.5)
+	upsertFindings(t, s, f, finding(t, "BTC-PHP", monitor.PatternEqualSizeBurst, t0, 0.5))
+
+	// the finding of the same pair, pattern and start grew longer
+	f.To, f.Trades, f.Volume, f.Score, f.Detail = f.To.Add(time.Minute), 8, dec(t, "2"), 0.7, "8 trades of 0.25"
+	upsertFindings(t, s, f)
+
+	q := monitor.FindingQuery{Pattern: monitor.PatternPingPong, From: t0, To: t0.Add(time.Hour)}
+	wantFindings(t, findingsOf(t, s, q), f)
+}
@@ -0,0 +1,218 @@
+package synth
+
+import (
+	"time"
+
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+const (
+	wsPageUpdate          = 35
+	wsPageReset           = 36
+	wsTradeViewID         = 4.0
+	wsTimeSalesChange     = 128
+	wsOrderBookChange     = 27
+	headerSize            = 15 // mtype, message_id, seq_number and viewID
+	tradeSize             = 86
+	tradeTailSize         = 35 // nullable update, remove, old_index and new_index of a trade
+	orderSize             = 97
+	orderUpdateSize       = 2 + 2 + 2 + 8 + 8 + 4 + 8 + 8
+	orderBookPageSize     = 8 + 8 + 1 + 2 + 2
+	orderBookChangesSize  = 8 + 1 + 2
+	orderBookChangeFlags  = 6
+	orderBookIndexSize    = 8
+	orderBookInsertHeader = 2 + 2
+)
+
+// tradeRow is a trade of the TimeSales view, prices and quantities are mantissas of the instrument's decimals.
+type tradeRow struct {
+	id       float64
+	time     time.Time
+	price    float64
+	quantity float64
+	side     uint8
+}
+
+// orderRow is an order of the OrderBook view, prices and quantities are mantissas of the instrument's decimals.
+type orderRow struct {
+	id       float64
+	time     time.Time
+	side     uint8
+	price    float64
+	quantity float64
+}
+
+// change is a single change of an order book page, exactly one of insert, update and remove is set.
+type change struct {
+	insert *orderRow
+	update *orderRow
+	remove *orderRow
+	index  int
+}
+
+// writeHeader writes the header every page message starts with.
+func writeHeader(wc *binary.WriteCursor, mtype uint8, messageID uint32, seq uint16, viewID float64) {
+	wc.WriteUint8(mtype)
+	wc.WriteUint32(messageID)
+	wc.WriteUint16(seq)
+	wc.WriteFloat64(viewID)
+}
+
+// encodeTrades encodes a TimeSales page update inserting the trades.
+func encodeTrades(messageID uint32, seq uint16, i trade.Instrument, trades []tradeRow) []byte {
+	wc := binary.WriteCursor{Data: make([]byte, headerSize+8+1+2+len(trades)*(1+2+2+tradeSize+tradeTailSize))}
+	writeHeader(&wc, wsPageUpdate, messageID, seq, wsTradeViewID)
+	wc.WriteFloat64(0)                      // page_id
+	wc.WriteUint8(0)                        // first_index nullable check
+	wc.WriteUint16(uint16(2 * len(trades))) // tradeCount, counts two per trade
+
+	for n, t := range trades {
+		wc.WriteUint8(1) // insert
+		wc.WriteUint16(wsTimeSalesChange)
+		wc.WriteUint16(1) // length
+		writeTrade(&wc, float64(n), i, t)
+	}
+
+	return wc.Data
+}
+
+// writeTrade writes the trade the way trade.Reader.ReadNullableTrade reads it.
+func writeTrade(wc *binary.WriteCursor, index float64, i trade.Instrument, t tradeRow) {
+	wc.WriteFloat64(index)
+	wc.WriteFloat64(t.id)
+	wc.WriteFloat64(trade.EncodeTime(t.time))
+	wc.WriteUint32(0) // timestamp 2 part
+	wc.WriteUint8(1)  // InstrumentMarket nullable check
+	wc.WriteFloat64(float64(i.ID))
+	wc.WriteFloat64(t.price)
+	wc.WriteFloat64(t.quantity)
+	wc.WriteFloat64(0) // Increment
+	wc.WriteFloat64(0) // Value
+	wc.WriteUint8(t.side)
+	wc.WriteFloat64(0) // Swing
+	wc.WriteUint8(i.PriceDecimals)
+	wc.WriteUint8(i.QuantityDecimals)
+	wc.WriteUint8(0)  // ValueDecimals
+	wc.WriteUint8(0)  // LeverageEvent
+	wc.WriteUint32(0) // permissions
+
+	wc.CurPos += tradeTailSize // left null
+}
+
+// encodeOrderBook encodes an OrderBook page reset of the orders.
+func encodeOrderBook(messageID uint32, seq uint16, viewID float64, i trade.Instrument, orders []orderRow) []byte {
+	wc := binary.WriteCursor{Data: make([]byte, headerSize+orderBookPageSize+len(orders)*orderSize)}
+	writeHeader(&wc, wsPageReset, messageID, seq, viewID)
+	wc.WriteFloat64(0) // page_id
+	wc.WriteFloat64(0) // first_index
+	wc.WriteUint8(0)   // animate
+	wc.WriteUint16(wsOrderBookChange)
+	wc.WriteUint16(uint16(len(orders)))
+
+	for n, o := range orders {
+		writeOrder(&wc, float64(n), i, o)
+	}
+
+	return wc.Data
+}
+
+// encodeOrderBookChanges encodes an OrderBook page update of the changes.
+func encodeOrderBookChanges(messageID uint32, seq uint16, viewID float64, i trade.Instrument, changes []change) []byte {
+	size := headerSize + orderBookChangesSize
+	for _, c := range changes {
+		size += orderBookChangeFlags
+		switch {
+		case c.insert != nil:
+			size += orderBookInsertHeader + orderSize + orderBookIndexSize
+		case c.update != nil:
+			size += orderUpdateSize + 2*orderBookIndexSize
+		case c.remove != nil:
+			size += 8 + orderBookIndexSize
+		}
+	}
+
+	wc := binary.WriteCursor{Data: make([]byte, size)}
+	writeHeader(&wc, wsPageUpdate, messageID, seq, viewID)
+	wc.WriteFloat64(0) // page_id
+	wc.WriteUint8(0)   // first_index nullable check
+	wc.WriteUint16(uint16(len(changes)))
+
+	for _, c := range changes {
+		writeChange(&wc, i, c)
+	}
+
+	return wc.Data
+}
+
+// writeChange writes the change the way order.ReadOrderBookUpdate reads it.
+func writeChange(wc *binary.WriteCursor, i trade.Instrument, c change) {
+	if c.insert != nil {
+		wc.WriteUint8(1)
+		wc.WriteUint16(wsOrderBookChange)
+		wc.WriteUint16(1) // length
+		writeOrder(wc, float64(c.index), i, *c.insert)
+	} else {
+		wc.WriteUint8(0)
+	}
+
+	if c.update != nil {
+		wc.WriteUint8(1)
+		wc.WriteUint16(wsOrderBookChange) // table
+		wc.WriteUint16(wsOrderBookChange) // table of ColumnKVPList
+		wc.WriteUint16(0)                 // count of column_indices
+		wc.WriteFloat64(c.update.id)
+		wc.WriteFloat64(trade.EncodeTime(c.update.time))
+		wc.WriteUint32(0) // timestamp 2 part
+		wc.WriteFloat64(c.update.quantity)
+		wc.WriteFloat64(1) // Orders
+	} else {
+		wc.WriteUint8(0)
+	}
+
+	if c.remove != nil {
+		wc.WriteUint8(1)
+		wc.WriteFloat64(c.remove.id)
+	} else {
+		wc.WriteUint8(0)
+	}
+
+	if c.update != nil || c.remove != nil { // old_index
+		wc.WriteUint8(1)
+		wc.WriteFloat64(float64(c.index))
+	} else {
+		wc.WriteUint8(0)
+	}
+
+	if c.insert != nil || c.update != nil { // new_index
+		wc.WriteUint8(1)
+		wc.WriteFloat64(float64(c.index))
+	} else {
+		wc.WriteUint8(0)
+	}
+
+	wc.WriteUint8(0) // animate
+}
+
+// writeOrder writes the order the way order.ReadOrderBook reads it.
+func writeOrder(wc *binary.WriteCursor, index float64, i trade.Instrument, o orderRow) {
+	wc.WriteFloat64(index)
+	wc.WriteFloat64(o.id)
+	wc.WriteFloat64(trade.EncodeTime(o.time))
+	wc.WriteUint32(0) // timestamp 2 part
+	wc.WriteUint8(1)  // InstrumentMarket nullable check
+	wc.WriteFloat64(float64(i.ID))
+	wc.WriteUint8(o.side)
+	wc.WriteFloat64(o.price)
+	wc.WriteUint8(i.PriceDecimals)
+	wc.WriteFloat64(o.quantity)
+	wc.WriteUint8(i.QuantityDecimals)
+	wc.WriteUint8(0)   // Flags
+	wc.WriteFloat64(1) // Orders
+	wc.WriteFloat64(0) // GeneralInterest
+	wc.WriteUint16(0)  // Tag length
+	wc.WriteUint16(0)  // OBInfo length
+	wc.WriteFloat64(0) // Currency
+	wc.WriteFloat64(0) // TransactionCount
+	wc.WriteUint32(0)  // permissions
+}
@@ -0,0 +1,402 @@
+// Package synth generates synthetic PDAX websocket frames of trades and order book changes at configurable rates,
+// so the monitor can be load and soak tested without PDAX.
+package synth
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket"
+)
+
+const (
+	defaultTradeRate = 2.0
+	defaultBookRate  = 20.0
+	defaultDepth     = 50
+	// volatility is the standard deviation of the relative price change per trade.
+	volatility = 0.0005
+	// spread is the relative distance of trades and the nearest orders from the price.
+	spread = 0.0005
+	// levelStep is the relative distance between price levels of generated orders.
+	levelStep = 0.0005
+	// quantitySigma is the standard deviation of logarithm of trade and order quantities.
+	quantitySigma = 1.0
+)
+
+// Market is a synthetic market of the instrument.
+type Market struct {
+	Instrument trade.Instrument
+	// ViewID is websocket view ID of the market's order book, no order book is generated when it's 0.
+	ViewID float64
+	// Price is the initial price, it walks randomly as trades are made.
+	Price float64
+	// Quantity is the median quantity of trades and orders, quantities are log-normally distributed around it.
+	Quantity float64
+	// Weight is the share of trades and order book changes of the market relative to other markets.
+	Weight float64
+}
+
+// DefaultMarkets returns markets resembling the most traded PDAX instruments,
+// instrument IDs and order book views match the bundled currency codes and serve defaults.
+func DefaultMarkets() []Market {
+	return []Market{
+		{
+			Instrument: trade.Instrument{ID: 167, Base: "BTC", Quote: "PHP", PriceDecimals: 2, QuantityDecimals: 8},
+			ViewID:     16,
+			Price:      3000000,
+			Quantity:   0.005,
+			Weight:     0.5,
+		},
+		{
+			Instrument: trade.Instrument{ID: 168, Base: "ETH", Quote: "PHP", PriceDecimals: 2, QuantityDecimals: 8},
+			ViewID:     21,
+			Price:      180000,
+			Quantity:   0.1,
+			Weight:     0.3,
+		},
+		{
+			Instrument: trade.Instrument{ID: 172, Base: "USDT", Quote: "PHP", PriceDecimals: 2, QuantityDecimals: 2},
+			Price:      57.5,
+			Quantity:   200,
+			Weight:     0.2,
+		},
+	}
+}
+
+// CurrencyCodes returns currency codes (instrument ID to base currency) of the markets.
+func CurrencyCodes(markets []Market) map[int]string {
+	codes := make(map[int]string, len(markets))
+	for _, m := range markets {
+		codes[m.Instrument.ID] = m.Instrument.Base
+	}
+
+	return codes
+}
+
+// ViewIDs returns websocket view IDs of order books of the markets.
+func ViewIDs(markets []Market) []float64 {
+	var viewIDs []float64
+	for _, m := range markets {
+		if m.ViewID != 0 {
+			viewIDs = append(viewIDs, m.ViewID)
+		}
+	}
+
+	return viewIDs
+}
+
+// market is the state of a synthetic market.
+type market struct {
+	Market
+	price float64
+	// orders are kept in the order of the view, i.e. by price from the highest ask to the lowest bid.
+	orders []orderRow
+}
+
+// Generator generates frames of trades and order book changes. Trades and changes arrive at exponentially
+// distributed intervals, i.e. they are Poisson processes of the configured rates. Frames are timed by
+// a virtual clock, so they are generated as fast as they are consumed unless Run paces them.
+type Generator struct {
+	markets   []*market
+	books     []*market
+	tradeRate float64
+	bookRate  float64
+	depth     int
+	start     time.Time
+	rand      *rand.Rand
+
+	now       time.Time
+	nextTrade time.Time
+	nextBook  time.Time
+	messageID uint32
+	seq       uint16
+	nextID    float64
+}
+
+// NewGenerator instantiates Generator of DefaultMarkets unless configured otherwise.
+func NewGenerator(options ...ConfigOption) *Generator {
+	g := Generator{
+		tradeRate: defaultTradeRate,
+		bookRate:  defaultBookRate,
+		depth:     defaultDepth,
+		start:     time.Now().UTC(),
+		rand:      rand.New(rand.NewSource(1)),
+	}
+	WithMarkets(DefaultMarkets()...)(&g)
+
+	for _, opt := range options {
+		opt(&g)
+	}
+
+	g.now = g.start
+	// IDs grow from the start time in milliseconds, so trades of separate runs don't collide in storage
+	g.nextID = float64(g.start.UnixNano() / int64(time.Millisecond))
+	g.nextTrade = g.after(g.tradeRate)
+	g.nextBook = g.after(g.bookRate)
+
+	return &g
+}
+
+// ConfigOption configures the generator.
+type ConfigOption func(*Generator)
+
+// WithMarkets configures markets to generate frames of.
+func WithMarkets(markets ...Market) ConfigOption {
+	return func(g *Generator) {
+		g.markets, g.books = nil, nil
+		for _, m := range markets {
+			if m.Weight <= 0 {
+				m.Weight = 1
+			}
+			s := market{Market: m, price: m.Price}
+			g.markets = append(g.markets, &s)
+			if m.ViewID != 0 {
+				g.books = append(g.books, &s)
+			}
+		}
+	}
+}
+
+// WithTradeRate configures the average number of trades per second across all markets.
+func WithTradeRate(perSecond float64) ConfigOption {
+	return func(g *Generator) {
+		if perSecond > 0 {
+			g.tradeRate = perSecond
+		}
+	}
+}
+
+// WithBookRate configures the average number of order book changes per second across all order books.
+func WithBookRate(perSecond float64) ConfigOption {
+	return func(g *Generator) {
+		if perSecond >= 0 {
+			g.bookRate = perSecond
+		}
+	}
+}
+
+// WithDepth configures the number of orders of each side of order book resets.
+func WithDepth(orders int) ConfigOption {
+	return func(g *Generator) {
+		if orders > 0 {
+			g.depth = orders
+		}
+	}
+}
+
+// WithSeed configures seed of random numbers, generators of the same seed and start generate the same frames.
+func WithSeed(seed int64) ConfigOption {
+	return func(g *Generator) {
+		g.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithStart configures time of the virtual clock the frames start at, it's the current time by default.
+func WithStart(t time.Time) ConfigOption {
+	return func(g *Generator) {
+		g.start = t.UTC()
+	}
+}
+
+// Resets returns order book resets of all markets with order books, they are to be handled before changes.
+// Order books are filled with orders around the current price.
+func (g *Generator) Resets() []websocket.Frame {
+	var frames []websocket.Frame
+	for _, m := range g.books {
+		m.orders = m.orders[:0]
+		for k := g.depth; k > 0; k-- {
+			m.orders = append(m.orders, g.order(m, monitor.SideAsk, m.price*(1+float64(k)*levelStep)))
+		}
+		for k := 1; k <= g.depth; k++ {
+			m.orders = append(m.orders, g.order(m, monitor.SideBid, m.price*(1-float64(k)*levelStep)))
+		}
+
+		frames = append(frames, g.frame(encodeOrderBook(g.messageID, g.seq, m.ViewID, m.Instrument, m.orders)))
+	}
+
+	return frames
+}
+
+// Next returns the next frame of a trade or an order book change.
+func (g *Generator) Next() websocket.Frame {
+	if len(g.books) == 0 || g.bookRate == 0 || g.nextTrade.Before(g.nextBook) {
+		g.now = g.nextTrade
+		g.nextTrade = g.after(g.tradeRate)
+
+		return g.tradeFrame()
+	}
+
+	g.now = g.nextBook
+	g.nextBook = g.after(g.bookRate)
+
+	return g.bookFrame()
+}
+
+// Run calls fn with order book resets and then with every next frame as soon as its time comes,
+// the virtual clock is aligned with the wall clock first. It returns when the context is done or fn fails.
+func (g *Generator) Run(ctx context.Context, fn func(websocket.Frame) error) error {
+	offset := time.Since(g.now)
+	for _, f := range g.Resets() {
+		f.Time = f.Time.Add(offset)
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		f := g.Next()
+		f.Time = f.Time.Add(offset)
+
+		if d := time.Until(f.Time); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// tradeFrame makes a trade of a random market, its price walks randomly and the aggressor side is random.
+func (g *Generator) tradeFrame() websocket.Frame {
+	m := g.pick(g.markets)
+	m.price *= math.Exp(volatility * g.rand.NormFloat64())
+
+	t := tradeRow{
+		id:       g.id(),
+		time:     g.now,
+		quantity: g.quantity(m),
+		side:     monitor.SideAsk,
+		price:    m.price * (1 - spread),
+	}
+	if g.rand.Intn(2) == 0 {
+		t.side = monitor.SideBid
+		t.price = m.price * (1 + spread)
+	}
+	t.price = mantissa(t.price, m.Instrument.PriceDecimals)
+
+	return g.frame(encodeTrades(g.messageID, g.seq, m.Instrument, []tradeRow{t}))
+}
+
+// bookFrame changes the order book of a random market. Orders are more likely inserted than removed while
+// the book is shallower than its reset depth and the other way round, so its size stays around the depth.
+func (g *Generator) bookFrame() websocket.Frame {
+	m := g.pick(g.books)
+
+	insert, update := 0.5, 0.8
+	if len(m.orders) >= 2*g.depth {
+		insert, update = 0.2, 0.5
+	}
+
+	var c change
+	switch r := g.rand.Float64(); {
+	case len(m.orders) == 0 || r < insert:
+		side, price := monitor.SideBid, m.price*(1-spread)
+		levels := 1 + math.Floor(g.rand.ExpFloat64()*float64(g.depth)/4)
+		if g.rand.Intn(2) == 0 {
+			side, price = monitor.SideAsk, m.price*(1+spread)
+			price *= 1 + levels*levelStep
+		} else {
+			price *= 1 - levels*levelStep
+		}
+
+		o := g.order(m, side, price)
+		c = change{insert: &o, index: sort.Search(len(m.orders), func(i int) bool {
+			return m.orders[i].price < o.price
+		})}
+		m.orders = append(m.orders, orderRow{})
+		copy(m.orders[c.index+1:], m.orders[c.index:])
+		m.orders[c.index] = o
+	case r < update:
+		c.index = g.rand.Intn(len(m.orders))
+		m.orders[c.index].quantity = g.quantity(m)
+		m.orders[c.index].time = g.now
+		o := m.orders[c.index]
+		c.update = &o
+	default:
+		c.index = g.rand.Intn(len(m.orders))
+		o := m.orders[c.index]
+		c.remove = &o
+		m.orders = append(m.orders[:c.index], m.orders[c.index+1:]...)
+	}
+
+	return g.frame(encodeOrderBookChanges(g.messageID, g.seq, m.ViewID, m.Instrument, []change{c}))
+}
+
+// order makes an order of a random quantity at the price.
+func (g *Generator) order(m *market, side uint8, price float64) orderRow {
+	return orderRow{
+		id:       g.id(),
+		time:     g.now,
+		side:     side,
+		price:    mantissa(price, m.Instrument.PriceDecimals),
+		quantity: g.quantity(m),
+	}
+}
+
+// quantity returns a log-normally distributed quantity mantissa, it's never less than the smallest unit.
+func (g *Generator) quantity(m *market) float64 {
+	q := m.Quantity * math.Exp(quantitySigma*g.rand.NormFloat64())
+
+	return math.Max(1, mantissa(q, m.Instrument.QuantityDecimals))
+}
+
+// pick returns a random market, markets are weighted.
+func (g *Generator) pick(markets []*market) *market {
+	total := 0.0
+	for _, m := range markets {
+		total += m.Weight
+	}
+
+	r := g.rand.Float64() * total
+	for _, m := range markets {
+		if r < m.Weight {
+			return m
+		}
+		r -= m.Weight
+	}
+
+	return markets[len(markets)-1]
+}
+
+// after returns time of the next event of a Poisson process of the rate.
+func (g *Generator) after(perSecond float64) time.Time {
+	if perSecond <= 0 {
+		return g.now
+	}
+
+	return g.now.Add(time.Duration(g.rand.ExpFloat64() / perSecond * float64(time.Second)))
+}
+
+func (g *Generator) id() float64 {
+	g.nextID++
+
+	return g.nextID
+}
+
+// frame stamps the message with the current time, the message ID and the sequence number are advanced.
+func (g *Generator) frame(data []byte) websocket.Frame {
+	g.messageID++
+	g.seq++
+
+	return websocket.Frame{Time: g.now, Data: data}
+}
+
+// mantissa returns mantissa of the value rounded to the decimals.
+func mantissa(v float64, decimals uint8) float64 {
+	return math.Round(v * math.Pow10(int(decimals)))
+}
@@ -0,0 +1,97 @@
+package synth
+
+import (
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/order"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+func TestFramesDecode(t *testing.T) {
+	start := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	g := NewGenerator(WithStart(start), WithDepth(10), WithTradeRate(5), WithBookRate(50))
+	reader := trade.Reader{Instruments: trade.NewInstruments(CurrencyCodes(DefaultMarkets()), nil, nil)}
+	books := make(map[float64]monitor.OrderBook)
+
+	frames := g.Resets()
+	for i := 0; i < 5000; i++ {
+		frames = append(frames, g.Next())
+	}
+
+	var trades int
+	for n, f := range frames {
+		rc := binary.ReadCursor{Data: f.Data}
+		mtype := rc.ReadUint8()
+		rc.ReadUint32() // message_id
+		rc.ReadUint16() // seq_number
+		viewID := rc.ReadFloat64()
+
+		switch {
+		case viewID == wsTradeViewID:
+			rc.ReadFloat64() // page_id
+			rc.ReadUint8()   // first_index nullable check
+			if count := rc.ReadUint16(); count != 2 {
+				t.Fatalf("frame %d: got trade count %d, want 2", n, count)
+			}
+			rc.ReadUint8() // insert
+			if number := rc.ReadUint16(); number != wsTimeSalesChange {
+				t.Fatalf("frame %d: got number %d, want %d", n, number, wsTimeSalesChange)
+			}
+			rc.ReadUint16() // length
+
+			tr := reader.ReadNullableTrade(&rc)
+			if tr.ID == 0 || tr.Price.Sign() <= 0 || tr.Quantity.Sign() <= 0 {
+				t.Fatalf("frame %d: got invalid trade %+v", n, tr)
+			}
+			if want := f.Time.Truncate(time.Second); !tr.Timestamp.Equal(want) {
+				t.Fatalf("frame %d: got trade time %v, want %v", n, tr.Timestamp, want)
+			}
+			if tr.CurrencyPair != "BTC-PHP" && tr.CurrencyPair != "ETH-PHP" && tr.CurrencyPair != "USDT-PHP" {
+				t.Fatalf("frame %d: got trade of %s", n, tr.CurrencyPair)
+			}
+			trades++
+		case mtype == wsPageReset:
+			book, err := order.ReadOrderBook(&rc)
+			if err != nil {
+				t.Fatalf("frame %d: %v", n, err)
+			}
+			books[viewID] = book
+		default:
+			updates, err := order.ReadOrderBookUpdate(&rc)
+			if err != nil {
+				t.Fatalf("frame %d: %v", n, err)
+			}
+			for _, u := range updates {
+				if err := books[viewID].Apply(u); err != nil {
+					t.Fatalf("frame %d: %v", n, err)
+				}
+			}
+		}
+
+		if rc.CurPos != uint(len(f.Data)) {
+			t.Fatalf("frame %d: read %d bytes of %d", n, rc.CurPos, len(f.Data))
+		}
+	}
+	if trades == 0 {
+		t.Fatal("no trades generated")
+	}
+
+	for _, m := range g.books {
+		orders := books[m.ViewID].Orders()
+		if len(orders) != len(m.orders) {
+			t.Fatalf("view %v: got %d orders, want %d", m.ViewID, len(orders), len(m.orders))
+		}
+		for i, o := range orders {
+			want := m.orders[i]
+			price := binary.Decimal(want.price, m.Instrument.PriceDecimals)
+			quantity := binary.Decimal(want.quantity, m.Instrument.QuantityDecimals)
+			if o.Side != want.side || o.Price.Cmp(price) != 0 || o.Quantity.Cmp(quantity) != 0 {
+				t.Fatalf("view %v order %d: got %s %s side %d, want %s %s side %d", m.ViewID, i,
+					o.Price, o.Quantity, o.Side, price, quantity, want.side)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package trade
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// LoadCurrencyCodes reads PDAX instrument IDs to currency codes map under "currencyCodes" key of JSON or YAML file.
+// Empty map is returned when the file doesn't exist.
+func LoadCurrencyCodes(path string) (map[int]string, error) {
+	currencyCodes := make(map[int]string)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return currencyCodes, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return currencyCodes, fmt.Errorf("failed to read currency codes file: %v", err)
+	}
+
+	for key, value := range v.GetStringMapString("currencyCodes") {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			return currencyCodes, fmt.Errorf("invalid currency code ID %q: %v", key, err)
+		}
+		currencyCodes[id] = value
+	}
+
+	return currencyCodes, nil
+}
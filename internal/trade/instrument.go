@@ -0,0 +1,251 @@
+package trade
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+const (
+	// fallbackQuote is quote currency of instruments known from currency codes file only, PDAX listed PHP pairs only then.
+	fallbackQuote = "PHP"
+	// unknownBase is base currency of instruments which are neither announced by PDAX nor listed in currency codes file.
+	unknownBase = "UNKNOWN"
+)
+
+// Instrument is PDAX InstrumentMarket, a traded currency pair.
+type Instrument struct {
+	ID               int
+	Base             string
+	Quote            string
+	PriceDecimals    uint8
+	QuantityDecimals uint8
+}
+
+// Pair returns currency pair name, e.g. BTC-PHP.
+func (i Instrument) Pair() string {
+	return i.Base + "-" + i.Quote
+}
+
+// ReadInstrument used to parse InstrumentMarket row of the instrument reference view from byte stream.
+func ReadInstrument(rc *binary.ReadCursor) Instrument {
+	rc.ReadFloat64()              // index
+	id := rc.ReadFloat64()        // ID
+	rc.ReadString()               // Symbol, e.g. BTCPHP
+	base := rc.ReadString()       // BaseCurrency
+	quote := rc.ReadString()      // QuoteCurrency
+	priceDec := rc.ReadUint8()    // PriceDecimals
+	quantityDec := rc.ReadUint8() // QuantityDecimals
+	rc.ReadUint8()                // Status
+
+	return Instrument{
+		ID:               int(id),
+		Base:             base,
+		Quote:            quote,
+		PriceDecimals:    priceDec,
+		QuantityDecimals: quantityDec,
+	}
+}
+
+// Instruments maps PDAX instrument IDs to currency pairs. Instruments announced by PDAX instrument feed take
+// precedence over currency codes file which is kept as a fallback. It's safe for concurrent use.
+type Instruments struct {
+	mu       sync.RWMutex
+	feed     map[int]Instrument
+	fallback map[int]string
+	// pairs are interned pair names of known instruments, so looking them up for every trade allocates nothing.
+	pairs map[int]string
+	// unknown are pair names of unknown instruments, they are logged once.
+	unknown map[int]string
+	logger  log.Logger
+	metrics *instrumentMetrics
+}
+
+// NewInstruments instantiates Instruments falling back to currency codes (instrument ID to base currency).
+// Unknown instruments are not measured when metrics registerer is nil.
+func NewInstruments(currencyCodes map[int]string, logger log.Logger, registerer prometheus.Registerer) *Instruments {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	instruments := Instruments{
+		feed:     make(map[int]Instrument),
+		fallback: currencyCodes,
+		unknown:  make(map[int]string),
+		logger:   logger,
+	}
+	if registerer != nil {
+		instruments.metrics = newInstrumentMetrics(registerer)
+	}
+	instruments.internPairs()
+
+	return &instruments
+}
+
+// Set stores the instrument announced by PDAX.
+func (s *Instruments) Set(i Instrument) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.feed[i.ID]; !ok || old != i {
+		level.Info(s.logger).Log("msg", "pdax instrument discovered", "id", i.ID, "pair", i.Pair(),
+			"priceDecimals", i.PriceDecimals, "quantityDecimals", i.QuantityDecimals)
+		s.pairs[i.ID] = i.Pair()
+	}
+	s.feed[i.ID] = i
+	delete(s.unknown, i.ID)
+	s.metrics.observeDiscovered(len(s.feed))
+}
+
+// SetFallback replaces currency codes (instrument ID to base currency) used for instruments not announced by PDAX.
+func (s *Instruments) SetFallback(currencyCodes map[int]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallback = currencyCodes
+	for id := range currencyCodes {
+		delete(s.unknown, id)
+	}
+	s.internPairs()
+}
+
+// internPairs names pairs of all known instruments, it must be called with the lock held.
+func (s *Instruments) internPairs() {
+	s.pairs = make(map[int]string, len(s.feed)+len(s.fallback))
+	for id, base := range s.fallback {
+		s.pairs[id] = Instrument{ID: id, Base: base, Quote: fallbackQuote}.Pair()
+	}
+	for id, i := range s.feed {
+		s.pairs[id] = i.Pair()
+	}
+}
+
+// Get returns the instrument, instruments of currency codes file are assumed to be quoted in PHP.
+func (s *Instruments) Get(id int) (Instrument, bool) {
+	if s == nil {
+		return Instrument{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i, ok := s.feed[id]; ok {
+		return i, true
+	}
+	if base, ok := s.fallback[id]; ok {
+		return Instrument{ID: id, Base: base, Quote: fallbackQuote}, true
+	}
+
+	return Instrument{}, false
+}
+
+// Pair returns currency pair name of the instrument. Unknown instruments are logged once and counted
+// every time, their pairs are named UNKNOWN-<id> to keep them apart.
+func (s *Instruments) Pair(id int) string {
+	if s == nil {
+		return unknownPair(id)
+	}
+
+	s.mu.RLock()
+	pair, ok := s.pairs[id]
+	s.mu.RUnlock()
+	if ok {
+		return pair
+	}
+
+	s.mu.Lock()
+	if pair, ok = s.unknown[id]; !ok {
+		pair = unknownPair(id)
+		s.unknown[id] = pair
+		level.Warn(s.logger).Log("msg", "unknown pdax instrument", "id", id)
+	}
+	s.mu.Unlock()
+	s.metrics.observeUnknown()
+
+	return pair
+}
+
+func unknownPair(id int) string {
+	return unknownBase + "-" + strconv.Itoa(id)
+}
+
+// All returns known instruments ordered by ID, instruments of currency codes file are assumed to be quoted in PHP.
+func (s *Instruments) All() []Instrument {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make([]Instrument, 0, len(s.feed)+len(s.fallback))
+	for _, i := range s.feed {
+		all = append(all, i)
+	}
+	for id, base := range s.fallback {
+		if _, ok := s.feed[id]; !ok {
+			all = append(all, Instrument{ID: id, Base: base, Quote: fallbackQuote})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].ID < all[j].ID
+	})
+
+	return all
+}
+
+// Len returns number of instruments announced by PDAX.
+func (s *Instruments) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.feed)
+}
+
+// instrumentMetrics records instrument discovery.
+// Methods are safe to call on nil metrics which records nothing.
+type instrumentMetrics struct {
+	discovered prometheus.Gauge
+	unknown    prometheus.Counter
+}
+
+func newInstrumentMetrics(registerer prometheus.Registerer) *instrumentMetrics {
+	m := instrumentMetrics{
+		discovered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pdax_instruments_discovered",
+			Help: "Number of instruments announced by PDAX instrument feed.",
+		}),
+		unknown: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pdax_unknown_instrument_lookups_total",
+			Help: "Lookups of instruments which are neither announced by PDAX nor listed in currency codes file.",
+		}),
+	}
+	registerer.MustRegister(m.discovered, m.unknown)
+
+	return &m
+}
+
+func (m *instrumentMetrics) observeDiscovered(n int) {
+	if m == nil {
+		return
+	}
+
+	m.discovered.Set(float64(n))
+}
+
+func (m *instrumentMetrics) observeUnknown() {
+	if m == nil {
+		return
+	}
+
+	m.unknown.Inc()
+}
@@ -0,0 +1,157 @@
+package trade_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+func TestReadInstrument(t *testing.T) {
+	want := trade.Instrument{ID: 167, Base: "BTC", Quote: "USDT", PriceDecimals: 2, QuantityDecimals: 8}
+	wc := binary.WriteCursor{Data: make([]byte, 64)}
+	wc.WriteFloat64(3) // index
+	wc.WriteFloat64(float64(want.ID))
+	wc.WriteString("BTCUSDT")
+	wc.WriteString(want.Base)
+	wc.WriteString(want.Quote)
+	wc.WriteUint8(want.PriceDecimals)
+	wc.WriteUint8(want.QuantityDecimals)
+	wc.WriteUint8(1) // Status
+	end := wc.CurPos
+
+	rc := binary.ReadCursor{Data: wc.Data}
+	if got := trade.ReadInstrument(&rc); got != want {
+		t.Errorf("ReadInstrument() = %+v, want %+v", got, want)
+	}
+	if rc.CurPos != end || rc.Overflowed() {
+		t.Errorf("cursor at %d (overflowed %v) after the instrument, want at %d", rc.CurPos, rc.Overflowed(), end)
+	}
+
+	rc = binary.ReadCursor{Data: wc.Data[:end-1]}
+	trade.ReadInstrument(&rc)
+	if !rc.Overflowed() {
+		t.Error("Overflowed() = false after reading a truncated instrument")
+	}
+}
+
+func TestInstrumentsFeedTakesPrecedence(t *testing.T) {
+	instruments := trade.NewInstruments(map[int]string{167: "BTC", 168: "ETH"}, nil, nil)
+	btc := trade.Instrument{ID: 167, Base: "BTC", Quote: "USDT", PriceDecimals: 2, QuantityDecimals: 8}
+	instruments.Set(btc)
+
+	pairs := map[int]string{167: "BTC-USDT", 168: "ETH-PHP", 169: "UNKNOWN-169"}
+	assertPairs(t, instruments, pairs)
+	if got, ok := instruments.Get(167); !ok || got != btc {
+		t.Errorf("Get(167) = %+v, %v, want %+v", got, ok, btc)
+	}
+	if got := instruments.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+
+	instruments.SetFallback(map[int]string{167: "XBT", 169: "XRP"})
+	pairs = map[int]string{167: "BTC-USDT", 168: "UNKNOWN-168", 169: "XRP-PHP"}
+	assertPairs(t, instruments, pairs)
+
+	want := []trade.Instrument{btc, {ID: 169, Base: "XRP", Quote: "PHP"}}
+	if got := instruments.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %+v, want %+v", got, want)
+	}
+
+	renamed := btc
+	renamed.Quote = "PHP"
+	instruments.Set(renamed)
+	assertPairs(t, instruments, map[int]string{167: "BTC-PHP"})
+}
+
+func TestInstrumentsUnknown(t *testing.T) {
+	var logger recordLogger
+	registry := prometheus.NewRegistry()
+	instruments := trade.NewInstruments(map[int]string{167: "BTC"}, &logger, registry)
+
+	for i := 0; i < 3; i++ {
+		assertPairs(t, instruments, map[int]string{167: "BTC-PHP", 250: "UNKNOWN-250", 251: "UNKNOWN-251"})
+	}
+	if got := logger.count("unknown pdax instrument"); got != 2 {
+		t.Errorf("unknown instruments logged %d times, want once per instrument", got)
+	}
+	assertUnknownLookups(t, registry, 6)
+
+	instruments.Set(trade.Instrument{ID: 250, Base: "SOL", Quote: "PHP"})
+	instruments.SetFallback(map[int]string{167: "BTC", 251: "ADA"})
+	assertPairs(t, instruments, map[int]string{250: "SOL-PHP", 251: "ADA-PHP"})
+	assertUnknownLookups(t, registry, 6)
+
+	instruments.SetFallback(map[int]string{167: "BTC"})
+	assertPairs(t, instruments, map[int]string{251: "UNKNOWN-251"})
+	if got := logger.count("unknown pdax instrument"); got != 3 {
+		t.Errorf("unknown instruments logged %d times, want again once an instrument is forgotten", got)
+	}
+	assertUnknownLookups(t, registry, 7)
+
+	var missing *trade.Instruments
+	if got := missing.Pair(167); got != "UNKNOWN-167" {
+		t.Errorf("Pair() of nil instruments = %s, want UNKNOWN-167", got)
+	}
+}
+
+func assertPairs(t *testing.T, instruments *trade.Instruments, pairs map[int]string) {
+	t.Helper()
+
+	for id, want := range pairs {
+		if got := instruments.Pair(id); got != want {
+			t.Errorf("Pair(%d) = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func assertUnknownLookups(t *testing.T, registry *prometheus.Registry, want int) {
+	t.Helper()
+
+	expected := "# HELP pdax_unknown_instrument_lookups_total " +
+		"Lookups of instruments which are neither announced by PDAX nor listed in currency codes file.\n" +
+		"# TYPE pdax_unknown_instrument_lookups_total counter\n" +
+		"pdax_unknown_instrument_lookups_total " + strconv.Itoa(want) + "\n"
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "pdax_unknown_instrument_lookups_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+// recordLogger keeps messages of log records.
+type recordLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordLogger) Log(keyvals ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "msg" {
+			l.messages = append(l.messages, keyvals[i+1].(string))
+		}
+	}
+
+	return nil
+}
+
+func (l *recordLogger) count(msg string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, m := range l.messages {
+		if m == msg {
+			n++
+		}
+	}
+
+	return n
+}
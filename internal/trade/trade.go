@@ -2,6 +2,7 @@ package trade
 
 import (
 	"math"
+	"math/big"
 	"time"
 
 	"github.com/cockroachdb/apd"
@@ -11,45 +12,54 @@ import (
 
 // Reader represents trade object reader.
 type Reader struct {
-	CurrencyCodes map[int]string
+	Instruments *Instruments
 }
 
-// ReadTrade used to parse Trade object from byte stream.
-func (tr Reader) ReadTrade(rc *binary.ReadCursor) monitor.Trade {
+// Raw is a trade as it's encoded, its price and quantity are mantissas of their decimals. Raw trades are read
+// without allocations, decimals are constructed only once the trade is to be stored.
+type Raw struct {
+	ID               float64
+	CurrencyPair     string
+	Time             float64 // seconds since 2000-01-01, see DecodeTime
+	Price            float64
+	Quantity         float64
+	PriceDecimals    uint8
+	QuantityDecimals uint8
+	Side             uint8
+}
+
+// ReadRawTrade used to parse Trade object from byte stream without allocations.
+func (tr Reader) ReadRawTrade(rc *binary.ReadCursor) Raw {
+	var r Raw
 	rc.ReadFloat64()        // index
-	rc.ReadFloat64()        // ID
-	ts1 := rc.ReadFloat64() // timestamp 1 part
-	rc.ReadUint32()         // timestamp 2 part
-	rc.ReadUint8()          // InstrumentMarket nullable check
+	r.ID = rc.ReadFloat64() // ID
+	r.Time = rc.ReadFloat64()
+	rc.ReadUint32() // timestamp 2 part
+	rc.ReadUint8()  // InstrumentMarket nullable check
 
-	currency := rc.ReadFloat64() // InstrumentMarket (currency)
-	price := rc.ReadFloat64()    // Price
-	quantity := rc.ReadFloat64() // Quantity
+	r.CurrencyPair = tr.CurrencyPair(int(rc.ReadFloat64())) // InstrumentMarket (currency)
+	r.Price = rc.ReadFloat64()
+	r.Quantity = rc.ReadFloat64()
 
 	rc.ReadFloat64() // Value (for history fetching), Increment (for live fetching)
 	rc.ReadFloat64() // Increment (for history fetching), Value (for live fetching)
 
-	rc.ReadUint8()   // Aggressor
-	rc.ReadFloat64() // Swing
+	r.Side = rc.ReadUint8() // Aggressor
+	rc.ReadFloat64()        // Swing
 
-	priceDec := rc.ReadUint8()    // PriceDecimals
-	quantityDec := rc.ReadUint8() // QuantityDecimals, RC_after(111)
-	rc.ReadUint8()                // ValueDecimals
-	rc.ReadUint8()                // LeverageEvent
-	rc.ReadUint32()               // permissions
+	r.PriceDecimals = rc.ReadUint8()
+	r.QuantityDecimals = rc.ReadUint8() // RC_after(111)
+	rc.ReadUint8()                      // ValueDecimals
+	rc.ReadUint8()                      // LeverageEvent
+	rc.ReadUint32()                     // permissions
 
-	return monitor.Trade{
-		CurrencyPair: tr.CurrencyCodes[int(currency)] + "-PHP",
-		Price:        apd.New(int64(price), -int32(priceDec)),
-		Quantity:     apd.New(int64(quantity), -int32(quantityDec)),
-		Timestamp:    DecodeTime(ts1),
-	}
+	return r
 }
 
-// ReadNullableTrade used to parse nullable (for live monitoring) Trade object from byte stream.
-func (tr Reader) ReadNullableTrade(rc *binary.ReadCursor) monitor.Trade {
+// ReadNullableRawTrade used to parse nullable (for live monitoring) Trade object from byte stream without allocations.
+func (tr Reader) ReadNullableRawTrade(rc *binary.ReadCursor) Raw {
 	// Trade main part, order should be preserved
-	trade := tr.ReadTrade(rc)
+	r := tr.ReadRawTrade(rc)
 
 	// Trade second null part
 	rc.ReadUint8()   // update, nullable check
@@ -68,7 +78,95 @@ func (tr Reader) ReadNullableTrade(rc *binary.ReadCursor) monitor.Trade {
 	rc.ReadUint8()   // new_index, nullable check
 	rc.ReadUint8()   // animate
 
-	return trade
+	return r
+}
+
+// ReadTrade used to parse Trade object from byte stream.
+func (tr Reader) ReadTrade(rc *binary.ReadCursor) monitor.Trade {
+	return *tr.ReadRawTrade(rc).NewTrade()
+}
+
+// ReadNullableTrade used to parse nullable (for live monitoring) Trade object from byte stream.
+func (tr Reader) ReadNullableTrade(rc *binary.ReadCursor) monitor.Trade {
+	return *tr.ReadNullableRawTrade(rc).NewTrade()
+}
+
+// ReadTrades used to parse n Trade objects from byte stream appending them to the page, e.g. of trade history.
+// Decimals of all the trades share a single allocation.
+func (tr Reader) ReadTrades(rc *binary.ReadCursor, n int, page []monitor.Trade) []monitor.Trade {
+	block := make([]decimals, n)
+	for i := range block {
+		t := tr.ReadRawTrade(rc).trade(&block[i])
+		page = append(page, t)
+	}
+
+	return page
+}
+
+// CurrencyPair returns currency pair name of the PDAX instrument.
+func (tr Reader) CurrencyPair(instrument int) string {
+	return tr.Instruments.Pair(instrument)
+}
+
+// decimals holds price and quantity of a trade along with their coefficients, so they are allocated at once.
+type decimals struct {
+	price    apd.Decimal
+	quantity apd.Decimal
+	words    [2]big.Word
+}
+
+// decoded is a trade allocated at once with its decimals.
+type decoded struct {
+	trade monitor.Trade
+	decimals
+}
+
+// NewTrade constructs the trade, it's allocated at once with its price and quantity.
+func (r Raw) NewTrade() *monitor.Trade {
+	d := new(decoded)
+	d.trade = r.trade(&d.decimals)
+
+	return &d.trade
+}
+
+// trade constructs the trade whose price and quantity are the decimals.
+func (r Raw) trade(d *decimals) monitor.Trade {
+	return monitor.Trade{
+		ID:           int64(r.ID),
+		CurrencyPair: r.CurrencyPair,
+		Price:        setDecimal(&d.price, d.words[0:1:1], r.Price, r.PriceDecimals),
+		Quantity:     setDecimal(&d.quantity, d.words[1:2:2], r.Quantity, r.QuantityDecimals),
+		Timestamp:    DecodeTime(r.Time),
+		Side:         r.Side,
+	}
+}
+
+// setDecimal sets the decimal the way binary.Decimal constructs it, its coefficient is kept in the word
+// unless the mantissa doesn't fit it.
+func setDecimal(d *apd.Decimal, word []big.Word, mantissa float64, decimals uint8) *apd.Decimal {
+	m := int64(math.Round(mantissa))
+	d.Exponent = -int32(decimals)
+	if m < 0 {
+		d.Negative = true
+		m = -m
+	}
+	if uint64(m) > uint64(^big.Word(0)) { // words are 32 bits on 32-bit platforms
+		d.Coeff.SetInt64(m)
+		return d
+	}
+
+	word[0] = big.Word(m)
+	d.Coeff.SetBits(word)
+
+	return d
+}
+
+// timeEpoch is the time binary encoded timestamps count seconds from.
+var timeEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// EncodeTime encodes the time the way DecodeTime parses it, fractions of a second are dropped.
+func EncodeTime(t time.Time) float64 {
+	return math.Floor(t.Sub(timeEpoch).Seconds())
 }
 
 // DecodeTime is to parse binary encoded (not sure its standard, might be proprietary) timestamp.
@@ -0,0 +1,133 @@
+package trade_test
+
+import (
+	"testing"
+	"time"
+
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/synth"
+	"github.com/pudgydoge/pdax-monitor/internal/trade"
+	"github.com/pudgydoge/pdax-monitor/internal/websocket/binary"
+)
+
+// tradeOffset is the size of page update, page and change headers preceding the trade of generated frames.
+const tradeOffset = 31
+
+func TestRawNewTrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		mantissa float64
+		decimals uint8
+	}{
+		{"integer", 2500000, 0},
+		{"price", 123456, 2},
+		{"quantity", 12345678, 8},
+		{"trailing zeros kept", 1500, 3},
+		{"float noise", 123455.99999999999, 2},
+		{"zero", 0, 4},
+		{"negative", -42, 1},
+		{"largest exact", 1 << 53, 8},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := trade.Raw{Price: tc.mantissa, PriceDecimals: tc.decimals, Quantity: tc.mantissa, QuantityDecimals: tc.decimals}
+			got := r.NewTrade()
+			want := binary.Decimal(tc.mantissa, tc.decimals)
+			if got.Price.String() != want.String() || got.Price.Cmp(want) != 0 {
+				t.Errorf("Price = %s, want %s", got.Price, want)
+			}
+			if got.Quantity.String() != want.String() || got.Quantity.Cmp(want) != 0 {
+				t.Errorf("Quantity = %s, want %s", got.Quantity, want)
+			}
+		})
+	}
+}
+
+func TestReadRawTradeAllocs(t *testing.T) {
+	reader, frames := generate(1)
+	data := frames[0]
+
+	allocs := testing.AllocsPerRun(100, func() {
+		rc := binary.ReadCursor{CurPos: tradeOffset, Data: data}
+		reader.ReadNullableRawTrade(&rc)
+	})
+	if allocs != 0 {
+		t.Errorf("ReadNullableRawTrade() allocates %v times, want 0", allocs)
+	}
+
+	allocs = testing.AllocsPerRun(100, func() {
+		rc := binary.ReadCursor{CurPos: tradeOffset, Data: data}
+		reader.ReadNullableRawTrade(&rc).NewTrade()
+	})
+	if allocs != 1 {
+		t.Errorf("NewTrade() allocates %v times, want 1", allocs)
+	}
+}
+
+func BenchmarkReadNullableRawTrade(b *testing.B) {
+	reader, frames := generate(1024)
+	b.SetBytes(int64(len(frames[0]) - tradeOffset))
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rc := binary.ReadCursor{CurPos: tradeOffset, Data: frames[i%len(frames)]}
+		reader.ReadNullableRawTrade(&rc)
+	}
+}
+
+func BenchmarkReadNullableTrade(b *testing.B) {
+	reader, frames := generate(1024)
+	b.SetBytes(int64(len(frames[0]) - tradeOffset))
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rc := binary.ReadCursor{CurPos: tradeOffset, Data: frames[i%len(frames)]}
+		reader.ReadNullableTrade(&rc)
+	}
+}
+
+// BenchmarkReadTrades reads history pages of the default page size into a reused page.
+func BenchmarkReadTrades(b *testing.B) {
+	const pageSize = 1000
+	reader, frames := generate(pageSize)
+	var data []byte
+	for _, f := range frames {
+		// history pages hold trades without the nullable part
+		data = append(data, f[tradeOffset:tradeOffset+86]...)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	page := make([]monitor.Trade, 0, pageSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rc := binary.ReadCursor{Data: data}
+		page = reader.ReadTrades(&rc, pageSize, page[:0])
+	}
+}
+
+func BenchmarkInstrumentsPair(b *testing.B) {
+	instruments := trade.NewInstruments(synth.CurrencyCodes(synth.DefaultMarkets()), nil, nil)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		instruments.Pair(167)
+	}
+}
+
+// generate returns reader of generated trades and n frames of a trade each.
+func generate(n int) (trade.Reader, [][]byte) {
+	markets := synth.DefaultMarkets()
+	g := synth.NewGenerator(synth.WithMarkets(markets...), synth.WithStart(time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)),
+		synth.WithBookRate(0))
+
+	frames := make([][]byte, n)
+	for i := range frames {
+		frames[i] = g.Next().Data
+	}
+
+	return trade.Reader{Instruments: trade.NewInstruments(synth.CurrencyCodes(markets), nil, nil)}, frames
+}
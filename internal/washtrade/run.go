@@ -0,0 +1,31 @@
+package washtrade
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// Run scans trades of the pairs every bucket till the context is canceled. Every scan covers two buckets
+// before the current one, so patterns spanning bucket boundaries are found in full the next time and replace
+// what was found of them before.
+func (d *Detector) Run(ctx context.Context, pairs func() []string) error {
+	for {
+		next := time.Now().UTC().Truncate(d.bucket).Add(d.bucket)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		from := next.Add(-2 * d.bucket)
+		findings, err := d.Scan(ctx, pairs(), from, next)
+		if err != nil {
+			level.Error(d.logger).Log("msg", "wash trade scan failed", "from", from, "err", err)
+			continue
+		}
+		level.Info(d.logger).Log("msg", "wash trade scan finished", "from", from, "findings", len(findings))
+	}
+}
@@ -0,0 +1,386 @@
+// Package washtrade detects patterns of stored trades which suggest wash trading or self-matching and scores them
+// from 0 to 1. Findings are heuristics to review, not proof of manipulation.
+package washtrade
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/go-kit/log"
+	monitor "github.com/pudgydoge/pdax-monitor"
+)
+
+const (
+	defaultGap        = time.Minute
+	defaultMinRun     = 5
+	defaultBucket     = time.Hour
+	defaultMinCluster = 10
+	defaultRoundShare = 0.8
+	defaultBookLag    = 10 * time.Second
+	// minUnchanged is the least number of trades of a cluster which left top of book unchanged.
+	minUnchanged = 3
+)
+
+// Detector finds patterns of trades and stores them as findings.
+type Detector struct {
+	trades   monitor.TradeRepository
+	findings monitor.FindingRepository
+	// orders are read to tell whether trades left top of book unchanged, the pattern isn't detected without them.
+	orders monitor.OrderRepository
+	// gap is the longest time between trades of a burst or a ping-pong run.
+	gap time.Duration
+	// minRun is the least number of trades of a burst or a ping-pong run.
+	minRun int
+	// bucket is the time window of round number and unchanged top clusters, trades are scanned bucket by bucket.
+	bucket time.Duration
+	// minCluster is the least number of round quantity trades of a cluster.
+	minCluster int
+	// roundShare is the least share of round quantity trades within a bucket.
+	roundShare float64
+	// bookLag is the longest time after a trade the order book snapshot showing its effect can be taken.
+	bookLag time.Duration
+	logger  log.Logger
+}
+
+// NewDetector instantiates Detector reading trades from the trade repository and storing findings
+// into the finding repository.
+func NewDetector(trades monitor.TradeRepository, findings monitor.FindingRepository, options ...ConfigOption) *Detector {
+	d := Detector{
+		trades:     trades,
+		findings:   findings,
+		gap:        defaultGap,
+		minRun:     defaultMinRun,
+		bucket:     defaultBucket,
+		minCluster: defaultMinCluster,
+		roundShare: defaultRoundShare,
+		bookLag:    defaultBookLag,
+		logger:     log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&d)
+	}
+
+	return &d
+}
+
+// ConfigOption configures the detector.
+type ConfigOption func(*Detector)
+
+// WithLogger configures a logger to debug the detector.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(d *Detector) {
+		d.logger = l
+	}
+}
+
+// WithOrderRepository configures repository of order book snapshots taken around trades,
+// trades which leave top of book unchanged are detected only with it.
+func WithOrderRepository(rep monitor.OrderRepository) ConfigOption {
+	return func(d *Detector) {
+		d.orders = rep
+	}
+}
+
+// WithRun configures the least number of trades of a burst or a ping-pong run and the longest time between them.
+func WithRun(minTrades int, gap time.Duration) ConfigOption {
+	return func(d *Detector) {
+		if minTrades > 1 {
+			d.minRun = minTrades
+		}
+		if gap > 0 {
+			d.gap = gap
+		}
+	}
+}
+
+// WithBucket configures the time window of clusters, it's also how often Run scans trades.
+func WithBucket(bucket time.Duration) ConfigOption {
+	return func(d *Detector) {
+		if bucket > 0 {
+			d.bucket = bucket
+		}
+	}
+}
+
+// WithRoundCluster configures the least number and share of round quantity trades within a bucket.
+func WithRoundCluster(minTrades int, share float64) ConfigOption {
+	return func(d *Detector) {
+		if minTrades > 0 {
+			d.minCluster = minTrades
+		}
+		if share > 0 && share <= 1 {
+			d.roundShare = share
+		}
+	}
+}
+
+// Scan detects patterns of trades of the pairs which start within the time range and stores the findings.
+// Trades made up to the run gap before the range are read too, so a run is found from its first trade
+// whichever range it's scanned in. Findings are keyed by their start, so overlapping scans replace them
+// rather than add partial duplicates.
+func (d *Detector) Scan(ctx context.Context, pairs []string, from, to time.Time) ([]monitor.Finding, error) {
+	var findings []monitor.Finding
+	for _, pair := range pairs {
+		trades, err := d.trades.Trades(ctx, monitor.TradeQuery{CurrencyPair: pair, From: from.Add(-d.gap), To: to})
+		if err != nil {
+			return findings, fmt.Errorf("failed to read %s trades: %v", pair, err)
+		}
+
+		found, err := d.Detect(ctx, trades)
+		if err != nil {
+			return findings, fmt.Errorf("failed to detect %s patterns: %v", pair, err)
+		}
+		found = startingFrom(found, from)
+		if err = d.findings.Upsert(ctx, found); err != nil {
+			return findings, fmt.Errorf("failed to store %s findings: %v", pair, err)
+		}
+		findings = append(findings, found...)
+	}
+
+	return findings, nil
+}
+
+// startingFrom filters the findings which start at the time or later in place.
+func startingFrom(findings []monitor.Finding, from time.Time) []monitor.Finding {
+	kept := findings[:0]
+	for _, f := range findings {
+		if !f.From.Before(from) {
+			kept = append(kept, f)
+		}
+	}
+
+	return kept
+}
+
+// Detect finds patterns of trades of a currency pair ordered by time.
+func (d *Detector) Detect(ctx context.Context, trades []monitor.Trade) ([]monitor.Finding, error) {
+	findings := d.equalSizeBursts(trades)
+	findings = append(findings, d.pingPongs(trades)...)
+	findings = append(findings, d.roundClusters(trades)...)
+
+	unchanged, err := d.unchangedTops(ctx, trades)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, unchanged...)
+	monitor.SortFindings(findings)
+
+	return findings, nil
+}
+
+// equalSizeBursts finds runs of trades of the same quantity at the same price.
+func (d *Detector) equalSizeBursts(trades []monitor.Trade) []monitor.Finding {
+	return d.runs(trades, monitor.PatternEqualSizeBurst, func(prev, t monitor.Trade) bool {
+		return t.Price.Cmp(prev.Price) == 0
+	}, func(run []monitor.Trade) string {
+		return fmt.Sprintf("%d trades of %s at %s", len(run), run[0].Quantity.Text('f'), run[0].Price.Text('f'))
+	})
+}
+
+// pingPongs finds runs of trades of the same quantity whose aggressor side alternates,
+// i.e. two parties taking turns to hit each other's orders.
+func (d *Detector) pingPongs(trades []monitor.Trade) []monitor.Finding {
+	return d.runs(trades, monitor.PatternPingPong, func(prev, t monitor.Trade) bool {
+		return t.Side != prev.Side
+	}, func(run []monitor.Trade) string {
+		return fmt.Sprintf("%d trades of %s alternating aggressor side", len(run), run[0].Quantity.Text('f'))
+	})
+}
+
+// runs finds runs of trades of the same quantity made within the gap of each other whose consecutive
+// trades match. The score grows with the run length, it's 1 for runs twice as long as the shortest one.
+func (d *Detector) runs(trades []monitor.Trade, pattern string, match func(prev, t monitor.Trade) bool,
+	detail func(run []monitor.Trade) string) []monitor.Finding {
+	var findings []monitor.Finding
+	flush := func(run []monitor.Trade) {
+		if len(run) < d.minRun {
+			return
+		}
+
+		f := newFinding(pattern, run)
+		f.Score = math.Min(1, float64(len(run))/float64(2*d.minRun))
+		f.Detail = detail(run)
+		findings = append(findings, f)
+	}
+
+	start := 0
+	for i := 1; i <= len(trades); i++ {
+		if i < len(trades) {
+			prev, t := trades[i-1], trades[i]
+			if t.Timestamp.Sub(prev.Timestamp) <= d.gap && t.Quantity.Cmp(prev.Quantity) == 0 && match(prev, t) {
+				continue
+			}
+		}
+		flush(trades[start:i])
+		start = i
+	}
+
+	return findings
+}
+
+// roundClusters finds buckets where most trades are of round quantities. The score is the share of them.
+func (d *Detector) roundClusters(trades []monitor.Trade) []monitor.Finding {
+	var findings []monitor.Finding
+	d.buckets(trades, func(start time.Time, bucket []monitor.Trade) {
+		var round []monitor.Trade
+		for _, t := range bucket {
+			if isRound(t.Quantity) {
+				round = append(round, t)
+			}
+		}
+
+		share := float64(len(round)) / float64(len(bucket))
+		if len(round) < d.minCluster || share < d.roundShare {
+			return
+		}
+
+		f := newFinding(monitor.PatternRoundNumbers, round)
+		f.From = start
+		f.Score = share
+		f.Detail = fmt.Sprintf("%d of %d trades of round quantities", len(round), len(bucket))
+		findings = append(findings, f)
+	})
+
+	return findings
+}
+
+// unchangedTops finds buckets with trades after which the best bid and ask stayed the same, i.e. trades
+// which consumed no visible liquidity. Trades without snapshots taken just before and after them are skipped.
+// The score is the share of such trades among the checked ones.
+func (d *Detector) unchangedTops(ctx context.Context, trades []monitor.Trade) ([]monitor.Finding, error) {
+	if d.orders == nil {
+		return nil, nil
+	}
+
+	var findings []monitor.Finding
+	var err error
+	d.buckets(trades, func(start time.Time, bucket []monitor.Trade) {
+		if err != nil {
+			return
+		}
+
+		var unchanged []monitor.Trade
+		checked := 0
+		for _, t := range bucket {
+			var same, ok bool
+			if same, ok, err = d.topUnchanged(ctx, t); err != nil {
+				return
+			}
+			if !ok {
+				continue
+			}
+			checked++
+			if same {
+				unchanged = append(unchanged, t)
+			}
+		}
+		if len(unchanged) < minUnchanged {
+			return
+		}
+
+		f := newFinding(monitor.PatternUnchangedTop, unchanged)
+		f.From = start
+		f.Score = float64(len(unchanged)) / float64(checked)
+		f.Detail = fmt.Sprintf("%d of %d checked trades left top of book unchanged", len(unchanged), checked)
+		findings = append(findings, f)
+	})
+
+	return findings, err
+}
+
+// topUnchanged compares top of book before the trade and after it, ok is false when snapshots are missing.
+func (d *Detector) topUnchanged(ctx context.Context, t monitor.Trade) (same, ok bool, err error) {
+	before, err := d.orders.BookAt(ctx, t.CurrencyPair, t.Timestamp)
+	if monitor.ErrorCode(err) == monitor.ErrorCodeNotFound {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	after, err := d.orders.BookAt(ctx, t.CurrencyPair, t.Timestamp.Add(d.bookLag))
+	if err != nil {
+		return false, false, err
+	}
+	if !after.Timestamp.After(t.Timestamp) {
+		return false, false, nil
+	}
+
+	return sameTop(before.Levels, after.Levels), true, nil
+}
+
+// sameTop tells whether the best bids and asks of the levels are the same, levels are ordered as repositories
+// return them.
+func sameTop(a, b []monitor.BookLevel) bool {
+	for _, side := range []uint8{monitor.SideBid, monitor.SideAsk} {
+		la, okA := best(a, side)
+		lb, okB := best(b, side)
+		if okA != okB {
+			return false
+		}
+		if okA && (la.Price.Cmp(lb.Price) != 0 || la.Quantity.Cmp(lb.Quantity) != 0 || la.Orders != lb.Orders) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func best(levels []monitor.BookLevel, side uint8) (monitor.BookLevel, bool) {
+	for _, l := range levels {
+		if l.Side == side {
+			return l, true
+		}
+	}
+
+	return monitor.BookLevel{}, false
+}
+
+// buckets calls fn with trades of every bucket, buckets without trades are skipped.
+func (d *Detector) buckets(trades []monitor.Trade, fn func(start time.Time, bucket []monitor.Trade)) {
+	first := 0
+	for i := 1; i <= len(trades); i++ {
+		start := trades[first].Timestamp.UTC().Truncate(d.bucket)
+		if i < len(trades) && trades[i].Timestamp.UTC().Truncate(d.bucket).Equal(start) {
+			continue
+		}
+		fn(start, trades[first:i])
+		first = i
+	}
+}
+
+// newFinding summarizes the trades of the pattern.
+func newFinding(pattern string, trades []monitor.Trade) monitor.Finding {
+	f := monitor.Finding{
+		CurrencyPair: trades[0].CurrencyPair,
+		Pattern:      pattern,
+		From:         trades[0].Timestamp,
+		To:           trades[len(trades)-1].Timestamp,
+		Trades:       len(trades),
+		Volume:       new(apd.Decimal),
+	}
+
+	ctx := apd.BaseContext.WithPrecision(34)
+	for _, t := range trades {
+		ctx.Add(f.Volume, f.Volume, t.Quantity)
+	}
+
+	return f
+}
+
+// isRound tells whether the quantity has a single significant digit, e.g. 0.3 or 2000,
+// or two significant digits ending with 5, e.g. 0.25 or 150.
+func isRound(d *apd.Decimal) bool {
+	if d.Sign() <= 0 {
+		return false
+	}
+
+	var reduced apd.Decimal
+	reduced.Reduce(d)
+	digits := reduced.Coeff.String()
+
+	return len(digits) == 1 || len(digits) == 2 && digits[1] == '5'
+}
@@ -0,0 +1,256 @@
+package washtrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	monitor "github.com/pudgydoge/pdax-monitor"
+	"github.com/pudgydoge/pdax-monitor/internal/memory"
+)
+
+var t0 = time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func TestRuns(t *testing.T) {
+	tests := []struct {
+		name       string
+		trades     []monitor.Trade
+		wantTrades []int
+		wantScore  []float64
+	}{
+		{"too short", tradesEvery(4, 10*time.Second, "1", "100"), nil, nil},
+		{"shortest", tradesEvery(5, 10*time.Second, "1", "100"), []int{5}, []float64{0.5}},
+		{"twice the shortest", tradesEvery(10, 10*time.Second, "1", "100"), []int{10}, []float64{1}},
+		{"longer", tradesEvery(12, 10*time.Second, "1", "100"), []int{12}, []float64{1}},
+		{"trades over the gap", tradesEvery(6, 2*time.Minute, "1", "100"), nil, nil},
+		{"broken by quantity", append(tradesEvery(5, 10*time.Second, "1", "100"),
+			trade(t0.Add(50*time.Second), "2", "100", monitor.SideBid),
+			trade(t0.Add(60*time.Second), "2", "100", monitor.SideBid)), []int{5}, []float64{0.5}},
+		{"broken by price", append(tradesEvery(3, 10*time.Second, "1", "100"),
+			tradesAt(t0.Add(30*time.Second), 5, 10*time.Second, "1", "101")...), []int{5}, []float64{0.5}},
+		{"two runs", append(tradesEvery(5, 10*time.Second, "1", "100"),
+			tradesAt(t0.Add(time.Hour), 6, 10*time.Second, "1", "100")...), []int{5, 6}, []float64{0.5, 0.6}},
+		{"equal quantity of decimals", []monitor.Trade{
+			trade(t0, "1.50", "100", monitor.SideBid),
+			trade(t0.Add(time.Second), "1.5", "100", monitor.SideBid),
+			trade(t0.Add(2*time.Second), "1.500", "100.0", monitor.SideBid),
+			trade(t0.Add(3*time.Second), "1.5", "100", monitor.SideBid),
+			trade(t0.Add(4*time.Second), "1.5", "100", monitor.SideBid),
+		}, []int{5}, []float64{0.5}},
+		{"no trades", nil, nil, nil},
+	}
+
+	d := NewDetector(nil, nil)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			findings := d.equalSizeBursts(tc.trades)
+			if len(findings) != len(tc.wantTrades) {
+				t.Fatalf("got %d findings %+v, want %d", len(findings), findings, len(tc.wantTrades))
+			}
+			for i, f := range findings {
+				if f.Pattern != monitor.PatternEqualSizeBurst || f.Trades != tc.wantTrades[i] || f.Score != tc.wantScore[i] {
+					t.Errorf("finding %d = %s of %d trades scored %v, want %d trades scored %v",
+						i, f.Pattern, f.Trades, f.Score, tc.wantTrades[i], tc.wantScore[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPingPongs(t *testing.T) {
+	alternating := tradesEvery(6, 10*time.Second, "0.5", "100")
+	for i := range alternating {
+		alternating[i].Side = uint8(i % 2)
+		alternating[i].Price = decimal([]string{"100", "101"}[i%2])
+	}
+
+	d := NewDetector(nil, nil)
+	findings := d.pingPongs(alternating)
+	if len(findings) != 1 || findings[0].Trades != 6 || findings[0].Volume.Cmp(decimal("3")) != 0 {
+		t.Fatalf("got ping-pong findings %+v, want a run of 6 trades of volume 3", findings)
+	}
+	if got := d.pingPongs(tradesEvery(6, 10*time.Second, "0.5", "100")); len(got) != 0 {
+		t.Errorf("got ping-pong findings %+v of trades of the same side", got)
+	}
+}
+
+func TestIsRound(t *testing.T) {
+	tests := []struct {
+		quantity string
+		want     bool
+	}{
+		{"1", true},
+		{"0.3", true},
+		{"2000", true},
+		{"2E+3", true},
+		{"0.30000", true},
+		{"0.25", true},
+		{"150", true},
+		{"0.015", true},
+		{"0.35", true},
+		{"0.24", false},
+		{"151", false},
+		{"0.125", false},
+		{"1.0001", false},
+		{"0", false},
+		{"-1", false},
+	}
+
+	for _, tc := range tests {
+		if got := isRound(decimal(tc.quantity)); got != tc.want {
+			t.Errorf("isRound(%s) = %v, want %v", tc.quantity, got, tc.want)
+		}
+	}
+}
+
+func TestRoundClusters(t *testing.T) {
+	round := func(n int, start time.Time) []monitor.Trade {
+		return tradesAt(start, n, time.Minute, "0.5", "100")
+	}
+	odd := func(n int, start time.Time) []monitor.Trade {
+		return tradesAt(start, n, time.Minute, "0.123", "100")
+	}
+
+	tests := []struct {
+		name      string
+		trades    []monitor.Trade
+		wantFrom  []time.Time
+		wantScore []float64
+	}{
+		{"all round", round(10, t0.Add(time.Minute)), []time.Time{t0}, []float64{1}},
+		{"too few round", round(9, t0), nil, nil},
+		{"share over threshold", append(round(12, t0), odd(3, t0.Add(30*time.Minute))...), []time.Time{t0}, []float64{0.8}},
+		{"share under threshold", append(round(12, t0), odd(4, t0.Add(30*time.Minute))...), nil, nil},
+		{"bucket by bucket", append(round(10, t0), append(odd(10, t0.Add(time.Hour)), round(10, t0.Add(2*time.Hour))...)...),
+			[]time.Time{t0, t0.Add(2 * time.Hour)}, []float64{1, 1}},
+		{"split by bucket boundary", round(10, t0.Add(55*time.Minute)), nil, nil},
+	}
+
+	d := NewDetector(nil, nil)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sortByTime(tc.trades)
+			findings := d.roundClusters(tc.trades)
+			if len(findings) != len(tc.wantFrom) {
+				t.Fatalf("got %d findings %+v, want %d", len(findings), findings, len(tc.wantFrom))
+			}
+			for i, f := range findings {
+				if !f.From.Equal(tc.wantFrom[i]) || f.Score != tc.wantScore[i] {
+					t.Errorf("finding %d from %v scored %v, want from %v scored %v", i, f.From, f.Score, tc.wantFrom[i], tc.wantScore[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSameTop(t *testing.T) {
+	book := []monitor.BookLevel{
+		bookLevel(monitor.SideBid, "100", "1", 1),
+		bookLevel(monitor.SideBid, "99", "2", 1),
+		bookLevel(monitor.SideAsk, "101", "1", 2),
+		bookLevel(monitor.SideAsk, "102", "3", 1),
+	}
+	with := func(i int, l monitor.BookLevel) []monitor.BookLevel {
+		changed := append([]monitor.BookLevel(nil), book...)
+		changed[i] = l
+		return changed
+	}
+
+	tests := []struct {
+		name string
+		a, b []monitor.BookLevel
+		want bool
+	}{
+		{"same", book, book, true},
+		{"same value of other scale", book, with(0, bookLevel(monitor.SideBid, "100.00", "1.0", 1)), true},
+		{"deeper level changed", book, with(1, bookLevel(monitor.SideBid, "99", "5", 1)), true},
+		{"bid price", book, with(0, bookLevel(monitor.SideBid, "100.5", "1", 1)), false},
+		{"bid quantity", book, with(0, bookLevel(monitor.SideBid, "100", "0.5", 1)), false},
+		{"ask orders", book, with(2, bookLevel(monitor.SideAsk, "101", "1", 1)), false},
+		{"side emptied", book, book[:2], false},
+		{"both empty", nil, nil, true},
+	}
+
+	for _, tc := range tests {
+		if got := sameTop(tc.a, tc.b); got != tc.want {
+			t.Errorf("%s: sameTop() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScanOverlappingWindows(t *testing.T) {
+	s := memory.NewStorage()
+	// a burst of 12 trades crossing 11:00, every scan of two hourly buckets sees a part or all of it
+	burst := tradesAt(t0.Add(59*time.Minute), 12, 10*time.Second, "1", "100")
+	for i := range burst {
+		if err := s.TradeRepository().Insert(context.Background(), &burst[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := NewDetector(s.TradeRepository(), s.FindingRepository())
+	for _, from := range []time.Time{t0.Add(-time.Hour), t0, t0.Add(time.Hour)} {
+		if _, err := d.Scan(context.Background(), []string{"BTC-PHP"}, from, from.Add(2*time.Hour)); err != nil {
+			t.Fatalf("Scan(%v) error = %v", from, err)
+		}
+	}
+
+	findings, err := s.FindingRepository().Findings(context.Background(), monitor.FindingQuery{
+		Pattern: monitor.PatternEqualSizeBurst,
+		From:    t0.Add(-time.Hour),
+		To:      t0.Add(3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Findings() error = %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("got %d findings %+v, want the burst found once", len(findings), findings)
+	}
+	if f := findings[0]; !f.From.Equal(burst[0].Timestamp) || f.Trades != 12 {
+		t.Errorf("got finding from %v of %d trades, want from %v of 12 trades", f.From, f.Trades, burst[0].Timestamp)
+	}
+}
+
+func tradesEvery(n int, every time.Duration, quantity, price string) []monitor.Trade {
+	return tradesAt(t0, n, every, quantity, price)
+}
+
+func tradesAt(start time.Time, n int, every time.Duration, quantity, price string) []monitor.Trade {
+	trades := make([]monitor.Trade, n)
+	for i := range trades {
+		trades[i] = trade(start.Add(time.Duration(i)*every), quantity, price, monitor.SideBid)
+	}
+	return trades
+}
+
+func trade(ts time.Time, quantity, price string, side uint8) monitor.Trade {
+	return monitor.Trade{
+		ID:           ts.Unix(),
+		CurrencyPair: "BTC-PHP",
+		Price:        decimal(price),
+		Quantity:     decimal(quantity),
+		Timestamp:    ts,
+		Side:         side,
+	}
+}
+
+func bookLevel(side uint8, price, quantity string, orders int) monitor.BookLevel {
+	return monitor.BookLevel{Side: side, Price: decimal(price), Quantity: decimal(quantity), Orders: orders}
+}
+
+func sortByTime(trades []monitor.Trade) {
+	for i := 1; i < len(trades); i++ {
+		for j := i; j > 0 && trades[j].Timestamp.Before(trades[j-1].Timestamp); j-- {
+			trades[j], trades[j-1] = trades[j-1], trades[j]
+		}
+	}
+}
+
+func decimal(s string) *apd.Decimal {
+	d, _, err := apd.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
@@ -6,59 +6,86 @@ import (
 )
 
 // ReadCursor represents pointer to byte array with ability to read arbitrary data types.
+// Reads past the end of Data return zero values and mark the cursor overflowed.
 type ReadCursor struct {
 	CurPos uint // byte position
 	Data   []byte
+
+	overflowed bool
+}
+
+// Overflowed reports whether any read went past the end of Data, i.e. the message is truncated
+// or decoded with a wrong layout.
+func (rc *ReadCursor) Overflowed() bool {
+	return rc.overflowed
 }
 
 // ReadUint8 used to read uint8.
 func (rc *ReadCursor) ReadUint8() uint8 {
-	defer func() {
-		rc.CurPos++
-	}()
+	if !rc.next(1) {
+		return 0
+	}
 
-	return rc.Data[rc.CurPos]
+	return rc.Data[rc.CurPos-1]
 }
 
 // ReadUint32 used to read uint32.
 func (rc *ReadCursor) ReadUint32() uint32 {
-	defer func() {
-		rc.CurPos += 4
-	}()
+	if !rc.next(4) {
+		return 0
+	}
 
-	return binary.BigEndian.Uint32(rc.Data[rc.CurPos:])
+	return binary.BigEndian.Uint32(rc.Data[rc.CurPos-4:])
 }
 
 // ReadUint16 used to read uint16.
 func (rc *ReadCursor) ReadUint16() uint16 {
-	defer func() {
-		rc.CurPos += 2
-	}()
+	if !rc.next(2) {
+		return 0
+	}
 
-	return binary.BigEndian.Uint16(rc.Data[rc.CurPos:])
+	return binary.BigEndian.Uint16(rc.Data[rc.CurPos-2:])
 }
 
 // ReadUint16Float used to read uint16 with float64 conversion.
 func (rc *ReadCursor) ReadUint16Float() float64 {
-	defer func() {
-		rc.CurPos += 2
-	}()
-
-	return math.Float64frombits(uint64(binary.BigEndian.Uint16(rc.Data[rc.CurPos:])))
+	return math.Float64frombits(uint64(rc.ReadUint16()))
 }
 
 // ReadFloat64 used to read float64.
 func (rc *ReadCursor) ReadFloat64() float64 {
-	defer func() {
-		rc.CurPos += 8
-	}()
+	if !rc.next(8) {
+		return 0
+	}
 
-	return math.Float64frombits(binary.BigEndian.Uint64(rc.Data[rc.CurPos:]))
+	return math.Float64frombits(binary.BigEndian.Uint64(rc.Data[rc.CurPos-8:]))
+}
+
+// ReadString used to read string prefixed by its uint16 length.
+func (rc *ReadCursor) ReadString() string {
+	n := uint(rc.ReadUint16())
+	if !rc.next(n) {
+		return ""
+	}
+
+	return string(rc.Data[rc.CurPos-n : rc.CurPos])
 }
 
 // Advance used to shift cursor.
 func (rc *ReadCursor) Advance(shift uint) {
-	rc.CurPos += shift
+	rc.next(shift)
+}
+
+// next shifts the cursor by n bytes and reports whether they are all within Data.
+func (rc *ReadCursor) next(n uint) bool {
+	pos := rc.CurPos
+	rc.CurPos += n
+	if pos > uint(len(rc.Data)) || n > uint(len(rc.Data))-pos {
+		rc.overflowed = true
+		return false
+	}
+
+	return true
 }
 
 // WriteCursor represents pointer to byte array with ability to write arbitrary data types.
@@ -85,6 +112,15 @@ func (wc *WriteCursor) WriteUint8(v uint8) {
 	wc.Data[wc.CurPos] = v
 }
 
+// WriteUint32 used to write uint32.
+func (wc *WriteCursor) WriteUint32(v uint32) {
+	defer func() {
+		wc.CurPos += 4
+	}()
+
+	binary.BigEndian.PutUint32(wc.Data[wc.CurPos:], v)
+}
+
 // WriteUint16 used to write uint16.
 func (wc *WriteCursor) WriteUint16(v uint16) {
 	defer func() {
@@ -93,3 +129,9 @@ func (wc *WriteCursor) WriteUint16(v uint16) {
 
 	binary.BigEndian.PutUint16(wc.Data[wc.CurPos:], v)
 }
+
+// WriteString used to write string prefixed by its uint16 length.
+func (wc *WriteCursor) WriteString(s string) {
+	wc.WriteUint16(uint16(len(s)))
+	wc.CurPos += uint(copy(wc.Data[wc.CurPos:], s))
+}
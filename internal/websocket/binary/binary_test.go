@@ -0,0 +1,72 @@
+package binary
+
+import (
+	"testing"
+)
+
+func TestReadCursor(t *testing.T) {
+	data := make([]byte, 20)
+	wc := WriteCursor{Data: data}
+	wc.WriteUint8(7)
+	wc.WriteUint16(300)
+	wc.WriteUint32(70000)
+	wc.WriteFloat64(1.5)
+	wc.WriteString("BTC")
+
+	rc := ReadCursor{Data: data}
+	if got := rc.ReadUint8(); got != 7 {
+		t.Errorf("ReadUint8() = %d, want 7", got)
+	}
+	if got := rc.ReadUint16(); got != 300 {
+		t.Errorf("ReadUint16() = %d, want 300", got)
+	}
+	if got := rc.ReadUint32(); got != 70000 {
+		t.Errorf("ReadUint32() = %d, want 70000", got)
+	}
+	if got := rc.ReadFloat64(); got != 1.5 {
+		t.Errorf("ReadFloat64() = %v, want 1.5", got)
+	}
+	if got := rc.ReadString(); got != "BTC" {
+		t.Errorf("ReadString() = %q, want BTC", got)
+	}
+	if rc.Overflowed() {
+		t.Error("Overflowed() = true after reading all the data")
+	}
+	if got := rc.ReadUint16(); got != 0 {
+		t.Errorf("ReadUint16() past the end = %d, want 0", got)
+	}
+	if !rc.Overflowed() {
+		t.Error("Overflowed() = false after reading past the end")
+	}
+}
+
+func TestReadCursorOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		read func(rc *ReadCursor)
+	}{
+		{"uint8", nil, func(rc *ReadCursor) { rc.ReadUint8() }},
+		{"uint16", []byte{1}, func(rc *ReadCursor) { rc.ReadUint16() }},
+		{"uint32", []byte{1, 2, 3}, func(rc *ReadCursor) { rc.ReadUint32() }},
+		{"float64", []byte{1, 2, 3, 4, 5, 6, 7}, func(rc *ReadCursor) { rc.ReadFloat64() }},
+		{"string", []byte{0, 3, 'a', 'b'}, func(rc *ReadCursor) { rc.ReadString() }},
+		{"advance", []byte{1}, func(rc *ReadCursor) { rc.Advance(2) }},
+		{"after advance", []byte{1, 2}, func(rc *ReadCursor) { rc.Advance(3); rc.ReadUint8() }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := ReadCursor{Data: tc.data}
+			tc.read(&rc)
+			if !rc.Overflowed() {
+				t.Error("Overflowed() = false, want true")
+			}
+		})
+	}
+
+	rc := ReadCursor{Data: []byte{0, 2, 'o', 'k'}}
+	if got := rc.ReadString(); got != "ok" || rc.Overflowed() {
+		t.Errorf("ReadString() = %q, overflowed %v, want ok", got, rc.Overflowed())
+	}
+}
@@ -0,0 +1,15 @@
+package binary
+
+import (
+	"math"
+
+	"github.com/cockroachdb/apd"
+)
+
+// Decimal converts PDAX scaled number into exact decimal.
+// PDAX encodes prices and quantities as float64 integers (mantissa) accompanied by the number of decimals,
+// e.g. mantissa 123456 with 2 decimals stands for 1234.56.
+// The mantissa is rounded to the nearest integer to get rid of float representation noise.
+func Decimal(mantissa float64, decimals uint8) *apd.Decimal {
+	return apd.New(int64(math.Round(mantissa)), -int32(decimals))
+}
@@ -0,0 +1,30 @@
+package binary
+
+import (
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		mantissa float64
+		decimals uint8
+		want     string
+	}{
+		{"integer", 2500000, 0, "2500000"},
+		{"price", 123456, 2, "1234.56"},
+		{"quantity", 12345678, 8, "0.12345678"},
+		{"trailing zeros kept", 1500, 3, "1.500"},
+		{"float noise", 123455.99999999999, 2, "1234.56"},
+		{"zero", 0, 4, "0.0000"},
+		{"negative", -42, 1, "-4.2"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Decimal(tc.mantissa, tc.decimals).String(); got != tc.want {
+				t.Errorf("Decimal(%v, %d) = %s, want %s", tc.mantissa, tc.decimals, got, tc.want)
+			}
+		})
+	}
+}
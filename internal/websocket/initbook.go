@@ -0,0 +1,29 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// LoadInitBook reads websocket bootstrap messages from JSON or YAML file.
+// Empty book is returned when the file doesn't exist.
+func LoadInitBook(path string) (InitBook, error) {
+	var book InitBook
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return book, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return book, fmt.Errorf("failed to read binary book: %v", err)
+	}
+
+	if err := v.Unmarshal(&book); err != nil {
+		return book, fmt.Errorf("unmarshaling binary book failed: %v", err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Frame is a websocket message received at the time.
+type Frame struct {
+	Time time.Time `json:"ts"`
+	Data []byte    `json:"data"`
+}
+
+// Recorder writes received websocket messages as JSON lines, so they can be replayed and dissected later.
+type Recorder struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+// NewRecorder instantiates Recorder.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record writes the message received now.
+func (r *Recorder) Record(data []byte) error {
+	return r.RecordFrame(Frame{Time: time.Now().UTC(), Data: data})
+}
+
+// RecordFrame writes the message received at the time of the frame.
+func (r *Recorder) RecordFrame(f Frame) error {
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, err = r.w.Write(append(line, '\n'))
+
+	return err
+}
+
+// ReadFrames calls fn for every frame of the recording till fn returns an error.
+func ReadFrames(r io.Reader, fn func(f Frame) error) error {
+	s := bufio.NewScanner(r)
+	// order book resets and trade history pages are way larger than default 64KB token
+	s.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for line := 1; s.Scan(); line++ {
+		var f Frame
+		if err := json.Unmarshal(s.Bytes(), &f); err != nil {
+			return fmt.Errorf("invalid frame on line %d: %v", line, err)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
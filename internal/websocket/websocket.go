@@ -96,6 +96,14 @@ func (ws *PDAXWebsocket) Bootstrap(authToken string, wsInitBook InitBook) error
 		}
 	}
 
+	for n, m := range wsInitBook.InstrumentMessages {
+		mc, _ := base64.StdEncoding.DecodeString(m)
+		err = ws.conn.WriteMessage(websocket.BinaryMessage, mc)
+		if err != nil {
+			return fmt.Errorf("pdax instrument view subscription %d write error: %v", n+1, err)
+		}
+	}
+
 	go ws.scheduleHeartbeat()
 
 	return nil
@@ -159,4 +167,6 @@ type InitBook struct {
 	M0                  string   `json:"m0"`
 	M1                  string   `json:"m1"`
 	Messages            []string `json:"messages"`
+	// InstrumentMessages subscribe to instrument reference view, currency codes file is used without them.
+	InstrumentMessages []string `json:"instrumentMessages"`
 }
@@ -2,6 +2,8 @@ package monitor
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/cockroachdb/apd"
@@ -9,16 +11,50 @@ import (
 
 // Trade is data from trade panel.
 type Trade struct {
+	// ID is PDAX trade ID, trade history is paged by it.
+	ID           int64
 	CurrencyPair string
 	Price        *apd.Decimal
 	Quantity     *apd.Decimal
 	Timestamp    time.Time
+	// Side is the aggressor side as encoded by PDAX.
+	Side uint8
+}
+
+// Key identifies the trade the way TradeRepository.Upsert matches trades: by PDAX ID, or by currency pair,
+// time, price and quantity when ID is unknown. Decimals are compared by value, e.g. 1.50 matches 1.5.
+func (t Trade) Key() string {
+	if t.ID != 0 {
+		return strconv.FormatInt(t.ID, 10)
+	}
+
+	return t.CurrencyPair + "|" + strconv.FormatInt(t.Timestamp.UnixNano(), 10) + "|" +
+		DecimalKey(t.Price) + "|" + DecimalKey(t.Quantity)
+}
+
+// DecimalKey formats the decimal without trailing zeros, so equal decimals have equal keys.
+func DecimalKey(d *apd.Decimal) string {
+	if d == nil {
+		return ""
+	}
+
+	var reduced apd.Decimal
+	reduced.Reduce(d)
+
+	return reduced.Text('f')
 }
 
 // OrderBook is a set of orders.
+// Implementations must be safe to query concurrently with Apply.
 type OrderBook interface {
-	Apply(update OrderBookUpdate)
+	// Apply applies the update, it fails when the update does not fit the book.
+	Apply(update OrderBookUpdate) error
+	// Orders returns a copy of the orders in the book's index order.
 	Orders() []Order
+	// Instrument returns the instrument of the book's orders, false when the book is empty.
+	Instrument() (int, bool)
+	// L2 returns the book aggregated by price levels.
+	L2() L2Book
 }
 
 // OrderBookUpdate represents single order insert, update or removal.
@@ -30,30 +66,135 @@ type OrderBookUpdate struct {
 	NewIndex int
 }
 
+// Order sides as they are encoded by PDAX.
+const (
+	SideAsk uint8 = 0
+	SideBid uint8 = 1
+)
+
 // Order represents fetched order from PDAX order book panel.
 type Order struct {
-	Price       float64
-	PriceDec    uint8
-	Quantity    float64
-	QuantityDec uint8
-	Timestamp   float64
-	Side        uint8
+	Instrument int
+	Price      *apd.Decimal
+	Quantity   *apd.Decimal
+	Timestamp  float64
+	Side       uint8
 }
 
 // OrderUpdate represents single order update.
 type OrderUpdate struct {
+	// Quantity is the scaled visible quantity, its decimals are the ones of the updated order.
 	Quantity  float64
 	Timestamp float64
 }
 
+// OrderBookSnapshot is a state of an instrument's order book at a point in time.
+type OrderBookSnapshot struct {
+	CurrencyPair string
+	Timestamp    time.Time
+	Levels       []BookLevel
+}
+
+// BookLevel is a single price level of an order book side.
+type BookLevel struct {
+	Side     uint8
+	Price    *apd.Decimal
+	Quantity *apd.Decimal
+	// Orders is the number of orders at the price level.
+	Orders int
+}
+
+// BookMetrics is a liquidity sample of an instrument's order book.
+type BookMetrics struct {
+	CurrencyPair string
+	Timestamp    time.Time
+	SpreadBps    *apd.Decimal
+	BidSize      *apd.Decimal
+	AskSize      *apd.Decimal
+	// Depth is cumulative quantity within the percent of the mid price.
+	Depth []BookDepth
+	// Slippage is estimated market order slippage for the quote currency notional.
+	Slippage []BookSlippage
+}
+
+// BookDepth is cumulative bid and ask quantity within the percent of the mid price.
+type BookDepth struct {
+	Percent float64      `json:"percent"`
+	Bids    *apd.Decimal `json:"bids"`
+	Asks    *apd.Decimal `json:"asks"`
+}
+
+// BookSlippage is estimated slippage in basis points of buy and sell market orders for the notional.
+// Nil slippage means the book is not deep enough to fill the order.
+type BookSlippage struct {
+	Notional *apd.Decimal `json:"notional"`
+	BuyBps   *apd.Decimal `json:"buyBps"`
+	SellBps  *apd.Decimal `json:"sellBps"`
+}
+
+// TradeImport is a summary of trades upserted into the repository.
+type TradeImport struct {
+	Inserted   int `json:"inserted"`
+	Duplicates int `json:"duplicates"`
+}
+
+// TradeQuery selects trades of the currency pair made at From or later and before To.
+type TradeQuery struct {
+	CurrencyPair string
+	From         time.Time
+	To           time.Time
+	// Limit caps number of returned trades when positive, the earliest trades are returned.
+	Limit int
+}
+
+// LimitTrades sorts trades by time keeping the order of trades made at the same time,
+// then it drops the latest ones beyond the limit when it's positive.
+func LimitTrades(trades []Trade, limit int) []Trade {
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp.Before(trades[j].Timestamp)
+	})
+	if limit > 0 && len(trades) > limit {
+		trades = trades[:limit]
+	}
+
+	return trades
+}
+
 // TradeRepository is a storage for fetched trades.
 type TradeRepository interface {
 	// Insert creates a trade's information new record in the repository.
 	Insert(ctx context.Context, a *Trade) error
+	// Upsert inserts the trades which are not stored yet, so importing the same trades again is a no-op.
+	// Trades are matched by ID, or by currency pair, time, price and quantity when ID is unknown (zero).
+	// Nothing is stored on dry run, the summary tells what would have been inserted.
+	Upsert(ctx context.Context, trades []Trade, dryRun bool) (TradeImport, error)
+	// Trades returns trades matching the query ordered by time.
+	Trades(ctx context.Context, q TradeQuery) ([]Trade, error)
 }
 
-// OrderRepository is a storage for order book.
+// OrderRepository is a storage for order book snapshots.
 type OrderRepository interface {
-	// Insert creates a order's information new record in the repository.
-	Insert(ctx context.Context, o []Order) error
+	// Insert creates a new order book snapshot record in the repository.
+	Insert(ctx context.Context, s *OrderBookSnapshot) error
+	// BookAt returns the latest snapshot of the currency pair's book taken at or before the given time.
+	BookAt(ctx context.Context, currencyPair string, at time.Time) (*OrderBookSnapshot, error)
+}
+
+// BookMetricsRepository is a storage for order book liquidity samples.
+type BookMetricsRepository interface {
+	// Insert creates a new liquidity sample record in the repository.
+	Insert(ctx context.Context, m *BookMetrics) error
+}
+
+// Storage is a storage backend of the repositories.
+type Storage interface {
+	TradeRepository() TradeRepository
+	OrderRepository() OrderRepository
+	BookMetricsRepository() BookMetricsRepository
+	FXRateRepository() FXRateRepository
+	FindingRepository() FindingRepository
+	// Ping verifies the storage is reachable.
+	Ping(ctx context.Context) error
+	// Close releases the storage, repositories must not be used afterwards.
+	Close() error
 }